@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/msgio"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/core/tasks/campaigns"
+	"github.com/nyaruka/mailroom/core/tasks/contacts"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// an admin command which is run instead of the server, e.g. `mailroom interrupt --flow 123`. Commands read their config
+// from mailroom.toml and the environment just like the server, and take their own arguments as flags.
+type command struct {
+	description string
+	run         func(context.Context, *runtime.Runtime, *flag.FlagSet, []string) error
+}
+
+var commands = map[string]*command{
+	"interrupt":               {"interrupts the sessions for a flow, a channel or a list of contacts", runInterrupt},
+	"requeue-start":           {"queues a flow start to be started again", runRequeueStart},
+	"requeue-broadcast":       {"queues a broadcast to be sent again", runRequeueBroadcast},
+	"populate-group":          {"queues a smart group to be repopulated from its query", runPopulateGroup},
+	"fire-campaign-event":     {"makes all unfired fires of a campaign event due now", runFireCampaignEvent},
+	"schedule-campaign-event": {"deletes the unfired fires of a campaign event and queues it to be scheduled again", runScheduleCampaignEvent},
+	"clear-courier-queue":     {"clears all queued messages for a channel from courier's queues", runClearCourierQueue},
+	"flush-org-assets":        {"makes every running instance reload the assets of an org when next used", runFlushOrgAssets},
+}
+
+// returns the command named by the first of the passed in arguments, if any, and its arguments. Arguments starting
+// with a dash are config flags for the server.
+func parseCommand(args []string) (string, *command, []string, error) {
+	if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+		return "", nil, nil, nil
+	}
+
+	name := args[1]
+	cmd := commands[name]
+	if cmd == nil {
+		return "", nil, nil, errors.Errorf("Unknown command: %s", name)
+	}
+	return name, cmd, args[2:], nil
+}
+
+// runs the passed in admin command, exiting with a non-zero status if it fails
+func runCommand(config *runtime.Config, name string, cmd *command, args []string) {
+	log := logrus.WithField("comp", "admin").WithField("command", name)
+
+	rt, err := mailroom.NewToolRuntime(config)
+	if err != nil {
+		log.WithError(err).Fatal("unable to create runtime")
+	}
+
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage of mailroom %s, which %s:\n", name, cmd.description)
+		flags.PrintDefaults()
+	}
+
+	if err := cmd.run(context.Background(), rt, flags, args); err != nil {
+		log.WithError(err).Fatal("command failed")
+	}
+}
+
+// prints the available admin commands
+func printCommands() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "\nCommands (run as mailroom <command> --help for options):\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-25s %s\n", name, commands[name].description)
+	}
+}
+
+func runInterrupt(ctx context.Context, rt *runtime.Runtime, flags *flag.FlagSet, args []string) error {
+	flowID := flags.Int("flow", 0, "the id of the flow to interrupt sessions for")
+	channelID := flags.Int("channel", 0, "the id of the channel to interrupt sessions for")
+	contactList := flags.String("contacts", "", "comma separated ids of the contacts to interrupt sessions for")
+	flags.Parse(args)
+
+	log := logrus.WithField("comp", "admin")
+
+	switch {
+	case *flowID != 0:
+		if err := models.InterruptSessionsForFlows(ctx, rt.DB, []models.FlowID{models.FlowID(*flowID)}); err != nil {
+			return err
+		}
+		log.WithField("flow_id", *flowID).Info("interrupted sessions for flow")
+
+	case *channelID != 0:
+		if err := models.InterruptSessionsForChannel(ctx, rt.DB, models.ChannelID(*channelID)); err != nil {
+			return err
+		}
+		log.WithField("channel_id", *channelID).Info("interrupted sessions for channel")
+
+	case *contactList != "":
+		contactIDs, err := parseContactIDs(*contactList)
+		if err != nil {
+			return err
+		}
+		count, err := models.InterruptSessionsForContacts(ctx, rt.DB, contactIDs)
+		if err != nil {
+			return err
+		}
+		log.WithField("contacts", len(contactIDs)).WithField("sessions", count).Info("interrupted sessions for contacts")
+
+	default:
+		return errors.New("one of --flow, --channel or --contacts is required")
+	}
+
+	return nil
+}
+
+func runRequeueStart(ctx context.Context, rt *runtime.Runtime, flags *flag.FlagSet, args []string) error {
+	startID := flags.Int("start", 0, "the id of the flow start to queue")
+	idempotencyKey := flags.String("idempotency-key", "", "optional key which makes repeats of this command within a day queue nothing")
+	flags.Parse(args)
+
+	if *startID == 0 {
+		return errors.New("--start is required")
+	}
+
+	start, err := models.GetFlowStartByID(ctx, rt.DB, models.StartID(*startID))
+	if err != nil {
+		return err
+	}
+
+	// queue it the same way as when it's first queued
+	taskQ := queue.HandlerQueue
+	priority := queue.DefaultPriority
+	if len(start.GroupIDs()) > 0 || start.Query() != "" {
+		taskQ = queue.BatchQueue
+		priority = queue.HighPriority
+	}
+
+	taskID, opts := queue.IdempotencyOptions(queue.StartFlow, int(start.OrgID()), *idempotencyKey)
+
+	if err := rt.Queue.AddTask(taskQ, queue.StartFlow, int(start.OrgID()), start, priority, opts...); err != nil {
+		return errors.Wrapf(err, "error queuing flow start")
+	}
+
+	logrus.WithField("comp", "admin").WithField("start_id", start.ID()).WithField("org_id", start.OrgID()).WithField("queue", taskQ).WithField("task_id", taskID).Info("queued flow start")
+	return nil
+}
+
+func runRequeueBroadcast(ctx context.Context, rt *runtime.Runtime, flags *flag.FlagSet, args []string) error {
+	broadcastID := flags.Int("broadcast", 0, "the id of the broadcast to queue")
+	idempotencyKey := flags.String("idempotency-key", "", "optional key which makes repeats of this command within a day queue nothing")
+	flags.Parse(args)
+
+	if *broadcastID == 0 {
+		return errors.New("--broadcast is required")
+	}
+
+	bcast, err := models.GetBroadcastByID(ctx, rt.DB, models.BroadcastID(*broadcastID))
+	if err != nil {
+		return err
+	}
+
+	// queue it the same way as when it's first queued
+	taskQ := queue.HandlerQueue
+	priority := queue.DefaultPriority
+	if len(bcast.GroupIDs()) > 0 {
+		taskQ = queue.BatchQueue
+		priority = queue.HighPriority
+	}
+
+	taskID, opts := queue.IdempotencyOptions(queue.SendBroadcast, int(bcast.OrgID()), *idempotencyKey)
+
+	if err := rt.Queue.AddTask(taskQ, queue.SendBroadcast, int(bcast.OrgID()), bcast, priority, opts...); err != nil {
+		return errors.Wrapf(err, "error queuing broadcast")
+	}
+
+	logrus.WithField("comp", "admin").WithField("broadcast_id", bcast.ID()).WithField("org_id", bcast.OrgID()).WithField("queue", taskQ).WithField("task_id", taskID).Info("queued broadcast")
+	return nil
+}
+
+func runPopulateGroup(ctx context.Context, rt *runtime.Runtime, flags *flag.FlagSet, args []string) error {
+	orgID := flags.Int("org", 0, "the id of the org which owns the group")
+	groupID := flags.Int("group", 0, "the id of the smart group to repopulate")
+	flags.Parse(args)
+
+	if *orgID == 0 || *groupID == 0 {
+		return errors.New("--org and --group are required")
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, models.OrgID(*orgID))
+	if err != nil {
+		return errors.Wrapf(err, "error loading org assets")
+	}
+
+	group := oa.GroupByID(models.GroupID(*groupID))
+	if group == nil {
+		return errors.Errorf("no group with id %d in org %d", *groupID, *orgID)
+	}
+	if group.Query() == "" {
+		return errors.Errorf("group %d is not a smart group", *groupID)
+	}
+
+	task := &contacts.PopulateDynamicGroupTask{GroupID: group.ID(), Query: group.Query()}
+
+	if err := rt.Queue.AddTask(queue.BatchQueue, contacts.TypePopulateDynamicGroup, *orgID, task, queue.HighPriority); err != nil {
+		return errors.Wrapf(err, "error queuing group population")
+	}
+
+	logrus.WithField("comp", "admin").WithField("group_id", group.ID()).WithField("query", group.Query()).Info("queued group population")
+	return nil
+}
+
+func runFireCampaignEvent(ctx context.Context, rt *runtime.Runtime, flags *flag.FlagSet, args []string) error {
+	eventID := flags.Int("event", 0, "the id of the campaign event to fire")
+	flags.Parse(args)
+
+	if *eventID == 0 {
+		return errors.New("--event is required")
+	}
+
+	count, err := models.MarkEventFiresDue(ctx, rt.DB, models.CampaignEventID(*eventID))
+	if err != nil {
+		return err
+	}
+
+	logrus.WithField("comp", "admin").WithField("event_id", *eventID).WithField("fires", count).Info("fires made due, will be queued by the next run of the campaign event cron")
+	return nil
+}
+
+func runScheduleCampaignEvent(ctx context.Context, rt *runtime.Runtime, flags *flag.FlagSet, args []string) error {
+	orgID := flags.Int("org", 0, "the id of the org which owns the campaign")
+	eventID := flags.Int("event", 0, "the id of the campaign event to reschedule")
+	flags.Parse(args)
+
+	if *orgID == 0 || *eventID == 0 {
+		return errors.New("--org and --event are required")
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, models.OrgID(*orgID))
+	if err != nil {
+		return errors.Wrapf(err, "error loading org assets")
+	}
+
+	event := oa.CampaignEventByID(models.CampaignEventID(*eventID))
+	if event == nil {
+		return errors.Errorf("no active campaign event with id %d in org %d", *eventID, *orgID)
+	}
+
+	// existing fires would block new ones for the same contacts so they have to go first
+	deleted, err := models.DeleteUnfiredEventFiresForEvent(ctx, rt.DB, event.ID())
+	if err != nil {
+		return err
+	}
+
+	task := &campaigns.ScheduleCampaignEventTask{CampaignEventID: event.ID()}
+
+	if err := rt.Queue.AddTask(queue.BatchQueue, campaigns.TypeScheduleCampaignEvent, *orgID, task, queue.HighPriority); err != nil {
+		return errors.Wrapf(err, "error queuing campaign event scheduling")
+	}
+
+	logrus.WithField("comp", "admin").WithField("event_id", event.ID()).WithField("deleted_fires", deleted).Info("queued campaign event scheduling")
+	return nil
+}
+
+func runClearCourierQueue(ctx context.Context, rt *runtime.Runtime, flags *flag.FlagSet, args []string) error {
+	channelID := flags.Int("channel", 0, "the id of the channel whose queued messages should be cleared")
+	flags.Parse(args)
+
+	if *channelID == 0 {
+		return errors.New("--channel is required")
+	}
+
+	channels, err := models.GetChannelsByID(ctx, rt.DB, []models.ChannelID{models.ChannelID(*channelID)})
+	if err != nil {
+		return err
+	}
+	if len(channels) == 0 {
+		return errors.Errorf("no channel with id %d", *channelID)
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	if err := msgio.ClearCourierQueues(rc, channels[0]); err != nil {
+		return errors.Wrapf(err, "error clearing courier queues")
+	}
+
+	logrus.WithField("comp", "admin").WithField("channel_uuid", channels[0].UUID()).Info("cleared courier queues")
+	return nil
+}
+
+func runFlushOrgAssets(ctx context.Context, rt *runtime.Runtime, flags *flag.FlagSet, args []string) error {
+	orgID := flags.Int("org", 0, "the id of the org whose assets should be flushed")
+	flags.Parse(args)
+
+	if *orgID == 0 {
+		return errors.New("--org is required")
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	received, err := models.PublishOrgAssetsFlush(rc, models.OrgID(*orgID))
+	if err != nil {
+		return err
+	}
+
+	logrus.WithField("comp", "admin").WithField("org_id", *orgID).WithField("instances", received).Info("published flush of org assets")
+	return nil
+}
+
+// parses a comma separated list of contact ids
+func parseContactIDs(s string) ([]models.ContactID, error) {
+	parts := strings.Split(s, ",")
+	ids := make([]models.ContactID, 0, len(parts))
+	for _, p := range parts {
+		id, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil {
+			return nil, errors.Errorf("invalid contact id: '%s'", p)
+		}
+		ids = append(ids, models.ContactID(id))
+	}
+	return ids, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"testing"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCommand(t *testing.T) {
+	// no command means running the server
+	name, cmd, args, err := parseCommand([]string{"mailroom"})
+	assert.NoError(t, err)
+	assert.Equal(t, "", name)
+	assert.Nil(t, cmd)
+
+	// as do config flags
+	name, cmd, args, err = parseCommand([]string{"mailroom", "-port", "8091"})
+	assert.NoError(t, err)
+	assert.Equal(t, "", name)
+	assert.Nil(t, cmd)
+	assert.Nil(t, args)
+
+	name, cmd, args, err = parseCommand([]string{"mailroom", "interrupt", "--flow", "123"})
+	assert.NoError(t, err)
+	assert.Equal(t, "interrupt", name)
+	assert.Equal(t, commands["interrupt"], cmd)
+	assert.Equal(t, []string{"--flow", "123"}, args)
+
+	_, cmd, _, err = parseCommand([]string{"mailroom", "explode"})
+	assert.EqualError(t, err, "Unknown command: explode")
+	assert.Nil(t, cmd)
+}
+
+func TestParseContactIDs(t *testing.T) {
+	ids, err := parseContactIDs("123")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ContactID{123}, ids)
+
+	ids, err = parseContactIDs("123, 234,345")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ContactID{123, 234, 345}, ids)
+
+	_, err = parseContactIDs("123,abc")
+	assert.EqualError(t, err, "invalid contact id: 'abc'")
+
+	_, err = parseContactIDs("123,")
+	assert.EqualError(t, err, "invalid contact id: ''")
+}
+
+func TestRequeueStart(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	startID := testdata.InsertFlowStart(db, testdata.Org1, testdata.Favorites, []*testdata.Contact{testdata.Cathy, testdata.Bob})
+
+	run := func(args ...string) error {
+		return runRequeueStart(ctx, rt, flag.NewFlagSet("requeue-start", flag.ContinueOnError), args)
+	}
+
+	assert.EqualError(t, run(), "--start is required")
+
+	// repeats with the same idempotency key don't queue the start again
+	require.NoError(t, run("--start", fmt.Sprint(startID), "--idempotency-key", "abc"))
+	require.NoError(t, run("--start", fmt.Sprint(startID), "--idempotency-key", "abc"))
+
+	size, err := rt.Queue.OrgSize(queue.HandlerQueue, int(testdata.Org1.ID))
+	require.NoError(t, err)
+	assert.Equal(t, 1, size)
+
+	// but repeats without one do
+	require.NoError(t, run("--start", fmt.Sprint(startID)))
+
+	size, err = rt.Queue.OrgSize(queue.HandlerQueue, int(testdata.Org1.ID))
+	require.NoError(t, err)
+	assert.Equal(t, 2, size)
+
+	task, err := rt.Queue.PopNextTask(queue.HandlerQueue)
+	require.NoError(t, err)
+	assert.Equal(t, queue.StartFlow, task.Type)
+}
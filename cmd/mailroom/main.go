@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"os/signal"
 	goruntime "runtime"
@@ -32,7 +33,9 @@ import (
 	_ "github.com/nyaruka/mailroom/services/tickets/mailgun"
 	_ "github.com/nyaruka/mailroom/services/tickets/rocketchat"
 	_ "github.com/nyaruka/mailroom/services/tickets/zendesk"
+	_ "github.com/nyaruka/mailroom/web/broadcast"
 	_ "github.com/nyaruka/mailroom/web/contact"
+	_ "github.com/nyaruka/mailroom/web/cron"
 	_ "github.com/nyaruka/mailroom/web/docs"
 	_ "github.com/nyaruka/mailroom/web/expression"
 	_ "github.com/nyaruka/mailroom/web/flow"
@@ -40,6 +43,7 @@ import (
 	_ "github.com/nyaruka/mailroom/web/msg"
 	_ "github.com/nyaruka/mailroom/web/org"
 	_ "github.com/nyaruka/mailroom/web/po"
+	_ "github.com/nyaruka/mailroom/web/queue"
 	_ "github.com/nyaruka/mailroom/web/simulation"
 	_ "github.com/nyaruka/mailroom/web/surveyor"
 	_ "github.com/nyaruka/mailroom/web/ticket"
@@ -55,14 +59,20 @@ var (
 )
 
 func main() {
+	// if we've been asked to run an admin command, its arguments aren't config flags
+	cmdName, cmd, cmdArgs, err := parseCommand(os.Args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		printCommands()
+		os.Exit(1)
+	}
+	if cmd != nil {
+		os.Args = os.Args[:1]
+	}
+
 	config := runtime.NewDefaultConfig()
 	config.Version = version
-	loader := ezconf.NewLoader(
-		config,
-		"mailroom", "Mailroom - flow event handler for RapidPro",
-		[]string{"mailroom.toml"},
-	)
-	loader.MustLoad()
+	newLoader(config).MustLoad()
 
 	// ensure config is valid
 	if err := config.Validate(); err != nil {
@@ -77,6 +87,12 @@ func main() {
 	logrus.SetLevel(level)
 	logrus.SetOutput(os.Stdout)
 	logrus.SetFormatter(&logrus.TextFormatter{})
+
+	if cmd != nil {
+		runCommand(config, cmdName, cmd, cmdArgs)
+		return
+	}
+
 	logrus.WithField("version", version).WithField("released", date).Info("starting mailroom")
 
 	// if we have a DSN entry, try to initialize it
@@ -108,10 +124,34 @@ func main() {
 	handleSignals(mr)
 }
 
-// handleSignals takes care of trapping quit, interrupt or terminate signals and doing the right thing
+// newLoader creates a new loader of config from our file, environment variables and command line arguments
+func newLoader(config *runtime.Config) *ezconf.EZLoader {
+	return ezconf.NewLoader(
+		config,
+		"mailroom", "Mailroom - flow event handler for RapidPro",
+		[]string{"mailroom.toml"},
+	)
+}
+
+// reloadConfig loads our config again and applies any changes to the running mailroom
+func reloadConfig(mr *mailroom.Mailroom) {
+	config := runtime.NewDefaultConfig()
+	config.Version = version
+
+	if err := newLoader(config).Load(); err != nil {
+		logrus.WithField("comp", "main").WithError(err).Error("error loading config, not reloading")
+		return
+	}
+
+	if err := mr.Reload(config); err != nil {
+		logrus.WithField("comp", "main").WithError(err).Error("error reloading config")
+	}
+}
+
+// handleSignals takes care of trapping quit, interrupt, terminate, drain or reload signals and doing the right thing
 func handleSignals(mr *mailroom.Mailroom) {
 	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGHUP)
 
 	for {
 		sig := <-sigs
@@ -121,6 +161,15 @@ func handleSignals(mr *mailroom.Mailroom) {
 			stacklen := goruntime.Stack(buf, true)
 			logrus.WithField("comp", "main").WithField("signal", sig).Info("received quit signal, dumping stack")
 			logrus.Printf("\n%s", buf[:stacklen])
+		case syscall.SIGUSR1:
+			logrus.WithField("comp", "main").WithField("signal", sig).Info("received drain signal, draining")
+			mr.Drain()
+		case syscall.SIGUSR2:
+			logrus.WithField("comp", "main").WithField("signal", sig).Info("received resume signal, resuming")
+			mr.Resume()
+		case syscall.SIGHUP:
+			logrus.WithField("comp", "main").WithField("signal", sig).Info("received reload signal, reloading config")
+			reloadConfig(mr)
 		case syscall.SIGINT, syscall.SIGTERM:
 			logrus.WithField("comp", "main").WithField("signal", sig).Info("received exit signal, exiting")
 			mr.Stop()
@@ -14,7 +14,8 @@ import (
 )
 
 var eng, simulator flows.Engine
-var engInit, simulatorInit sync.Once
+var engConfig, simulatorConfig *runtime.Config
+var engMutex sync.Mutex
 
 var emailFactory func(*runtime.Config) engine.EmailServiceFactory
 var classificationFactory func(*runtime.Config) engine.ClassificationServiceFactory
@@ -45,18 +46,32 @@ func RegisterAirtimeServiceFactory(f func(*runtime.Config) engine.AirtimeService
 	airtimeFactory = f
 }
 
+// Reset discards the engines and HTTP clients built from config, so that they are rebuilt from the config passed
+// to their next use. They are also rebuilt whenever they're used with a different config, e.g. after a config reload.
+func Reset() {
+	engMutex.Lock()
+	eng, simulator = nil, nil
+	engConfig, simulatorConfig = nil, nil
+	engMutex.Unlock()
+
+	resetHTTP()
+}
+
 // Engine returns the global engine instance for use with real sessions
 func Engine(c *runtime.Config) flows.Engine {
-	engInit.Do(func() {
+	engMutex.Lock()
+	defer engMutex.Unlock()
+
+	if eng == nil || engConfig != c {
 		webhookHeaders := map[string]string{
 			"User-Agent":      "RapidProMailroom/" + c.Version,
 			"X-Mailroom-Mode": "normal",
 		}
 
-		httpClient, httpRetries, httpAccess := HTTP(c)
+		_, httpRetries, httpAccess := HTTP(c)
 
 		eng = engine.NewBuilder().
-			WithWebhookServiceFactory(webhooks.NewServiceFactory(httpClient, httpRetries, httpAccess, webhookHeaders, c.WebhooksMaxBodyBytes)).
+			WithWebhookServiceFactory(webhooks.NewServiceFactory(webhookHTTP(c), httpRetries, httpAccess, webhookHeaders, c.WebhooksMaxBodyBytes)).
 			WithClassificationServiceFactory(classificationFactory(c)).
 			WithEmailServiceFactory(emailFactory(c)).
 			WithTicketServiceFactory(ticketFactory(c)).
@@ -64,23 +79,27 @@ func Engine(c *runtime.Config) flows.Engine {
 			WithMaxStepsPerSprint(c.MaxStepsPerSprint).
 			WithMaxResumesPerSession(c.MaxResumesPerSession).
 			Build()
-	})
+		engConfig = c
+	}
 
 	return eng
 }
 
 // Simulator returns the global engine instance for use with simulated sessions
 func Simulator(c *runtime.Config) flows.Engine {
-	simulatorInit.Do(func() {
+	engMutex.Lock()
+	defer engMutex.Unlock()
+
+	if simulator == nil || simulatorConfig != c {
 		webhookHeaders := map[string]string{
 			"User-Agent":      "RapidProMailroom/" + c.Version,
 			"X-Mailroom-Mode": "simulation",
 		}
 
-		httpClient, _, httpAccess := HTTP(c) // don't do retries in simulator
+		_, _, httpAccess := HTTP(c) // don't do retries in simulator
 
 		simulator = engine.NewBuilder().
-			WithWebhookServiceFactory(webhooks.NewServiceFactory(httpClient, nil, httpAccess, webhookHeaders, c.WebhooksMaxBodyBytes)).
+			WithWebhookServiceFactory(webhooks.NewServiceFactory(webhookHTTP(c), nil, httpAccess, webhookHeaders, c.WebhooksMaxBodyBytes)).
 			WithClassificationServiceFactory(classificationFactory(c)). // simulated sessions do real classification
 			WithEmailServiceFactory(simulatorEmailServiceFactory).      // but faked emails
 			WithTicketServiceFactory(simulatorTicketServiceFactory).    // and faked tickets
@@ -88,7 +107,8 @@ func Simulator(c *runtime.Config) flows.Engine {
 			WithMaxStepsPerSprint(c.MaxStepsPerSprint).
 			WithMaxResumesPerSession(c.MaxResumesPerSession).
 			Build()
-	})
+		simulatorConfig = c
+	}
 
 	return simulator
 }
@@ -3,6 +3,7 @@ package goflow_test
 import (
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/nyaruka/gocommon/httpx"
 	"github.com/nyaruka/gocommon/urns"
@@ -20,7 +21,7 @@ import (
 func TestEngineWebhook(t *testing.T) {
 	_, rt, _, _ := testsuite.Get()
 
-	svc, err := goflow.Engine(rt.Config).Services().Webhook(nil)
+	svc, err := goflow.Engine(rt.Config()).Services().Webhook(nil)
 	assert.NoError(t, err)
 
 	defer httpx.SetRequestor(httpx.DefaultRequestor)
@@ -42,7 +43,7 @@ func TestEngineWebhook(t *testing.T) {
 func TestSimulatorAirtime(t *testing.T) {
 	_, rt, _, _ := testsuite.Get()
 
-	svc, err := goflow.Simulator(rt.Config).Services().Airtime(nil)
+	svc, err := goflow.Simulator(rt.Config()).Services().Airtime(nil)
 	assert.NoError(t, err)
 
 	amounts := map[string]decimal.Decimal{"USD": decimal.RequireFromString(`1.50`)}
@@ -65,7 +66,7 @@ func TestSimulatorTicket(t *testing.T) {
 	ticketer, err := models.LookupTicketerByUUID(ctx, db, testdata.Mailgun.UUID)
 	require.NoError(t, err)
 
-	svc, err := goflow.Simulator(rt.Config).Services().Ticket(flows.NewTicketer(ticketer))
+	svc, err := goflow.Simulator(rt.Config()).Services().Ticket(flows.NewTicketer(ticketer))
 	assert.NoError(t, err)
 
 	oa, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
@@ -80,7 +81,7 @@ func TestSimulatorTicket(t *testing.T) {
 func TestSimulatorWebhook(t *testing.T) {
 	_, rt, _, _ := testsuite.Get()
 
-	svc, err := goflow.Simulator(rt.Config).Services().Webhook(nil)
+	svc, err := goflow.Simulator(rt.Config()).Services().Webhook(nil)
 	assert.NoError(t, err)
 
 	defer httpx.SetRequestor(httpx.DefaultRequestor)
@@ -98,3 +99,33 @@ func TestSimulatorWebhook(t *testing.T) {
 	assert.Equal(t, "HTTP/1.0 200 OK\r\nContent-Length: 2\r\n\r\n", string(call.ResponseTrace))
 	assert.Equal(t, "OK", string(call.ResponseBody))
 }
+
+func TestReset(t *testing.T) {
+	_, rt, _, _ := testsuite.Get()
+
+	defer goflow.Reset()
+
+	eng := goflow.Engine(rt.Config())
+	client, _, _ := goflow.HTTP(rt.Config())
+
+	// engine and client are only built once
+	assert.Same(t, eng, goflow.Engine(rt.Config()))
+
+	c2, _, _ := goflow.HTTP(rt.Config())
+	assert.Same(t, client, c2)
+
+	// but are rebuilt when used with a different config, e.g. after a reload
+	cfg := *rt.Config()
+	cfg.WebhooksTimeout = 1234
+
+	eng2 := goflow.Engine(&cfg)
+	assert.NotSame(t, eng, eng2)
+
+	client, _, _ = goflow.HTTP(&cfg)
+	assert.Equal(t, 1234*time.Millisecond, client.Timeout)
+
+	// and after a reset
+	goflow.Reset()
+
+	assert.NotSame(t, eng2, goflow.Engine(&cfg))
+}
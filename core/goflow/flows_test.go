@@ -23,12 +23,12 @@ func TestReadFlow(t *testing.T) {
 	_, rt, _, _ := testsuite.Get()
 
 	// try to read empty definition
-	flow, err := goflow.ReadFlow(rt.Config, []byte(`{}`))
+	flow, err := goflow.ReadFlow(rt.Config(), []byte(`{}`))
 	assert.Nil(t, flow)
 	assert.EqualError(t, err, "unable to read flow header: field 'uuid' is required, field 'spec_version' is required")
 
 	// read legacy definition
-	flow, err = goflow.ReadFlow(rt.Config, []byte(`{"flow_type": "M", "base_language": "eng", "action_sets": [], "metadata": {"uuid": "502c3ee4-3249-4dee-8e71-c62070667d52", "name": "Legacy"}}`))
+	flow, err = goflow.ReadFlow(rt.Config(), []byte(`{"flow_type": "M", "base_language": "eng", "action_sets": [], "metadata": {"uuid": "502c3ee4-3249-4dee-8e71-c62070667d52", "name": "Legacy"}}`))
 	assert.Nil(t, err)
 	assert.Equal(t, assets.FlowUUID("502c3ee4-3249-4dee-8e71-c62070667d52"), flow.UUID())
 	assert.Equal(t, "Legacy", flow.Name())
@@ -36,7 +36,7 @@ func TestReadFlow(t *testing.T) {
 	assert.Equal(t, flows.FlowTypeMessaging, flow.Type())
 
 	// read new definition
-	flow, err = goflow.ReadFlow(rt.Config, []byte(`{"uuid": "502c3ee4-3249-4dee-8e71-c62070667d52", "name": "New", "spec_version": "13.0.0", "type": "messaging", "language": "eng", "nodes": []}`))
+	flow, err = goflow.ReadFlow(rt.Config(), []byte(`{"uuid": "502c3ee4-3249-4dee-8e71-c62070667d52", "name": "New", "spec_version": "13.0.0", "type": "messaging", "language": "eng", "nodes": []}`))
 	assert.Nil(t, err)
 	assert.Equal(t, assets.FlowUUID("502c3ee4-3249-4dee-8e71-c62070667d52"), flow.UUID())
 	assert.Equal(t, "New", flow.Name())
@@ -56,7 +56,7 @@ func TestMigrateDefinition(t *testing.T) {
 	_, rt, _, _ := testsuite.Get()
 
 	// 13.0 > 13.1
-	migrated, err := goflow.MigrateDefinition(rt.Config, []byte(`{"uuid": "502c3ee4-3249-4dee-8e71-c62070667d52", "name": "New", "spec_version": "13.0.0", "type": "messaging", "language": "eng", "nodes": []}`), semver.MustParse("13.1.0"))
+	migrated, err := goflow.MigrateDefinition(rt.Config(), []byte(`{"uuid": "502c3ee4-3249-4dee-8e71-c62070667d52", "name": "New", "spec_version": "13.0.0", "type": "messaging", "language": "eng", "nodes": []}`), semver.MustParse("13.1.0"))
 	assert.NoError(t, err)
 	test.AssertEqualJSON(t, []byte(`{"uuid": "502c3ee4-3249-4dee-8e71-c62070667d52", "name": "New", "spec_version": "13.1.0", "type": "messaging", "language": "eng", "nodes": []}`), migrated)
 }
@@ -8,17 +8,40 @@ import (
 
 	"github.com/nyaruka/gocommon/httpx"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/tracing"
 )
 
-var httpInit sync.Once
+var httpMutex sync.Mutex
 
 var httpClient *http.Client
+var httpWebhookClient *http.Client
 var httpRetries *httpx.RetryConfig
 var httpAccess *httpx.AccessConfig
+var httpConfig *runtime.Config
 
-// HTTP returns the configuration objects for HTTP calls from the engine and its services
+// HTTP returns the configuration objects for HTTP calls from the engine and its services, which are rebuilt if the
+// passed in config isn't the one they were last built from. Calls made with the client are traced.
 func HTTP(cfg *runtime.Config) (*http.Client, *httpx.RetryConfig, *httpx.AccessConfig) {
-	httpInit.Do(func() {
+	httpMutex.Lock()
+	defer httpMutex.Unlock()
+
+	buildHTTP(cfg)
+	return httpClient, httpRetries, httpAccess
+}
+
+// returns the client for webhook calls, which isn't traced as we record webhook spans from their events so that they
+// can be parented to the sprint which made them
+func webhookHTTP(cfg *runtime.Config) *http.Client {
+	httpMutex.Lock()
+	defer httpMutex.Unlock()
+
+	buildHTTP(cfg)
+	return httpWebhookClient
+}
+
+// builds our HTTP configuration objects if necessary. Callers must hold the mutex.
+func buildHTTP(cfg *runtime.Config) {
+	if httpClient == nil || httpConfig != cfg {
 		// customize the default golang transport
 		t := http.DefaultTransport.(*http.Transport).Clone()
 		t.MaxIdleConns = 32
@@ -29,6 +52,10 @@ func HTTP(cfg *runtime.Config) (*http.Client, *httpx.RetryConfig, *httpx.AccessC
 		}
 
 		httpClient = &http.Client{
+			Transport: tracing.NewTransport(t),
+			Timeout:   time.Duration(cfg.WebhooksTimeout) * time.Millisecond,
+		}
+		httpWebhookClient = &http.Client{
 			Transport: t,
 			Timeout:   time.Duration(cfg.WebhooksTimeout) * time.Millisecond,
 		}
@@ -41,6 +68,12 @@ func HTTP(cfg *runtime.Config) (*http.Client, *httpx.RetryConfig, *httpx.AccessC
 
 		disallowedIPs, disallowedNets, _ := cfg.ParseDisallowedNetworks()
 		httpAccess = httpx.NewAccessConfig(10*time.Second, disallowedIPs, disallowedNets)
-	})
-	return httpClient, httpRetries, httpAccess
+		httpConfig = cfg
+	}
+}
+
+func resetHTTP() {
+	httpMutex.Lock()
+	httpClient, httpWebhookClient, httpRetries, httpAccess, httpConfig = nil, nil, nil, nil, nil
+	httpMutex.Unlock()
 }
@@ -161,7 +161,7 @@ func RunTestCases(t *testing.T, ctx context.Context, rt *runtime.Runtime, tcs []
 	oa, err := models.GetOrgAssets(ctx, rt, models.OrgID(1))
 	assert.NoError(t, err)
 
-	svcs := goflow.Engine(rt.Config).Services()
+	svcs := goflow.Engine(rt.Config()).Services()
 
 	// reuse id from one of our real flows
 	flowUUID := testdata.Favorites.UUID
@@ -23,8 +23,8 @@ func TestMsgCreated(t *testing.T) {
 
 	defer testsuite.Reset(testsuite.ResetAll)
 
-	rt.Config.AttachmentDomain = "foo.bar.com"
-	defer func() { rt.Config.AttachmentDomain = "" }()
+	rt.Config().AttachmentDomain = "foo.bar.com"
+	defer func() { rt.Config().AttachmentDomain = "" }()
 
 	// add a URN for cathy so we can test all urn sends
 	testdata.InsertContactURN(db, testdata.Org1, testdata.Cathy, urns.URN("tel:+12065551212"), 10)
@@ -10,9 +10,15 @@ import (
 	"github.com/nyaruka/mailroom/core/hooks"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/metrics"
+	"github.com/nyaruka/mailroom/utils/tracing"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+var webhookDuration = metrics.NewHistogram("mailroom_webhook_duration_seconds", "the response times of webhook calls by status", metrics.DefaultBuckets, "status")
+
 func init() {
 	models.RegisterEventHandler(events.TypeWebhookCalled, handleWebhookCalled)
 }
@@ -30,6 +36,21 @@ func handleWebhookCalled(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx,
 		"extraction":   event.Extraction,
 	}).Debug("webhook called")
 
+	elapsed := time.Millisecond * time.Duration(event.ElapsedMS)
+	webhookDuration.Observe(elapsed.Seconds(), string(event.Status))
+
+	// the engine makes webhook calls without a context so we record their spans here, and we don't propagate our trace
+	// context to them as that would leak it into third party request logs
+	var callErr error
+	if event.Status != flows.CallStatusSuccess {
+		callErr = errors.Errorf("webhook call %s", event.Status)
+	}
+	tracing.Record(ctx, "webhook", event.CreatedOn().Add(-elapsed), event.CreatedOn(), callErr,
+		attribute.String("http.url", event.URL),
+		attribute.Int("http.status_code", event.StatusCode),
+		attribute.String("mailroom.contact_uuid", string(scene.ContactUUID())),
+	)
+
 	// if this was a resthook and the status was 410, that means we should remove it
 	if event.Status == flows.CallStatusSubscriberGone {
 		unsub := &models.ResthookUnsubscribe{
@@ -51,7 +72,7 @@ func handleWebhookCalled(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx,
 			flow.(*models.Flow).ID(),
 			event.URL, event.StatusCode, event.Request, event.Response,
 			event.Status != flows.CallStatusSuccess,
-			time.Millisecond*time.Duration(event.ElapsedMS),
+			elapsed,
 			event.Retries,
 			event.CreatedOn(),
 		)
@@ -39,6 +39,10 @@ func (h *monitorWebhooks) Apply(ctx context.Context, rt *runtime.Runtime, tx *sq
 			return errors.Wrap(err, "error recording events for webhook node")
 		}
 
+		if err := recordWebhookResults(rt, oa.OrgID(), nodeUUID, events); err != nil {
+			return err
+		}
+
 		healthy, err := node.Healthy(rt)
 		if err != nil {
 			return errors.Wrap(err, "error getting health of webhook node")
@@ -59,3 +63,10 @@ func (h *monitorWebhooks) Apply(ctx context.Context, rt *runtime.Runtime, tx *sq
 
 	return nil
 }
+
+func recordWebhookResults(rt *runtime.Runtime, orgID models.OrgID, nodeUUID flows.NodeUUID, calls []*events.WebhookCalledEvent) error {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	return models.RecordWebhookResults(rc, orgID, nodeUUID, calls)
+}
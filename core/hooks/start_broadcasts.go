@@ -19,9 +19,6 @@ type startBroadcastsHook struct{}
 
 // Apply queues up our broadcasts for sending
 func (h *startBroadcastsHook) Apply(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *models.OrgAssets, scenes map[*models.Scene][]interface{}) error {
-	rc := rt.RP.Get()
-	defer rc.Close()
-
 	// for each of our scene
 	for _, es := range scenes {
 		for _, e := range es {
@@ -41,7 +38,7 @@ func (h *startBroadcastsHook) Apply(ctx context.Context, rt *runtime.Runtime, tx
 				priority = queue.HighPriority
 			}
 
-			err = queue.AddTask(rc, taskQ, queue.SendBroadcast, int(oa.OrgID()), bcast, priority)
+			err = rt.Queue.AddTask(taskQ, queue.SendBroadcast, int(oa.OrgID()), bcast, priority)
 			if err != nil {
 				return errors.Wrapf(err, "error queuing broadcast")
 			}
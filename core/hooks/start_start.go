@@ -18,9 +18,6 @@ type startStartHook struct{}
 
 // Apply queues up our flow starts
 func (h *startStartHook) Apply(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *models.OrgAssets, scenes map[*models.Scene][]interface{}) error {
-	rc := rt.RP.Get()
-	defer rc.Close()
-
 	// for each of our scene
 	for _, es := range scenes {
 		for _, e := range es {
@@ -35,7 +32,7 @@ func (h *startStartHook) Apply(ctx context.Context, rt *runtime.Runtime, tx *sql
 				priority = queue.HighPriority
 			}
 
-			err := queue.AddTask(rc, taskQ, queue.StartFlow, int(oa.OrgID()), start, priority)
+			err := rt.Queue.AddTask(taskQ, queue.StartFlow, int(oa.OrgID()), start, priority)
 			if err != nil {
 				return errors.Wrapf(err, "error queuing flow start")
 			}
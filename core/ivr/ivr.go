@@ -209,7 +209,7 @@ func RequestCall(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets,
 
 func RequestStartForCall(ctx context.Context, rt *runtime.Runtime, channel *models.Channel, telURN urns.URN, call *models.Call) (*models.ChannelLog, error) {
 	// the domain that will be used for callbacks, can be specific for channels due to white labeling
-	domain := channel.ConfigValue(models.ChannelConfigCallbackDomain, rt.Config.Domain)
+	domain := channel.ConfigValue(models.ChannelConfigCallbackDomain, rt.Config().Domain)
 
 	// get max concurrent events if any
 	maxCalls := channel.ConfigValue(models.ChannelConfigMaxConcurrentEvents, "")
@@ -578,7 +578,7 @@ func buildMsgResume(
 	msgIn := flows.NewMsgIn(msgUUID, urn, channel.ChannelReference(), resume.Input, attachments)
 
 	// create an incoming message
-	msg := models.NewIncomingIVR(rt.Config, oa.OrgID(), call, msgIn, time.Now())
+	msg := models.NewIncomingIVR(rt.Config(), oa.OrgID(), call, msgIn, time.Now())
 
 	// commit it
 	if err := models.InsertMessages(ctx, rt.DB, []*models.Msg{msg}); err != nil {
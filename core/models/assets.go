@@ -4,10 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/goflow/flows"
@@ -16,6 +18,7 @@ import (
 	"github.com/nyaruka/mailroom/runtime"
 	cache "github.com/patrickmn/go-cache"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 // OrgAssets is our top level cache of all things contained in an org. It is used to build
@@ -115,6 +118,99 @@ func FlushCache() {
 	orgCache.Flush()
 }
 
+// the redis channel on which org ids are published to have their assets flushed by every instance
+const orgAssetsFlushChannel = "mailroom:flush_org_assets"
+
+// FlushOrgAssets removes the cached assets of the given org so that they're loaded again when next used
+func FlushOrgAssets(orgID OrgID) {
+	orgCache.Delete(fmt.Sprintf("%d", orgID))
+}
+
+// PublishOrgAssetsFlush asks every running instance to flush its cached assets for the given org, returning the number
+// of instances which received the request. This is only needed when a change has to take effect immediately as
+// cached assets are otherwise refreshed after a few seconds.
+func PublishOrgAssetsFlush(rc redis.Conn, orgID OrgID) (int, error) {
+	received, err := redis.Int(rc.Do("PUBLISH", orgAssetsFlushChannel, int(orgID)))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error publishing flush of org assets")
+	}
+	return received, nil
+}
+
+// StartOrgAssetsFlusher starts a goroutine which flushes the cached assets of orgs published by PublishOrgAssetsFlush
+// until quit is closed. It holds one connection from the redis pool whilst subscribed, and resubscribes after errors.
+func StartOrgAssetsFlusher(rt *runtime.Runtime, wg *sync.WaitGroup, quit chan bool) {
+	log := logrus.WithField("comp", "assets_flusher")
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for {
+			err := listenForOrgAssetsFlushes(rt, quit)
+			if err == nil {
+				return
+			}
+
+			log.WithError(err).Error("error listening for org assets flushes")
+
+			select {
+			case <-quit:
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}()
+}
+
+// listens for org assets flushes until quit is closed, returning an error if our subscription fails
+func listenForOrgAssetsFlushes(rt *runtime.Runtime, quit chan bool) error {
+	psc := redis.PubSubConn{Conn: rt.RP.Get()}
+	defer psc.Close()
+
+	if err := psc.Subscribe(orgAssetsFlushChannel); err != nil {
+		return errors.Wrapf(err, "error subscribing to org assets flushes")
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		for {
+			switch v := psc.Receive().(type) {
+			case redis.Message:
+				orgID, err := strconv.Atoi(string(v.Data))
+				if err != nil {
+					logrus.WithField("comp", "assets_flusher").WithField("data", string(v.Data)).Error("invalid org id in org assets flush")
+					continue
+				}
+				FlushOrgAssets(OrgID(orgID))
+				logrus.WithField("comp", "assets_flusher").WithField("org_id", orgID).Info("flushed org assets")
+			case redis.Subscription:
+				if v.Count == 0 {
+					done <- nil
+					return
+				}
+			case error:
+				done <- v
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-quit:
+		psc.Unsubscribe()
+		<-done
+		return nil
+	case err := <-done:
+		if err == nil {
+			err = errors.New("unexpectedly unsubscribed")
+		}
+		return errors.Wrapf(err, "error receiving org assets flushes")
+	}
+}
+
 // NewOrgAssets creates and returns a new org assets objects, potentially using the previous
 // org assets passed in to prevent refetching locations
 func NewOrgAssets(ctx context.Context, rt *runtime.Runtime, orgID OrgID, prev *OrgAssets, refresh Refresh) (*OrgAssets, error) {
@@ -137,7 +233,7 @@ func NewOrgAssets(ctx context.Context, rt *runtime.Runtime, orgID OrgID, prev *O
 	var err error
 
 	if prev == nil || refresh&RefreshOrg > 0 {
-		oa.org, err = LoadOrg(ctx, rt.Config, db, orgID)
+		oa.org, err = LoadOrg(ctx, rt.Config(), db, orgID)
 		if err != nil {
 			return nil, errors.Wrapf(err, "error loading environment for org %d", orgID)
 		}
@@ -362,7 +458,7 @@ func NewOrgAssets(ctx context.Context, rt *runtime.Runtime, orgID OrgID, prev *O
 	}
 
 	// intialize our session assets
-	oa.sessionAssets, err = engine.NewSessionAssets(oa.Env(), oa, goflow.MigrationConfig(rt.Config))
+	oa.sessionAssets, err = engine.NewSessionAssets(oa.Env(), oa, goflow.MigrationConfig(rt.Config()))
 	if err != nil {
 		return nil, errors.Wrapf(err, "error build session assets for org: %d", orgID)
 	}
@@ -505,7 +601,7 @@ func (a *OrgAssets) CloneForSimulation(ctx context.Context, rt *runtime.Runtime,
 	clone.channels = append(clone.channels, testChannels...)
 
 	// rebuild our session assets with our new items
-	clone.sessionAssets, err = engine.NewSessionAssets(a.Env(), clone, goflow.MigrationConfig(rt.Config))
+	clone.sessionAssets, err = engine.NewSessionAssets(a.Env(), clone, goflow.MigrationConfig(rt.Config()))
 	if err != nil {
 		return nil, errors.Wrapf(err, "error build session assets for org: %d", clone.OrgID())
 	}
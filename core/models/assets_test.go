@@ -2,7 +2,9 @@ package models_test
 
 import (
 	"encoding/json"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/assets/static"
@@ -113,3 +115,47 @@ func TestCloneForSimulation(t *testing.T) {
 	_, err = oa.CloneForSimulation(ctx, rt, map[assets.FlowUUID]json.RawMessage{"a121f1af-7dfa-47af-9d22-9726372e2daa": []byte(newFavoritesDef)}, nil)
 	assert.EqualError(t, err, "unable to find flow with UUID 'a121f1af-7dfa-47af-9d22-9726372e2daa': not found")
 }
+
+func TestOrgAssetsFlusher(t *testing.T) {
+	ctx, rt, _, rp := testsuite.Get()
+
+	defer models.FlushCache()
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	wg := &sync.WaitGroup{}
+	quit := make(chan bool)
+	models.StartOrgAssetsFlusher(rt, wg, quit)
+
+	oa1, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+	oa2, err := models.GetOrgAssets(ctx, rt, testdata.Org2.ID)
+	require.NoError(t, err)
+
+	// wait for the flusher to be subscribed and receive our flush
+	assert.Eventually(t, func() bool {
+		received, err := models.PublishOrgAssetsFlush(rc, testdata.Org1.ID)
+		require.NoError(t, err)
+		return received == 1
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		oa, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+		require.NoError(t, err)
+		return oa != oa1
+	}, time.Second, 10*time.Millisecond)
+
+	// other orgs are left cached
+	oa, err := models.GetOrgAssets(ctx, rt, testdata.Org2.ID)
+	require.NoError(t, err)
+	assert.Same(t, oa2, oa)
+
+	close(quit)
+	wg.Wait()
+
+	// nothing is listening once we've quit
+	received, err := models.PublishOrgAssetsFlush(rc, testdata.Org1.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, received)
+}
@@ -0,0 +1,233 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/null"
+	"github.com/pkg/errors"
+)
+
+// reports are cached so that they don't have to be computed from the messages of large broadcasts on every request,
+// and are kept for as long as they might still be refreshed
+const (
+	broadcastReportPattern = "broadcast_report:%d"
+	broadcastReportExpiry  = 7 * 24 * 60 * 60
+)
+
+// the progress of a paced broadcast is recorded in a hash per broadcast, which is kept as long as its report
+const broadcastProgressPattern = "broadcast_progress:%d"
+
+// DefaultBroadcastReplyHours is the default window after a broadcast message in which a reply from its contact counts
+const DefaultBroadcastReplyHours = 24
+
+// the names we use in reports for message statuses and failed reasons
+var broadcastReportStatuses = map[MsgStatus]string{
+	MsgStatusPending:   "pending",
+	MsgStatusQueued:    "queued",
+	MsgStatusWired:     "wired",
+	MsgStatusSent:      "sent",
+	MsgStatusDelivered: "delivered",
+	MsgStatusErrored:   "errored",
+	MsgStatusFailed:    "failed",
+}
+
+var broadcastReportFailedReasons = map[MsgFailedReason]string{
+	MsgFailedSuspended:      "suspended",
+	MsgFailedContact:        "contact",
+	MsgFailedLooping:        "looping",
+	MsgFailedErrorLimit:     "error_limit",
+	MsgFailedTooOld:         "too_old",
+	MsgFailedNoDestination:  "no_destination",
+	MsgFailedChannelRemoved: "channel_removed",
+}
+
+// contacts without a language are reported under the ISO 639 code for undetermined
+const broadcastReportNoLanguage = envs.Language("und")
+
+// BroadcastReport is a summary of how the messages of a broadcast have fared, and how many of its contacts replied
+type BroadcastReport struct {
+	OrgID         OrgID                      `json:"org_id"`
+	BroadcastID   BroadcastID                `json:"broadcast_id"`
+	Msgs          int                        `json:"msgs"`
+	Statuses      map[string]int             `json:"statuses"`
+	FailedReasons map[string]int             `json:"failed_reasons"`
+	Channels      map[assets.ChannelUUID]int `json:"channels"`
+	Languages     map[envs.Language]int      `json:"languages"`
+	Contacts      int                        `json:"contacts"`
+	ReplyHours    int                        `json:"reply_hours"`
+	Replied       int                        `json:"replied"`
+	ReplyRate     float64                    `json:"reply_rate"`
+	CreatedOn     time.Time                  `json:"created_on"`
+
+	// when the last batch of a paced broadcast is due to be released
+	ProjectedEnd *time.Time `json:"projected_end,omitempty"`
+}
+
+const sqlSelectBroadcastMsgCounts = `
+  SELECT m.status, m.failed_reason, ch.uuid AS channel_uuid, c.language, count(*) AS count
+    FROM msgs_msg m
+    JOIN contacts_contact c ON c.id = m.contact_id
+LEFT JOIN channels_channel ch ON ch.id = m.channel_id
+   WHERE m.broadcast_id = $1 AND m.org_id = $2 AND m.direction = 'O'
+GROUP BY m.status, m.failed_reason, ch.uuid, c.language`
+
+// a contact has replied if they sent us a message within the window after any of the broadcast's messages to them
+const sqlSelectBroadcastReplies = `
+SELECT count(DISTINCT m.contact_id) AS contacts,
+       count(DISTINCT m.contact_id) FILTER (WHERE EXISTS (
+           SELECT 1 FROM msgs_msg r
+            WHERE r.contact_id = m.contact_id AND r.direction = 'I' AND r.created_on > m.created_on AND r.created_on <= m.created_on + $3 * INTERVAL '1 hour'
+       )) AS replied
+  FROM msgs_msg m
+ WHERE m.broadcast_id = $1 AND m.org_id = $2 AND m.direction = 'O'`
+
+// GetBroadcastReport computes the report for the given broadcast from its messages, counting replies received within
+// the given number of hours. Returns ErrNotFound if the broadcast doesn't exist in the given org.
+func GetBroadcastReport(ctx context.Context, db Queryer, orgID OrgID, broadcastID BroadcastID, replyHours int) (*BroadcastReport, error) {
+	var id BroadcastID
+	err := db.GetContext(ctx, &id, `SELECT id FROM msgs_broadcast WHERE id = $1 AND org_id = $2`, broadcastID, orgID)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error looking up broadcast %d", broadcastID)
+	}
+
+	report := &BroadcastReport{
+		OrgID:         orgID,
+		BroadcastID:   broadcastID,
+		Statuses:      make(map[string]int),
+		FailedReasons: make(map[string]int),
+		Channels:      make(map[assets.ChannelUUID]int),
+		Languages:     make(map[envs.Language]int),
+		ReplyHours:    replyHours,
+		CreatedOn:     dates.Now(),
+	}
+
+	rows, err := db.QueryxContext(ctx, sqlSelectBroadcastMsgCounts, broadcastID, orgID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error counting messages of broadcast %d", broadcastID)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row := &struct {
+			Status       MsgStatus       `db:"status"`
+			FailedReason MsgFailedReason `db:"failed_reason"`
+			ChannelUUID  null.String     `db:"channel_uuid"`
+			Language     null.String     `db:"language"`
+			Count        int             `db:"count"`
+		}{}
+		if err := rows.StructScan(row); err != nil {
+			return nil, errors.Wrapf(err, "error scanning message counts of broadcast %d", broadcastID)
+		}
+
+		report.Msgs += row.Count
+		report.Statuses[broadcastReportStatuses[row.Status]] += row.Count
+
+		if row.FailedReason != NilMsgFailedReason {
+			report.FailedReasons[broadcastReportFailedReasons[row.FailedReason]] += row.Count
+		}
+		if row.ChannelUUID != "" {
+			report.Channels[assets.ChannelUUID(row.ChannelUUID)] += row.Count
+		}
+
+		lang := envs.Language(row.Language)
+		if lang == envs.NilLanguage {
+			lang = broadcastReportNoLanguage
+		}
+		report.Languages[lang] += row.Count
+	}
+
+	replies := &struct {
+		Contacts int `db:"contacts"`
+		Replied  int `db:"replied"`
+	}{}
+	if err := db.GetContext(ctx, replies, sqlSelectBroadcastReplies, broadcastID, orgID, replyHours); err != nil {
+		return nil, errors.Wrapf(err, "error counting replies to broadcast %d", broadcastID)
+	}
+
+	report.Contacts = replies.Contacts
+	report.Replied = replies.Replied
+	if replies.Contacts > 0 {
+		report.ReplyRate = float64(replies.Replied) / float64(replies.Contacts)
+	}
+
+	return report, nil
+}
+
+// CacheBroadcastReport caches the given report so that it can be returned without being recomputed
+func CacheBroadcastReport(rc redis.Conn, report *BroadcastReport) error {
+	_, err := rc.Do("set", fmt.Sprintf(broadcastReportPattern, report.BroadcastID), jsonx.MustMarshal(report), "ex", broadcastReportExpiry)
+	return errors.Wrapf(err, "error caching report for broadcast %d", report.BroadcastID)
+}
+
+// GetCachedBroadcastReport gets the cached report for the given broadcast, or nil if there isn't one
+func GetCachedBroadcastReport(rc redis.Conn, broadcastID BroadcastID) (*BroadcastReport, error) {
+	data, err := redis.Bytes(rc.Do("get", fmt.Sprintf(broadcastReportPattern, broadcastID)))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting cached report for broadcast %d", broadcastID)
+	}
+
+	report := &BroadcastReport{}
+	if err := json.Unmarshal(data, report); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshalling cached report for broadcast %d", broadcastID)
+	}
+	return report, nil
+}
+
+// RecordBroadcastProjectedEnd records when the last batch of the given paced broadcast is due to be released
+func RecordBroadcastProjectedEnd(rc redis.Conn, broadcastID BroadcastID, projectedEnd time.Time) error {
+	key := fmt.Sprintf(broadcastProgressPattern, broadcastID)
+
+	rc.Send("multi")
+	rc.Send("hset", key, "projected_end", projectedEnd.Unix())
+	rc.Send("expire", key, broadcastReportExpiry)
+	_, err := rc.Do("exec")
+
+	return errors.Wrapf(err, "error recording projected end of broadcast %d", broadcastID)
+}
+
+// GetBroadcastProjectedEnd gets when the last batch of the given paced broadcast is due to be released, or nil if it
+// isn't paced
+func GetBroadcastProjectedEnd(rc redis.Conn, broadcastID BroadcastID) (*time.Time, error) {
+	projectedEnd, err := redis.Int64(rc.Do("hget", fmt.Sprintf(broadcastProgressPattern, broadcastID), "projected_end"))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting projected end of broadcast %d", broadcastID)
+	}
+
+	t := time.Unix(projectedEnd, 0).UTC()
+	return &t, nil
+}
+
+// BroadcastRef is the ID of a broadcast, the org it belongs to and when it was sent
+type BroadcastRef struct {
+	OrgID       OrgID       `db:"org_id"`
+	BroadcastID BroadcastID `db:"id"`
+	SentOn      time.Time   `db:"modified_on"`
+}
+
+// GetBroadcastsSentSince gets the broadcasts which were marked as sent after the given time
+func GetBroadcastsSentSince(ctx context.Context, db Queryer, since time.Time) ([]*BroadcastRef, error) {
+	refs := make([]*BroadcastRef, 0, 10)
+	err := db.SelectContext(ctx, &refs, `SELECT org_id, id, modified_on FROM msgs_broadcast WHERE status = 'S' AND is_active = TRUE AND modified_on > $1 ORDER BY id`, since)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting broadcasts sent since %s", since)
+	}
+	return refs, nil
+}
@@ -0,0 +1,108 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroadcastReports(t *testing.T) {
+	ctx, _, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	bcastID := testdata.InsertBroadcast(db, testdata.Org1, "eng", map[envs.Language]string{"eng": "Hi there"}, models.NilScheduleID, nil, nil)
+
+	db.MustExec(`UPDATE contacts_contact SET language = 'eng' WHERE id = $1`, testdata.Cathy.ID)
+	db.MustExec(`UPDATE contacts_contact SET language = 'fra' WHERE id = $1`, testdata.Bob.ID)
+	db.MustExec(`UPDATE contacts_contact SET language = NULL WHERE id = $1`, testdata.George.ID)
+
+	// Cathy's message is delivered and she replies, Bob's is sent but he replies too late and George's fails
+	testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "Hi there", nil, models.MsgStatusDelivered, false)
+	testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "Hi there", nil, models.MsgStatusSent, false)
+	testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.VonageChannel, testdata.George, "Hi there", nil, models.MsgStatusFailed, false)
+
+	db.MustExec(`UPDATE msgs_msg SET broadcast_id = $1, created_on = NOW() - INTERVAL '1 hour' WHERE direction = 'O' AND contact_id = ANY(ARRAY[$2, $3]::int[])`, bcastID, testdata.Cathy.ID, testdata.George.ID)
+	db.MustExec(`UPDATE msgs_msg SET broadcast_id = $1, created_on = NOW() - INTERVAL '30 hours' WHERE direction = 'O' AND contact_id = $2`, bcastID, testdata.Bob.ID)
+	db.MustExec(`UPDATE msgs_msg SET failed_reason = 'E' WHERE direction = 'O' AND contact_id = $1`, testdata.George.ID)
+
+	testdata.InsertIncomingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "Thanks", models.MsgStatusHandled)
+	testdata.InsertIncomingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "Thanks", models.MsgStatusHandled)
+
+	// and a message to Cathy which isn't part of the broadcast
+	testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "Other", nil, models.MsgStatusDelivered, false)
+
+	report, err := models.GetBroadcastReport(ctx, db, testdata.Org1.ID, bcastID, models.DefaultBroadcastReplyHours)
+	require.NoError(t, err)
+
+	assert.Equal(t, testdata.Org1.ID, report.OrgID)
+	assert.Equal(t, bcastID, report.BroadcastID)
+	assert.Equal(t, 3, report.Msgs)
+	assert.Equal(t, map[string]int{"delivered": 1, "sent": 1, "failed": 1}, report.Statuses)
+	assert.Equal(t, map[string]int{"error_limit": 1}, report.FailedReasons)
+	assert.Equal(t, map[assets.ChannelUUID]int{testdata.TwilioChannel.UUID: 2, testdata.VonageChannel.UUID: 1}, report.Channels)
+	assert.Equal(t, map[envs.Language]int{"eng": 1, "fra": 1, "und": 1}, report.Languages)
+	assert.Equal(t, 3, report.Contacts)
+	assert.Equal(t, 24, report.ReplyHours)
+	assert.Equal(t, 1, report.Replied)
+	assert.InDelta(t, 0.333, report.ReplyRate, 0.001)
+
+	// with a longer window, Bob's reply counts
+	report, err = models.GetBroadcastReport(ctx, db, testdata.Org1.ID, bcastID, 48)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Replied)
+
+	// broadcast doesn't exist in another org
+	_, err = models.GetBroadcastReport(ctx, db, testdata.Org2.ID, bcastID, models.DefaultBroadcastReplyHours)
+	assert.Equal(t, models.ErrNotFound, err)
+
+	// reports can be cached
+	cached, err := models.GetCachedBroadcastReport(rc, bcastID)
+	require.NoError(t, err)
+	assert.Nil(t, cached)
+
+	err = models.CacheBroadcastReport(rc, report)
+	require.NoError(t, err)
+
+	cached, err = models.GetCachedBroadcastReport(rc, bcastID)
+	require.NoError(t, err)
+	assert.Equal(t, report.Replied, cached.Replied)
+	assert.Equal(t, report.Statuses, cached.Statuses)
+	assert.True(t, report.CreatedOn.Equal(cached.CreatedOn))
+
+	// paced broadcasts record when their last batch is due
+	projectedEnd, err := models.GetBroadcastProjectedEnd(rc, bcastID)
+	require.NoError(t, err)
+	assert.Nil(t, projectedEnd)
+
+	end := time.Date(2022, 12, 1, 12, 30, 0, 0, time.UTC)
+	require.NoError(t, models.RecordBroadcastProjectedEnd(rc, bcastID, end))
+
+	projectedEnd, err = models.GetBroadcastProjectedEnd(rc, bcastID)
+	require.NoError(t, err)
+	assert.Equal(t, &end, projectedEnd)
+
+	// only broadcasts which have been sent are refreshed
+	refs, err := models.GetBroadcastsSentSince(ctx, db, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, refs, 0)
+
+	err = models.MarkBroadcastSent(ctx, db, bcastID)
+	require.NoError(t, err)
+
+	refs, err = models.GetBroadcastsSentSince(ctx, db, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Len(t, refs, 1)
+	assert.Equal(t, testdata.Org1.ID, refs[0].OrgID)
+	assert.Equal(t, bcastID, refs[0].BroadcastID)
+	assert.WithinDuration(t, time.Now(), refs[0].SentOn, time.Minute)
+}
@@ -480,6 +480,27 @@ func DeleteUnfiredContactEvents(ctx context.Context, tx Queryer, contactIDs []Co
 	return nil
 }
 
+// DeleteUnfiredEventFiresForEvent deletes all unfired event fires for the passed in event, returning how many were deleted
+func DeleteUnfiredEventFiresForEvent(ctx context.Context, db Queryer, eventID CampaignEventID) (int, error) {
+	res, err := db.ExecContext(ctx, `DELETE FROM campaigns_eventfire WHERE event_id = $1 AND fired IS NULL`, eventID)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error deleting unfired fires for event %d", eventID)
+	}
+	deleted, _ := res.RowsAffected()
+	return int(deleted), nil
+}
+
+// MarkEventFiresDue reschedules all unfired event fires for the passed in event to now, so that they'll be queued by
+// the next run of the campaign event cron, returning how many were rescheduled
+func MarkEventFiresDue(ctx context.Context, db Queryer, eventID CampaignEventID) (int, error) {
+	res, err := db.ExecContext(ctx, `UPDATE campaigns_eventfire SET scheduled = NOW() WHERE event_id = $1 AND fired IS NULL AND scheduled > NOW()`, eventID)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error marking fires for event %d as due", eventID)
+	}
+	updated, _ := res.RowsAffected()
+	return int(updated), nil
+}
+
 const sqlInsertEventFires = `
 INSERT INTO campaigns_eventfire(contact_id,  event_id,  scheduled)
                          VALUES(:contact_id, :event_id, :scheduled)
@@ -114,3 +114,34 @@ func TestAddEventFires(t *testing.T) {
 	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE contact_id = $1 AND event_id = $2`, testdata.Cathy.ID, testdata.RemindersEvent1.ID).Returns(2)
 	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE contact_id = $1`, testdata.Bob.ID).Returns(2)
 }
+
+func TestRescheduleEventFires(t *testing.T) {
+	ctx, _, db, _ := testsuite.Get()
+
+	defer db.MustExec(`DELETE FROM campaigns_eventfire`)
+
+	future := time.Now().Add(time.Hour * 24)
+
+	testdata.InsertEventFire(db, testdata.Cathy, testdata.RemindersEvent1, future)
+	testdata.InsertEventFire(db, testdata.Bob, testdata.RemindersEvent1, future)
+	testdata.InsertEventFire(db, testdata.George, testdata.RemindersEvent1, future)
+	testdata.InsertEventFire(db, testdata.Bob, testdata.RemindersEvent2, future)
+
+	db.MustExec(`UPDATE campaigns_eventfire SET fired = NOW() WHERE contact_id = $1`, testdata.George.ID)
+
+	// only unfired fires for the event should be made due
+	count, err := models.MarkEventFiresDue(ctx, db, testdata.RemindersEvent1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE scheduled <= NOW()`).Returns(2)
+	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE event_id = $1 AND scheduled > NOW()`, testdata.RemindersEvent2.ID).Returns(1)
+
+	// and only unfired fires should be deleted
+	count, err = models.DeleteUnfiredEventFiresForEvent(ctx, db, testdata.RemindersEvent1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE event_id = $1`, testdata.RemindersEvent1.ID).Returns(1)
+	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE event_id = $1`, testdata.RemindersEvent2.ID).Returns(1)
+}
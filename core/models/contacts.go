@@ -705,6 +705,29 @@ func contactIDsFromURNs(ctx context.Context, db Queryer, orgID OrgID, urnz []urn
 	return owners, nil
 }
 
+// GetPreferredChannelIDs looks up the channel of the highest priority URN of each of the given contacts, which will be
+// NilChannelID for contacts without URNs or whose highest priority URN has no channel affinity
+func GetPreferredChannelIDs(ctx context.Context, db Queryer, contactIDs []ContactID) (map[ContactID]ChannelID, error) {
+	channelIDs := make(map[ContactID]ChannelID, len(contactIDs))
+
+	rows, err := db.QueryxContext(ctx, `SELECT DISTINCT ON (contact_id) contact_id, channel_id FROM contacts_contacturn WHERE contact_id = ANY($1) ORDER BY contact_id, priority DESC, id`, pq.Array(contactIDs))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error querying preferred channels of contacts")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var contactID ContactID
+		var channelID ChannelID
+		if err := rows.Scan(&contactID, &channelID); err != nil {
+			return nil, errors.Wrapf(err, "error scanning preferred channel")
+		}
+		channelIDs[contactID] = channelID
+	}
+
+	return channelIDs, nil
+}
+
 func getOrCreateContact(ctx context.Context, db QueryerWithTx, orgID OrgID, urnz []urns.URN, channelID ChannelID) (ContactID, bool, error) {
 	// find current owners of these URNs
 	owners, err := contactIDsFromURNs(ctx, db, orgID, urnz)
@@ -0,0 +1,272 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ContactErasure is the audit record of a contact erasure, which counts what was removed without recording any of it
+type ContactErasure struct {
+	OrgID            OrgID             `json:"org_id"`
+	ContactID        ContactID         `json:"contact_id"`
+	ContactUUID      flows.ContactUUID `json:"contact_uuid"`
+	UserID           UserID            `json:"user_id,omitempty"`
+	Sessions         int               `json:"sessions"`
+	SessionOutputs   int               `json:"session_outputs"`
+	Runs             int               `json:"runs"`
+	Msgs             int               `json:"msgs"`
+	Attachments      int               `json:"attachments"`
+	ChannelLogs      int               `json:"channel_logs"`
+	HTTPLogs         int               `json:"http_logs"`
+	Tickets          int               `json:"tickets"`
+	AirtimeTransfers int               `json:"airtime_transfers"`
+	EventFires       int               `json:"event_fires"`
+	URNs             int               `json:"urns"`
+	StorageNote      string            `json:"storage_note,omitempty"`
+	ErasedOn         time.Time         `json:"erased_on"`
+}
+
+// StoragePath returns the path of the audit record in session storage
+func (e *ContactErasure) StoragePath(cfg *runtime.Config) string {
+	ts := e.ErasedOn.UTC().Format(storageTSFormat)
+
+	// example output: /orgs/1/erasures/20060102T150405.123Z_erasure_20a5534c-b2ad-4f18-973a-f1aa3b4e6c74.json
+	return path.Join(
+		cfg.S3SessionPrefix,
+		"orgs",
+		fmt.Sprintf("%d", e.OrgID),
+		"erasures",
+		fmt.Sprintf("%s_erasure_%s.json", ts, e.ContactUUID),
+	)
+}
+
+// what we overwrite stored session outputs with, as storage doesn't let us delete them
+var erasedSessionOutput = []byte(`{}`)
+
+// recorded in the audit record when we've overwritten stored content, as that doesn't remove earlier versions of it
+const overwrittenStorageNote = "session outputs and attachments were overwritten in place, earlier versions of them remain if bucket versioning is enabled"
+
+// EraseContact erases everything we have for the given contact so that they can't be identified from anything that's
+// left. Stored session outputs and message attachments are overwritten, channel and HTTP logs are deleted, message
+// bodies, run results, ticket bodies and airtime recipients are blanked, pending campaign fires are deleted, URNs are
+// anonymized and the contact is released. Any waiting sessions are interrupted. The caller should hold the contact's
+// lock. Contacts which have already been released can still be erased. Once done, the audit record is written to
+// session storage and returned.
+func EraseContact(ctx context.Context, rt *runtime.Runtime, orgID OrgID, contactID ContactID, userID UserID) (*ContactErasure, error) {
+	var contactUUID flows.ContactUUID
+	if err := rt.DB.GetContext(ctx, &contactUUID, `SELECT uuid FROM contacts_contact WHERE id = $1 AND org_id = $2`, contactID, orgID); err != nil {
+		return nil, errors.Wrapf(err, "error loading contact %d", contactID)
+	}
+
+	erasure := &ContactErasure{OrgID: orgID, ContactID: contactID, ContactUUID: contactUUID, UserID: userID}
+
+	// overwrite stored content first, so if that fails the erasure can be retried as we still know where it is
+	outputsErased, err := eraseSessionOutputs(ctx, rt, contactID)
+	if err != nil {
+		return nil, err
+	}
+	attachmentsErased, err := eraseAttachments(ctx, rt, orgID, contactID)
+	if err != nil {
+		return nil, err
+	}
+	erasure.SessionOutputs = outputsErased
+	erasure.Attachments = attachmentsErased
+	if outputsErased > 0 || attachmentsErased > 0 {
+		erasure.StorageNote = overwrittenStorageNote
+	}
+
+	// logs can be large so they're deleted outside of our transaction, but must go before the messages and transfers
+	// they're found through are erased, and before the URNs they're matched on are anonymized
+	if err := eraseLogs(ctx, rt, erasure); err != nil {
+		return nil, err
+	}
+
+	tx, err := rt.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error beginning transaction")
+	}
+
+	if err := eraseContact(ctx, tx, erasure); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrapf(err, "error committing erasure of contact %d", contactID)
+	}
+
+	erasure.ErasedOn = dates.Now()
+
+	if _, err := rt.SessionStorage.Put(ctx, erasure.StoragePath(rt.Config()), "application/json", jsonx.MustMarshal(erasure)); err != nil {
+		return nil, errors.Wrapf(err, "error writing audit record for erasure of contact %d", contactID)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"org_id":       orgID,
+		"contact_id":   contactID,
+		"contact_uuid": contactUUID,
+		"user_id":      userID,
+		"msgs":         erasure.Msgs,
+		"sessions":     erasure.Sessions,
+		"http_logs":    erasure.HTTPLogs,
+		"channel_logs": erasure.ChannelLogs,
+	}).Info("erased contact")
+
+	return erasure, nil
+}
+
+func eraseContact(ctx context.Context, tx *sqlx.Tx, erasure *ContactErasure) error {
+	contactID := erasure.ContactID
+
+	if err := InterruptSessionsForContactsTx(ctx, tx, []ContactID{contactID}); err != nil {
+		return errors.Wrapf(err, "error interrupting sessions for contact %d", contactID)
+	}
+
+	erasures := []struct {
+		count *int
+		sql   string
+		args  []interface{}
+	}{
+		{&erasure.Msgs, `UPDATE msgs_msg SET text = '', attachments = NULL, metadata = NULL, log_uuids = NULL, modified_on = NOW() WHERE contact_id = $1`, []interface{}{contactID}},
+		{&erasure.Sessions, `UPDATE flows_flowsession SET output = CASE WHEN output IS NULL THEN NULL ELSE '{}' END WHERE contact_id = $1`, []interface{}{contactID}},
+		{&erasure.Runs, `UPDATE flows_flowrun SET results = '{}' WHERE contact_id = $1`, []interface{}{contactID}},
+		{&erasure.Tickets, `UPDATE tickets_ticket SET body = '' WHERE contact_id = $1`, []interface{}{contactID}},
+		{nil, `UPDATE tickets_ticketevent SET note = NULL WHERE contact_id = $1 AND note IS NOT NULL`, []interface{}{contactID}},
+		{&erasure.AirtimeTransfers, `UPDATE airtime_airtimetransfer SET recipient = '', sender = NULL WHERE contact_id = $1`, []interface{}{contactID}},
+		{&erasure.EventFires, `DELETE FROM campaigns_eventfire WHERE contact_id = $1 AND fired IS NULL`, []interface{}{contactID}},
+		{nil, `DELETE FROM contacts_contactgroup_contacts WHERE contact_id = $1`, []interface{}{contactID}},
+		{&erasure.URNs, sqlAnonymizeContactURNs, []interface{}{contactID}},
+		{nil, `UPDATE contacts_contact SET name = NULL, language = NULL, fields = '{}', is_active = FALSE, modified_on = NOW() WHERE id = $1`, []interface{}{contactID}},
+	}
+
+	for _, e := range erasures {
+		res, err := tx.ExecContext(ctx, e.sql, e.args...)
+		if err != nil {
+			return errors.Wrapf(err, "error erasing contact %d", contactID)
+		}
+		if e.count != nil {
+			rows, _ := res.RowsAffected()
+			*e.count = int(rows)
+		}
+	}
+	return nil
+}
+
+// deletes the channel and HTTP logs of the contact
+func eraseLogs(ctx context.Context, rt *runtime.Runtime, erasure *ContactErasure) error {
+	contactID := erasure.ContactID
+
+	res, err := rt.DB.ExecContext(ctx, sqlEraseChannelLogs, contactID)
+	if err != nil {
+		return errors.Wrapf(err, "error erasing channel logs of contact %d", contactID)
+	}
+	rows, _ := res.RowsAffected()
+	erasure.ChannelLogs = int(rows)
+
+	// HTTP logs aren't linked to contacts so we look for their UUID and the full identities of their URNs, as quoted
+	// JSON strings so that other URNs which start with the same path don't match
+	patterns := []string{"%" + escapeLike(string(erasure.ContactUUID)) + "%"}
+	var identities []string
+	if err := rt.DB.SelectContext(ctx, &identities, `SELECT identity FROM contacts_contacturn WHERE contact_id = $1`, contactID); err != nil {
+		return errors.Wrapf(err, "error loading URNs for contact %d", contactID)
+	}
+	for _, identity := range identities {
+		patterns = append(patterns, `%"`+escapeLike(identity)+`"%`)
+	}
+
+	res, err = rt.DB.ExecContext(ctx, sqlEraseHTTPLogs, erasure.OrgID, contactID, pq.Array(patterns))
+	if err != nil {
+		return errors.Wrapf(err, "error erasing HTTP logs of contact %d", contactID)
+	}
+	rows, _ = res.RowsAffected()
+	erasure.HTTPLogs = int(rows)
+
+	return nil
+}
+
+const sqlEraseChannelLogs = `
+DELETE FROM channels_channellog
+ WHERE uuid IN (SELECT unnest(log_uuids) FROM msgs_msg WHERE contact_id = $1)
+    OR msg_id IN (SELECT id FROM msgs_msg WHERE contact_id = $1)
+    OR call_id IN (SELECT id FROM ivr_call WHERE contact_id = $1)`
+
+const sqlEraseHTTPLogs = `
+DELETE FROM request_logs_httplog
+ WHERE org_id = $1 AND (
+	airtime_transfer_id IN (SELECT id FROM airtime_airtimetransfer WHERE contact_id = $2) OR
+	request LIKE ANY($3) OR
+	response LIKE ANY($3)
+)`
+
+// URNs are still referenced by messages and calls so rather than deleting them we replace their identities with
+// something unique which says nothing about the contact
+const sqlAnonymizeContactURNs = `
+UPDATE contacts_contacturn
+   SET scheme = 'deleted', path = id::text, identity = 'deleted:' || id::text, display = NULL, auth = NULL, channel_id = NULL
+ WHERE contact_id = $1`
+
+// overwrites the stored outputs of the contact's sessions, returning how many were overwritten
+func eraseSessionOutputs(ctx context.Context, rt *runtime.Runtime, contactID ContactID) (int, error) {
+	var outputURLs []string
+	if err := rt.DB.SelectContext(ctx, &outputURLs, `SELECT output_url FROM flows_flowsession WHERE contact_id = $1 AND output_url IS NOT NULL`, contactID); err != nil {
+		return 0, errors.Wrapf(err, "error loading session output URLs for contact %d", contactID)
+	}
+
+	for _, outputURL := range outputURLs {
+		u, err := url.Parse(outputURL)
+		if err != nil {
+			return 0, errors.Wrapf(err, "error parsing output URL: %s", outputURL)
+		}
+		if _, err := rt.SessionStorage.Put(ctx, u.Path, "application/json", erasedSessionOutput); err != nil {
+			return 0, errors.Wrapf(err, "error overwriting session output: %s", outputURL)
+		}
+	}
+	return len(outputURLs), nil
+}
+
+// overwrites the attachments of the contact's messages which are in our attachment storage, returning how many were
+// overwritten
+func eraseAttachments(ctx context.Context, rt *runtime.Runtime, orgID OrgID, contactID ContactID) (int, error) {
+	var attachments []string
+	if err := rt.DB.SelectContext(ctx, &attachments, `SELECT unnest(attachments) FROM msgs_msg WHERE contact_id = $1`, contactID); err != nil {
+		return 0, errors.Wrapf(err, "error loading attachments for contact %d", contactID)
+	}
+
+	// our attachments are stored under the org's directory in the attachments prefix
+	orgPrefix := path.Join("/", rt.Config().S3AttachmentsPrefix, fmt.Sprintf("%d", orgID)) + "/"
+
+	erased := 0
+	for _, attachment := range attachments {
+		contentType, attURL, found := strings.Cut(attachment, ":")
+		if !found {
+			continue
+		}
+		u, err := url.Parse(attURL)
+		if err != nil || !strings.HasPrefix(u.Path, orgPrefix) {
+			continue
+		}
+		if _, err := rt.AttachmentStorage.Put(ctx, u.Path, contentType, []byte{}); err != nil {
+			return 0, errors.Wrapf(err, "error overwriting attachment: %s", attURL)
+		}
+		erased++
+	}
+	return erased, nil
+}
+
+// escapes the special characters in a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
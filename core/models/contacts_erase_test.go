@@ -0,0 +1,107 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEraseContact(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	// give Cathy a session with its output in storage
+	outputPath := "/orgs/1/c/6393/6393abc0-283d-4c9b-a1b3-641a035c34bf/20221201T120000.000Z_session_9b6c5ab4-2e1c-4b4c-8bdc-1b8f2f7d2d9c_123.json"
+	_, err := rt.SessionStorage.Put(ctx, outputPath, "application/json", []byte(`{"contact": {"name": "Cathy"}}`))
+	require.NoError(t, err)
+
+	sessionID := testdata.InsertWaitingSession(db, testdata.Org1, testdata.Cathy, models.FlowTypeMessaging, testdata.Favorites, models.NilCallID, time.Now(), time.Now().Add(time.Hour), true, nil)
+	testdata.InsertFlowRun(db, testdata.Org1, sessionID, testdata.Cathy, testdata.Favorites, models.RunStatusWaiting)
+	db.MustExec(`UPDATE flows_flowsession SET output = NULL, output_url = $2 WHERE id = $1`, sessionID, "https://mailroom-sessions.s3.us-east-1.amazonaws.com"+outputPath)
+	db.MustExec(`UPDATE flows_flowrun SET results = '{"name": {"value": "Cathy"}}' WHERE session_id = $1`, sessionID)
+
+	// and some messages, one with an attachment of ours and one with someone else's
+	attachmentPath := "/attachments/1/5f3c/5f3c6c8e-7a2d-4a07-8bfc-9a7c2d5dc7a1.jpg"
+	_, err = rt.AttachmentStorage.Put(ctx, attachmentPath, "image/jpeg", []byte(`JPEG`))
+	require.NoError(t, err)
+
+	testdata.InsertIncomingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "My secret", models.MsgStatusHandled)
+	testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "Thanks", []utils.Attachment{
+		utils.Attachment("image/jpeg:https://mailroom-attachments.s3.us-east-1.amazonaws.com" + attachmentPath),
+		utils.Attachment("image/jpeg:https://example.com/cat.jpg"),
+	}, models.MsgStatusSent, false)
+	testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "Hi Bob", nil, models.MsgStatusSent, false)
+
+	db.MustExec(`INSERT INTO channels_channellog(uuid, channel_id, msg_id, log_type, http_logs, errors, is_error, elapsed_ms, created_on)
+	              SELECT gen_random_uuid(), $1, id, 'msg_send', '[]', '[]', FALSE, 10, NOW() FROM msgs_msg WHERE contact_id = $2 OR contact_id = $3`, testdata.TwilioChannel.ID, testdata.Cathy.ID, testdata.Bob.ID)
+
+	// webhook calls with Cathy's URN, with Bob's and with a URN which starts with Cathy's
+	insertLog := `INSERT INTO request_logs_httplog(log_type, org_id, flow_id, url, status_code, request, response, is_error, request_time, num_retries, created_on)
+	              VALUES('webhook_called', 1, $1, 'http://example.com', 200, $2, 'OK', FALSE, 10, 0, NOW())`
+	db.MustExec(insertLog, testdata.Favorites.ID, `POST / HTTP/1.1\r\n\r\n{"urn": "tel:+16055741111"}`)
+	db.MustExec(insertLog, testdata.Favorites.ID, `POST / HTTP/1.1\r\n\r\n{"urn": "tel:+16055741222"}`)
+	db.MustExec(insertLog, testdata.Favorites.ID, `POST / HTTP/1.1\r\n\r\n{"urn": "tel:+160557411119"}`)
+
+	testdata.InsertOpenTicket(db, testdata.Org1, testdata.Cathy, testdata.Mailgun, testdata.DefaultTopic, "Help me", "", time.Now(), nil)
+	testdata.InsertEventFire(db, testdata.Cathy, testdata.RemindersEvent1, time.Now().Add(time.Hour))
+
+	erasure, err := models.EraseContact(ctx, rt, testdata.Org1.ID, testdata.Cathy.ID, testdata.Admin.ID)
+	require.NoError(t, err)
+
+	assert.Equal(t, testdata.Cathy.UUID, erasure.ContactUUID)
+	assert.Equal(t, 1, erasure.Sessions)
+	assert.Equal(t, 1, erasure.SessionOutputs)
+	assert.Equal(t, 1, erasure.Runs)
+	assert.Equal(t, 2, erasure.Msgs)
+	assert.Equal(t, 1, erasure.Attachments)
+	assert.Equal(t, 2, erasure.ChannelLogs)
+	assert.Equal(t, 1, erasure.HTTPLogs)
+	assert.Equal(t, 1, erasure.Tickets)
+	assert.Equal(t, 1, erasure.EventFires)
+	assert.Equal(t, 1, erasure.URNs)
+	assert.Contains(t, erasure.StorageNote, "versioning")
+
+	// stored content has been overwritten
+	_, output, err := rt.SessionStorage.Get(ctx, outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, `{}`, string(output))
+
+	_, attachment, err := rt.AttachmentStorage.Get(ctx, attachmentPath)
+	require.NoError(t, err)
+	assert.Equal(t, ``, string(attachment))
+
+	// and what's in the database has been erased
+	assertdb.Query(t, db, `SELECT status FROM flows_flowsession WHERE id = $1`, sessionID).Returns("I")
+	assertdb.Query(t, db, `SELECT results FROM flows_flowrun WHERE session_id = $1`, sessionID).Returns("{}")
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE contact_id = $1 AND (text != '' OR attachments IS NOT NULL)`, testdata.Cathy.ID).Returns(0)
+	assertdb.Query(t, db, `SELECT count(*) FROM request_logs_httplog WHERE request LIKE '%"tel:+16055741111"%'`).Returns(0)
+	assertdb.Query(t, db, `SELECT body FROM tickets_ticket WHERE contact_id = $1`, testdata.Cathy.ID).Returns("")
+	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE contact_id = $1`, testdata.Cathy.ID).Returns(0)
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contacturn WHERE identity = $1`, testdata.Cathy.URN).Returns(0)
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contactgroup_contacts WHERE contact_id = $1`, testdata.Cathy.ID).Returns(0)
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contact WHERE id = $1 AND name IS NULL AND fields = '{}' AND is_active = FALSE`, testdata.Cathy.ID).Returns(1)
+
+	// Bob is untouched
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE contact_id = $1 AND text = 'Hi Bob'`, testdata.Bob.ID).Returns(1)
+	assertdb.Query(t, db, `SELECT count(*) FROM channels_channellog l JOIN msgs_msg m ON m.id = l.msg_id WHERE m.contact_id = $1 AND m.text = 'Hi Bob'`, testdata.Bob.ID).Returns(1)
+	assertdb.Query(t, db, `SELECT count(*) FROM request_logs_httplog WHERE request LIKE '%+16055741222%'`).Returns(1)
+	assertdb.Query(t, db, `SELECT count(*) FROM request_logs_httplog WHERE request LIKE '%+160557411119%'`).Returns(1)
+
+	// and we have an audit record
+	_, audit, err := rt.SessionStorage.Get(ctx, erasure.StoragePath(rt.Config()))
+	require.NoError(t, err)
+	assert.Equal(t, string(jsonx.MustMarshal(erasure)), string(audit))
+
+	// erasing a contact from another org is an error
+	_, err = models.EraseContact(ctx, rt, testdata.Org2.ID, testdata.Bob.ID, testdata.Admin.ID)
+	assert.EqualError(t, err, "error loading contact 10001: sql: no rows in result set")
+}
@@ -0,0 +1,201 @@
+package models
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/modifiers"
+	"github.com/nyaruka/mailroom/core/goflow"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+)
+
+// MergePrecedence decides whose value is kept when both contacts in a merge have a name, language or field value
+type MergePrecedence string
+
+// merge precedence constants
+const (
+	MergePrecedenceContact   = MergePrecedence("contact")
+	MergePrecedenceDuplicate = MergePrecedence("duplicate")
+)
+
+// MergeContacts merges the duplicate contact into the given contact. The duplicate's URNs are moved to the contact,
+// its name, language and field values are combined with the contact's according to the given precedence, and the
+// contact is added to its groups. Its messages, runs, tickets and campaign fires are reassigned to the contact, its
+// sessions are interrupted and it's released. This all happens in a single transaction, and the events of the
+// modifiers applied to the contact are returned.
+func MergeContacts(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, userID UserID, contact, duplicate *Contact, precedence MergePrecedence) (*flows.Contact, []flows.Event, error) {
+	flowContact, err := contact.FlowContact(oa)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error creating flow contact for contact %d", contact.ID())
+	}
+	flowDuplicate, err := duplicate.FlowContact(oa)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error creating flow contact for contact %d", duplicate.ID())
+	}
+
+	env := flows.NewEnvironment(oa.Env(), oa.SessionAssets().Locations())
+	svcs := goflow.Engine(rt.Config()).Services()
+
+	evts := make([]flows.Event, 0)
+	for _, mod := range mergeModifiers(oa, flowContact, flowDuplicate, precedence) {
+		modifiers.Apply(env, svcs, oa.SessionAssets(), flowContact, mod, func(e flows.Event) { evts = append(evts, e) })
+	}
+
+	scene := NewSceneForContact(flowContact, userID)
+
+	tx, err := rt.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error beginning transaction")
+	}
+
+	if err := mergeContacts(ctx, rt, tx, oa, scene, evts, contact.ID(), duplicate.ID()); err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, errors.Wrapf(err, "error committing contact merge")
+	}
+
+	// begin the transaction for post-commit hooks
+	tx, err = rt.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error beginning transaction for post commit")
+	}
+
+	if err := ApplyEventPostCommitHooks(ctx, rt, tx, oa, []*Scene{scene}); err != nil {
+		tx.Rollback()
+		return nil, nil, errors.Wrapf(err, "error applying post commit hooks")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, errors.Wrapf(err, "error committing post commit hooks")
+	}
+
+	return flowContact, evts, nil
+}
+
+func mergeContacts(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *OrgAssets, scene *Scene, evts []flows.Event, contactID, duplicateID ContactID) error {
+	if err := InterruptSessionsForContactsTx(ctx, tx, []ContactID{duplicateID}); err != nil {
+		return errors.Wrapf(err, "error interrupting sessions for contact %d", duplicateID)
+	}
+
+	for _, sql := range sqlReassignContactHistory {
+		if _, err := tx.ExecContext(ctx, sql, duplicateID, contactID); err != nil {
+			return errors.Wrapf(err, "error reassigning history of contact %d", duplicateID)
+		}
+	}
+
+	// handle the modifier events which moves the URNs and saves the field and group changes
+	if err := HandleEvents(ctx, rt, tx, oa, scene, evts); err != nil {
+		return errors.Wrapf(err, "error handling merge events")
+	}
+	if err := ApplyEventPreCommitHooks(ctx, rt, tx, oa, []*Scene{scene}); err != nil {
+		return errors.Wrapf(err, "error applying pre commit hooks")
+	}
+
+	// smart groups can depend on things that aren't modifiers, like tickets, so recalculate from what's now saved
+	merged, err := LoadContact(ctx, tx, oa, contactID)
+	if err != nil {
+		return errors.Wrapf(err, "error reloading contact %d", contactID)
+	}
+	flowMerged, err := merged.FlowContact(oa)
+	if err != nil {
+		return errors.Wrapf(err, "error creating flow contact for contact %d", contactID)
+	}
+	if err := CalculateDynamicGroups(ctx, tx, oa, []*flows.Contact{flowMerged}); err != nil {
+		return errors.Wrapf(err, "error recalculating groups for contact %d", contactID)
+	}
+
+	// campaign fires go last because recalculating groups clears unfired fires
+	if _, err := tx.ExecContext(ctx, sqlReassignEventFires, duplicateID, contactID); err != nil {
+		return errors.Wrapf(err, "error reassigning campaign fires of contact %d", duplicateID)
+	}
+
+	if err := releaseContact(ctx, tx, duplicateID); err != nil {
+		return err
+	}
+
+	return UpdateContactModifiedOn(ctx, tx, []ContactID{contactID})
+}
+
+// builds the modifiers which give the contact the URNs, groups and, where they take precedence, the name, language
+// and field values of the duplicate
+func mergeModifiers(oa *OrgAssets, contact, duplicate *flows.Contact, precedence MergePrecedence) []flows.Modifier {
+	mods := make([]flows.Modifier, 0)
+	takeDuplicate := func(current, other bool) bool {
+		return other && (!current || precedence == MergePrecedenceDuplicate)
+	}
+
+	// URNs are added without their ids so that they're moved rather than updated in place
+	if len(duplicate.URNs()) > 0 {
+		urnz := make([]urns.URN, 0, len(duplicate.URNs()))
+		for _, u := range duplicate.URNs() {
+			urn, _ := urns.NewURNFromParts(u.URN().Scheme(), u.URN().Path(), "", u.URN().Display())
+			urnz = append(urnz, urn)
+		}
+		mods = append(mods, modifiers.NewURNs(urnz, modifiers.URNsAppend))
+	}
+
+	if takeDuplicate(contact.Name() != "", duplicate.Name() != "") {
+		mods = append(mods, modifiers.NewName(duplicate.Name()))
+	}
+	if takeDuplicate(contact.Language() != "", duplicate.Language() != "") {
+		mods = append(mods, modifiers.NewLanguage(duplicate.Language()))
+	}
+
+	for _, field := range oa.SessionAssets().Fields().All() {
+		value := duplicate.Fields().Get(field)
+		if takeDuplicate(contact.Fields().Get(field) != nil, value != nil) {
+			mods = append(mods, modifiers.NewField(field, value.Text.Native()))
+		}
+	}
+
+	// smart groups are recalculated rather than copied
+	groups := make([]*flows.Group, 0)
+	for _, group := range duplicate.Groups().All() {
+		if !group.UsesQuery() {
+			groups = append(groups, group)
+		}
+	}
+	if len(groups) > 0 {
+		mods = append(mods, modifiers.NewGroups(groups, modifiers.GroupsAdd))
+	}
+
+	return mods
+}
+
+var sqlReassignContactHistory = []string{
+	`UPDATE msgs_msg SET contact_id = $2 WHERE contact_id = $1`,
+	`UPDATE flows_flowrun SET contact_id = $2 WHERE contact_id = $1`,
+	`UPDATE tickets_ticket SET contact_id = $2 WHERE contact_id = $1`,
+	`UPDATE tickets_ticketevent SET contact_id = $2 WHERE contact_id = $1`,
+}
+
+// fired fires are history and are all reassigned, but unfired fires are only reassigned for events the contact
+// doesn't already have a fire for
+const sqlReassignEventFires = `
+UPDATE campaigns_eventfire f
+   SET contact_id = $2
+ WHERE f.contact_id = $1 AND (f.fired IS NOT NULL OR NOT EXISTS (
+	SELECT 1 FROM campaigns_eventfire o WHERE o.contact_id = $2 AND o.event_id = f.event_id AND o.fired IS NULL
+))`
+
+// releases a contact which has been merged into another, removing what's left of its state
+func releaseContact(ctx context.Context, db Queryer, contactID ContactID) error {
+	if err := DeleteUnfiredContactEvents(ctx, db, []ContactID{contactID}); err != nil {
+		return err
+	}
+
+	if _, err := db.ExecContext(ctx, `DELETE FROM contacts_contactgroup_contacts WHERE contact_id = $1`, contactID); err != nil {
+		return errors.Wrapf(err, "error removing contact %d from groups", contactID)
+	}
+
+	if _, err := db.ExecContext(ctx, `UPDATE contacts_contact SET is_active = FALSE, modified_on = NOW() WHERE id = $1`, contactID); err != nil {
+		return errors.Wrapf(err, "error releasing contact %d", contactID)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/goflow/flows"
+	_ "github.com/nyaruka/mailroom/core/handlers"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeContacts(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	// Cathy has a gender, Bob has a gender and an age
+	db.MustExec(`UPDATE contacts_contact SET fields = '{"3a5891e4-756e-4dc9-8e12-b7a766168824": {"text": "F"}}' WHERE id = $1`, testdata.Cathy.ID)
+	db.MustExec(`UPDATE contacts_contact SET fields = '{"3a5891e4-756e-4dc9-8e12-b7a766168824": {"text": "M"}, "903f51da-2717-47c7-a0d3-f2f32877013d": {"text": "40", "number": 40}}' WHERE id = $1`, testdata.Bob.ID)
+	db.MustExec(`DELETE FROM contacts_contactgroup_contacts WHERE contact_id = $1 OR contact_id = $2`, testdata.Cathy.ID, testdata.Bob.ID)
+	db.MustExec(`INSERT INTO contacts_contactgroup_contacts(contact_id, contactgroup_id) VALUES($1, $2)`, testdata.Bob.ID, testdata.TestersGroup.ID)
+
+	// give Bob some history
+	testdata.InsertIncomingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "Hi", models.MsgStatusHandled)
+	sessionID := testdata.InsertWaitingSession(db, testdata.Org1, testdata.Bob, models.FlowTypeMessaging, testdata.Favorites, models.NilCallID, time.Now(), time.Now().Add(time.Hour), true, nil)
+	testdata.InsertFlowRun(db, testdata.Org1, sessionID, testdata.Bob, testdata.Favorites, models.RunStatusWaiting)
+	testdata.InsertOpenTicket(db, testdata.Org1, testdata.Bob, testdata.Mailgun, testdata.DefaultTopic, "Help", "", time.Now(), nil)
+	testdata.InsertEventFire(db, testdata.Bob, testdata.RemindersEvent1, time.Now().Add(time.Hour))
+
+	models.FlushCache()
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	cathy, err := models.LoadContact(ctx, db, oa, testdata.Cathy.ID)
+	require.NoError(t, err)
+	bob, err := models.LoadContact(ctx, db, oa, testdata.Bob.ID)
+	require.NoError(t, err)
+
+	merged, evts, err := models.MergeContacts(ctx, rt, oa, testdata.Admin.ID, cathy, bob, models.MergePrecedenceContact)
+	require.NoError(t, err)
+
+	// Cathy keeps her own gender but gets Bob's age, URN and group
+	assert.Equal(t, "F", merged.Fields().Get(oa.SessionAssets().Fields().Get("gender")).Text.Native())
+	assert.Equal(t, "40", merged.Fields().Get(oa.SessionAssets().Fields().Get("age")).Text.Native())
+	assert.Equal(t, 2, len(merged.URNs()))
+	assert.NotNil(t, merged.Groups().FindByUUID(testdata.TestersGroup.UUID))
+
+	eventTypes := make([]string, len(evts))
+	for i, e := range evts {
+		eventTypes[i] = e.Type()
+	}
+	assert.Contains(t, eventTypes, "contact_urns_changed")
+	assert.Contains(t, eventTypes, "contact_field_changed")
+	assert.Contains(t, eventTypes, "contact_groups_changed")
+
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contacturn WHERE contact_id = $1`, testdata.Cathy.ID).Returns(2)
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contacturn WHERE contact_id = $1`, testdata.Bob.ID).Returns(0)
+	assertdb.Query(t, db, `SELECT fields->$2->>'text' FROM contacts_contact WHERE id = $1`, testdata.Cathy.ID, testdata.GenderField.UUID).Returns("F")
+	assertdb.Query(t, db, `SELECT fields->$2->>'text' FROM contacts_contact WHERE id = $1`, testdata.Cathy.ID, testdata.AgeField.UUID).Returns("40")
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contactgroup_contacts WHERE contact_id = $1 AND contactgroup_id = $2`, testdata.Cathy.ID, testdata.TestersGroup.ID).Returns(1)
+
+	// Bob's history now belongs to Cathy
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE contact_id = $1`, testdata.Bob.ID).Returns(0)
+	assertdb.Query(t, db, `SELECT count(*) FROM flows_flowrun WHERE contact_id = $1`, testdata.Bob.ID).Returns(0)
+	assertdb.Query(t, db, `SELECT count(*) FROM tickets_ticket WHERE contact_id = $1`, testdata.Bob.ID).Returns(0)
+	assertdb.Query(t, db, `SELECT count(*) FROM tickets_ticket WHERE contact_id = $1 AND status = 'O'`, testdata.Cathy.ID).Returns(1)
+	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE contact_id = $1`, testdata.Bob.ID).Returns(0)
+	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE contact_id = $1 AND event_id = $2`, testdata.Cathy.ID, testdata.RemindersEvent1.ID).Returns(1)
+
+	// and Bob has been interrupted and released
+	assertdb.Query(t, db, `SELECT status FROM flows_flowsession WHERE id = $1`, sessionID).Returns("I")
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contact WHERE id = $1 AND is_active = FALSE`, testdata.Bob.ID).Returns(1)
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contactgroup_contacts WHERE contact_id = $1`, testdata.Bob.ID).Returns(0)
+
+	// check taking the duplicate's values instead
+	cathy, err = models.LoadContact(ctx, db, oa, testdata.Cathy.ID)
+	require.NoError(t, err)
+
+	db.MustExec(`UPDATE contacts_contact SET fields = '{"3a5891e4-756e-4dc9-8e12-b7a766168824": {"text": "X"}}' WHERE id = $1`, testdata.George.ID)
+
+	george, err := models.LoadContact(ctx, db, oa, testdata.George.ID)
+	require.NoError(t, err)
+
+	merged, _, err = models.MergeContacts(ctx, rt, oa, testdata.Admin.ID, cathy, george, models.MergePrecedenceDuplicate)
+	require.NoError(t, err)
+
+	assert.Equal(t, "X", merged.Fields().Get(oa.SessionAssets().Fields().Get("gender")).Text.Native())
+	assert.Equal(t, "40", merged.Fields().Get(oa.SessionAssets().Fields().Get("age")).Text.Native())
+	assert.Equal(t, flows.ContactStatusActive, merged.Status())
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contacturn WHERE contact_id = $1`, testdata.Cathy.ID).Returns(3)
+}
@@ -449,6 +449,20 @@ func TestGetContactIDsFromReferences(t *testing.T) {
 	assert.ElementsMatch(t, []models.ContactID{testdata.Cathy.ID, testdata.Bob.ID}, ids)
 }
 
+func TestGetPreferredChannelIDs(t *testing.T) {
+	ctx, _, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	db.MustExec(`UPDATE contacts_contacturn SET channel_id = $2 WHERE contact_id = $1`, testdata.Cathy.ID, testdata.TwilioChannel.ID)
+	db.MustExec(`UPDATE contacts_contacturn SET channel_id = NULL WHERE contact_id = $1`, testdata.Bob.ID)
+	db.MustExec(`DELETE FROM contacts_contacturn WHERE contact_id = $1`, testdata.George.ID)
+
+	channelIDs, err := models.GetPreferredChannelIDs(ctx, db, []models.ContactID{testdata.Cathy.ID, testdata.Bob.ID, testdata.George.ID})
+	require.NoError(t, err)
+	assert.Equal(t, map[models.ContactID]models.ChannelID{testdata.Cathy.ID: testdata.TwilioChannel.ID, testdata.Bob.ID: models.NilChannelID}, channelIDs)
+}
+
 func TestStopContact(t *testing.T) {
 	ctx, _, db, _ := testsuite.Get()
 
@@ -2,6 +2,7 @@ package models
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/nyaruka/goflow/flows"
@@ -9,7 +10,9 @@ import (
 	"github.com/nyaruka/goflow/flows/modifiers"
 	"github.com/nyaruka/mailroom/core/goflow"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/tracing"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Scene represents the context that events are occurring in
@@ -151,7 +154,7 @@ func ApplyEventPreCommitHooks(ctx context.Context, rt *runtime.Runtime, tx *sqlx
 
 	// now fire each of our hooks
 	for hook, args := range preHooks {
-		err := hook.Apply(ctx, rt, tx, oa, args)
+		err := applyHook(ctx, rt, tx, oa, hook, args, "pre")
 		if err != nil {
 			return errors.Wrapf(err, "error applying pre commit hook: %T", hook)
 		}
@@ -177,7 +180,7 @@ func ApplyEventPostCommitHooks(ctx context.Context, rt *runtime.Runtime, tx *sql
 
 	// now fire each of our hooks
 	for hook, args := range postHooks {
-		err := hook.Apply(ctx, rt, tx, oa, args)
+		err := applyHook(ctx, rt, tx, oa, hook, args, "post")
 		if err != nil {
 			return errors.Wrapf(err, "error applying post commit hook: %v", hook)
 		}
@@ -186,8 +189,23 @@ func ApplyEventPostCommitHooks(ctx context.Context, rt *runtime.Runtime, tx *sql
 	return nil
 }
 
+// applies a single commit hook inside its own span so that slow hooks stand out in traces
+func applyHook(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *OrgAssets, hook EventCommitHook, args map[*Scene][]interface{}, stage string) error {
+	ctx, span := tracing.Start(ctx, fmt.Sprintf("%s commit hook %T", stage, hook), attribute.Int("mailroom.scenes", len(args)))
+	err := hook.Apply(ctx, rt, tx, oa, args)
+	tracing.End(span, err)
+	return err
+}
+
 // HandleAndCommitEvents takes a set of contacts and events, handles the events and applies any hooks, and commits everything
 func HandleAndCommitEvents(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, userID UserID, contactEvents map[*flows.Contact][]flows.Event) error {
+	ctx, span := tracing.Start(ctx, "handle and commit events", attribute.Int("mailroom.contacts", len(contactEvents)))
+	err := handleAndCommitEvents(ctx, rt, oa, userID, contactEvents)
+	tracing.End(span, err)
+	return err
+}
+
+func handleAndCommitEvents(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, userID UserID, contactEvents map[*flows.Contact][]flows.Event) error {
 	// create scenes for each contact
 	scenes := make([]*Scene, 0, len(contactEvents))
 	for contact := range contactEvents {
@@ -195,48 +213,48 @@ func HandleAndCommitEvents(ctx context.Context, rt *runtime.Runtime, oa *OrgAsse
 		scenes = append(scenes, scene)
 	}
 
-	// begin the transaction for pre-commit hooks
-	tx, err := rt.DB.BeginTxx(ctx, nil)
-	if err != nil {
-		return errors.Wrapf(err, "error beginning transaction")
-	}
-
-	// handle the events to create the hooks on each scene
-	for _, scene := range scenes {
-		err := HandleEvents(ctx, rt, tx, oa, scene, contactEvents[scene.Contact()])
-		if err != nil {
-			return errors.Wrapf(err, "error applying events")
+	// handle the events and apply the pre commit hooks in one transaction
+	err := commitInTx(ctx, rt, "pre", func(ctx context.Context, tx *sqlx.Tx) error {
+		// handle the events to create the hooks on each scene
+		for _, scene := range scenes {
+			err := HandleEvents(ctx, rt, tx, oa, scene, contactEvents[scene.Contact()])
+			if err != nil {
+				return errors.Wrapf(err, "error applying events")
+			}
 		}
-	}
 
-	// gather all our pre commit events, group them by hook and apply them
-	err = ApplyEventPreCommitHooks(ctx, rt, tx, oa, scenes)
+		// gather all our pre commit events, group them by hook and apply them
+		return errors.Wrapf(ApplyEventPreCommitHooks(ctx, rt, tx, oa, scenes), "error applying pre commit hooks")
+	})
 	if err != nil {
-		return errors.Wrapf(err, "error applying pre commit hooks")
+		return err
 	}
 
-	// commit the transaction
-	if err := tx.Commit(); err != nil {
-		return errors.Wrapf(err, "error committing pre commit hooks")
-	}
+	// and apply the post commit hooks in another
+	return commitInTx(ctx, rt, "post", func(ctx context.Context, tx *sqlx.Tx) error {
+		return errors.Wrapf(ApplyEventPostCommitHooks(ctx, rt, tx, oa, scenes), "error applying post commit hooks")
+	})
+}
 
-	// begin the transaction for post-commit hooks
-	tx, err = rt.DB.BeginTxx(ctx, nil)
-	if err != nil {
-		return errors.Wrapf(err, "error beginning transaction for post commit")
-	}
+// runs the passed in function in a new transaction which is committed if it succeeds, inside a span which covers the
+// whole transaction so that time spent waiting on the database stands out in traces
+func commitInTx(ctx context.Context, rt *runtime.Runtime, stage string, fn func(context.Context, *sqlx.Tx) error) error {
+	ctx, span := tracing.Start(ctx, fmt.Sprintf("%s commit transaction", stage), attribute.String("db.system", "postgresql"))
+	err := func() error {
+		tx, err := rt.DB.BeginTxx(ctx, nil)
+		if err != nil {
+			return errors.Wrapf(err, "error beginning %s commit transaction", stage)
+		}
 
-	// apply the post commit hooks
-	err = ApplyEventPostCommitHooks(ctx, rt, tx, oa, scenes)
-	if err != nil {
-		return errors.Wrapf(err, "error applying post commit hooks")
-	}
+		if err := fn(ctx, tx); err != nil {
+			tx.Rollback()
+			return err
+		}
 
-	// commit the transaction
-	if err := tx.Commit(); err != nil {
-		return errors.Wrapf(err, "error committing post commit hooks")
-	}
-	return nil
+		return errors.Wrapf(tx.Commit(), "error committing %s commit hooks", stage)
+	}()
+	tracing.End(span, err)
+	return err
 }
 
 // ApplyModifiers modifies contacts by applying modifiers and handling the resultant events
@@ -246,7 +264,7 @@ func ApplyModifiers(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, use
 	// create an environment instance with location support
 	env := flows.NewEnvironment(oa.Env(), oa.SessionAssets().Locations())
 
-	svcs := goflow.Engine(rt.Config).Services()
+	svcs := goflow.Engine(rt.Config()).Services()
 
 	eventsByContact := make(map[*flows.Contact][]flows.Event, len(modifiersByContact))
 
@@ -103,7 +103,7 @@ func TestLoadFlows(t *testing.T) {
 		assert.Equal(t, tc.expectedIVRRetry, dbFlow.IVRRetryWait(), "db IVR retry mismatch for %s", desc)
 
 		// load as engine flow and check that too
-		flow, err := goflow.ReadFlow(rt.Config, dbFlow.Definition())
+		flow, err := goflow.ReadFlow(rt.Config(), dbFlow.Definition())
 		assert.NoError(t, err, "read flow failed for %s", desc)
 
 		assert.Equal(t, tc.uuid, flow.UUID(), "engine UUID mismatch for %s", desc)
@@ -161,7 +161,7 @@ type WebhookNode struct {
 func (n *WebhookNode) Record(rt *runtime.Runtime, events []*events.WebhookCalledEvent) error {
 	numHealthy, numUnhealthy := 0, 0
 	for _, e := range events {
-		if e.ElapsedMS <= rt.Config.WebhooksHealthyResponseLimit {
+		if e.ElapsedMS <= rt.Config().WebhooksHealthyResponseLimit {
 			numHealthy++
 		} else {
 			numUnhealthy++
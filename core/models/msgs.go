@@ -12,6 +12,7 @@ import (
 	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/gocommon/gsm7"
 	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/goflow/excellent"
@@ -145,6 +146,7 @@ type Msg struct {
 		SessionID     SessionID             `json:"session_id,omitempty"`
 		SessionStatus SessionStatus         `json:"session_status,omitempty"`
 		Flow          *assets.FlowReference `json:"flow,omitempty"`
+		TraceID       string                `json:"trace_id,omitempty"`
 
 		// These fields are set on the last outgoing message in a session's sprint. In the case
 		// of the session being at a wait with a timeout then the timeout will be set. It is up to
@@ -185,6 +187,10 @@ func (m *Msg) FlowID() FlowID                   { return m.m.FlowID }
 func (m *Msg) ContactID() ContactID             { return m.m.ContactID }
 func (m *Msg) ContactURNID() *URNID             { return m.m.ContactURNID }
 func (m *Msg) IsResend() bool                   { return m.m.IsResend }
+func (m *Msg) TraceID() string                  { return m.m.TraceID }
+
+// SetTraceID sets the ID of the trace this message was created in, so that courier can continue it when sending
+func (m *Msg) SetTraceID(traceID string) { m.m.TraceID = traceID }
 
 func (m *Msg) SetChannel(channel *Channel) {
 	m.channel = channel
@@ -400,7 +406,7 @@ func newOutgoingMsg(rt *runtime.Runtime, org *Org, channel *Channel, contact *fl
 	// if we have attachments, add them
 	if len(out.Attachments()) > 0 {
 		for _, a := range out.Attachments() {
-			m.Attachments = append(m.Attachments, string(NormalizeAttachment(rt.Config, a)))
+			m.Attachments = append(m.Attachments, string(NormalizeAttachment(rt.Config(), a)))
 		}
 	}
 
@@ -696,6 +702,7 @@ type Broadcast struct {
 		CreatedByID   UserID                                  `json:"created_by_id,omitempty" db:"created_by_id"`
 		ParentID      BroadcastID                             `json:"parent_id,omitempty"     db:"parent_id"`
 		TicketID      TicketID                                `json:"ticket_id,omitempty"     db:"ticket_id"`
+		PacePerSecond int                                     `json:"pace_per_second,omitempty"` // optional limit on messages per second per channel
 	}
 }
 
@@ -709,6 +716,17 @@ func (b *Broadcast) BaseLanguage() envs.Language                           { ret
 func (b *Broadcast) Translations() map[envs.Language]*BroadcastTranslation { return b.b.Translations }
 func (b *Broadcast) TemplateState() TemplateState                          { return b.b.TemplateState }
 func (b *Broadcast) TicketID() TicketID                                    { return b.b.TicketID }
+func (b *Broadcast) PacePerSecond() int                                    { return b.b.PacePerSecond }
+
+// BatchInterval returns how far apart batches of the given number of contacts should be released to keep to the pace
+// of this broadcast, or zero if it isn't paced. The pace applies to each channel, so this is the interval between the
+// batches of contacts who will be sent to through the same channel.
+func (b *Broadcast) BatchInterval(batchSize int) time.Duration {
+	if b.b.PacePerSecond <= 0 {
+		return 0
+	}
+	return time.Duration(batchSize) * time.Second / time.Duration(b.b.PacePerSecond)
+}
 
 func (b *Broadcast) MarshalJSON() ([]byte, error)    { return json.Marshal(b.b) }
 func (b *Broadcast) UnmarshalJSON(data []byte) error { return json.Unmarshal(data, &b.b) }
@@ -912,6 +930,67 @@ type BroadcastBatch struct {
 	OrgID         OrgID                                   `json:"org_id"`
 	CreatedByID   UserID                                  `json:"created_by_id"`
 	TicketID      TicketID                                `json:"ticket_id"`
+
+	// the ID of the task which created this batch, which if cancelled means this batch shouldn't be sent
+	TaskID uuids.UUID `json:"task_id,omitempty"`
+}
+
+// ResolveTranslation resolves which translation the given contact should be sent, trying their language if it's
+// allowed by the org, then the org default language, then the broadcast base language. Returns the language of the
+// translation and the translation itself, which is nil if none exist.
+func (b *BroadcastBatch) ResolveTranslation(oa *OrgAssets, contact *flows.Contact) (envs.Language, *BroadcastTranslation) {
+	lang := contact.Language()
+	if lang != envs.NilLanguage {
+		found := false
+		for _, l := range oa.Env().AllowedLanguages() {
+			if l == lang {
+				found = true
+				break
+			}
+		}
+		if !found {
+			lang = envs.NilLanguage
+		}
+	}
+
+	// have a valid contact language, try that
+	if t := b.Translations[lang]; t != nil {
+		return lang, t
+	}
+
+	// not found? try org default language
+	if t := b.Translations[oa.Env().DefaultLanguage()]; t != nil {
+		return oa.Env().DefaultLanguage(), t
+	}
+
+	// not found? use broadcast base language
+	return b.BaseLanguage, b.Translations[b.BaseLanguage]
+}
+
+// RenderText renders the text of the given translation for the given contact, evaluating it as a template unless
+// it's already been evaluated. If evaluation fails, the error is returned along with whatever text was rendered.
+func (b *BroadcastBatch) RenderText(oa *OrgAssets, contact *flows.Contact, t *BroadcastTranslation) (string, error) {
+	template := ""
+
+	// if this is a legacy template, migrate it forward
+	if b.TemplateState == TemplateStateLegacy {
+		template, _ = expressions.MigrateTemplate(t.Text, nil)
+	} else if b.TemplateState == TemplateStateUnevaluated {
+		template = t.Text
+	}
+
+	if template == "" {
+		return t.Text, nil
+	}
+
+	// build up the minimum viable context for templates
+	templateCtx := types.NewXObject(map[string]types.XValue{
+		"contact": flows.Context(oa.Env(), contact),
+		"fields":  flows.Context(oa.Env(), contact.Fields()),
+		"globals": flows.Context(oa.Env(), oa.SessionAssets().Globals()),
+		"urns":    flows.ContextFunc(oa.Env(), contact.URNs().MapContext),
+	})
+	return excellent.EvaluateTemplate(oa.Env(), templateCtx, template, nil)
 }
 
 func (b *BroadcastBatch) CreateMessages(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets) ([]*Msg, error) {
@@ -993,65 +1072,13 @@ func (b *BroadcastBatch) CreateMessages(ctx context.Context, rt *runtime.Runtime
 			return nil, nil
 		}
 
-		// resolve our translations, the order is:
-		//   1) valid contact language
-		//   2) org default language
-		//   3) broadcast base language
-		lang := contact.Language()
-		if lang != envs.NilLanguage {
-			found := false
-			for _, l := range oa.Env().AllowedLanguages() {
-				if l == lang {
-					found = true
-					break
-				}
-			}
-			if !found {
-				lang = envs.NilLanguage
-			}
-		}
-
-		// have a valid contact language, try that
-		trans := b.Translations
-		t := trans[lang]
-
-		// not found? try org default language
+		_, t := b.ResolveTranslation(oa, contact)
 		if t == nil {
-			t = trans[oa.Env().DefaultLanguage()]
-		}
-
-		// not found? use broadcast base language
-		if t == nil {
-			t = trans[b.BaseLanguage]
-		}
-
-		if t == nil {
-			logrus.WithField("base_language", b.BaseLanguage).WithField("translations", trans).Error("unable to find translation for broadcast")
+			logrus.WithField("base_language", b.BaseLanguage).WithField("translations", b.Translations).Error("unable to find translation for broadcast")
 			return nil, nil
 		}
 
-		template := ""
-
-		// if this is a legacy template, migrate it forward
-		if b.TemplateState == TemplateStateLegacy {
-			template, _ = expressions.MigrateTemplate(t.Text, nil)
-		} else if b.TemplateState == TemplateStateUnevaluated {
-			template = t.Text
-		}
-
-		text := t.Text
-
-		// if we have a template, evaluate it
-		if template != "" {
-			// build up the minimum viable context for templates
-			templateCtx := types.NewXObject(map[string]types.XValue{
-				"contact": flows.Context(oa.Env(), contact),
-				"fields":  flows.Context(oa.Env(), contact.Fields()),
-				"globals": flows.Context(oa.Env(), oa.SessionAssets().Globals()),
-				"urns":    flows.ContextFunc(oa.Env(), contact.URNs().MapContext),
-			})
-			text, _ = excellent.EvaluateTemplate(oa.Env(), templateCtx, template, nil)
-		}
+		text, _ := b.RenderText(oa, contact, t)
 
 		// don't do anything if we have no text or attachments
 		if text == "" && len(t.Attachments) == 0 {
@@ -1277,6 +1304,53 @@ func MarkBroadcastSent(ctx context.Context, db Queryer, id BroadcastID) error {
 	return nil
 }
 
+// MarkBroadcastFailed marks the passed in broadcast as failed, e.g. because it was cancelled before all its batches
+// were sent
+func MarkBroadcastFailed(ctx context.Context, db Queryer, id BroadcastID) error {
+	// noop if it is a nil id
+	if id == NilBroadcastID {
+		return nil
+	}
+
+	_, err := db.ExecContext(ctx, `UPDATE msgs_broadcast SET status = 'F', modified_on = now() WHERE id = $1`, id)
+	if err != nil {
+		return errors.Wrapf(err, "error setting broadcast with id %d as failed", id)
+	}
+	return nil
+}
+
+const sqlSelectBroadcast = `
+SELECT ROW_TO_JSON(r) FROM (SELECT
+	b.id AS broadcast_id,
+	(SELECT JSON_OBJECT_AGG(ts.key, ts.value) FROM (SELECT key, JSON_BUILD_OBJECT('text', t.value) AS value FROM each(b.text) t) ts) AS translations,
+	'unevaluated' AS template_state,
+	b.base_language AS base_language,
+	b.org_id AS org_id,
+	b.created_by_id AS created_by_id,
+	b.parent_id AS parent_id,
+	b.ticket_id AS ticket_id,
+	(SELECT ARRAY_AGG(bc.contact_id) FROM msgs_broadcast_contacts bc WHERE bc.broadcast_id = b.id) AS contact_ids,
+	(SELECT ARRAY_AGG(bg.contactgroup_id) FROM msgs_broadcast_groups bg WHERE bg.broadcast_id = b.id) AS group_ids,
+	(SELECT ARRAY_AGG(cu.identity || '?id=' || cu.id) FROM msgs_broadcast_urns bu JOIN contacts_contacturn cu ON cu.id = bu.contacturn_id WHERE bu.broadcast_id = b.id) AS urns
+FROM
+	msgs_broadcast b
+WHERE
+	b.id = $1
+) r`
+
+// GetBroadcastByID loads the broadcast with the passed in id, including its recipients, so that it can be queued again
+func GetBroadcastByID(ctx context.Context, db Queryer, id BroadcastID) (*Broadcast, error) {
+	bcast := &Broadcast{}
+	var data []byte
+	if err := db.GetContext(ctx, &data, sqlSelectBroadcast, id); err != nil {
+		return nil, errors.Wrapf(err, "error loading broadcast #%d", id)
+	}
+	if err := json.Unmarshal(data, &bcast.b); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshalling broadcast #%d", id)
+	}
+	return bcast, nil
+}
+
 // NilID implementations
 
 // MarshalJSON marshals into JSON. 0 values will become null
@@ -560,8 +560,8 @@ func TestGetMsgRepetitions(t *testing.T) {
 func TestNormalizeAttachment(t *testing.T) {
 	_, rt, _, _ := testsuite.Get()
 
-	rt.Config.AttachmentDomain = "foo.bar.com"
-	defer func() { rt.Config.AttachmentDomain = "" }()
+	rt.Config().AttachmentDomain = "foo.bar.com"
+	defer func() { rt.Config().AttachmentDomain = "" }()
 
 	tcs := []struct {
 		raw        string
@@ -575,7 +575,7 @@ func TestNormalizeAttachment(t *testing.T) {
 	}
 
 	for _, tc := range tcs {
-		assert.Equal(t, tc.normalized, string(models.NormalizeAttachment(rt.Config, utils.Attachment(tc.raw))))
+		assert.Equal(t, tc.normalized, string(models.NormalizeAttachment(rt.Config(), utils.Attachment(tc.raw))))
 	}
 }
 
@@ -682,6 +682,42 @@ func TestNonPersistentBroadcasts(t *testing.T) {
 	assertdb.Query(t, db, `SELECT count(*) FROM tickets_ticket WHERE id = $1 AND last_activity_on > $2`, ticket.ID, modelTicket.LastActivityOn()).Returns(1)
 }
 
+func TestBroadcastPacing(t *testing.T) {
+	bcast := &models.Broadcast{}
+	err := json.Unmarshal([]byte(`{"org_id": 1, "translations": {"eng": {"text": "Hi there"}}, "base_language": "eng", "pace_per_second": 20}`), bcast)
+	require.NoError(t, err)
+
+	assert.Equal(t, 20, bcast.PacePerSecond())
+	assert.Equal(t, 5*time.Second, bcast.BatchInterval(100))
+
+	// broadcasts aren't paced by default
+	bcast = models.NewBroadcast(testdata.Org1.ID, models.NilBroadcastID, nil, models.TemplateStateEvaluated, envs.Language("eng"), nil, nil, nil, models.NilTicketID, models.NilUserID)
+	assert.Equal(t, 0, bcast.PacePerSecond())
+	assert.Equal(t, time.Duration(0), bcast.BatchInterval(100))
+}
+
+func TestGetBroadcastByID(t *testing.T) {
+	ctx, _, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	bcastID := testdata.InsertBroadcast(db, testdata.Org1, "eng", map[envs.Language]string{"eng": "Hi there", "fra": "Salut"}, models.NilScheduleID, []*testdata.Contact{testdata.Cathy}, []*testdata.Group{testdata.DoctorsGroup})
+
+	bcast, err := models.GetBroadcastByID(ctx, db, bcastID)
+	require.NoError(t, err)
+	assert.Equal(t, bcastID, bcast.ID())
+	assert.Equal(t, testdata.Org1.ID, bcast.OrgID())
+	assert.Equal(t, envs.Language("eng"), bcast.BaseLanguage())
+	assert.Equal(t, models.TemplateStateUnevaluated, bcast.TemplateState())
+	assert.Equal(t, map[envs.Language]*models.BroadcastTranslation{"eng": {Text: "Hi there"}, "fra": {Text: "Salut"}}, bcast.Translations())
+	assert.Equal(t, []models.ContactID{testdata.Cathy.ID}, bcast.ContactIDs())
+	assert.Equal(t, []models.GroupID{testdata.DoctorsGroup.ID}, bcast.GroupIDs())
+	assert.Nil(t, bcast.URNs())
+
+	_, err = models.GetBroadcastByID(ctx, db, models.BroadcastID(123456))
+	assert.EqualError(t, err, "error loading broadcast #123456: sql: no rows in result set")
+}
+
 func TestNewOutgoingIVR(t *testing.T) {
 	ctx, rt, db, _ := testsuite.Get()
 
@@ -695,7 +731,7 @@ func TestNewOutgoingIVR(t *testing.T) {
 	createdOn := time.Date(2021, 7, 26, 12, 6, 30, 0, time.UTC)
 
 	flowMsg := flows.NewIVRMsgOut(testdata.Cathy.URN, vonage.ChannelReference(), "Hello", "eng", "http://example.com/hi.mp3")
-	dbMsg := models.NewOutgoingIVR(rt.Config, testdata.Org1.ID, conn, flowMsg, createdOn)
+	dbMsg := models.NewOutgoingIVR(rt.Config(), testdata.Org1.ID, conn, flowMsg, createdOn)
 
 	assert.Equal(t, flowMsg.UUID(), dbMsg.UUID())
 	assert.Equal(t, "Hello", dbMsg.Text())
@@ -24,9 +24,11 @@ import (
 	"github.com/nyaruka/goflow/utils/smtpx"
 	"github.com/nyaruka/mailroom/core/goflow"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/tracing"
 	"github.com/nyaruka/null"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Register a airtime service factory with the engine
@@ -39,13 +41,29 @@ func emailServiceFactory(c *runtime.Config) engine.EmailServiceFactory {
 	var emailRetries = smtpx.NewFixedRetries(time.Second*3, time.Second*6)
 
 	return func(sa flows.SessionAssets) (flows.EmailService, error) {
-		return orgFromAssets(sa).EmailService(c, emailRetries)
+		svc, err := orgFromAssets(sa).EmailService(c, emailRetries)
+		if err != nil {
+			return nil, err
+		}
+		return &tracedEmailService{svc}, nil
 	}
 }
 
+// email sends are made over SMTP rather than with our traced HTTP client so we trace them separately
+type tracedEmailService struct {
+	flows.EmailService
+}
+
+func (s *tracedEmailService) Send(addresses []string, subject, body string) error {
+	_, span := tracing.Start(context.Background(), "email send", attribute.Int("mailroom.recipients", len(addresses)))
+	err := s.EmailService.Send(addresses, subject, body)
+	tracing.End(span, err)
+	return err
+}
+
 func airtimeServiceFactory(c *runtime.Config) engine.AirtimeServiceFactory {
 	// give airtime transfers an extra long timeout
-	airtimeHTTPClient := &http.Client{Timeout: time.Duration(120 * time.Second)}
+	airtimeHTTPClient := &http.Client{Transport: tracing.NewTransport(http.DefaultTransport), Timeout: time.Duration(120 * time.Second)}
 	airtimeHTTPRetries := httpx.NewFixedRetries(time.Second*5, time.Second*10)
 
 	return func(sa flows.SessionAssets) (flows.AirtimeService, error) {
@@ -167,7 +185,7 @@ func (o *Org) AirtimeService(httpClient *http.Client, httpRetries *httpx.RetryCo
 
 // StoreAttachment saves an attachment to storage
 func (o *Org) StoreAttachment(ctx context.Context, rt *runtime.Runtime, filename string, contentType string, content io.ReadCloser) (utils.Attachment, error) {
-	prefix := rt.Config.S3AttachmentsPrefix
+	prefix := rt.Config().S3AttachmentsPrefix
 
 	// read the content
 	contentBytes, err := io.ReadAll(content)
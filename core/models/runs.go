@@ -83,6 +83,9 @@ func (r *FlowRun) SetStartID(startID StartID)       { r.r.StartID = startID }
 func (r *FlowRun) UUID() flows.RunUUID              { return r.r.UUID }
 func (r *FlowRun) ModifiedOn() time.Time            { return r.r.ModifiedOn }
 
+// Run returns the engine's run that this run was created from
+func (r *FlowRun) Run() flows.Run { return r.run }
+
 // MarshalJSON is our custom marshaller so that our inner struct get output
 func (r *FlowRun) MarshalJSON() ([]byte, error) {
 	return json.Marshal(r.r)
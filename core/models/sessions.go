@@ -371,7 +371,7 @@ func (s *Session) Update(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx,
 	updateSQL := sqlUpdateSession
 
 	// if writing to S3, do so
-	if rt.Config.SessionStorage == "s3" {
+	if rt.Config().SessionStorage == "s3" {
 		err := WriteSessionOutputsToStorage(ctx, rt, []*Session{s})
 		if err != nil {
 			logrus.WithError(err).Error("error writing session to s3")
@@ -641,7 +641,7 @@ func InsertSessions(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *O
 	insertWaitingSQL := sqlInsertWaitingSession
 
 	// if writing our sessions to S3, do so
-	if rt.Config.SessionStorage == "s3" {
+	if rt.Config().SessionStorage == "s3" {
 		err := WriteSessionOutputsToStorage(ctx, rt, sessions)
 		if err != nil {
 			return nil, errors.Wrapf(err, "error writing sessions to storage")
@@ -803,7 +803,7 @@ func WriteSessionOutputsToStorage(ctx context.Context, rt *runtime.Runtime, sess
 	uploads := make([]*storage.Upload, len(sessions))
 	for i, s := range sessions {
 		uploads[i] = &storage.Upload{
-			Path:        s.StoragePath(rt.Config),
+			Path:        s.StoragePath(rt.Config()),
 			Body:        []byte(s.Output()),
 			ContentType: "application/json",
 		}
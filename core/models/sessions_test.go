@@ -71,7 +71,7 @@ func TestSessionCreationAndUpdating(t *testing.T) {
 	modelContact, _ = testdata.Bob.Load(db, oa)
 	assert.Equal(t, flow.ID, modelContact.CurrentFlowID())
 
-	flowSession, err = session.FlowSession(rt.Config, oa.SessionAssets(), oa.Env())
+	flowSession, err = session.FlowSession(rt.Config(), oa.SessionAssets(), oa.Env())
 	require.NoError(t, err)
 
 	flowSession, sprint2, err := test.ResumeSession(flowSession, sa, "no")
@@ -93,7 +93,7 @@ func TestSessionCreationAndUpdating(t *testing.T) {
 	assert.False(t, session.WaitResumeOnExpire())
 	assert.Nil(t, session.Timeout()) // this wait doesn't have a timeout
 
-	flowSession, err = session.FlowSession(rt.Config, oa.SessionAssets(), oa.Env())
+	flowSession, err = session.FlowSession(rt.Config(), oa.SessionAssets(), oa.Env())
 	require.NoError(t, err)
 
 	flowSession, sprint3, err := test.ResumeSession(flowSession, sa, "yes")
@@ -226,7 +226,7 @@ func TestSessionWithSubflows(t *testing.T) {
 			"status": "W", "session_type": "M", "current_flow_id": int64(child.ID), "responded": false, "ended_on": nil, "wait_resume_on_expire": true,
 		})
 
-	flowSession, err = session.FlowSession(rt.Config, oa.SessionAssets(), oa.Env())
+	flowSession, err = session.FlowSession(rt.Config(), oa.SessionAssets(), oa.Env())
 	require.NoError(t, err)
 
 	flowSession, sprint2, err := test.ResumeSession(flowSession, sa, "yes")
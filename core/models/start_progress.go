@@ -0,0 +1,135 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// the progress of a start through its batches is counted in a hash per start, which is kept long enough for even the
+// slowest of starts to finish
+const (
+	startProgressPattern = "start_progress:%d"
+	startProgressExpiry  = 7 * 24 * 60 * 60
+)
+
+// StartProgress is the progress of a flow start through the batches it was split into
+type StartProgress struct {
+	Batches        int  `json:"batches"`
+	BatchesRun     int  `json:"batches_run"`
+	BatchesSkipped int  `json:"batches_skipped"`
+	Contacts       int  `json:"contacts"`
+	Sessions       int  `json:"sessions"`
+	Errors         int  `json:"errors"`
+	Cancelled      bool `json:"cancelled"`
+
+	// when the last batch of a paced start is due to be released
+	ProjectedEnd *time.Time `json:"projected_end,omitempty"`
+}
+
+func startProgressKey(startID StartID) string {
+	return fmt.Sprintf(startProgressPattern, startID)
+}
+
+// RecordStartBatches records the number of batches the given start has been split into
+func RecordStartBatches(rc redis.Conn, startID StartID, batches int) error {
+	key := startProgressKey(startID)
+
+	rc.Send("multi")
+	rc.Send("hset", key, "batches", batches)
+	rc.Send("expire", key, startProgressExpiry)
+	_, err := rc.Do("exec")
+
+	return errors.Wrapf(err, "error recording batches of start %d", startID)
+}
+
+// RecordStartProjectedEnd records when the last batch of the given paced start is due to be released
+func RecordStartProjectedEnd(rc redis.Conn, startID StartID, projectedEnd time.Time) error {
+	key := startProgressKey(startID)
+
+	rc.Send("multi")
+	rc.Send("hset", key, "projected_end", projectedEnd.Unix())
+	rc.Send("expire", key, startProgressExpiry)
+	_, err := rc.Do("exec")
+
+	return errors.Wrapf(err, "error recording projected end of start %d", startID)
+}
+
+// RecordStartBatchRun records that a batch of the given start was run, how many contacts it had, how many sessions it
+// created and whether it errored
+func RecordStartBatchRun(rc redis.Conn, startID StartID, contacts, sessions int, failed bool) error {
+	key := startProgressKey(startID)
+
+	rc.Send("multi")
+	rc.Send("hincrby", key, "batches_run", 1)
+	rc.Send("hincrby", key, "contacts", contacts)
+	rc.Send("hincrby", key, "sessions", sessions)
+	if failed {
+		rc.Send("hincrby", key, "errors", 1)
+	}
+	rc.Send("expire", key, startProgressExpiry)
+	_, err := rc.Do("exec")
+
+	return errors.Wrapf(err, "error recording batch run of start %d", startID)
+}
+
+// RecordStartBatchSkipped records that a batch of the given start was skipped because the start was cancelled
+func RecordStartBatchSkipped(rc redis.Conn, startID StartID) error {
+	key := startProgressKey(startID)
+
+	rc.Send("multi")
+	rc.Send("hincrby", key, "batches_skipped", 1)
+	rc.Send("expire", key, startProgressExpiry)
+	_, err := rc.Do("exec")
+
+	return errors.Wrapf(err, "error recording skipped batch of start %d", startID)
+}
+
+// CancelStart flags the given start as cancelled so that any of its batches which haven't been run yet are skipped
+func CancelStart(rc redis.Conn, startID StartID) error {
+	key := startProgressKey(startID)
+
+	rc.Send("multi")
+	rc.Send("hset", key, "cancelled", 1)
+	rc.Send("expire", key, startProgressExpiry)
+	_, err := rc.Do("exec")
+
+	return errors.Wrapf(err, "error cancelling start %d", startID)
+}
+
+// IsStartCancelled returns whether the given start has been cancelled
+func IsStartCancelled(rc redis.Conn, startID StartID) (bool, error) {
+	cancelled, err := redis.Bool(rc.Do("hget", startProgressKey(startID), "cancelled"))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	return cancelled, errors.Wrapf(err, "error checking if start %d is cancelled", startID)
+}
+
+// GetStartProgress gets the progress of the given start, or nil if nothing has been recorded for it
+func GetStartProgress(rc redis.Conn, startID StartID) (*StartProgress, error) {
+	values, err := redis.IntMap(rc.Do("hgetall", startProgressKey(startID)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting progress of start %d", startID)
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	progress := &StartProgress{
+		Batches:        values["batches"],
+		BatchesRun:     values["batches_run"],
+		BatchesSkipped: values["batches_skipped"],
+		Contacts:       values["contacts"],
+		Sessions:       values["sessions"],
+		Errors:         values["errors"],
+		Cancelled:      values["cancelled"] == 1,
+	}
+	if projectedEnd, ok := values["projected_end"]; ok {
+		t := time.Unix(int64(projectedEnd), 0).UTC()
+		progress.ProjectedEnd = &t
+	}
+	return progress, nil
+}
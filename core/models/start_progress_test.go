@@ -0,0 +1,60 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartProgress(t *testing.T) {
+	_, _, _, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	progress, err := models.GetStartProgress(rc, 123)
+	assert.NoError(t, err)
+	assert.Nil(t, progress)
+
+	cancelled, err := models.IsStartCancelled(rc, 123)
+	assert.NoError(t, err)
+	assert.False(t, cancelled)
+
+	require.NoError(t, models.RecordStartBatches(rc, 123, 3))
+	require.NoError(t, models.RecordStartBatchRun(rc, 123, 100, 98, false))
+	require.NoError(t, models.RecordStartBatchRun(rc, 123, 100, 0, true))
+
+	progress, err = models.GetStartProgress(rc, 123)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.StartProgress{Batches: 3, BatchesRun: 2, Contacts: 200, Sessions: 98, Errors: 1}, progress)
+
+	require.NoError(t, models.CancelStart(rc, 123))
+	require.NoError(t, models.RecordStartBatchSkipped(rc, 123))
+
+	cancelled, err = models.IsStartCancelled(rc, 123)
+	assert.NoError(t, err)
+	assert.True(t, cancelled)
+
+	progress, err = models.GetStartProgress(rc, 123)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.StartProgress{Batches: 3, BatchesRun: 2, BatchesSkipped: 1, Contacts: 200, Sessions: 98, Errors: 1, Cancelled: true}, progress)
+
+	// paced starts also record when their last batch is due
+	projectedEnd := time.Date(2022, 12, 1, 12, 30, 0, 0, time.UTC)
+	require.NoError(t, models.RecordStartProjectedEnd(rc, 123, projectedEnd))
+
+	progress, err = models.GetStartProgress(rc, 123)
+	assert.NoError(t, err)
+	assert.Equal(t, &projectedEnd, progress.ProjectedEnd)
+
+	// other starts aren't affected
+	cancelled, err = models.IsStartCancelled(rc, 124)
+	assert.NoError(t, err)
+	assert.False(t, cancelled)
+}
@@ -2,8 +2,10 @@ package models
 
 import (
 	"context"
+	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
+	"time"
 
 	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/gocommon/urns"
@@ -40,6 +42,9 @@ const (
 	StartStatusStarting = StartStatus("S")
 	StartStatusComplete = StartStatus("C")
 	StartStatusFailed   = StartStatus("F")
+
+	// a start which was cancelled before all its batches were run, which RapidPro calls interrupted
+	StartStatusCancelled = StartStatus("I")
 )
 
 // MarkStartComplete sets the status for the passed in flow start
@@ -87,6 +92,33 @@ func MarkStartFailed(ctx context.Context, db Queryer, startID StartID) error {
 	return nil
 }
 
+// MarkStartCancelled sets the status for the passed in flow start to I
+func MarkStartCancelled(ctx context.Context, db Queryer, startID StartID) error {
+	_, err := db.ExecContext(ctx, "UPDATE flows_flowstart SET status = 'I', modified_on = NOW() WHERE id = $1", startID)
+	if err != nil {
+		return errors.Wrapf(err, "error setting start as cancelled")
+	}
+	return nil
+}
+
+// GetStartStatus gets the status and contact count of the given flow start, returning ErrNotFound if it doesn't exist
+// in the given org
+func GetStartStatus(ctx context.Context, db Queryer, orgID OrgID, startID StartID) (StartStatus, int, error) {
+	row := &struct {
+		Status       StartStatus `db:"status"`
+		ContactCount null.Int    `db:"contact_count"`
+	}{}
+
+	err := db.GetContext(ctx, row, `SELECT status, contact_count FROM flows_flowstart WHERE id = $1 AND org_id = $2`, startID, orgID)
+	if err == sql.ErrNoRows {
+		return "", 0, ErrNotFound
+	}
+	if err != nil {
+		return "", 0, errors.Wrapf(err, "error getting status of start %d", startID)
+	}
+	return row.Status, int(row.ContactCount), nil
+}
+
 // FlowStartBatch represents a single flow batch that needs to be started
 type FlowStartBatch struct {
 	b struct {
@@ -151,6 +183,8 @@ type FlowStart struct {
 		RestartParticipants bool `json:"restart_participants" db:"restart_participants"`
 		IncludeActive       bool `json:"include_active"       db:"include_active"`
 
+		PacePerMinute int `json:"pace_per_minute,omitempty"` // optional limit on how many contacts are started per minute
+
 		Extra          null.JSON `json:"extra,omitempty"           db:"extra"`
 		ParentSummary  null.JSON `json:"parent_summary,omitempty"  db:"parent_summary"`
 		SessionHistory null.JSON `json:"session_history,omitempty" db:"session_history"`
@@ -211,6 +245,21 @@ func (s *FlowStart) WithCreateContact(create bool) *FlowStart {
 	return s
 }
 
+func (s *FlowStart) PacePerMinute() int { return s.s.PacePerMinute }
+func (s *FlowStart) WithPacePerMinute(pace int) *FlowStart {
+	s.s.PacePerMinute = pace
+	return s
+}
+
+// BatchInterval returns how far apart batches of the given size should be released to keep to the pace of this start,
+// or zero if it isn't paced
+func (s *FlowStart) BatchInterval(batchSize int) time.Duration {
+	if s.s.PacePerMinute <= 0 {
+		return 0
+	}
+	return time.Duration(batchSize) * time.Minute / time.Duration(s.s.PacePerMinute)
+}
+
 func (s *FlowStart) ParentSummary() json.RawMessage { return json.RawMessage(s.s.ParentSummary) }
 func (s *FlowStart) WithParentSummary(sum json.RawMessage) *FlowStart {
 	s.s.ParentSummary = null.JSON(sum)
@@ -242,6 +291,44 @@ func GetFlowStartAttributes(ctx context.Context, db Queryer, startID StartID) (*
 	return start, nil
 }
 
+const sqlSelectFlowStart = `
+SELECT ROW_TO_JSON(r) FROM (SELECT
+	s.id AS start_id,
+	s.uuid AS uuid,
+	s.start_type AS start_type,
+	s.org_id AS org_id,
+	s.created_by_id AS created_by_id,
+	s.flow_id AS flow_id,
+	f.flow_type AS flow_type,
+	(SELECT ARRAY_AGG(sc.contact_id) FROM flows_flowstart_contacts sc WHERE sc.flowstart_id = s.id) AS contact_ids,
+	(SELECT ARRAY_AGG(sg.contactgroup_id) FROM flows_flowstart_groups sg WHERE sg.flowstart_id = s.id) AS group_ids,
+	s.query AS query,
+	s.restart_participants AS restart_participants,
+	s.include_active AS include_active,
+	s.extra AS extra,
+	s.parent_summary AS parent_summary,
+	s.session_history AS session_history
+FROM
+	flows_flowstart s JOIN
+	flows_flow f ON f.id = s.flow_id
+WHERE
+	s.id = $1
+) r`
+
+// GetFlowStartByID loads the flow start with the passed in id, including its contacts and groups, so that it can be
+// queued again
+func GetFlowStartByID(ctx context.Context, db Queryer, startID StartID) (*FlowStart, error) {
+	start := &FlowStart{}
+	var data []byte
+	if err := db.GetContext(ctx, &data, sqlSelectFlowStart, startID); err != nil {
+		return nil, errors.Wrapf(err, "error loading flow start #%d", startID)
+	}
+	if err := json.Unmarshal(data, &start.s); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshalling flow start #%d", startID)
+	}
+	return start, nil
+}
+
 // NewFlowStart creates a new flow start objects for the passed in parameters
 func NewFlowStart(orgID OrgID, startType StartType, flowType FlowType, flowID FlowID) *FlowStart {
 	s := &FlowStart{}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/nyaruka/gocommon/dbutil/assertdb"
 	"github.com/nyaruka/gocommon/jsonx"
@@ -94,6 +95,19 @@ func TestStarts(t *testing.T) {
 	require.NoError(t, err)
 
 	assertdb.Query(t, db, `SELECT count(*) FROM flows_flowstart WHERE id = $1 AND status = 'C'`, startID).Returns(1)
+
+	status, contactCount, err := models.GetStartStatus(ctx, db, testdata.Org1.ID, startID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StartStatusComplete, status)
+	assert.Equal(t, 2, contactCount)
+
+	_, _, err = models.GetStartStatus(ctx, db, testdata.Org2.ID, startID)
+	assert.Equal(t, models.ErrNotFound, err)
+
+	err = models.MarkStartCancelled(ctx, db, startID)
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM flows_flowstart WHERE id = $1 AND status = 'I'`, startID).Returns(1)
 }
 
 func TestStartsBuilding(t *testing.T) {
@@ -105,7 +119,12 @@ func TestStartsBuilding(t *testing.T) {
 		WithExcludeGroupIDs([]models.GroupID{testdata.TestersGroup.ID}).
 		WithContactIDs([]models.ContactID{testdata.Cathy.ID, testdata.Bob.ID}).
 		WithQuery(`language != ""`).
-		WithCreateContact(true)
+		WithCreateContact(true).
+		WithPacePerMinute(500)
+
+	assert.Equal(t, 500, start.PacePerMinute())
+	assert.Equal(t, 12*time.Second, start.BatchInterval(100))
+	assert.Equal(t, time.Duration(0), models.NewFlowStart(testdata.Org1.ID, models.StartTypeManual, models.FlowTypeMessaging, testdata.Favorites.ID).BatchInterval(100))
 
 	marshalled, err := jsonx.Marshal(start)
 	require.NoError(t, err)
@@ -121,9 +140,32 @@ func TestStartsBuilding(t *testing.T) {
 		"group_ids": [%d],
 		"include_active": true,
 		"org_id": 1,
+		"pace_per_minute": 500,
 		"query": "language != \"\"",
 		"restart_participants": true,
 		"start_id": null,
 		"start_type": "M"
 	}`, testdata.Cathy.ID, testdata.Bob.ID, testdata.TestersGroup.ID, testdata.Favorites.ID, testdata.DoctorsGroup.ID)), marshalled)
 }
+
+func TestGetFlowStartByID(t *testing.T) {
+	ctx, _, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	startID := testdata.InsertFlowStart(db, testdata.Org1, testdata.SingleMessage, []*testdata.Contact{testdata.Cathy, testdata.Bob})
+	db.MustExec(`INSERT INTO flows_flowstart_groups(flowstart_id, contactgroup_id) VALUES($1, $2)`, startID, testdata.DoctorsGroup.ID)
+
+	start, err := models.GetFlowStartByID(ctx, db, startID)
+	require.NoError(t, err)
+	assert.Equal(t, startID, start.ID())
+	assert.Equal(t, testdata.Org1.ID, start.OrgID())
+	assert.Equal(t, models.StartTypeManual, start.Type())
+	assert.Equal(t, testdata.SingleMessage.ID, start.FlowID())
+	assert.Equal(t, models.FlowTypeMessaging, start.FlowType())
+	assert.ElementsMatch(t, []models.ContactID{testdata.Cathy.ID, testdata.Bob.ID}, start.ContactIDs())
+	assert.Equal(t, []models.GroupID{testdata.DoctorsGroup.ID}, start.GroupIDs())
+
+	_, err = models.GetFlowStartByID(ctx, db, models.StartID(123456))
+	assert.EqualError(t, err, "error loading flow start #123456: sql: no rows in result set")
+}
@@ -174,7 +174,7 @@ func (t *Ticket) ForwardIncoming(ctx context.Context, rt *runtime.Runtime, oa *O
 		return errors.Errorf("can't find ticketer with id %d", t.t.TicketerID)
 	}
 
-	service, err := ticketer.AsService(rt.Config, flows.NewTicketer(ticketer))
+	service, err := ticketer.AsService(rt.Config(), flows.NewTicketer(ticketer))
 	if err != nil {
 		return err
 	}
@@ -587,7 +587,7 @@ func CloseTickets(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, userI
 		for ticketerID, ticketerTickets := range byTicketer {
 			ticketer := oa.TicketerByID(ticketerID)
 			if ticketer != nil {
-				service, err := ticketer.AsService(rt.Config, flows.NewTicketer(ticketer))
+				service, err := ticketer.AsService(rt.Config(), flows.NewTicketer(ticketer))
 				if err != nil {
 					return nil, err
 				}
@@ -652,7 +652,7 @@ func ReopenTickets(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, user
 		for ticketerID, ticketerTickets := range byTicketer {
 			ticketer := oa.TicketerByID(ticketerID)
 			if ticketer != nil {
-				service, err := ticketer.AsService(rt.Config, flows.NewTicketer(ticketer))
+				service, err := ticketer.AsService(rt.Config(), flows.NewTicketer(ticketer))
 				if err != nil {
 					return nil, err
 				}
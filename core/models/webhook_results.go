@@ -0,0 +1,93 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/events"
+	"github.com/pkg/errors"
+)
+
+// webhook calls aren't recorded against their nodes in the database, so we count the results of calls to each node in
+// hourly hashes per org, which are kept long enough to report over the last day
+const (
+	webhookResultsPattern = "webhook_results:%d:%s"
+	webhookResultsExpiry  = 25 * 60 * 60
+)
+
+// WebhookResults is the number of successful and failed calls to a webhook node
+type WebhookResults struct {
+	Success int
+	Failure int
+}
+
+func webhookResultsKey(orgID OrgID, hour time.Time) string {
+	return fmt.Sprintf(webhookResultsPattern, orgID, hour.UTC().Format("2006-01-02T15"))
+}
+
+// RecordWebhookResults records the results of the passed in webhook calls made by the given node
+func RecordWebhookResults(rc redis.Conn, orgID OrgID, nodeUUID flows.NodeUUID, calls []*events.WebhookCalledEvent) error {
+	success, failure := 0, 0
+	for _, e := range calls {
+		if e.Status == flows.CallStatusSuccess {
+			success++
+		} else {
+			failure++
+		}
+	}
+
+	key := webhookResultsKey(orgID, dates.Now())
+
+	rc.Send("multi")
+	if success > 0 {
+		rc.Send("hincrby", key, string(nodeUUID)+":success", success)
+	}
+	if failure > 0 {
+		rc.Send("hincrby", key, string(nodeUUID)+":failure", failure)
+	}
+	rc.Send("expire", key, webhookResultsExpiry)
+	_, err := rc.Do("exec")
+
+	return errors.Wrapf(err, "error recording webhook results for node %s", nodeUUID)
+}
+
+// GetWebhookResults gets the results of webhook calls made by each node in the given org over the last day
+func GetWebhookResults(rc redis.Conn, orgID OrgID) (map[flows.NodeUUID]*WebhookResults, error) {
+	now := dates.Now()
+	results := make(map[flows.NodeUUID]*WebhookResults)
+
+	for h := 0; h < 24; h++ {
+		key := webhookResultsKey(orgID, now.Add(-time.Hour*time.Duration(h)))
+
+		counts, err := redis.IntMap(rc.Do("hgetall", key))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting webhook results from %s", key)
+		}
+
+		for field, count := range counts {
+			parts := strings.SplitN(field, ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+
+			nodeUUID := flows.NodeUUID(parts[0])
+			nodeResults := results[nodeUUID]
+			if nodeResults == nil {
+				nodeResults = &WebhookResults{}
+				results[nodeUUID] = nodeResults
+			}
+
+			if parts[1] == "success" {
+				nodeResults.Success += count
+			} else {
+				nodeResults.Failure += count
+			}
+		}
+	}
+
+	return results, nil
+}
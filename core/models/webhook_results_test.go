@@ -0,0 +1,70 @@
+package models_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/events"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookResults(t *testing.T) {
+	_, _, _, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+	defer dates.SetNowSource(dates.DefaultNowSource)
+
+	createWebhookEvents := func(status flows.CallStatus, count int) []*events.WebhookCalledEvent {
+		evts := make([]*events.WebhookCalledEvent, count)
+		for i := range evts {
+			req, _ := http.NewRequest("GET", "http://example.com", nil)
+			trace := &httpx.Trace{Request: req, StartTime: dates.Now(), EndTime: dates.Now()}
+			evts[i] = events.NewWebhookCalled(&flows.WebhookCall{Trace: trace}, status, "")
+		}
+		return evts
+	}
+
+	node1 := flows.NodeUUID("3c703019-8c92-4d28-9be0-a926a934486b")
+	node2 := flows.NodeUUID("a7e1ef5f-2a0b-4ad2-8cb4-5e2a5b8e1e2c")
+
+	results, err := models.GetWebhookResults(rc, testdata.Org1.ID)
+	require.NoError(t, err)
+	assert.Len(t, results, 0)
+
+	dates.SetNowSource(dates.NewFixedNowSource(time.Date(2022, 11, 30, 10, 30, 0, 0, time.UTC)))
+
+	// a day ago so will be outside of our window
+	require.NoError(t, models.RecordWebhookResults(rc, testdata.Org1.ID, node1, createWebhookEvents(flows.CallStatusSuccess, 5)))
+
+	dates.SetNowSource(dates.NewFixedNowSource(time.Date(2022, 12, 1, 9, 30, 0, 0, time.UTC)))
+
+	require.NoError(t, models.RecordWebhookResults(rc, testdata.Org1.ID, node1, createWebhookEvents(flows.CallStatusSuccess, 3)))
+	require.NoError(t, models.RecordWebhookResults(rc, testdata.Org1.ID, node1, createWebhookEvents(flows.CallStatusResponseError, 1)))
+	require.NoError(t, models.RecordWebhookResults(rc, testdata.Org2.ID, node2, createWebhookEvents(flows.CallStatusConnectionError, 2)))
+
+	dates.SetNowSource(dates.NewFixedNowSource(time.Date(2022, 12, 1, 10, 15, 0, 0, time.UTC)))
+
+	require.NoError(t, models.RecordWebhookResults(rc, testdata.Org1.ID, node1, createWebhookEvents(flows.CallStatusSuccess, 2)))
+	require.NoError(t, models.RecordWebhookResults(rc, testdata.Org1.ID, node2, createWebhookEvents(flows.CallStatusConnectionError, 4)))
+
+	results, err = models.GetWebhookResults(rc, testdata.Org1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[flows.NodeUUID]*models.WebhookResults{
+		node1: {Success: 5, Failure: 1},
+		node2: {Success: 0, Failure: 4},
+	}, results)
+
+	results, err = models.GetWebhookResults(rc, testdata.Org2.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[flows.NodeUUID]*models.WebhookResults{node2: {Success: 0, Failure: 2}}, results)
+}
@@ -97,11 +97,11 @@ func TestSyncAndroidChannels(t *testing.T) {
 func TestCreateFCMClient(t *testing.T) {
 	_, rt, _, _ := testsuite.Get()
 
-	rt.Config.FCMKey = "1234"
+	rt.Config().FCMKey = "1234"
 
-	assert.NotNil(t, msgio.CreateFCMClient(rt.Config))
+	assert.NotNil(t, msgio.CreateFCMClient(rt.Config()))
 
-	rt.Config.FCMKey = ""
+	rt.Config().FCMKey = ""
 
-	assert.Nil(t, msgio.CreateFCMClient(rt.Config))
+	assert.Nil(t, msgio.CreateFCMClient(rt.Config()))
 }
@@ -176,8 +176,8 @@ func FetchAttachment(ctx context.Context, rt *runtime.Runtime, ch *models.Channe
 		URL:         attURL,
 		MsgID:       msgID,
 	})
-	req, _ := http.NewRequest("POST", fmt.Sprintf("https://%s/c/_fetch-attachment", rt.Config.Domain), bytes.NewReader(payload))
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", rt.Config.CourierAuthToken))
+	req, _ := http.NewRequest("POST", fmt.Sprintf("https://%s/c/_fetch-attachment", rt.Config().Domain), bytes.NewReader(payload))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", rt.Config().CourierAuthToken))
 
 	resp, err := httpx.DoTrace(courierHttpClient, req, nil, nil, -1)
 	if err != nil || resp.Response.StatusCode != 200 {
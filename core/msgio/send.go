@@ -6,7 +6,9 @@ import (
 	"github.com/edganiukov/fcm"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/tracing"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // SendMessages tries to send the given messages via Courier or Android syncing
@@ -49,7 +51,17 @@ func SendMessages(ctx context.Context, rt *runtime.Runtime, tx models.Queryer, f
 		defer rc.Close()
 
 		for contactID, contactMsgs := range courierMsgs {
+			_, span := tracing.Start(ctx, "queue courier messages", attribute.Int("mailroom.msgs", len(contactMsgs)))
+
+			// include the trace ID in the courier payload so that sends can be linked back to this trace
+			if traceID := tracing.TraceID(ctx); traceID != "" {
+				for _, m := range contactMsgs {
+					m.SetTraceID(traceID)
+				}
+			}
+
 			err := QueueCourierMessages(rc, contactID, contactMsgs)
+			tracing.End(span, err)
 
 			// not being able to queue a message isn't the end of the world, log but don't return an error
 			if err != nil {
@@ -65,7 +77,7 @@ func SendMessages(ctx context.Context, rt *runtime.Runtime, tx models.Queryer, f
 	// if we have any android messages, trigger syncs for the unique channels
 	if len(androidChannels) > 0 {
 		if fc == nil {
-			fc = CreateFCMClient(rt.Config)
+			fc = CreateFCMClient(rt.Config())
 		}
 		SyncAndroidChannels(fc, androidChannels)
 	}
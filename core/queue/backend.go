@@ -0,0 +1,174 @@
+package queue
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/uuids"
+)
+
+// Backend is a fair queue implementation, where tasks are grouped by org and the next task is always taken from
+// the org with the fewest active workers which hasn't reached its maximum number of workers
+type Backend interface {
+	AddTask(queue string, taskType string, orgID int, task interface{}, priority Priority, opts ...TaskOption) error
+	PopNextTask(queue string) (*Task, error)
+	WaitForTask(queue string, timeout time.Duration) (bool, error)
+	MarkTaskComplete(queue string, orgID int) error
+	RetryTask(queue string, task *Task, delay time.Duration) error
+
+	Size(queue string) (int, error)
+	OrgSize(queue string, orgID int) (int, error)
+	DelayedSize(queue string) (int, error)
+	ActiveOrgs(queue string) (int, error)
+	Inspect(queue string, sampleSize int) ([]*OrgInfo, error)
+
+	SetMaxWorkers(queue string, orgID int, limit int) error
+	GetMaxWorkers(queue string) (int, map[int]int, error)
+
+	AddDeadLetter(queue string, task *Task, taskErr error) (*DeadLetter, error)
+	DeadLetters(queue string, limit int) ([]*DeadLetter, error)
+	GetDeadLetter(queue string, id uuids.UUID) (*DeadLetter, error)
+	RequeueDeadLetter(queue string, id uuids.UUID) (bool, error)
+	DiscardDeadLetter(queue string, id uuids.UUID) (bool, error)
+
+	SetTaskStatus(queue string, task *Task, status TaskStatus, taskErr error) error
+	GetTaskRecord(id uuids.UUID) (*TaskRecord, error)
+	CancelTask(id uuids.UUID) (bool, error)
+	IsTaskCancelled(id uuids.UUID) (bool, error)
+}
+
+// redisBackend is a backend which stores queues in redis sorted sets, using connections from the given pool
+type redisBackend struct {
+	rp *redis.Pool
+}
+
+// NewRedisBackend creates a new backend which uses the given redis pool
+func NewRedisBackend(rp *redis.Pool) Backend {
+	return &redisBackend{rp: rp}
+}
+
+func (b *redisBackend) AddTask(queue string, taskType string, orgID int, task interface{}, priority Priority, opts ...TaskOption) error {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return AddTask(rc, queue, taskType, orgID, task, priority, opts...)
+}
+
+func (b *redisBackend) PopNextTask(queue string) (*Task, error) {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return PopNextTask(rc, queue)
+}
+
+func (b *redisBackend) WaitForTask(queue string, timeout time.Duration) (bool, error) {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return WaitForTask(rc, queue, timeout)
+}
+
+func (b *redisBackend) MarkTaskComplete(queue string, orgID int) error {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return MarkTaskComplete(rc, queue, orgID)
+}
+
+func (b *redisBackend) RetryTask(queue string, task *Task, delay time.Duration) error {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return RetryTask(rc, queue, task, delay)
+}
+
+func (b *redisBackend) Size(queue string) (int, error) {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return Size(rc, queue)
+}
+
+func (b *redisBackend) OrgSize(queue string, orgID int) (int, error) {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return OrgSize(rc, queue, orgID)
+}
+
+func (b *redisBackend) DelayedSize(queue string) (int, error) {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return DelayedSize(rc, queue)
+}
+
+func (b *redisBackend) ActiveOrgs(queue string) (int, error) {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return ActiveOrgs(rc, queue)
+}
+
+func (b *redisBackend) Inspect(queue string, sampleSize int) ([]*OrgInfo, error) {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return Inspect(rc, queue, sampleSize)
+}
+
+func (b *redisBackend) SetMaxWorkers(queue string, orgID int, limit int) error {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return SetMaxWorkers(rc, queue, orgID, limit)
+}
+
+func (b *redisBackend) GetMaxWorkers(queue string) (int, map[int]int, error) {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return GetMaxWorkers(rc, queue)
+}
+
+func (b *redisBackend) AddDeadLetter(queue string, task *Task, taskErr error) (*DeadLetter, error) {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return AddDeadLetter(rc, queue, task, taskErr)
+}
+
+func (b *redisBackend) DeadLetters(queue string, limit int) ([]*DeadLetter, error) {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return DeadLetters(rc, queue, limit)
+}
+
+func (b *redisBackend) GetDeadLetter(queue string, id uuids.UUID) (*DeadLetter, error) {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return GetDeadLetter(rc, queue, id)
+}
+
+func (b *redisBackend) RequeueDeadLetter(queue string, id uuids.UUID) (bool, error) {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return RequeueDeadLetter(rc, queue, id)
+}
+
+func (b *redisBackend) DiscardDeadLetter(queue string, id uuids.UUID) (bool, error) {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return DiscardDeadLetter(rc, queue, id)
+}
+
+func (b *redisBackend) SetTaskStatus(queue string, task *Task, status TaskStatus, taskErr error) error {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return SetTaskStatus(rc, queue, task, status, taskErr)
+}
+
+func (b *redisBackend) GetTaskRecord(id uuids.UUID) (*TaskRecord, error) {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return GetTaskRecord(rc, id)
+}
+
+func (b *redisBackend) CancelTask(id uuids.UUID) (bool, error) {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return CancelTask(rc, id)
+}
+
+func (b *redisBackend) IsTaskCancelled(id uuids.UUID) (bool, error) {
+	rc := b.rp.Get()
+	defer rc.Close()
+	return IsTaskCancelled(rc, id)
+}
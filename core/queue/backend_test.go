@@ -0,0 +1,344 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisBackend(t *testing.T) {
+	rp := &redis.Pool{Dial: func() (redis.Conn, error) { return redis.Dial("tcp", "localhost:6379") }}
+	defer rp.Close()
+
+	rc := rp.Get()
+	_, err := rc.Do("del", "backend:active", "backend:1", "backend:2", "backend:delayed", "backend:max_workers", "backend:wakeup", "backend:dead", "backend:dead:letters", "backend:dedupe:key1", "task:bd6e2a27-0d1a-4c2c-a51b-92c2b7cd8e0f")
+	require.NoError(t, err)
+	rc.Close()
+
+	testBackend(t, NewRedisBackend(rp))
+
+	rc = rp.Get()
+	defer rc.Close()
+
+	// cancelling keeps the TTL of status records and doesn't recreate records which have expired
+	task := &Task{ID: "bd6e2a27-0d1a-4c2c-a51b-92c2b7cd8e0f", Type: "tracked", OrgID: 1}
+	require.NoError(t, SetTaskStatus(rc, "backend", task, TaskStatusRunning, nil))
+
+	cancelled, err := CancelTask(rc, task.ID)
+	require.NoError(t, err)
+	assert.True(t, cancelled)
+
+	ttl, err := redis.Int(rc.Do("pttl", "task:bd6e2a27-0d1a-4c2c-a51b-92c2b7cd8e0f"))
+	require.NoError(t, err)
+	assert.Greater(t, ttl, 0)
+
+	_, err = rc.Do("del", "task:bd6e2a27-0d1a-4c2c-a51b-92c2b7cd8e0f")
+	require.NoError(t, err)
+
+	cancelled, err = CancelTask(rc, task.ID)
+	require.NoError(t, err)
+	assert.False(t, cancelled)
+
+	exists, err := redis.Bool(rc.Do("exists", "task:bd6e2a27-0d1a-4c2c-a51b-92c2b7cd8e0f"))
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestMemoryBackend(t *testing.T) {
+	testBackend(t, NewMemoryBackend())
+}
+
+func TestMemoryBackendDedupeExpiry(t *testing.T) {
+	b := NewMemoryBackend().(*memoryBackend)
+
+	require.NoError(t, b.AddTask("backend", "type1", 1, "task1", DefaultPriority, WithDedupeKey("key1", time.Millisecond)))
+	require.NoError(t, b.AddTask("backend", "type1", 1, "task2", DefaultPriority, WithDedupeKey("key2", time.Millisecond)))
+	assert.Len(t, b.queue("backend").dedupe, 2)
+
+	time.Sleep(5 * time.Millisecond)
+
+	// expired keys are removed once a minute when keys are checked
+	b.queue("backend").dedupePruned = time.Now().Add(-time.Minute)
+	require.NoError(t, b.AddTask("backend", "type1", 1, "task3", DefaultPriority, WithDedupeKey("key3", time.Minute)))
+	assert.Len(t, b.queue("backend").dedupe, 1)
+	assert.Contains(t, b.queue("backend").dedupe, "key3")
+}
+
+func testBackend(t *testing.T, b Backend) {
+	assertPops := func(expected ...string) {
+		for _, e := range expected {
+			task, err := b.PopNextTask("backend")
+			require.NoError(t, err)
+			require.NotNil(t, task, "expected task %s, got none", e)
+			assert.Equal(t, `"`+e+`"`, string(task.Task))
+		}
+		task, err := b.PopNextTask("backend")
+		require.NoError(t, err)
+		assert.Nil(t, task, "expected no more tasks")
+	}
+	drainWakeups := func() {
+		for {
+			added, err := b.WaitForTask("backend", time.Millisecond*10)
+			require.NoError(t, err)
+			if !added {
+				return
+			}
+		}
+	}
+	assertSizes := func(size, delayed int) {
+		actual, err := b.Size("backend")
+		require.NoError(t, err)
+		assert.Equal(t, size, actual, "size mismatch")
+		actual, err = b.DelayedSize("backend")
+		require.NoError(t, err)
+		assert.Equal(t, delayed, actual, "delayed size mismatch")
+	}
+
+	assertPops()
+	assertSizes(0, 0)
+
+	// tasks are popped in priority order within an org, and orgs with fewer active workers go first
+	require.NoError(t, b.AddTask("backend", "type1", 1, "task1", DefaultPriority))
+	require.NoError(t, b.AddTask("backend", "type1", 1, "task2", DefaultPriority))
+	require.NoError(t, b.AddTask("backend", "type2", 2, "task3", DefaultPriority))
+	require.NoError(t, b.AddTask("backend", "type1", 1, "task4", HighPriority))
+	assertSizes(4, 0)
+
+	orgSize, err := b.OrgSize("backend", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 3, orgSize)
+	orgSize, err = b.OrgSize("backend", 3)
+	require.NoError(t, err)
+	assert.Equal(t, 0, orgSize)
+
+	activeOrgs, err := b.ActiveOrgs("backend")
+	require.NoError(t, err)
+	assert.Equal(t, 2, activeOrgs)
+
+	added, err := b.WaitForTask("backend", time.Second)
+	require.NoError(t, err)
+	assert.True(t, added)
+
+	infos, err := b.Inspect("backend", 10)
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	assert.Equal(t, 1, infos[0].OrgID)
+	assert.Equal(t, 3, infos[0].Depth)
+	assert.Equal(t, map[string]int{"type1": 3}, infos[0].TaskTypes)
+	assert.Equal(t, 2, infos[1].OrgID)
+	assert.Equal(t, 1, infos[1].Depth)
+	assert.Equal(t, map[string]int{"type2": 1}, infos[1].TaskTypes)
+
+	assertPops("task4", "task3", "task1", "task2")
+	assertSizes(0, 0)
+
+	for _, orgID := range []int{1, 2, 1, 1} {
+		require.NoError(t, b.MarkTaskComplete("backend", orgID))
+	}
+
+	// an org which has reached its max workers doesn't get any more tasks until one completes
+	require.NoError(t, b.SetMaxWorkers("backend", 0, 1))
+	require.NoError(t, b.SetMaxWorkers("backend", 2, 3))
+
+	def, orgs, err := b.GetMaxWorkers("backend")
+	require.NoError(t, err)
+	assert.Equal(t, 1, def)
+	assert.Equal(t, map[int]int{2: 3}, orgs)
+
+	require.NoError(t, b.AddTask("backend", "type1", 1, "task5", DefaultPriority))
+	require.NoError(t, b.AddTask("backend", "type1", 1, "task6", DefaultPriority))
+	assertPops("task5")
+
+	// completing a task for an org with more tasks wakes up anybody waiting
+	drainWakeups()
+	require.NoError(t, b.MarkTaskComplete("backend", 1))
+
+	added, err = b.WaitForTask("backend", time.Second*5)
+	require.NoError(t, err)
+	assert.True(t, added)
+
+	assertPops("task6")
+	require.NoError(t, b.MarkTaskComplete("backend", 1))
+
+	// an org keeps its count of workers when its queue empties, so tasks added later still respect its limit
+	require.NoError(t, b.AddTask("backend", "type2", 2, "capped1", DefaultPriority))
+	assertPops("capped1")
+	for _, task := range []string{"capped2", "capped3", "capped4"} {
+		require.NoError(t, b.AddTask("backend", "type2", 2, task, DefaultPriority))
+	}
+	assertPops("capped2", "capped3")
+	require.NoError(t, b.MarkTaskComplete("backend", 2))
+	assertPops("capped4")
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, b.MarkTaskComplete("backend", 2))
+	}
+
+	// and once its last task completes with nothing queued, it's no longer active
+	infos, err = b.Inspect("backend", 10)
+	require.NoError(t, err)
+	assert.Len(t, infos, 0)
+
+	require.NoError(t, b.SetMaxWorkers("backend", 0, 0))
+	require.NoError(t, b.SetMaxWorkers("backend", 2, 0))
+
+	def, orgs, err = b.GetMaxWorkers("backend")
+	require.NoError(t, err)
+	assert.Equal(t, 0, def)
+	assert.Equal(t, map[int]int{}, orgs)
+
+	// delayed tasks aren't popped until they're due
+	require.NoError(t, b.AddTask("backend", "type1", 1, "task7", DefaultPriority, WithRunAt(time.Now().Add(time.Millisecond*200))))
+	assertSizes(0, 1)
+	assertPops()
+
+	// and waiting for tasks only waits until they're due
+	drainWakeups()
+	start := time.Now()
+	added, err = b.WaitForTask("backend", time.Second*5)
+	require.NoError(t, err)
+	assert.True(t, added)
+	assert.Less(t, time.Since(start), time.Second)
+
+	assertPops("task7")
+	assertSizes(0, 0)
+	require.NoError(t, b.MarkTaskComplete("backend", 1))
+
+	// tasks with a dedupe key which is still held aren't added
+	require.NoError(t, b.AddTask("backend", "type1", 1, "task8", DefaultPriority, WithDedupeKey("key1", time.Minute)))
+	require.NoError(t, b.AddTask("backend", "type1", 1, "task9", DefaultPriority, WithDedupeKey("key1", time.Minute)))
+	assertPops("task8")
+
+	// failed tasks can be retried with a delay or moved to dead letters
+	task := &Task{Type: "type1", OrgID: 1, Task: []byte(`"task8"`), ErrorCount: 1}
+	require.NoError(t, b.RetryTask("backend", task, time.Minute))
+	assertSizes(0, 1)
+
+	task.ErrorCount = 4
+	letter, err := b.AddDeadLetter("backend", task, errors.New("boom"))
+	require.NoError(t, err)
+	assert.Equal(t, "boom", letter.Error)
+
+	letters, err := b.DeadLetters("backend", 10)
+	require.NoError(t, err)
+	require.Len(t, letters, 1)
+	assert.Equal(t, letter.ID, letters[0].ID)
+
+	fetched, err := b.GetDeadLetter("backend", letter.ID)
+	require.NoError(t, err)
+	require.NotNil(t, fetched)
+	assert.Equal(t, 4, fetched.Task.ErrorCount)
+
+	requeued, err := b.RequeueDeadLetter("backend", letter.ID)
+	require.NoError(t, err)
+	assert.True(t, requeued)
+
+	task, err = b.PopNextTask("backend")
+	require.NoError(t, err)
+	require.NotNil(t, task)
+	assert.Equal(t, `"task8"`, string(task.Task))
+	assert.Equal(t, 0, task.ErrorCount)
+
+	discarded, err := b.DiscardDeadLetter("backend", letter.ID)
+	require.NoError(t, err)
+	assert.False(t, discarded)
+
+	letters, err = b.DeadLetters("backend", 10)
+	require.NoError(t, err)
+	assert.Len(t, letters, 0)
+
+	// requeuing a letter which has already been requeued doesn't duplicate its task
+	requeued, err = b.RequeueDeadLetter("backend", letter.ID)
+	require.NoError(t, err)
+	assert.False(t, requeued)
+	assertPops()
+
+	// only so many dead letters are kept
+	for i := 0; i < maxDeadLetters+5; i++ {
+		_, err := b.AddDeadLetter("backend", task, errors.New("boom"))
+		require.NoError(t, err)
+	}
+	letters, err = b.DeadLetters("backend", maxDeadLetters+10)
+	require.NoError(t, err)
+	assert.Len(t, letters, maxDeadLetters)
+
+	for _, l := range letters {
+		_, err := b.DiscardDeadLetter("backend", l.ID)
+		require.NoError(t, err)
+	}
+
+	// tasks of tracked types have status records which can be updated and flagged as cancelled
+	TrackTaskType("tracked")
+	require.NoError(t, b.AddTask("backend", "tracked", 1, "task10", DefaultPriority, WithTaskID("bd6e2a27-0d1a-4c2c-a51b-92c2b7cd8e0f")))
+
+	record, err := b.GetTaskRecord("bd6e2a27-0d1a-4c2c-a51b-92c2b7cd8e0f")
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, "backend", record.Queue)
+	assert.Equal(t, "tracked", record.Type)
+	assert.Equal(t, 1, record.OrgID)
+	assert.Equal(t, TaskStatusQueued, record.Status)
+	assert.False(t, record.Cancelled)
+	assert.Nil(t, record.StartedOn)
+
+	task, err = b.PopNextTask("backend")
+	require.NoError(t, err)
+	require.NotNil(t, task)
+	assert.Equal(t, uuids.UUID("bd6e2a27-0d1a-4c2c-a51b-92c2b7cd8e0f"), task.ID)
+
+	require.NoError(t, b.SetTaskStatus("backend", task, TaskStatusRunning, nil))
+
+	cancelled, err := b.CancelTask(task.ID)
+	require.NoError(t, err)
+	assert.True(t, cancelled)
+
+	cancelled, err = b.IsTaskCancelled(task.ID)
+	require.NoError(t, err)
+	assert.True(t, cancelled)
+
+	task.ErrorCount = 1
+	require.NoError(t, b.SetTaskStatus("backend", task, TaskStatusFailed, errors.New("boom")))
+
+	record, err = b.GetTaskRecord(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusFailed, record.Status)
+	assert.Equal(t, "boom", record.Error)
+	assert.Equal(t, 1, record.ErrorCount)
+	assert.True(t, record.Cancelled)
+	assert.NotNil(t, record.StartedOn)
+	assert.NotNil(t, record.EndedOn)
+
+	// and the error is cleared when it's updated without one
+	require.NoError(t, b.SetTaskStatus("backend", task, TaskStatusQueued, nil))
+
+	record, err = b.GetTaskRecord(task.ID)
+	require.NoError(t, err)
+	assert.Equal(t, TaskStatusQueued, record.Status)
+	assert.Equal(t, "", record.Error)
+
+	// tasks of other types don't have status records
+	require.NoError(t, b.AddTask("backend", "type1", 1, "task11", DefaultPriority, WithTaskID("2f8d6d1e-2e55-4d5c-8d8a-0f3b3c9f3a1e")))
+
+	record, err = b.GetTaskRecord("2f8d6d1e-2e55-4d5c-8d8a-0f3b3c9f3a1e")
+	require.NoError(t, err)
+	assert.Nil(t, record)
+	assertPops("task11")
+
+	// non-existent tasks have no record and can't be cancelled
+	record, err = b.GetTaskRecord("8720f157-ca1c-432f-9c0b-2014ddc77094")
+	require.NoError(t, err)
+	assert.Nil(t, record)
+
+	cancelled, err = b.CancelTask("8720f157-ca1c-432f-9c0b-2014ddc77094")
+	require.NoError(t, err)
+	assert.False(t, cancelled)
+
+	cancelled, err = b.IsTaskCancelled("8720f157-ca1c-432f-9c0b-2014ddc77094")
+	require.NoError(t, err)
+	assert.False(t, cancelled)
+}
@@ -0,0 +1,545 @@
+package queue
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nyaruka/gocommon/uuids"
+)
+
+// memoryBackend is a backend which keeps queues in process memory, e.g. for an embedded single node mailroom or
+// for tests. It has the same fairness semantics as the redis backend, and task status records expire in the same way.
+type memoryBackend struct {
+	mutex         sync.Mutex
+	queues        map[string]*memoryQueue
+	records       map[uuids.UUID]*memoryRecord
+	recordsPruned time.Time
+}
+
+type memoryRecord struct {
+	record    *TaskRecord
+	expiresOn time.Time
+}
+
+type memoryQueue struct {
+	orgs         map[int][]*memoryTask // queued tasks by org, ordered by score
+	active       map[int]int           // active orgs and their worker counts
+	delayed      []*memoryTask         // delayed tasks, ordered by score
+	maxWorkers   map[int]int           // limits by org, with 0 being the default
+	dedupe       map[string]time.Time  // held dedupe keys and when they expire
+	dedupePruned time.Time
+	deadLetters  []*DeadLetter // ordered by when they failed
+	wakeup       chan bool
+}
+
+type memoryTask struct {
+	task  *Task
+	score float64
+}
+
+// NewMemoryBackend creates a new in-memory backend
+func NewMemoryBackend() Backend {
+	return &memoryBackend{queues: make(map[string]*memoryQueue), records: make(map[uuids.UUID]*memoryRecord), recordsPruned: time.Now()}
+}
+
+// gets the queue with the given name, creating it if necessary. Callers must hold the mutex.
+func (b *memoryBackend) queue(name string) *memoryQueue {
+	q := b.queues[name]
+	if q == nil {
+		q = &memoryQueue{
+			orgs:       make(map[int][]*memoryTask),
+			active:     make(map[int]int),
+			maxWorkers: make(map[int]int),
+			dedupe:     make(map[string]time.Time),
+			wakeup:     make(chan bool, maxWakeups),
+		}
+		b.queues[name] = q
+	}
+	return q
+}
+
+func (b *memoryBackend) AddTask(queue string, taskType string, orgID int, task interface{}, priority Priority, opts ...TaskOption) error {
+	options := &taskOptions{}
+	for _, o := range opts {
+		o(options)
+	}
+
+	taskBody, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+
+	payload := &Task{
+		ID:       options.taskID,
+		Type:     taskType,
+		OrgID:    orgID,
+		Task:     taskBody,
+		QueuedOn: time.Now(),
+		Priority: priority,
+	}
+	if payload.ID == "" {
+		payload.ID = uuids.New()
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	q := b.queue(queue)
+
+	if options.dedupeKey != "" {
+		q.pruneDedupe(payload.QueuedOn)
+
+		if expiresOn, held := q.dedupe[options.dedupeKey]; held && expiresOn.After(payload.QueuedOn) {
+			return nil
+		}
+		q.dedupe[options.dedupeKey] = payload.QueuedOn.Add(options.dedupeTTL)
+	}
+
+	b.setTaskStatus(queue, payload, TaskStatusQueued, nil)
+
+	if !options.runAt.IsZero() && options.runAt.After(payload.QueuedOn) {
+		q.delay(payload, options.runAt)
+	} else {
+		q.push(payload, payload.QueuedOn)
+	}
+	return nil
+}
+
+// removes any expired dedupe keys, at most once a minute. Callers must hold the mutex.
+func (q *memoryQueue) pruneDedupe(now time.Time) {
+	if now.Sub(q.dedupePruned) < time.Minute {
+		return
+	}
+	for key, expiresOn := range q.dedupe {
+		if !expiresOn.After(now) {
+			delete(q.dedupe, key)
+		}
+	}
+	q.dedupePruned = now
+}
+
+// pushes the passed in task onto its org queue, scored by the given time adjusted by its priority
+func (q *memoryQueue) push(task *Task, t time.Time) {
+	q.orgs[task.OrgID] = insertTask(q.orgs[task.OrgID], &memoryTask{task: task, score: score(t) + float64(task.Priority)})
+	if _, active := q.active[task.OrgID]; !active {
+		q.active[task.OrgID] = 0
+	}
+
+	q.wake()
+}
+
+// wakes up anybody waiting for tasks on this queue
+func (q *memoryQueue) wake() {
+	select {
+	case q.wakeup <- true:
+	default:
+	}
+}
+
+// adds the passed in task to the delayed tasks, to be moved onto its org queue once the given time has passed
+func (q *memoryQueue) delay(task *Task, runAt time.Time) {
+	q.delayed = insertTask(q.delayed, &memoryTask{task: task, score: score(runAt)})
+}
+
+func (b *memoryBackend) PopNextTask(queue string) (*Task, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	q := b.queue(queue)
+	now := score(time.Now())
+
+	// move any delayed tasks which are now due onto their org queues
+	for len(q.delayed) > 0 && q.delayed[0].score <= now {
+		due := q.delayed[0]
+		q.delayed = q.delayed[1:]
+		q.orgs[due.task.OrgID] = insertTask(q.orgs[due.task.OrgID], &memoryTask{task: due.task, score: due.score + float64(due.task.Priority)})
+		if _, active := q.active[due.task.OrgID]; !active {
+			q.active[due.task.OrgID] = 0
+		}
+		q.wake()
+	}
+
+	// find the org with the fewest active workers which hasn't reached its max workers
+	for _, orgID := range q.activeOrgs() {
+		workers := q.active[orgID]
+		limit, hasLimit := q.maxWorkers[orgID]
+		if !hasLimit {
+			limit = q.maxWorkers[0]
+		}
+
+		if limit <= 0 || workers < limit {
+			tasks := q.orgs[orgID]
+			if len(tasks) > 0 {
+				q.orgs[orgID] = tasks[1:]
+				q.active[orgID]++
+				return tasks[0].task, nil
+			}
+
+			// no tasks, remove this org from active orgs unless it still has workers whose count we need to keep
+			delete(q.orgs, orgID)
+			if workers <= 0 {
+				delete(q.active, orgID)
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// returns the active orgs ordered in the same way as the redis active set, i.e. by workers and then by id as a string
+func (q *memoryQueue) activeOrgs() []int {
+	orgs := make([]int, 0, len(q.active))
+	for orgID := range q.active {
+		orgs = append(orgs, orgID)
+	}
+	sort.Slice(orgs, func(i, j int) bool {
+		if q.active[orgs[i]] != q.active[orgs[j]] {
+			return q.active[orgs[i]] < q.active[orgs[j]]
+		}
+		return strconv.Itoa(orgs[i]) < strconv.Itoa(orgs[j])
+	})
+	return orgs
+}
+
+func (b *memoryBackend) WaitForTask(queue string, timeout time.Duration) (bool, error) {
+	b.mutex.Lock()
+	q := b.queue(queue)
+	wakeup := q.wakeup
+
+	// if a delayed task will become due before our timeout, only wait until then
+	dueSoon := false
+	if len(q.delayed) > 0 {
+		if untilDue := time.Until(time.UnixMicro(int64(q.delayed[0].score * 1000000))); untilDue < timeout {
+			timeout = untilDue
+			dueSoon = true
+		}
+	}
+	b.mutex.Unlock()
+
+	select {
+	case <-wakeup:
+		return true, nil
+	case <-time.After(timeout):
+		return dueSoon, nil
+	}
+}
+
+func (b *memoryBackend) MarkTaskComplete(queue string, orgID int) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	q := b.queue(queue)
+	q.active[orgID]--
+
+	if q.active[orgID] <= 0 {
+		// if that was the last worker and there are no more tasks, remove this org from active orgs
+		if len(q.orgs[orgID]) == 0 {
+			delete(q.active, orgID)
+		} else if q.active[orgID] < 0 {
+			// reset to zero if we somehow go below
+			q.active[orgID] = 0
+		}
+	}
+
+	// if this org has tasks, which it may not have been able to pop because of its max workers, wake up anybody
+	// waiting for tasks on this queue
+	if len(q.orgs[orgID]) > 0 {
+		q.wake()
+	}
+	return nil
+}
+
+func (b *memoryBackend) RetryTask(queue string, task *Task, delay time.Duration) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.queue(queue).delay(task, time.Now().Add(delay))
+	return nil
+}
+
+func (b *memoryBackend) Size(queue string) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	size := 0
+	for _, tasks := range b.queue(queue).orgs {
+		size += len(tasks)
+	}
+	return size, nil
+}
+
+func (b *memoryBackend) OrgSize(queue string, orgID int) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return len(b.queue(queue).orgs[orgID]), nil
+}
+
+func (b *memoryBackend) DelayedSize(queue string) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return len(b.queue(queue).delayed), nil
+}
+
+func (b *memoryBackend) ActiveOrgs(queue string) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return len(b.queue(queue).active), nil
+}
+
+func (b *memoryBackend) Inspect(queue string, sampleSize int) ([]*OrgInfo, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	q := b.queue(queue)
+	infos := make([]*OrgInfo, 0, len(q.active))
+
+	for _, orgID := range q.activeOrgs() {
+		tasks := q.orgs[orgID]
+		info := &OrgInfo{OrgID: orgID, Depth: len(tasks), Workers: q.active[orgID], TaskTypes: make(map[string]int)}
+
+		sample := tasks
+		if len(tasks) > sampleSize*2 {
+			sample = append(append([]*memoryTask{}, tasks[:sampleSize]...), tasks[len(tasks)-sampleSize:]...)
+		}
+
+		for _, t := range sample {
+			info.TaskTypes[t.task.Type]++
+
+			if info.OldestQueuedOn.IsZero() || t.task.QueuedOn.Before(info.OldestQueuedOn) {
+				info.OldestQueuedOn = t.task.QueuedOn
+			}
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+func (b *memoryBackend) SetMaxWorkers(queue string, orgID int, limit int) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	q := b.queue(queue)
+	if limit > 0 {
+		q.maxWorkers[orgID] = limit
+	} else {
+		delete(q.maxWorkers, orgID)
+	}
+	return nil
+}
+
+func (b *memoryBackend) GetMaxWorkers(queue string) (int, map[int]int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	q := b.queue(queue)
+	orgs := make(map[int]int, len(q.maxWorkers))
+	for orgID, limit := range q.maxWorkers {
+		if orgID != 0 {
+			orgs[orgID] = limit
+		}
+	}
+	return q.maxWorkers[0], orgs, nil
+}
+
+func (b *memoryBackend) AddDeadLetter(queue string, task *Task, taskErr error) (*DeadLetter, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	letter := &DeadLetter{ID: uuids.New(), Task: task, Error: taskErr.Error(), FailedOn: time.Now()}
+
+	q := b.queue(queue)
+	q.deadLetters = append(q.deadLetters, letter)
+
+	// trim letters which are too old, and then the oldest letters if there are still too many
+	trim := 0
+	for trim < len(q.deadLetters) && q.deadLetters[trim].FailedOn.Before(letter.FailedOn.Add(-deadLetterMaxAge)) {
+		trim++
+	}
+	if excess := len(q.deadLetters) - trim - maxDeadLetters; excess > 0 {
+		trim += excess
+	}
+	q.deadLetters = q.deadLetters[trim:]
+
+	return letter, nil
+}
+
+func (b *memoryBackend) DeadLetters(queue string, limit int) ([]*DeadLetter, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	q := b.queue(queue)
+	letters := make([]*DeadLetter, 0, limit)
+	for i := len(q.deadLetters) - 1; i >= 0 && len(letters) < limit; i-- {
+		letters = append(letters, q.deadLetters[i])
+	}
+	return letters, nil
+}
+
+func (b *memoryBackend) GetDeadLetter(queue string, id uuids.UUID) (*DeadLetter, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	_, letter := b.queue(queue).findDeadLetter(id)
+	return letter, nil
+}
+
+func (b *memoryBackend) RequeueDeadLetter(queue string, id uuids.UUID) (bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	q := b.queue(queue)
+	i, letter := q.findDeadLetter(id)
+	if letter == nil {
+		return false, nil
+	}
+
+	letter.Task.ErrorCount = 0
+	q.push(letter.Task, time.Now())
+	b.setTaskStatus(queue, letter.Task, TaskStatusQueued, nil)
+	q.deadLetters = append(q.deadLetters[:i], q.deadLetters[i+1:]...)
+	return true, nil
+}
+
+func (b *memoryBackend) DiscardDeadLetter(queue string, id uuids.UUID) (bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	q := b.queue(queue)
+	i, letter := q.findDeadLetter(id)
+	if letter == nil {
+		return false, nil
+	}
+
+	q.deadLetters = append(q.deadLetters[:i], q.deadLetters[i+1:]...)
+	return true, nil
+}
+
+func (q *memoryQueue) findDeadLetter(id uuids.UUID) (int, *DeadLetter) {
+	for i, letter := range q.deadLetters {
+		if letter.ID == id {
+			return i, letter
+		}
+	}
+	return -1, nil
+}
+
+func (b *memoryBackend) SetTaskStatus(queue string, task *Task, status TaskStatus, taskErr error) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.setTaskStatus(queue, task, status, taskErr)
+	return nil
+}
+
+// updates the status record of the passed in task. Callers must hold the mutex.
+func (b *memoryBackend) setTaskStatus(queue string, task *Task, status TaskStatus, taskErr error) {
+	if !IsTaskTracked(task) {
+		return
+	}
+
+	now := time.Now()
+	b.pruneRecords(now)
+
+	r := b.records[task.ID]
+	if r == nil {
+		r = &memoryRecord{record: &TaskRecord{ID: task.ID}}
+		b.records[task.ID] = r
+	}
+
+	record := r.record
+	record.Queue = queue
+	record.Type = task.Type
+	record.OrgID = task.OrgID
+	record.Status = status
+	record.ErrorCount = task.ErrorCount
+	record.QueuedOn = task.QueuedOn
+	record.Error = ""
+	r.expiresOn = now.Add(activeTaskStatusTTL)
+
+	switch status {
+	case TaskStatusRunning:
+		record.StartedOn = &now
+	case TaskStatusDone, TaskStatusFailed:
+		record.EndedOn = &now
+		r.expiresOn = now.Add(finishedTaskStatusTTL)
+	}
+	if taskErr != nil {
+		record.Error = taskErr.Error()
+	}
+}
+
+// removes any expired status records, at most once a minute. Callers must hold the mutex.
+func (b *memoryBackend) pruneRecords(now time.Time) {
+	if now.Sub(b.recordsPruned) < time.Minute {
+		return
+	}
+	for id, r := range b.records {
+		if !r.expiresOn.After(now) {
+			delete(b.records, id)
+		}
+	}
+	b.recordsPruned = now
+}
+
+// gets the status record with the given id if it exists and hasn't expired. Callers must hold the mutex.
+func (b *memoryBackend) getRecord(id uuids.UUID) *TaskRecord {
+	r := b.records[id]
+	if r == nil || !r.expiresOn.After(time.Now()) {
+		return nil
+	}
+	return r.record
+}
+
+func (b *memoryBackend) GetTaskRecord(id uuids.UUID) (*TaskRecord, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	record := b.getRecord(id)
+	if record == nil {
+		return nil, nil
+	}
+	copied := *record
+	return &copied, nil
+}
+
+func (b *memoryBackend) CancelTask(id uuids.UUID) (bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	record := b.getRecord(id)
+	if record == nil {
+		return false, nil
+	}
+	record.Cancelled = true
+	return true, nil
+}
+
+func (b *memoryBackend) IsTaskCancelled(id uuids.UUID) (bool, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	record := b.getRecord(id)
+	return record != nil && record.Cancelled, nil
+}
+
+// inserts the passed in task into the given slice of tasks ordered by score, after any tasks with the same score
+func insertTask(tasks []*memoryTask, task *memoryTask) []*memoryTask {
+	i := sort.Search(len(tasks), func(i int) bool { return tasks[i].score > task.score })
+	tasks = append(tasks, nil)
+	copy(tasks[i+1:], tasks[i:])
+	tasks[i] = task
+	return tasks
+}
+
+// returns the passed in time as a score in seconds with microsecond precision, like the redis backend
+func score(t time.Time) float64 {
+	return float64(t.UnixNano()/int64(time.Microsecond)) / float64(1000000)
+}
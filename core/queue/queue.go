@@ -1,21 +1,27 @@
 package queue
 
 import (
+	"crypto/sha1"
 	"encoding/json"
 	"fmt"
+	"math"
+	"sort"
 	"strconv"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/uuids"
 	"github.com/pkg/errors"
 )
 
 // Task is a utility struct for encoding a task
 type Task struct {
+	ID         uuids.UUID      `json:"id,omitempty"`
 	Type       string          `json:"type"`
 	OrgID      int             `json:"org_id"`
 	Task       json.RawMessage `json:"task"`
 	QueuedOn   time.Time       `json:"queued_on"`
+	Priority   Priority        `json:"priority,omitempty"`
 	ErrorCount int             `json:"error_count,omitempty"`
 }
 
@@ -23,8 +29,25 @@ type Task struct {
 type Priority int
 
 const (
-	queuePattern  = "%s:%d"
-	activePattern = "%s:active"
+	queuePattern      = "%s:%d"
+	activePattern     = "%s:active"
+	delayedPattern    = "%s:delayed"
+	maxWorkersPattern = "%s:max_workers"
+	dedupePattern     = "%s:dedupe:%s"
+	wakeupPattern     = "%s:wakeup"
+	deadPattern       = "%s:dead"
+	deadLetterPattern = "%s:dead:letters"
+
+	// max number of pending wakeups we keep for a queue
+	maxWakeups = 100
+
+	// max number of dead letters we keep for a queue, and how long we keep them for
+	maxDeadLetters   = 1000
+	deadLetterMaxAge = 14 * 24 * time.Hour
+
+	// how long dedupe keys are held if not given a usable duration, and how long idempotency keys are held
+	defaultDedupeTTL  = time.Hour
+	idempotencyKeyTTL = 24 * time.Hour
 
 	// DefaultPriority is the default priority for tasks
 	DefaultPriority = Priority(0)
@@ -81,9 +104,138 @@ func Size(rc redis.Conn, queue string) (int, error) {
 	return size, nil
 }
 
+// OrgSize returns the number of tasks queued for the given org in the passed in queue
+func OrgSize(rc redis.Conn, queue string, orgID int) (int, error) {
+	size, err := redis.Int(rc.Do("zcard", fmt.Sprintf(queuePattern, queue, orgID)))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error getting size of: %d", orgID)
+	}
+	return size, nil
+}
+
+// OrgInfo is a summary of the tasks queued for a single org in a queue
+type OrgInfo struct {
+	OrgID          int
+	Depth          int
+	Workers        int
+	OldestQueuedOn time.Time
+	TaskTypes      map[string]int
+}
+
+// Inspect returns a summary of each active org in the passed in queue. Task types and the oldest task are
+// determined from a sample of up to the given number of tasks from each end of each org's queue.
+func Inspect(rc redis.Conn, queue string, sampleSize int) ([]*OrgInfo, error) {
+	active, err := redis.Ints(rc.Do("zrange", fmt.Sprintf(activePattern, queue), 0, -1, "WITHSCORES"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting active orgs for: %s", queue)
+	}
+
+	infos := make([]*OrgInfo, 0, len(active)/2)
+
+	for i := 0; i < len(active); i += 2 {
+		info := &OrgInfo{OrgID: active[i], Workers: active[i+1], TaskTypes: make(map[string]int)}
+		orgQueue := fmt.Sprintf(queuePattern, queue, info.OrgID)
+
+		info.Depth, err = redis.Int(rc.Do("zcard", orgQueue))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting size of: %s", orgQueue)
+		}
+
+		var sample []string
+		if info.Depth <= sampleSize*2 {
+			sample, err = redis.Strings(rc.Do("zrange", orgQueue, 0, -1))
+		} else {
+			sample, err = redis.Strings(rc.Do("zrange", orgQueue, 0, sampleSize-1))
+			if err == nil {
+				var tail []string
+				tail, err = redis.Strings(rc.Do("zrange", orgQueue, -sampleSize, -1))
+				sample = append(sample, tail...)
+			}
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "error sampling tasks from: %s", orgQueue)
+		}
+
+		for _, payload := range sample {
+			task := &Task{}
+			if err := json.Unmarshal([]byte(payload), task); err != nil {
+				return nil, errors.Wrapf(err, "error unmarshaling task from: %s", orgQueue)
+			}
+
+			info.TaskTypes[task.Type]++
+
+			if info.OldestQueuedOn.IsZero() || task.QueuedOn.Before(info.OldestQueuedOn) {
+				info.OldestQueuedOn = task.QueuedOn
+			}
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// TaskOption is an optional setting for a task being added to a queue
+type TaskOption func(*taskOptions)
+
+type taskOptions struct {
+	taskID    uuids.UUID
+	runAt     time.Time
+	dedupeKey string
+	dedupeTTL time.Duration
+}
+
+// WithTaskID specifies the ID of the task rather than having a new one generated, e.g. so the caller can report it
+func WithTaskID(id uuids.UUID) TaskOption {
+	return func(o *taskOptions) { o.taskID = id }
+}
+
+// WithRunAt specifies that a task shouldn't be delivered to workers before the given time
+func WithRunAt(t time.Time) TaskOption {
+	return func(o *taskOptions) { o.runAt = t }
+}
+
+// WithDedupeKey specifies a key which is held for the given duration after the task is added, during which
+// adding another task to the same queue with the same key does nothing. Durations of less than a millisecond, which
+// redis can't hold a key for, are replaced by a default of an hour.
+func WithDedupeKey(key string, ttl time.Duration) TaskOption {
+	if ttl < time.Millisecond {
+		ttl = defaultDedupeTTL
+	}
+	return func(o *taskOptions) { o.dedupeKey, o.dedupeTTL = key, ttl }
+}
+
+// IdempotencyOptions returns the task ID and options to use when adding a task of the given type for the given org on
+// behalf of a caller which provided the given idempotency key. The key is held for a day during which repeats add
+// nothing, and the task ID is derived from it so that repeats get the same task ID. An empty key gives a new task ID
+// and no deduping.
+func IdempotencyOptions(taskType string, orgID int, key string) (uuids.UUID, []TaskOption) {
+	if key == "" {
+		taskID := uuids.New()
+		return taskID, []TaskOption{WithTaskID(taskID)}
+	}
+
+	dedupeKey := fmt.Sprintf("%s:%d:%s", taskType, orgID, key)
+	taskID := keyedUUID(dedupeKey)
+
+	return taskID, []TaskOption{WithTaskID(taskID), WithDedupeKey(dedupeKey, idempotencyKeyTTL)}
+}
+
+// generates a name based (version 5) UUID from the passed in key
+func keyedUUID(key string) uuids.UUID {
+	h := sha1.Sum([]byte(key))
+	h[6] = (h[6] & 0x0f) | 0x50
+	h[8] = (h[8] & 0x3f) | 0x80
+
+	return uuids.UUID(fmt.Sprintf("%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16]))
+}
+
 // AddTask adds the passed in task to our queue for execution
-func AddTask(rc redis.Conn, queue string, taskType string, orgID int, task interface{}, priority Priority) error {
-	score := strconv.FormatFloat(float64(time.Now().UnixNano()/int64(time.Microsecond))/float64(1000000)+float64(priority), 'f', 6, 64)
+func AddTask(rc redis.Conn, queue string, taskType string, orgID int, task interface{}, priority Priority, opts ...TaskOption) error {
+	options := &taskOptions{}
+	for _, o := range opts {
+		o(options)
+	}
 
 	taskBody, err := json.Marshal(task)
 	if err != nil {
@@ -91,89 +243,475 @@ func AddTask(rc redis.Conn, queue string, taskType string, orgID int, task inter
 	}
 
 	payload := &Task{
+		ID:       options.taskID,
 		Type:     taskType,
 		OrgID:    orgID,
 		Task:     taskBody,
 		QueuedOn: time.Now(),
+		Priority: priority,
 	}
-	jsonPayload, err := json.Marshal(payload)
+	if payload.ID == "" {
+		payload.ID = uuids.New()
+	}
+
+	// if we have a dedupe key, try to claim it and if it's already held, this task is a duplicate so do nothing
+	var dedupeKey string
+	if options.dedupeKey != "" {
+		dedupeKey = fmt.Sprintf(dedupePattern, queue, options.dedupeKey)
+
+		_, err := redis.String(rc.Do("set", dedupeKey, payload.QueuedOn.Format(time.RFC3339Nano), "nx", "px", options.dedupeTTL.Milliseconds()))
+		if err == redis.ErrNil {
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "error claiming dedupe key: %s", options.dedupeKey)
+		}
+	}
+
+	// record the status of our task before it can be picked up by a worker
+	err = SetTaskStatus(rc, queue, payload, TaskStatusQueued, nil)
+	if err == nil {
+		if !options.runAt.IsZero() && options.runAt.After(payload.QueuedOn) {
+			err = delayTask(rc, queue, payload, options.runAt)
+		} else {
+			err = queueTask(rc, queue, payload)
+		}
+	}
+
+	// if we failed to add the task, release our dedupe key so it can be retried
+	if err != nil && dedupeKey != "" {
+		rc.Do("del", dedupeKey)
+	}
+
+	return err
+}
+
+// queues the passed in task payload, scoring it by the current time adjusted by its priority
+func queueTask(rc redis.Conn, queue string, task *Task) error {
+	score := strconv.FormatFloat(float64(time.Now().UnixNano()/int64(time.Microsecond))/float64(1000000)+float64(task.Priority), 'f', 6, 64)
+
+	jsonPayload, err := json.Marshal(task)
 	if err != nil {
 		return err
 	}
 
-	rc.Send("zadd", fmt.Sprintf(queuePattern, queue, orgID), score, jsonPayload)
-	rc.Send("zincrby", fmt.Sprintf(activePattern, queue), 0, orgID)
+	rc.Send("zadd", fmt.Sprintf(queuePattern, queue, task.OrgID), score, jsonPayload)
+	rc.Send("zincrby", fmt.Sprintf(activePattern, queue), 0, task.OrgID)
+
+	// and wake up anybody waiting for tasks on this queue
+	rc.Send("rpush", fmt.Sprintf(wakeupPattern, queue), 1)
+	rc.Send("ltrim", fmt.Sprintf(wakeupPattern, queue), -maxWakeups, -1)
 	_, err = rc.Do("")
 	return err
 }
 
-var popTask = redis.NewScript(1, `-- KEYS: [QueueName]
-    -- first get what is the active queue
-	local result = redis.call("zrange", KEYS[1] .. ":active", 0, 0, "WITHSCORES")
+// WaitForTask blocks until a task has been added to the passed in queue, a task has been completed for an org with
+// more tasks, a delayed task has become due or the timeout is reached, returning whether there might be a task to
+// pop. Note that the timeout is rounded up to the nearest second and a task being added doesn't guarantee that it
+// will still be available when the caller tries to pop it.
+func WaitForTask(rc redis.Conn, queue string, timeout time.Duration) (bool, error) {
+	// if a delayed task will become due before our timeout, only wait until then
+	nextDue, err := redis.Strings(rc.Do("zrange", fmt.Sprintf(delayedPattern, queue), 0, 0, "WITHSCORES"))
+	if err != nil {
+		return false, errors.Wrapf(err, "error getting next delayed task on: %s", queue)
+	}
+	if len(nextDue) == 2 {
+		due, _ := strconv.ParseFloat(nextDue[1], 64)
+		untilDue := time.Until(time.UnixMicro(int64(due * 1000000)))
+
+		if untilDue < timeout {
+			// blocking pops are only precise to the second so sleep for shorter waits
+			if untilDue < time.Second {
+				time.Sleep(untilDue)
+				return true, nil
+			}
+			timeout = untilDue
+		}
+	}
 
-	-- nothing? return nothing
-	local group = result[1]
-	if not group then
-		return {"empty", ""}
-	end
+	seconds := int(math.Ceil(timeout.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
 
-	local queue = KEYS[1] .. ":" .. group
+	_, err = redis.Values(rc.Do("blpop", fmt.Sprintf(wakeupPattern, queue), seconds))
+	if err == redis.ErrNil {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "error waiting for task on: %s", queue)
+	}
+	return true, nil
+}
 
-	-- pop off our queue
-	local result = redis.call("zrangebyscore", queue, 0, "+inf", "WITHSCORES", "LIMIT", 0, 1)
+// adds the passed in task payload to the delayed set of the queue, from which it will be moved onto its org
+// queue by the pop script once the given time has passed
+func delayTask(rc redis.Conn, queue string, task *Task, runAt time.Time) error {
+	jsonPayload, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
 
-	-- found a result?
-	if result[1] then
-		-- then remove it from the queue
-		redis.call('zremrangebyrank', queue, 0, 0)
+	_, err = rc.Do("zadd", fmt.Sprintf(delayedPattern, queue), timestamp(runAt), jsonPayload)
+	return err
+}
 
-		-- and add a worker to this queue
-		redis.call("zincrby", KEYS[1] .. ":active", 1, group)
+// ActiveOrgs returns the number of orgs in the passed in queue which have queued tasks or workers
+func ActiveOrgs(rc redis.Conn, queue string) (int, error) {
+	count, err := redis.Int(rc.Do("zcard", fmt.Sprintf(activePattern, queue)))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error getting active orgs of: %s", queue)
+	}
+	return count, nil
+}
+
+// DelayedSize returns the number of tasks in the passed in queue which aren't yet due
+func DelayedSize(rc redis.Conn, queue string) (int, error) {
+	size, err := redis.Int(rc.Do("zcard", fmt.Sprintf(delayedPattern, queue)))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error getting delayed size of: %s", queue)
+	}
+	return size, nil
+}
 
-		return {group, result[1]}
-	else
-		-- no result found, remove this group from active queues
-		redis.call("zrem", KEYS[1] .. ":active", group)
+var popTask = redis.NewScript(1, `-- KEYS: [QueueName] ARGV: [Now, MaxWakeups]
+	-- move any delayed tasks which are now due onto their org queues, scored by when they were due plus their priority
+	local due = redis.call("zrangebyscore", KEYS[1] .. ":delayed", 0, ARGV[1], "LIMIT", 0, 100, "WITHSCORES")
+	for i = 1, #due, 2 do
+		local payload = due[i]
+		local task = cjson.decode(payload)
+		local org = string.format("%d", task["org_id"])
+		local score = tonumber(due[i + 1]) + (tonumber(task["priority"]) or 0)
+
+		redis.call("zadd", KEYS[1] .. ":" .. org, string.format("%.6f", score), payload)
+		redis.call("zincrby", KEYS[1] .. ":active", 0, org)
+		redis.call("zrem", KEYS[1] .. ":delayed", payload)
+
+		-- and wake up anybody waiting for tasks on this queue
+		redis.call("rpush", KEYS[1] .. ":wakeup", 1)
+	end
+	if #due > 0 then
+		redis.call("ltrim", KEYS[1] .. ":wakeup", -ARGV[2], -1)
+	end
 
-		return {"retry", ""}
+	-- find the org with the fewest active workers which hasn't reached its max workers, looking at active orgs a page
+	-- at a time and only fetching the limits of the orgs on each page
+	local active_key = KEYS[1] .. ":active"
+	local limits_key = KEYS[1] .. ":max_workers"
+	local default_limit = tonumber(redis.call("hget", limits_key, "default")) or 0
+
+	-- if there are no per-org limits, then once we reach an org at the default limit, all the orgs after it are too
+	local only_default = default_limit > 0 and redis.call("hlen", limits_key) == 1
+
+	local page_size = 25
+	local offset = 0
+
+	while true do
+		local active = redis.call("zrange", active_key, offset, offset + page_size - 1, "WITHSCORES")
+		if #active == 0 then
+			break
+		end
+
+		local groups = {}
+		for i = 1, #active, 2 do
+			groups[#groups + 1] = active[i]
+		end
+		local limits = redis.call("hmget", limits_key, unpack(groups))
+		local removed = 0
+
+		for i = 1, #active, 2 do
+			local group = active[i]
+			local workers = tonumber(active[i + 1])
+			local limit = tonumber(limits[(i + 1) / 2]) or default_limit
+
+			if limit > 0 and workers >= limit then
+				if only_default then
+					return {"empty", ""}
+				end
+			else
+				local queue = KEYS[1] .. ":" .. group
+
+				-- pop off our queue
+				local result = redis.call("zrangebyscore", queue, 0, "+inf", "WITHSCORES", "LIMIT", 0, 1)
+
+				-- found a result?
+				if result[1] then
+					-- then remove it from the queue
+					redis.call('zremrangebyrank', queue, 0, 0)
+
+					-- and add a worker to this queue
+					redis.call("zincrby", active_key, 1, group)
+
+					return {group, result[1]}
+				elseif workers <= 0 then
+					-- no result found and no workers, remove this group from active queues, otherwise it stays so that
+					-- we don't lose its count of workers, and is removed when its last task completes
+					redis.call("zrem", active_key, group)
+					removed = removed + 1
+				end
+			end
+		end
+
+		offset = offset + page_size - removed
 	end
+
+	-- nothing to do, either no tasks or every org with tasks is at its limit
+	return {"empty", ""}
 `)
 
 // PopNextTask pops the next task off our queue
 func PopNextTask(rc redis.Conn, queue string) (*Task, error) {
-	task := Task{}
-	for {
-		values, err := redis.Strings(popTask.Do(rc, queue))
-		if err != nil {
-			return nil, err
-		}
-
-		if values[0] == "empty" {
-			return nil, nil
-		}
-
-		if values[0] == "retry" {
-			continue
-		}
+	values, err := redis.Strings(popTask.Do(rc, queue, timestamp(time.Now()), maxWakeups))
+	if err != nil {
+		return nil, err
+	}
 
-		err = json.Unmarshal([]byte(values[1]), &task)
-		return &task, err
+	if values[0] == "empty" {
+		return nil, nil
 	}
+
+	task := &Task{}
+	err = json.Unmarshal([]byte(values[1]), task)
+	return task, err
 }
 
-var markComplete = redis.NewScript(2, `-- KEYS: [QueueName] [TaskGroup]
+var markComplete = redis.NewScript(2, `-- KEYS: [QueueName] [TaskGroup] ARGV: [MaxWakeups]
 	-- decrement our active
 	local active = tonumber(redis.call("zincrby", KEYS[1] .. ":active", -1, KEYS[2]))
+	local queued = redis.call("zcard", KEYS[1] .. ":" .. KEYS[2])
+
+	if active <= 0 then
+		-- if that was the last worker and there are no more tasks, remove this group from active queues
+		if queued == 0 then
+			redis.call("zrem", KEYS[1] .. ":active", KEYS[2])
 
-	-- reset to zero if we somehow go below
-	if active < 0 then
-		redis.call("zadd", KEYS[1] .. ":active", 0, KEYS[2])
+		-- reset to zero if we somehow go below
+		elseif active < 0 then
+			redis.call("zadd", KEYS[1] .. ":active", 0, KEYS[2])
+		end
+	end
+
+	-- if this group has tasks, which it may not have been able to pop because of its max workers, wake up anybody
+	-- waiting for tasks on this queue
+	if queued > 0 then
+		redis.call("rpush", KEYS[1] .. ":wakeup", 1)
+		redis.call("ltrim", KEYS[1] .. ":wakeup", -ARGV[1], -1)
 	end
 `)
 
 // MarkTaskComplete marks the passed in task as complete. Callers must call this in order
 // to maintain fair workers across orgs
 func MarkTaskComplete(rc redis.Conn, queue string, orgID int) error {
-	_, err := markComplete.Do(rc, queue, strconv.FormatInt(int64(orgID), 10))
+	_, err := markComplete.Do(rc, queue, strconv.FormatInt(int64(orgID), 10), maxWakeups)
 	return err
 }
+
+// SetMaxWorkers sets the maximum number of workers which can be working on tasks for the given org at once in
+// the passed in queue. An org of 0 sets the default for all orgs without their own limit, and a limit of 0
+// removes the limit.
+func SetMaxWorkers(rc redis.Conn, queue string, orgID int, limit int) error {
+	field := "default"
+	if orgID != 0 {
+		field = strconv.Itoa(orgID)
+	}
+
+	var err error
+	if limit > 0 {
+		_, err = rc.Do("hset", fmt.Sprintf(maxWorkersPattern, queue), field, limit)
+	} else {
+		_, err = rc.Do("hdel", fmt.Sprintf(maxWorkersPattern, queue), field)
+	}
+	return errors.Wrapf(err, "error setting max workers for queue: %s", queue)
+}
+
+// GetMaxWorkers gets the default and per-org maximum number of workers for the passed in queue
+func GetMaxWorkers(rc redis.Conn, queue string) (int, map[int]int, error) {
+	values, err := redis.IntMap(rc.Do("hgetall", fmt.Sprintf(maxWorkersPattern, queue)))
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "error getting max workers for queue: %s", queue)
+	}
+
+	def := 0
+	orgs := make(map[int]int, len(values))
+	for field, limit := range values {
+		if field == "default" {
+			def = limit
+		} else {
+			orgID, _ := strconv.Atoi(field)
+			orgs[orgID] = limit
+		}
+	}
+
+	return def, orgs, nil
+}
+
+// RetryBackoff returns how long to wait before retrying a task which has failed the given number of times,
+// doubling the initial backoff with each failure
+func RetryBackoff(initial time.Duration, errorCount int) time.Duration {
+	if errorCount < 1 {
+		errorCount = 1
+	}
+	return initial * time.Duration(1<<(errorCount-1))
+}
+
+// RetryTask schedules the passed in task to be put back on its queue after the given delay. Callers are
+// expected to have already incremented the error count of the task.
+func RetryTask(rc redis.Conn, queue string, task *Task, delay time.Duration) error {
+	return delayTask(rc, queue, task, time.Now().Add(delay))
+}
+
+// DeadLetter is a task which failed too many times and has been moved out of its queue
+type DeadLetter struct {
+	ID       uuids.UUID `json:"id"`
+	Task     *Task      `json:"task"`
+	Error    string     `json:"error"`
+	FailedOn time.Time  `json:"failed_on"`
+}
+
+var addDeadLetter = redis.NewScript(1, `-- KEYS: [QueueName] ARGV: [ID, FailedOn, Payload, MinFailedOn, MaxLetters]
+	local dead_key = KEYS[1] .. ":dead"
+	local letters_key = KEYS[1] .. ":dead:letters"
+
+	redis.call("zadd", dead_key, ARGV[2], ARGV[1])
+	redis.call("hset", letters_key, ARGV[1], ARGV[3])
+
+	-- trim letters which are too old, and then the oldest letters if there are still too many
+	local expired = redis.call("zrangebyscore", dead_key, "-inf", "(" .. ARGV[4])
+	local excess = redis.call("zcard", dead_key) - #expired - tonumber(ARGV[5])
+	if excess > 0 then
+		expired = redis.call("zrange", dead_key, 0, #expired + excess - 1)
+	end
+	for i = 1, #expired do
+		redis.call("zrem", dead_key, expired[i])
+		redis.call("hdel", letters_key, expired[i])
+	end
+`)
+
+// AddDeadLetter moves the passed in task to the dead letter set of the given queue, trimming letters which are older
+// than the max age or beyond the max number of letters
+func AddDeadLetter(rc redis.Conn, queue string, task *Task, taskErr error) (*DeadLetter, error) {
+	letter := &DeadLetter{ID: uuids.New(), Task: task, Error: taskErr.Error(), FailedOn: time.Now()}
+
+	payload, err := json.Marshal(letter)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = addDeadLetter.Do(rc, queue, letter.ID, timestamp(letter.FailedOn), payload, timestamp(letter.FailedOn.Add(-deadLetterMaxAge)), maxDeadLetters)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error adding dead letter to: %s", queue)
+	}
+
+	return letter, nil
+}
+
+// DeadLetters returns the dead letters for the passed in queue, most recent first
+func DeadLetters(rc redis.Conn, queue string, limit int) ([]*DeadLetter, error) {
+	ids, err := redis.Strings(rc.Do("zrevrange", fmt.Sprintf(deadPattern, queue), 0, limit-1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting dead letters for: %s", queue)
+	}
+	if len(ids) == 0 {
+		return []*DeadLetter{}, nil
+	}
+
+	args := redis.Args{}.Add(fmt.Sprintf(deadLetterPattern, queue)).AddFlat(ids)
+	payloads, err := redis.ByteSlices(rc.Do("hmget", args...))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting dead letters for: %s", queue)
+	}
+
+	letters := make([]*DeadLetter, 0, len(payloads))
+	for _, payload := range payloads {
+		if payload == nil {
+			continue
+		}
+		letter := &DeadLetter{}
+		if err := json.Unmarshal(payload, letter); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling dead letter")
+		}
+		letters = append(letters, letter)
+	}
+
+	sort.SliceStable(letters, func(i, j int) bool { return letters[i].FailedOn.After(letters[j].FailedOn) })
+
+	return letters, nil
+}
+
+// GetDeadLetter returns the dead letter with the given id in the passed in queue, or nil if it doesn't exist
+func GetDeadLetter(rc redis.Conn, queue string, id uuids.UUID) (*DeadLetter, error) {
+	payload, err := redis.Bytes(rc.Do("hget", fmt.Sprintf(deadLetterPattern, queue), id))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting dead letter %s", id)
+	}
+
+	letter := &DeadLetter{}
+	if err := json.Unmarshal(payload, letter); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshalling dead letter %s", id)
+	}
+	return letter, nil
+}
+
+var requeueDeadLetter = redis.NewScript(1, `-- KEYS: [QueueName] ARGV: [ID, OrgID, Score, Payload, MaxWakeups]
+	-- only the caller which removes the letter gets to requeue its task
+	if redis.call("hdel", KEYS[1] .. ":dead:letters", ARGV[1]) == 0 then
+		return 0
+	end
+	redis.call("zrem", KEYS[1] .. ":dead", ARGV[1])
+
+	redis.call("zadd", KEYS[1] .. ":" .. ARGV[2], ARGV[3], ARGV[4])
+	redis.call("zincrby", KEYS[1] .. ":active", 0, ARGV[2])
+
+	-- and wake up anybody waiting for tasks on this queue
+	redis.call("rpush", KEYS[1] .. ":wakeup", 1)
+	redis.call("ltrim", KEYS[1] .. ":wakeup", -ARGV[5], -1)
+	return 1
+`)
+
+// RequeueDeadLetter removes the dead letter with the given id and puts its task back on the queue with
+// its error count reset, as a single atomic step. Returns false if no such dead letter exists.
+func RequeueDeadLetter(rc redis.Conn, queue string, id uuids.UUID) (bool, error) {
+	letter, err := GetDeadLetter(rc, queue, id)
+	if err != nil || letter == nil {
+		return false, err
+	}
+
+	letter.Task.ErrorCount = 0
+
+	payload, err := json.Marshal(letter.Task)
+	if err != nil {
+		return false, err
+	}
+
+	// record the status of our task before it can be picked up by a worker
+	if err := SetTaskStatus(rc, queue, letter.Task, TaskStatusQueued, nil); err != nil {
+		return false, err
+	}
+
+	score := strconv.FormatFloat(float64(time.Now().UnixNano()/int64(time.Microsecond))/float64(1000000)+float64(letter.Task.Priority), 'f', 6, 64)
+
+	requeued, err := redis.Bool(requeueDeadLetter.Do(rc, queue, id, letter.Task.OrgID, score, payload, maxWakeups))
+	if err != nil {
+		return false, errors.Wrapf(err, "error requeuing dead letter %s", id)
+	}
+	return requeued, nil
+}
+
+// DiscardDeadLetter removes the dead letter with the given id. Returns false if no such dead letter exists.
+func DiscardDeadLetter(rc redis.Conn, queue string, id uuids.UUID) (bool, error) {
+	rc.Send("multi")
+	rc.Send("zrem", fmt.Sprintf(deadPattern, queue), id)
+	rc.Send("hdel", fmt.Sprintf(deadLetterPattern, queue), id)
+	removed, err := redis.Ints(rc.Do("exec"))
+	if err != nil {
+		return false, errors.Wrapf(err, "error discarding dead letter %s", id)
+	}
+
+	return removed[1] > 0, nil
+}
+
+// formats the passed in time as a sorted set score
+func timestamp(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano()/int64(time.Microsecond))/float64(1000000), 'f', 6, 64)
+}
@@ -3,8 +3,11 @@ package queue
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -75,3 +78,372 @@ func TestQueues(t *testing.T) {
 		assert.Equal(t, tc.Size, size, "%d: mismatch", i)
 	}
 }
+
+func TestRetriesAndDeadLetters(t *testing.T) {
+	rc, err := redis.Dial("tcp", "localhost:6379")
+	assert.NoError(t, err)
+	rc.Do("del", "test:active", "test:1", "test:delayed", "test:dead", "test:dead:letters")
+
+	assert.Equal(t, time.Second, RetryBackoff(time.Second, 0))
+	assert.Equal(t, time.Second, RetryBackoff(time.Second, 1))
+	assert.Equal(t, time.Second*4, RetryBackoff(time.Second, 3))
+
+	assert.NoError(t, AddTask(rc, "test", "campaign", 1, "task1", DefaultPriority))
+
+	task, err := PopNextTask(rc, "test")
+	assert.NoError(t, err)
+	assert.NoError(t, MarkTaskComplete(rc, "test", 1))
+
+	// schedule a retry in the future, task shouldn't be available yet
+	task.ErrorCount++
+	assert.NoError(t, RetryTask(rc, "test", task, time.Second))
+
+	task, err = PopNextTask(rc, "test")
+	assert.NoError(t, err)
+	assert.Nil(t, task)
+
+	time.Sleep(time.Millisecond * 1100)
+
+	// now it should be back on the queue with its error count
+	task, err = PopNextTask(rc, "test")
+	assert.NoError(t, err)
+	assert.NotNil(t, task)
+	assert.Equal(t, "campaign", task.Type)
+	assert.Equal(t, 1, task.ErrorCount)
+	assert.NoError(t, MarkTaskComplete(rc, "test", 1))
+
+	// move it to our dead letters
+	letter, err := AddDeadLetter(rc, "test", task, errors.New("boom"))
+	assert.NoError(t, err)
+	assert.Equal(t, "boom", letter.Error)
+
+	letters, err := DeadLetters(rc, "test", 10)
+	assert.NoError(t, err)
+	assert.Len(t, letters, 1)
+	assert.Equal(t, letter.ID, letters[0].ID)
+	assert.Equal(t, "campaign", letters[0].Task.Type)
+
+	fetched, err := GetDeadLetter(rc, "test", letter.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "boom", fetched.Error)
+
+	fetched, err = GetDeadLetter(rc, "test", "8720f157-ca1c-432f-9c0b-2014ddc77094")
+	assert.NoError(t, err)
+	assert.Nil(t, fetched)
+
+	// requeue it, should be back on the queue with its error count reset
+	requeued, err := RequeueDeadLetter(rc, "test", letter.ID)
+	assert.NoError(t, err)
+	assert.True(t, requeued)
+
+	letters, err = DeadLetters(rc, "test", 10)
+	assert.NoError(t, err)
+	assert.Len(t, letters, 0)
+
+	task, err = PopNextTask(rc, "test")
+	assert.NoError(t, err)
+	assert.NotNil(t, task)
+	assert.Equal(t, 0, task.ErrorCount)
+	assert.NoError(t, MarkTaskComplete(rc, "test", 1))
+
+	// discarding a dead letter just removes it
+	letter, err = AddDeadLetter(rc, "test", task, errors.New("boom"))
+	assert.NoError(t, err)
+
+	discarded, err := DiscardDeadLetter(rc, "test", letter.ID)
+	assert.NoError(t, err)
+	assert.True(t, discarded)
+
+	discarded, err = DiscardDeadLetter(rc, "test", letter.ID)
+	assert.NoError(t, err)
+	assert.False(t, discarded)
+
+	size, err := Size(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, size)
+}
+
+func TestDelayedTasks(t *testing.T) {
+	rc, err := redis.Dial("tcp", "localhost:6379")
+	assert.NoError(t, err)
+	rc.Do("del", "test:active", "test:1", "test:2", "test:delayed")
+
+	assertPop := func(expected string) {
+		task, err := PopNextTask(rc, "test")
+		assert.NoError(t, err)
+
+		if expected == "" {
+			assert.Nil(t, task)
+		} else if assert.NotNil(t, task) {
+			var value string
+			assert.NoError(t, json.Unmarshal(task.Task, &value))
+			assert.Equal(t, expected, value)
+			assert.NoError(t, MarkTaskComplete(rc, "test", task.OrgID))
+		}
+	}
+
+	// a run at time in the past is the same as no run at time
+	assert.NoError(t, AddTask(rc, "test", "campaign", 1, "task1", DefaultPriority, WithRunAt(time.Now().Add(-time.Minute))))
+	assert.NoError(t, AddTask(rc, "test", "campaign", 1, "task2", DefaultPriority, WithRunAt(time.Now().Add(time.Second))))
+	assert.NoError(t, AddTask(rc, "test", "campaign", 2, "task3", HighPriority, WithRunAt(time.Now().Add(time.Second))))
+	assert.NoError(t, AddTask(rc, "test", "campaign", 2, "task4", DefaultPriority))
+
+	size, err := Size(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, size)
+
+	delayed, err := DelayedSize(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, delayed)
+
+	assertPop("task1")
+	assertPop("task4")
+	assertPop("")
+
+	time.Sleep(time.Millisecond * 1100)
+
+	// delayed tasks are now due and keep their priority
+	delayed, err = DelayedSize(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, delayed)
+
+	assertPop("task2")
+	assertPop("task3")
+	assertPop("")
+
+	delayed, err = DelayedSize(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, delayed)
+}
+
+func TestMaxWorkers(t *testing.T) {
+	rc, err := redis.Dial("tcp", "localhost:6379")
+	assert.NoError(t, err)
+	rc.Do("del", "test:active", "test:1", "test:2", "test:max_workers")
+
+	assertPop := func(expected string) *Task {
+		task, err := PopNextTask(rc, "test")
+		assert.NoError(t, err)
+
+		if expected == "" {
+			assert.Nil(t, task)
+			return nil
+		}
+
+		var value string
+		if assert.NotNil(t, task) {
+			assert.NoError(t, json.Unmarshal(task.Task, &value))
+			assert.Equal(t, expected, value)
+		}
+		return task
+	}
+
+	// set a default of 2 workers per org, but allow org 2 to have 3
+	assert.NoError(t, SetMaxWorkers(rc, "test", 0, 2))
+	assert.NoError(t, SetMaxWorkers(rc, "test", 2, 3))
+
+	def, orgs, err := GetMaxWorkers(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, def)
+	assert.Equal(t, map[int]int{2: 3}, orgs)
+
+	for _, task := range []string{"task1", "task2", "task3", "task4"} {
+		assert.NoError(t, AddTask(rc, "test", "campaign", 1, task, DefaultPriority))
+	}
+	for _, task := range []string{"task5", "task6", "task7", "task8"} {
+		assert.NoError(t, AddTask(rc, "test", "campaign", 2, task, DefaultPriority))
+	}
+
+	assertPop("task1")
+	assertPop("task5")
+	assertPop("task2")
+	assertPop("task6")
+	assertPop("task7") // org 1 is at its limit
+	assertPop("")      // and now so is org 2
+
+	// once an org 1 task completes, we can pop another for org 1
+	assert.NoError(t, MarkTaskComplete(rc, "test", 1))
+	assertPop("task3")
+	assertPop("")
+
+	// remove the default limit and org 1 is no longer limited
+	assert.NoError(t, SetMaxWorkers(rc, "test", 0, 0))
+	assertPop("task4")
+
+	// remove the org 2 override and it's no longer limited either
+	assert.NoError(t, SetMaxWorkers(rc, "test", 2, 0))
+	assertPop("task8")
+	assertPop("")
+
+	def, orgs, err = GetMaxWorkers(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, def)
+	assert.Equal(t, map[int]int{}, orgs)
+
+	// orgs whose queues have emptied keep their count of workers, so limits still apply to tasks added later
+	assert.NoError(t, SetMaxWorkers(rc, "test", 0, 4))
+	assert.NoError(t, AddTask(rc, "test", "campaign", 2, "task9", DefaultPriority))
+	assertPop("")
+	assert.NoError(t, MarkTaskComplete(rc, "test", 2))
+	assertPop("task9")
+}
+
+func TestDedupeKeys(t *testing.T) {
+	rc, err := redis.Dial("tcp", "localhost:6379")
+	assert.NoError(t, err)
+	rc.Do("del", "test:active", "test:1", "test:delayed", "test:dedupe:start1", "test:dedupe:start2", "test:dedupe:start3")
+
+	assert.NoError(t, AddTask(rc, "test", "start_flow", 1, "task1", DefaultPriority, WithDedupeKey("start1", time.Second)))
+	assert.NoError(t, AddTask(rc, "test", "start_flow", 1, "task1", DefaultPriority, WithDedupeKey("start1", time.Second)))
+	assert.NoError(t, AddTask(rc, "test", "start_flow", 1, "task2", DefaultPriority, WithDedupeKey("start2", time.Second)))
+	assert.NoError(t, AddTask(rc, "test", "start_flow", 1, "task3", DefaultPriority))
+
+	size, err := Size(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, size)
+
+	// dedupe keys also apply to delayed tasks
+	assert.NoError(t, AddTask(rc, "test", "start_flow", 1, "task2", DefaultPriority, WithDedupeKey("start2", time.Second), WithRunAt(time.Now().Add(time.Minute))))
+
+	delayed, err := DelayedSize(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, delayed)
+
+	// once the key expires, we can add the task again
+	time.Sleep(time.Millisecond * 1100)
+
+	assert.NoError(t, AddTask(rc, "test", "start_flow", 1, "task1", DefaultPriority, WithDedupeKey("start1", time.Second)))
+
+	size, err = Size(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, size)
+
+	// a key without a usable duration is held for the default duration
+	assert.NoError(t, AddTask(rc, "test", "start_flow", 1, "task4", DefaultPriority, WithDedupeKey("start3", 0)))
+	assert.NoError(t, AddTask(rc, "test", "start_flow", 1, "task4", DefaultPriority, WithDedupeKey("start3", 0)))
+
+	size, err = Size(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, size)
+
+	ttl, err := redis.Int(rc.Do("ttl", "test:dedupe:start3"))
+	assert.NoError(t, err)
+	assert.InDelta(t, 3600, ttl, 5)
+}
+
+func TestIdempotencyOptions(t *testing.T) {
+	// without a key, tasks get new ids and aren't deduped
+	taskID1, opts := IdempotencyOptions("start_flow", 1, "")
+	options := &taskOptions{}
+	for _, o := range opts {
+		o(options)
+	}
+	assert.Equal(t, taskID1, options.taskID)
+	assert.Equal(t, "", options.dedupeKey)
+
+	taskID2, _ := IdempotencyOptions("start_flow", 1, "")
+	assert.NotEqual(t, taskID1, taskID2)
+
+	// with a key, the task id is derived from the key and the key is held for a day
+	taskID1, opts = IdempotencyOptions("start_flow", 1, "abc")
+	options = &taskOptions{}
+	for _, o := range opts {
+		o(options)
+	}
+	assert.Equal(t, taskID1, options.taskID)
+	assert.Equal(t, "start_flow:1:abc", options.dedupeKey)
+	assert.Equal(t, 24*time.Hour, options.dedupeTTL)
+
+	taskID2, _ = IdempotencyOptions("start_flow", 1, "abc")
+	assert.Equal(t, taskID1, taskID2)
+
+	// but keys are scoped by task type and org
+	taskID2, _ = IdempotencyOptions("send_broadcast", 1, "abc")
+	assert.NotEqual(t, taskID1, taskID2)
+	taskID2, _ = IdempotencyOptions("start_flow", 2, "abc")
+	assert.NotEqual(t, taskID1, taskID2)
+
+	// keyed UUIDs are valid version 5 UUIDs
+	assert.Equal(t, uuids.UUID("a9993e36-4706-516a-ba3e-25717850c26c"), keyedUUID("abc"))
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, string(keyedUUID("start_flow:1:abc")))
+}
+
+func TestWaitForTask(t *testing.T) {
+	rc, err := redis.Dial("tcp", "localhost:6379")
+	assert.NoError(t, err)
+	rc.Do("del", "test:active", "test:1", "test:wakeup")
+
+	// no tasks added, so we wait for our timeout
+	start := time.Now()
+	added, err := WaitForTask(rc, "test", time.Second)
+	assert.NoError(t, err)
+	assert.False(t, added)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	// add a task from another connection while we're waiting
+	go func() {
+		rc2, err := redis.Dial("tcp", "localhost:6379")
+		assert.NoError(t, err)
+		defer rc2.Close()
+
+		time.Sleep(time.Millisecond * 100)
+		assert.NoError(t, AddTask(rc2, "test", "campaign", 1, "task1", DefaultPriority))
+	}()
+
+	start = time.Now()
+	added, err = WaitForTask(rc, "test", time.Second*5)
+	assert.NoError(t, err)
+	assert.True(t, added)
+	assert.Less(t, time.Since(start), time.Second)
+
+	task, err := PopNextTask(rc, "test")
+	assert.NoError(t, err)
+	assert.NotNil(t, task)
+
+	// wakeups are capped so they don't accumulate when nobody is waiting
+	for i := 0; i < maxWakeups+10; i++ {
+		assert.NoError(t, AddTask(rc, "test", "campaign", 1, "task", DefaultPriority))
+	}
+	wakeups, err := redis.Int(rc.Do("llen", "test:wakeup"))
+	assert.NoError(t, err)
+	assert.Equal(t, maxWakeups, wakeups)
+}
+
+func TestInspect(t *testing.T) {
+	rc, err := redis.Dial("tcp", "localhost:6379")
+	assert.NoError(t, err)
+	rc.Do("del", "test:active", "test:1", "test:2", "test:delayed")
+
+	infos, err := Inspect(rc, "test", 2)
+	assert.NoError(t, err)
+	assert.Len(t, infos, 0)
+
+	assert.NoError(t, AddTask(rc, "test", "start_flow", 1, "task1", DefaultPriority))
+	assert.NoError(t, AddTask(rc, "test", "send_broadcast", 1, "task2", DefaultPriority))
+	assert.NoError(t, AddTask(rc, "test", "start_flow", 2, "task3", DefaultPriority))
+	assert.NoError(t, AddTask(rc, "test", "start_flow", 2, "task4", DefaultPriority))
+	assert.NoError(t, AddTask(rc, "test", "start_flow", 2, "task5", DefaultPriority))
+	assert.NoError(t, AddTask(rc, "test", "start_flow", 2, "task6", DefaultPriority))
+	assert.NoError(t, AddTask(rc, "test", "send_broadcast", 2, "task7", DefaultPriority))
+
+	// pop a task from org 1 so that it has a worker
+	task, err := PopNextTask(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, `"task1"`, string(task.Task))
+
+	infos, err = Inspect(rc, "test", 2)
+	assert.NoError(t, err)
+	assert.Len(t, infos, 2)
+
+	assert.Equal(t, 2, infos[0].OrgID)
+	assert.Equal(t, 5, infos[0].Depth)
+	assert.Equal(t, 0, infos[0].Workers)
+	assert.Equal(t, map[string]int{"start_flow": 3, "send_broadcast": 1}, infos[0].TaskTypes) // sample of 4 tasks
+	assert.False(t, infos[0].OldestQueuedOn.IsZero())
+
+	assert.Equal(t, 1, infos[1].OrgID)
+	assert.Equal(t, 1, infos[1].Depth)
+	assert.Equal(t, 1, infos[1].Workers)
+	assert.Equal(t, map[string]int{"send_broadcast": 1}, infos[1].TaskTypes)
+	assert.True(t, infos[1].OldestQueuedOn.Before(infos[0].OldestQueuedOn))
+}
@@ -0,0 +1,166 @@
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/pkg/errors"
+)
+
+// TaskStatus is the status of a queued task
+type TaskStatus string
+
+// possible values for task statuses
+const (
+	TaskStatusQueued  = TaskStatus("queued")
+	TaskStatusRunning = TaskStatus("running")
+	TaskStatusDone    = TaskStatus("done")
+	TaskStatusFailed  = TaskStatus("failed")
+)
+
+const (
+	taskStatusPattern = "task:%s"
+
+	// how long we keep status records of tasks which are still queued or running, and of tasks which have finished
+	activeTaskStatusTTL   = time.Hour * 24 * 7
+	finishedTaskStatusTTL = time.Hour * 6
+)
+
+// status records are only kept for the types of task which can be cancelled or whose IDs are reported to callers, so
+// that we're not writing records for every handler task
+var trackedTaskTypes = map[string]bool{StartFlow: true, SendBroadcast: true}
+
+// TrackTaskType registers a type of task as one which has status records
+func TrackTaskType(taskType string) {
+	trackedTaskTypes[taskType] = true
+}
+
+// IsTaskTracked returns whether status records are kept for the passed in task
+func IsTaskTracked(task *Task) bool {
+	return task.ID != "" && trackedTaskTypes[task.Type]
+}
+
+// TaskRecord is the status record of a task, including whether it has been cancelled
+type TaskRecord struct {
+	ID         uuids.UUID `json:"id"`
+	Queue      string     `json:"queue"`
+	Type       string     `json:"type"`
+	OrgID      int        `json:"org_id"`
+	Status     TaskStatus `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	ErrorCount int        `json:"error_count"`
+	Cancelled  bool       `json:"cancelled"`
+	QueuedOn   time.Time  `json:"queued_on"`
+	StartedOn  *time.Time `json:"started_on,omitempty"`
+	EndedOn    *time.Time `json:"ended_on,omitempty"`
+}
+
+// SetTaskStatus updates the status record of the passed in task. Tasks without IDs or of types which aren't tracked
+// are ignored. The error of the record is cleared if no error is given.
+func SetTaskStatus(rc redis.Conn, queue string, task *Task, status TaskStatus, taskErr error) error {
+	if !IsTaskTracked(task) {
+		return nil
+	}
+
+	key := fmt.Sprintf(taskStatusPattern, task.ID)
+	now := time.Now()
+	ttl := activeTaskStatusTTL
+
+	args := redis.Args{}.Add(key).Add(
+		"queue", queue,
+		"type", task.Type,
+		"org_id", task.OrgID,
+		"status", status,
+		"error_count", task.ErrorCount,
+		"queued_on", task.QueuedOn.Format(time.RFC3339Nano),
+	)
+
+	switch status {
+	case TaskStatusRunning:
+		args = args.Add("started_on", now.Format(time.RFC3339Nano))
+	case TaskStatusDone, TaskStatusFailed:
+		args = args.Add("ended_on", now.Format(time.RFC3339Nano))
+		ttl = finishedTaskStatusTTL
+	}
+	if taskErr != nil {
+		args = args.Add("error", taskErr.Error())
+	}
+
+	rc.Send("multi")
+	rc.Send("hset", args...)
+	if taskErr == nil {
+		rc.Send("hdel", key, "error")
+	}
+	rc.Send("pexpire", key, ttl.Milliseconds())
+	_, err := rc.Do("exec")
+	return errors.Wrapf(err, "error setting status of task %s", task.ID)
+}
+
+// GetTaskRecord returns the status record of the task with the given ID, or nil if it doesn't exist
+func GetTaskRecord(rc redis.Conn, id uuids.UUID) (*TaskRecord, error) {
+	values, err := redis.StringMap(rc.Do("hgetall", fmt.Sprintf(taskStatusPattern, id)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting status of task %s", id)
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	record := &TaskRecord{
+		ID:        id,
+		Queue:     values["queue"],
+		Type:      values["type"],
+		Status:    TaskStatus(values["status"]),
+		Error:     values["error"],
+		Cancelled: values["cancelled"] == "1",
+	}
+	record.OrgID, _ = strconv.Atoi(values["org_id"])
+	record.ErrorCount, _ = strconv.Atoi(values["error_count"])
+	record.QueuedOn, _ = time.Parse(time.RFC3339Nano, values["queued_on"])
+
+	if v, ok := values["started_on"]; ok {
+		t, _ := time.Parse(time.RFC3339Nano, v)
+		record.StartedOn = &t
+	}
+	if v, ok := values["ended_on"]; ok {
+		t, _ := time.Parse(time.RFC3339Nano, v)
+		record.EndedOn = &t
+	}
+
+	return record, nil
+}
+
+var cancelTask = redis.NewScript(1, `-- KEYS: [TaskKey]
+	-- only flag tasks which still have a record, so that we never recreate an expired record without its TTL
+	if redis.call("exists", KEYS[1]) == 0 then
+		return 0
+	end
+	redis.call("hset", KEYS[1], "cancelled", 1)
+	return 1
+`)
+
+// CancelTask flags the task with the given ID as cancelled. Tasks which support cancellation check this flag as they
+// run. Returns false if the task has no status record.
+func CancelTask(rc redis.Conn, id uuids.UUID) (bool, error) {
+	cancelled, err := redis.Bool(cancelTask.Do(rc, fmt.Sprintf(taskStatusPattern, id)))
+	if err != nil {
+		return false, errors.Wrapf(err, "error cancelling task %s", id)
+	}
+	return cancelled, nil
+}
+
+// IsTaskCancelled returns whether the task with the given ID has been cancelled
+func IsTaskCancelled(rc redis.Conn, id uuids.UUID) (bool, error) {
+	if id == "" {
+		return false, nil
+	}
+
+	cancelled, err := redis.Bool(rc.Do("hget", fmt.Sprintf(taskStatusPattern, id), "cancelled"))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	return cancelled, errors.Wrapf(err, "error checking if task %s is cancelled", id)
+}
@@ -15,9 +15,12 @@ import (
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/core/queue"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/metrics"
+	"github.com/nyaruka/mailroom/utils/tracing"
 	"github.com/nyaruka/redisx"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -25,6 +28,8 @@ const (
 	postCommitTimeout = time.Minute
 )
 
+var sprintDuration = metrics.NewHistogram("mailroom_sprint_duration_seconds", "the time taken by the flow engine to start or resume sessions", metrics.DefaultBuckets, "sprint_type")
+
 var startTypeToOrigin = map[models.StartType]string{
 	models.StartTypeManual:    "ui",
 	models.StartTypeAPI:       "api",
@@ -63,6 +68,19 @@ type TriggerBuilder func(contact *flows.Contact) flows.Trigger
 
 // ResumeFlow resumes the passed in session using the passed in session
 func ResumeFlow(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, session *models.Session, contact *models.Contact, resume flows.Resume, hook models.SessionCommitHook) (*models.Session, error) {
+	ctx, span := tracing.Start(ctx, "resume flow",
+		attribute.Int64("mailroom.org_id", int64(oa.OrgID())),
+		attribute.String("mailroom.session_uuid", string(session.UUID())),
+		attribute.String("mailroom.resume_type", resume.Type()),
+	)
+
+	session, err := resumeFlow(ctx, rt, oa, session, contact, resume, hook)
+
+	tracing.End(span, err)
+	return session, err
+}
+
+func resumeFlow(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, session *models.Session, contact *models.Contact, resume flows.Resume, hook models.SessionCommitHook) (*models.Session, error) {
 	start := time.Now()
 	sa := oa.SessionAssets()
 
@@ -78,13 +96,17 @@ func ResumeFlow(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets,
 	}
 
 	// build our flow session
-	fs, err := session.FlowSession(rt.Config, sa, oa.Env())
+	fs, err := session.FlowSession(rt.Config(), sa, oa.Env())
 	if err != nil {
 		return nil, errors.Wrapf(err, "unable to create session from output")
 	}
 
 	// resume our session
+	resumeStart := time.Now()
+	_, sprintSpan := tracing.Start(ctx, "engine sprint")
 	sprint, err := fs.Resume(resume)
+	tracing.End(sprintSpan, err)
+	sprintDuration.Observe(time.Since(resumeStart).Seconds(), "resume")
 
 	// had a problem resuming our flow? bail
 	if err != nil {
@@ -534,6 +556,22 @@ func StartFlow(
 func StartFlowForContacts(
 	ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets,
 	flow *models.Flow, contacts []*models.Contact, triggers []flows.Trigger, hook models.SessionCommitHook, interrupt bool) ([]*models.Session, error) {
+
+	ctx, span := tracing.Start(ctx, "start flow",
+		attribute.Int64("mailroom.org_id", int64(oa.OrgID())),
+		attribute.String("mailroom.flow_uuid", string(flow.UUID())),
+		attribute.Int("mailroom.contacts", len(contacts)),
+	)
+
+	sessions, err := startFlowForContacts(ctx, rt, oa, flow, contacts, triggers, hook, interrupt)
+
+	tracing.End(span, err)
+	return sessions, err
+}
+
+func startFlowForContacts(
+	ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets,
+	flow *models.Flow, contacts []*models.Contact, triggers []flows.Trigger, hook models.SessionCommitHook, interrupt bool) ([]*models.Session, error) {
 	sa := oa.SessionAssets()
 
 	// no triggers? nothing to do
@@ -553,13 +591,16 @@ func StartFlowForContacts(
 		log := log.WithField("contact_uuid", trigger.Contact().UUID())
 		start := time.Now()
 
-		session, sprint, err := goflow.Engine(rt.Config).NewSession(sa, trigger)
+		_, sprintSpan := tracing.Start(ctx, "engine sprint", attribute.String("mailroom.contact_uuid", string(trigger.Contact().UUID())))
+		session, sprint, err := goflow.Engine(rt.Config()).NewSession(sa, trigger)
+		tracing.End(sprintSpan, err)
 		if err != nil {
 			log.WithError(err).Errorf("error starting flow")
 			continue
 		}
 		log.WithField("elapsed", time.Since(start)).Info("flow engine start")
 		analytics.Gauge("mr.flow_start_elapsed", float64(time.Since(start)))
+		sprintDuration.Observe(time.Since(start).Seconds(), "start")
 
 		sessions = append(sessions, session)
 		sprints = append(sprints, sprint)
@@ -749,9 +790,7 @@ func TriggerIVRFlow(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID
 	task := start.CreateBatch(contactIDs, true, len(contactIDs))
 
 	// queue this to our ivr starter, it will take care of creating the calls then calling back in
-	rc := rt.RP.Get()
-	defer rc.Close()
-	err = queue.AddTask(rc, queue.BatchQueue, queue.StartIVRFlowBatch, int(orgID), task, queue.HighPriority)
+	err = rt.Queue.AddTask(queue.BatchQueue, queue.StartIVRFlowBatch, int(orgID), task, queue.HighPriority)
 	if err != nil {
 		return errors.Wrapf(err, "error queuing ivr flow start")
 	}
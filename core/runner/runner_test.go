@@ -256,7 +256,7 @@ func TestResume(t *testing.T) {
 	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetStorage)
 
 	// write sessions to s3 storage
-	rt.Config.SessionStorage = "s3"
+	rt.Config().SessionStorage = "s3"
 
 	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg)
 	require.NoError(t, err)
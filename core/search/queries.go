@@ -20,7 +20,8 @@ type Exclusions struct {
 	NotSeenSinceDays  int  `json:"not_seen_since_days"` // contacts who have not been seen for more than this number of days
 }
 
-// BuildStartQuery builds a start query for the given flow and start options
+// BuildStartQuery builds a start query for the given flow and start options. The flow can be nil when building a query
+// for something other than a flow start, e.g. a broadcast, in which case the started previously exclusion is ignored.
 func BuildStartQuery(oa *models.OrgAssets, flow *models.Flow, groups []*models.Group, contactUUIDs []flows.ContactUUID, urnz []urns.URN, userQuery string, excs Exclusions) (string, error) {
 	var parsedQuery *contactql.ContactQuery
 	var err error
@@ -59,7 +60,7 @@ func buildStartQuery(env envs.Environment, flow *models.Flow, groups []*models.G
 	if excs.InAFlow {
 		exclusions = append(exclusions, contactql.NewCondition("flow", contactql.PropertyTypeAttribute, contactql.OpEqual, ""))
 	}
-	if excs.StartedPreviously {
+	if excs.StartedPreviously && flow != nil {
 		exclusions = append(exclusions, contactql.NewCondition("history", contactql.PropertyTypeAttribute, contactql.OpNotEqual, flow.Name()))
 	}
 	if excs.NotSeenSinceDays > 0 {
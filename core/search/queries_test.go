@@ -120,4 +120,9 @@ func TestBuildStartQuery(t *testing.T) {
 			assert.NoError(t, err)
 		}
 	}
+
+	// without a flow, e.g. for a broadcast, the started previously exclusion is ignored
+	actual, err := search.BuildStartQuery(oa, nil, []*models.Group{doctors}, nil, nil, "", search.Exclusions{NonActive: true, StartedPreviously: true})
+	assert.NoError(t, err)
+	assert.Equal(t, `group = "Doctors" AND status = "active"`, actual)
 }
@@ -10,6 +10,7 @@ import (
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/contactql"
 	"github.com/nyaruka/goflow/contactql/es"
+	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/olivere/elastic/v7"
 	"github.com/pkg/errors"
@@ -116,6 +117,54 @@ func GetContactIDsForQueryPage(ctx context.Context, client *elastic.Client, oa *
 	return parsed, ids, results.Hits.TotalHits.Value, nil
 }
 
+// GetContactLanguageCounts returns how many of the contacts that match the given query have each of the given languages,
+// using a single terms aggregation. Languages which no contacts have are omitted.
+func GetContactLanguageCounts(ctx context.Context, client *elastic.Client, oa *models.OrgAssets, query string, languages []envs.Language) (map[envs.Language]int, error) {
+	start := time.Now()
+	counts := make(map[envs.Language]int, len(languages))
+
+	if client == nil {
+		return nil, errors.Errorf("no elastic client available, check your configuration")
+	}
+	if len(languages) == 0 {
+		return counts, nil
+	}
+
+	parsed, err := contactql.ParseQuery(oa.Env(), query, oa.SessionAssets())
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing query: %s", query)
+	}
+
+	eq := BuildElasticQuery(oa, nil, models.NilContactStatus, nil, parsed)
+
+	values := make([]interface{}, len(languages))
+	for i, lang := range languages {
+		values[i] = string(lang)
+	}
+	agg := elastic.NewTermsAggregation().Field("language").IncludeValues(values...).Size(len(languages))
+
+	s := client.Search("contacts").Routing(strconv.FormatInt(int64(oa.OrgID()), 10))
+	s = s.Size(0).Query(eq).Aggregation("languages", agg)
+
+	results, err := s.Do(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error performing language count query")
+	}
+
+	buckets, ok := results.Aggregations.Terms("languages")
+	if !ok {
+		return nil, errors.New("language count query returned no aggregation")
+	}
+	for _, b := range buckets.Buckets {
+		lang, _ := b.Key.(string)
+		counts[envs.Language(lang)] = int(b.DocCount)
+	}
+
+	logrus.WithFields(logrus.Fields{"org_id": oa.OrgID(), "query": query, "elapsed": time.Since(start), "languages": len(counts)}).Debug("contact language count query complete")
+
+	return counts, nil
+}
+
 // GetContactIDsForQuery returns up to limit the contact ids that match the given query without sorting. Limit of -1 means return all.
 func GetContactIDsForQuery(ctx context.Context, client *elastic.Client, oa *models.OrgAssets, query string, limit int) ([]models.ContactID, error) {
 	env := oa.Env()
@@ -31,17 +31,14 @@ func reportAnalytics(ctx context.Context, rt *runtime.Runtime) error {
 	// the items in our queues.
 	time.Sleep(time.Second * 15)
 
-	rc := rt.RP.Get()
-	defer rc.Close()
-
 	// calculate size of batch queue
-	batchSize, err := queue.Size(rc, queue.BatchQueue)
+	batchSize, err := rt.Queue.Size(queue.BatchQueue)
 	if err != nil {
 		logrus.WithError(err).Error("error calculating batch queue size")
 	}
 
 	// and size of handler queue
-	handlerSize, err := queue.Size(rc, queue.HandlerQueue)
+	handlerSize, err := rt.Queue.Size(queue.HandlerQueue)
 	if err != nil {
 		logrus.WithError(err).Error("error calculating handler queue size")
 	}
@@ -20,6 +20,10 @@ var registeredTypes = map[string](func() Task){}
 func RegisterType(name string, initFunc func() Task) {
 	registeredTypes[name] = initFunc
 
+	if r, ok := initFunc().(Retryable); ok && r.Retryable() {
+		mailroom.SetTaskRetryable(name)
+	}
+
 	mailroom.AddTaskFunction(name, func(ctx context.Context, rt *runtime.Runtime, task *queue.Task) error {
 		// decode our task body
 		typedTask, err := ReadTask(task.Type, task.Task)
@@ -43,6 +47,11 @@ type Task interface {
 	Perform(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error
 }
 
+// Retryable is implemented by task types which are idempotent and so can be safely retried if they fail
+type Retryable interface {
+	Retryable() bool
+}
+
 //------------------------------------------------------------------------------------------
 // JSON Encoding / Decoding
 //------------------------------------------------------------------------------------------
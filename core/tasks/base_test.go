@@ -3,6 +3,7 @@ package tasks_test
 import (
 	"testing"
 
+	"github.com/nyaruka/mailroom"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/core/tasks"
 	"github.com/nyaruka/mailroom/core/tasks/contacts"
@@ -22,3 +23,9 @@ func TestReadTask(t *testing.T) {
 	assert.Equal(t, models.GroupID(23), typedTask.GroupID)
 	assert.Equal(t, "gender = F", typedTask.Query)
 }
+
+func TestRetryableTypes(t *testing.T) {
+	assert.True(t, mailroom.IsTaskRetryable(contacts.TypePopulateDynamicGroup))
+	assert.False(t, mailroom.IsTaskRetryable(contacts.TypeImportContactBatch))
+	assert.False(t, mailroom.IsTaskRetryable("start_flow_batch"))
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/gomodule/redigo/redis"
 	"github.com/nyaruka/gocommon/analytics"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/mailroom"
@@ -25,7 +24,7 @@ const (
 var campaignsMarker = redisx.NewIntervalSet("campaign_event", time.Hour*24, 2)
 
 func init() {
-	mailroom.RegisterCron("campaign_event", time.Second*60, false, QueueEventFires)
+	mailroom.RegisterCronExpression("campaign_event", "* * * * *", false, QueueEventFires)
 }
 
 // QueueEventFires looks for all due campaign event fires and queues them to be started
@@ -80,7 +79,7 @@ func QueueEventFires(ctx context.Context, rt *runtime.Runtime) error {
 
 		// if not, queue up current task...
 		if task != nil {
-			err = queueFiresTask(rt.RP, orgID, task)
+			err = queueFiresTask(rt, orgID, task)
 			if err != nil {
 				return errors.Wrapf(err, "error queueing task")
 			}
@@ -101,7 +100,7 @@ func QueueEventFires(ctx context.Context, rt *runtime.Runtime) error {
 
 	// queue our last task if we have one
 	if task != nil {
-		if err := queueFiresTask(rt.RP, orgID, task); err != nil {
+		if err := queueFiresTask(rt, orgID, task); err != nil {
 			return errors.Wrapf(err, "error queueing task")
 		}
 		numTasks++
@@ -118,11 +117,11 @@ func QueueEventFires(ctx context.Context, rt *runtime.Runtime) error {
 	return nil
 }
 
-func queueFiresTask(rp *redis.Pool, orgID models.OrgID, task *FireCampaignEventTask) error {
-	rc := rp.Get()
+func queueFiresTask(rt *runtime.Runtime, orgID models.OrgID, task *FireCampaignEventTask) error {
+	rc := rt.RP.Get()
 	defer rc.Close()
 
-	err := queue.AddTask(rc, queue.BatchQueue, TypeFireCampaignEvent, int(orgID), task, queue.DefaultPriority)
+	err := rt.Queue.AddTask(queue.BatchQueue, TypeFireCampaignEvent, int(orgID), task, queue.DefaultPriority)
 	if err != nil {
 		return errors.Wrap(err, "error queuing task")
 	}
@@ -0,0 +1,67 @@
+package contacts
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/core/tasks"
+	"github.com/nyaruka/mailroom/runtime"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// TypeEraseContacts is the type of the erase contacts task
+const TypeEraseContacts = "erase_contacts"
+
+func init() {
+	tasks.RegisterType(TypeEraseContacts, func() tasks.Task { return &EraseContactsTask{} })
+
+	// callers are given the ID of the task so they can check on its status
+	queue.TrackTaskType(TypeEraseContacts)
+}
+
+// EraseContactsTask is our task to erase everything we have for a batch of contacts
+type EraseContactsTask struct {
+	UserID     models.UserID      `json:"user_id"`
+	ContactIDs []models.ContactID `json:"contact_ids" validate:"required"`
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *EraseContactsTask) Timeout() time.Duration {
+	return time.Hour
+}
+
+// Perform erases each contact in turn, holding its lock so that it can't be handling events at the same time
+func (t *EraseContactsTask) Perform(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error {
+	for _, contactID := range t.ContactIDs {
+		if err := t.eraseContact(ctx, rt, orgID, contactID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *EraseContactsTask) eraseContact(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, contactID models.ContactID) error {
+	locker := models.GetContactLocker(orgID, contactID)
+
+	lock, err := locker.Grab(rt.RP, time.Minute)
+	if err != nil {
+		return errors.Wrapf(err, "error grabbing lock for contact %d", contactID)
+	}
+	if lock == "" {
+		return errors.Errorf("timed out waiting for lock for contact %d", contactID)
+	}
+	defer locker.Release(rt.RP, lock)
+
+	erasure, err := models.EraseContact(ctx, rt, orgID, contactID, t.UserID)
+	if err != nil {
+		return errors.Wrapf(err, "error erasing contact %d", contactID)
+	}
+
+	logrus.WithField("org_id", orgID).WithField("contact_id", contactID).WithField("audit_path", erasure.StoragePath(rt.Config())).Debug("contact erasure audited")
+	return nil
+}
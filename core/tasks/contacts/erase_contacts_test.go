@@ -0,0 +1,41 @@
+package contacts_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/contacts"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEraseContactsTask(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	testdata.InsertIncomingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "Hi", models.MsgStatusHandled)
+	testdata.InsertIncomingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "Hello", models.MsgStatusHandled)
+	testdata.InsertIncomingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.George, "Hey", models.MsgStatusHandled)
+
+	task := &contacts.EraseContactsTask{
+		UserID:     testdata.Admin.ID,
+		ContactIDs: []models.ContactID{testdata.Cathy.ID, testdata.Bob.ID},
+	}
+	err := task.Perform(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contact WHERE is_active = FALSE AND name IS NULL AND (id = $1 OR id = $2)`, testdata.Cathy.ID, testdata.Bob.ID).Returns(2)
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE text != '' AND (contact_id = $1 OR contact_id = $2)`, testdata.Cathy.ID, testdata.Bob.ID).Returns(0)
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contact WHERE is_active = TRUE AND id = $1`, testdata.George.ID).Returns(1)
+	assertdb.Query(t, db, `SELECT text FROM msgs_msg WHERE contact_id = $1`, testdata.George.ID).Returns("Hey")
+
+	// contacts must belong to the org
+	task = &contacts.EraseContactsTask{ContactIDs: []models.ContactID{testdata.Org2Contact.ID}}
+	err = task.Perform(ctx, rt, testdata.Org1.ID)
+	assert.EqualError(t, err, "error erasing contact 20000: error loading contact 20000: sql: no rows in result set")
+}
@@ -35,6 +35,11 @@ func (t *PopulateDynamicGroupTask) Timeout() time.Duration {
 	return time.Hour
 }
 
+// Retryable implements tasks.Retryable as the group is repopulated from scratch
+func (t *PopulateDynamicGroupTask) Retryable() bool {
+	return true
+}
+
 // Perform figures out the membership for a query based group then repopulates it
 func (t *PopulateDynamicGroupTask) Perform(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error {
 	locker := redisx.NewLocker(fmt.Sprintf(populateLockKey, t.GroupID), time.Hour)
@@ -22,8 +22,8 @@ const (
 var expirationsMarker = redisx.NewIntervalSet("run_expirations", time.Hour*24, 2)
 
 func init() {
-	mailroom.RegisterCron("run_expirations", time.Minute, false, HandleWaitExpirations)
-	mailroom.RegisterCron("expire_ivr_calls", time.Minute, false, ExpireVoiceSessions)
+	mailroom.RegisterCronExpression("run_expirations", "* * * * *", false, HandleWaitExpirations)
+	mailroom.RegisterCronExpression("expire_ivr_calls", "* * * * *", false, ExpireVoiceSessions)
 }
 
 // HandleWaitExpirations handles waiting messaging sessions whose waits have expired, resuming those that can be resumed,
@@ -86,7 +86,7 @@ func HandleWaitExpirations(ctx context.Context, rt *runtime.Runtime) error {
 
 		// ok, queue this task
 		task := handler.NewExpirationTask(expiredWait.OrgID, expiredWait.ContactID, expiredWait.SessionID, expiredWait.WaitExpiresOn)
-		err = handler.QueueHandleTask(rc, expiredWait.ContactID, task)
+		err = handler.QueueHandleTask(rt, expiredWait.ContactID, task)
 		if err != nil {
 			return errors.Wrapf(err, "error adding new expiration task")
 		}
@@ -23,7 +23,7 @@ func init() {
 
 // RetryPendingMsgs looks for any pending msgs older than five minutes and queues them to be handled again
 func RetryPendingMsgs(ctx context.Context, rt *runtime.Runtime) error {
-	if !rt.Config.RetryPendingMessages {
+	if !rt.Config().RetryPendingMessages {
 		return nil
 	}
 
@@ -34,7 +34,7 @@ func RetryPendingMsgs(ctx context.Context, rt *runtime.Runtime) error {
 	defer rc.Close()
 
 	// check the size of our handle queue
-	handlerSize, err := queue.Size(rc, queue.HandlerQueue)
+	handlerSize, err := rt.Queue.Size(queue.HandlerQueue)
 	if err != nil {
 		return errors.Wrapf(err, "error finding size of handler queue")
 	}
@@ -85,7 +85,7 @@ func RetryPendingMsgs(ctx context.Context, rt *runtime.Runtime) error {
 		}
 
 		// queue this event up for handling
-		err = QueueHandleTask(rc, contactID, task)
+		err = QueueHandleTask(rt, contactID, task)
 		if err != nil {
 			return errors.Wrapf(err, "error queuing retry for task")
 		}
@@ -326,7 +326,7 @@ func TestMsgEvents(t *testing.T) {
 
 		task := makeMsgTask(tc.org, tc.channel, tc.contact, tc.text)
 
-		err := handler.QueueHandleTask(rc, tc.contact.ID, task)
+		err := handler.QueueHandleTask(rt, tc.contact.ID, task)
 		assert.NoError(t, err, "%d: error adding task", i)
 
 		task, err = queue.PopNextTask(rc, queue.HandlerQueue)
@@ -385,7 +385,7 @@ func TestMsgEvents(t *testing.T) {
 	// force an error by marking our run for fred as complete (our session is still active so this will blow up)
 	db.MustExec(`UPDATE flows_flowrun SET status = 'C', exited_on = NOW() WHERE contact_id = $1`, testdata.Org2Contact.ID)
 	task = makeMsgTask(testdata.Org2, testdata.Org2Channel, testdata.Org2Contact, "red")
-	handler.QueueHandleTask(rc, testdata.Org2Contact.ID, task)
+	handler.QueueHandleTask(rt, testdata.Org2Contact.ID, task)
 
 	// should get requeued three times automatically
 	for i := 0; i < 3; i++ {
@@ -406,7 +406,7 @@ func TestMsgEvents(t *testing.T) {
 
 	// try to resume now
 	task = makeMsgTask(testdata.Org2, testdata.Org2Channel, testdata.Org2Contact, "red")
-	handler.QueueHandleTask(rc, testdata.Org2Contact.ID, task)
+	handler.QueueHandleTask(rt, testdata.Org2Contact.ID, task)
 	task, _ = queue.PopNextTask(rc, queue.HandlerQueue)
 	assert.NotNil(t, task)
 	err = handler.HandleEvent(ctx, rt, task)
@@ -421,7 +421,7 @@ func TestMsgEvents(t *testing.T) {
 
 	// trigger should also not start a new session
 	task = makeMsgTask(testdata.Org2, testdata.Org2Channel, testdata.Org2Contact, "start")
-	handler.QueueHandleTask(rc, testdata.Org2Contact.ID, task)
+	handler.QueueHandleTask(rt, testdata.Org2Contact.ID, task)
 	task, _ = queue.PopNextTask(rc, queue.HandlerQueue)
 	err = handler.HandleEvent(ctx, rt, task)
 	assert.NoError(t, err)
@@ -476,7 +476,7 @@ func TestChannelEvents(t *testing.T) {
 			Task:  eventJSON,
 		}
 
-		err = handler.QueueHandleTask(rc, tc.ContactID, task)
+		err = handler.QueueHandleTask(rt, tc.ContactID, task)
 		assert.NoError(t, err, "%d: error adding task", i)
 
 		task, err = queue.PopNextTask(rc, queue.HandlerQueue)
@@ -515,7 +515,7 @@ func TestTicketEvents(t *testing.T) {
 
 	event := models.NewTicketClosedEvent(modelTicket, testdata.Admin.ID)
 
-	err := handler.QueueTicketEvent(rc, testdata.Cathy.ID, event)
+	err := handler.QueueTicketEvent(rt, testdata.Cathy.ID, event)
 	require.NoError(t, err)
 
 	task, err := queue.PopNextTask(rc, queue.HandlerQueue)
@@ -550,7 +550,7 @@ func TestStopEvent(t *testing.T) {
 		Task:  eventJSON,
 	}
 
-	err = handler.QueueHandleTask(rc, testdata.Cathy.ID, task)
+	err = handler.QueueHandleTask(rt, testdata.Cathy.ID, task)
 	assert.NoError(t, err, "error adding task")
 
 	task, err = queue.PopNextTask(rc, queue.HandlerQueue)
@@ -677,7 +677,7 @@ func TestTimedEvents(t *testing.T) {
 			task = handler.NewTimeoutTask(tc.Org.ID, tc.Contact.ID, sessionID, timeoutOn)
 		}
 
-		err := handler.QueueHandleTask(rc, tc.Contact.ID, task)
+		err := handler.QueueHandleTask(rt, tc.Contact.ID, task)
 		assert.NoError(t, err, "%d: error adding task", i)
 
 		task, err = queue.PopNextTask(rc, queue.HandlerQueue)
@@ -725,7 +725,7 @@ func TestTimedEvents(t *testing.T) {
 	// try to expire the run
 	task := handler.NewExpirationTask(testdata.Org1.ID, testdata.Cathy.ID, sessionID, expiration)
 
-	err = handler.QueueHandleTask(rc, testdata.Cathy.ID, task)
+	err = handler.QueueHandleTask(rt, testdata.Cathy.ID, task)
 	assert.NoError(t, err)
 
 	task, err = queue.PopNextTask(rc, queue.HandlerQueue)
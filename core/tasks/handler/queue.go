@@ -9,17 +9,21 @@ import (
 	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/runtime"
 	"github.com/pkg/errors"
 )
 
 // QueueHandleTask queues a single task for the given contact
-func QueueHandleTask(rc redis.Conn, contactID models.ContactID, task *queue.Task) error {
-	return queueHandleTask(rc, contactID, task, false)
+func QueueHandleTask(rt *runtime.Runtime, contactID models.ContactID, task *queue.Task) error {
+	return queueHandleTask(rt, contactID, task, false)
 }
 
 // queueHandleTask queues a single task for the passed in contact. `front` specifies whether the task
 // should be inserted in front of all other tasks for that contact
-func queueHandleTask(rc redis.Conn, contactID models.ContactID, task *queue.Task, front bool) error {
+func queueHandleTask(rt *runtime.Runtime, contactID models.ContactID, task *queue.Task, front bool) error {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
 	// marshal our task
 	taskJSON, err := json.Marshal(task)
 	if err != nil {
@@ -38,18 +42,18 @@ func queueHandleTask(rc redis.Conn, contactID models.ContactID, task *queue.Task
 		return errors.Wrapf(err, "error adding contact event")
 	}
 
-	return queueContactTask(rc, models.OrgID(task.OrgID), contactID)
+	return queueContactTask(rt, models.OrgID(task.OrgID), contactID)
 }
 
 // pushes a single contact task on our queue. Note this does not push the actual content of the task
 // only that a task exists for the contact, addHandleTask should be used if the task has already been pushed
 // off the contact specific queue.
-func queueContactTask(rc redis.Conn, orgID models.OrgID, contactID models.ContactID) error {
+func queueContactTask(rt *runtime.Runtime, orgID models.OrgID, contactID models.ContactID) error {
 	// create our contact event
 	contactTask := &HandleEventTask{ContactID: contactID}
 
 	// then add a handle task for that contact on our global handler queue
-	err := queue.AddTask(rc, queue.HandlerQueue, queue.HandleContactEvent, int(orgID), contactTask, queue.DefaultPriority)
+	err := rt.Queue.AddTask(queue.HandlerQueue, queue.HandleContactEvent, int(orgID), contactTask, queue.DefaultPriority)
 	if err != nil {
 		return errors.Wrapf(err, "error adding handle event task")
 	}
@@ -57,7 +61,7 @@ func queueContactTask(rc redis.Conn, orgID models.OrgID, contactID models.Contac
 }
 
 // QueueTicketEvent queues a ticket event to be handled
-func QueueTicketEvent(rc redis.Conn, contactID models.ContactID, evt *models.TicketEvent) error {
+func QueueTicketEvent(rt *runtime.Runtime, contactID models.ContactID, evt *models.TicketEvent) error {
 	eventJSON := jsonx.MustMarshal(evt)
 	var task *queue.Task
 
@@ -71,5 +75,5 @@ func QueueTicketEvent(rc redis.Conn, contactID models.ContactID, evt *models.Tic
 		}
 	}
 
-	return queueHandleTask(rc, contactID, task, false)
+	return queueHandleTask(rt, contactID, task, false)
 }
@@ -24,9 +24,11 @@ import (
 	"github.com/nyaruka/mailroom/core/queue"
 	"github.com/nyaruka/mailroom/core/runner"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/tracing"
 	"github.com/nyaruka/null"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -64,16 +66,18 @@ func handleContactEvent(ctx context.Context, rt *runtime.Runtime, task *queue.Ta
 	// acquire the lock for this contact
 	locker := models.GetContactLocker(models.OrgID(task.OrgID), eventTask.ContactID)
 
+	_, lockSpan := tracing.Start(ctx, "contact lock", attribute.Int64("mailroom.contact_id", int64(eventTask.ContactID)))
 	lock, err := locker.Grab(rt.RP, time.Second*10)
+	lockSpan.SetAttributes(attribute.Bool("mailroom.lock_acquired", lock != ""))
+	tracing.End(lockSpan, err)
+
 	if err != nil {
 		return errors.Wrapf(err, "error acquiring lock for contact %d", eventTask.ContactID)
 	}
 
 	// we didn't get the lock within our timeout, skip and requeue for later
 	if lock == "" {
-		rc := rt.RP.Get()
-		defer rc.Close()
-		err = queueContactTask(rc, models.OrgID(task.OrgID), eventTask.ContactID)
+		err = queueContactTask(rt, models.OrgID(task.OrgID), eventTask.ContactID)
 		if err != nil {
 			return errors.Wrapf(err, "error re-adding contact task after failing to get lock")
 		}
@@ -180,12 +184,10 @@ func handleContactEvent(ctx context.Context, rt *runtime.Runtime, task *queue.Ta
 
 			contactEvent.ErrorCount++
 			if contactEvent.ErrorCount < 3 {
-				rc := rt.RP.Get()
-				retryErr := queueHandleTask(rc, eventTask.ContactID, contactEvent, true)
+				retryErr := queueHandleTask(rt, eventTask.ContactID, contactEvent, true)
 				if retryErr != nil {
 					logrus.WithError(retryErr).Error("error requeuing errored contact event")
 				}
-				rc.Close()
 
 				log.WithError(err).WithField("error_count", contactEvent.ErrorCount).Error("error handling contact event")
 				return nil
@@ -58,3 +58,8 @@ func (t *InterruptChannelTask) Perform(ctx context.Context, rt *runtime.Runtime,
 func (*InterruptChannelTask) Timeout() time.Duration {
 	return time.Hour
 }
+
+// Retryable implements tasks.Retryable as interrupting a channel again is harmless
+func (*InterruptChannelTask) Retryable() bool {
+	return true
+}
@@ -29,6 +29,11 @@ func (t *InterruptSessionsTask) Timeout() time.Duration {
 	return time.Hour
 }
 
+// Retryable implements tasks.Retryable as interrupting sessions again is harmless
+func (t *InterruptSessionsTask) Retryable() bool {
+	return true
+}
+
 func (t *InterruptSessionsTask) Perform(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error {
 	db := rt.DB
 
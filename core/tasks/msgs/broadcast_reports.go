@@ -0,0 +1,70 @@
+package msgs
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// how long after being sent we keep refreshing the report of a broadcast, which is long enough for its messages to
+// reach their final statuses and for replies to come in
+const broadcastReportRefreshWindow = 3 * 24 * time.Hour
+
+func init() {
+	mailroom.RegisterCron("refresh_broadcast_reports", time.Minute*5, false, RefreshBroadcastReports)
+}
+
+// RefreshBroadcastReports recomputes and caches the reports of recently sent broadcasts which are stale
+func RefreshBroadcastReports(ctx context.Context, rt *runtime.Runtime) error {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	start := time.Now()
+
+	bcasts, err := models.GetBroadcastsSentSince(ctx, rt.ReadonlyDB, start.Add(-broadcastReportRefreshWindow))
+	if err != nil {
+		return errors.Wrap(err, "error fetching broadcasts to refresh reports for")
+	}
+
+	refreshed := 0
+
+	for _, b := range bcasts {
+		cached, err := models.GetCachedBroadcastReport(rc, b.BroadcastID)
+		if err != nil {
+			return err
+		}
+		if !isBroadcastReportStale(cached, b.SentOn, start) {
+			continue
+		}
+
+		report, err := models.GetBroadcastReport(ctx, rt.ReadonlyDB, b.OrgID, b.BroadcastID, models.DefaultBroadcastReplyHours)
+		if err != nil {
+			return errors.Wrapf(err, "error computing report for broadcast %d", b.BroadcastID)
+		}
+
+		if err := models.CacheBroadcastReport(rc, report); err != nil {
+			return err
+		}
+		refreshed++
+	}
+
+	if refreshed > 0 {
+		logrus.WithField("count", refreshed).WithField("elapsed", time.Since(start)).Info("refreshed broadcast reports")
+	}
+
+	return nil
+}
+
+// a cached report is stale once it's older than a tenth of the time since its broadcast was sent, so reports of newly
+// sent broadcasts are refreshed on every run and those of older broadcasts less often as their messages settle
+func isBroadcastReportStale(report *models.BroadcastReport, sentOn, now time.Time) bool {
+	if report == nil {
+		return true
+	}
+	return now.Sub(report.CreatedOn) >= now.Sub(sentOn)/10
+}
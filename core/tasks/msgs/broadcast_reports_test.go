@@ -0,0 +1,77 @@
+package msgs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/msgs"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshBroadcastReports(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	// nothing to refresh
+	err := msgs.RefreshBroadcastReports(ctx, rt)
+	require.NoError(t, err)
+
+	sentID := testdata.InsertBroadcast(db, testdata.Org1, "eng", map[envs.Language]string{"eng": "Hi there"}, models.NilScheduleID, nil, nil)
+	pendingID := testdata.InsertBroadcast(db, testdata.Org1, "eng", map[envs.Language]string{"eng": "Hi there"}, models.NilScheduleID, nil, nil)
+	oldID := testdata.InsertBroadcast(db, testdata.Org1, "eng", map[envs.Language]string{"eng": "Hi there"}, models.NilScheduleID, nil, nil)
+
+	db.MustExec(`UPDATE msgs_broadcast SET status = 'S' WHERE id = $1`, sentID)
+	db.MustExec(`UPDATE msgs_broadcast SET status = 'S', modified_on = NOW() - INTERVAL '7 days' WHERE id = $1`, oldID)
+
+	testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "Hi there", nil, models.MsgStatusDelivered, false)
+	testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "Hi there", nil, models.MsgStatusWired, false)
+	db.MustExec(`UPDATE msgs_msg SET broadcast_id = $1 WHERE direction = 'O'`, sentID)
+
+	err = msgs.RefreshBroadcastReports(ctx, rt)
+	require.NoError(t, err)
+
+	// only the recently sent broadcast has a report
+	report, err := models.GetCachedBroadcastReport(rc, sentID)
+	require.NoError(t, err)
+	require.NotNil(t, report)
+	assert.Equal(t, 2, report.Msgs)
+	assert.Equal(t, map[string]int{"delivered": 1, "wired": 1}, report.Statuses)
+	assert.Equal(t, models.DefaultBroadcastReplyHours, report.ReplyHours)
+
+	for _, id := range []models.BroadcastID{pendingID, oldID} {
+		report, err = models.GetCachedBroadcastReport(rc, id)
+		require.NoError(t, err)
+		assert.Nil(t, report)
+	}
+
+	// a report computed recently enough relative to when its broadcast was sent isn't refreshed
+	db.MustExec(`UPDATE msgs_broadcast SET modified_on = NOW() - INTERVAL '1 day' WHERE id = $1`, sentID)
+	testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.George, "Hi there", nil, models.MsgStatusSent, false)
+	db.MustExec(`UPDATE msgs_msg SET broadcast_id = $1 WHERE direction = 'O'`, sentID)
+
+	err = msgs.RefreshBroadcastReports(ctx, rt)
+	require.NoError(t, err)
+
+	report, err = models.GetCachedBroadcastReport(rc, sentID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Msgs)
+
+	// but once it's old enough it is
+	report.CreatedOn = time.Now().Add(-3 * time.Hour)
+	require.NoError(t, models.CacheBroadcastReport(rc, report))
+
+	err = msgs.RefreshBroadcastReports(ctx, rt)
+	require.NoError(t, err)
+
+	report, err = models.GetCachedBroadcastReport(rc, sentID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Msgs)
+}
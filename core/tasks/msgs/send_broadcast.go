@@ -3,9 +3,11 @@ package msgs
 import (
 	"context"
 	"encoding/json"
+	"sort"
 	"time"
 
 	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/mailroom"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/core/msgio"
@@ -39,11 +41,13 @@ func handleSendBroadcast(ctx context.Context, rt *runtime.Runtime, task *queue.T
 		return errors.Wrapf(err, "error unmarshalling broadcast: %s", string(task.Task))
 	}
 
-	return CreateBroadcastBatches(ctx, rt, broadcast)
+	return CreateBroadcastBatches(ctx, rt, broadcast, task.ID)
 }
 
-// CreateBroadcastBatches takes our master broadcast and creates batches of broadcast sends for all the unique contacts
-func CreateBroadcastBatches(ctx context.Context, rt *runtime.Runtime, bcast *models.Broadcast) error {
+// CreateBroadcastBatches takes our master broadcast and creates batches of broadcast sends for all the unique contacts.
+// If the broadcast is paced, the batches of each channel are released gradually rather than all at once. If the task
+// with the given ID is cancelled, no further batches are queued.
+func CreateBroadcastBatches(ctx context.Context, rt *runtime.Runtime, bcast *models.Broadcast, taskID uuids.UUID) error {
 	// we are building a set of contact ids, start with the explicit ones
 	contactIDs := make(map[models.ContactID]bool)
 	for _, id := range bcast.ContactIDs() {
@@ -85,49 +89,111 @@ func CreateBroadcastBatches(ctx context.Context, rt *runtime.Runtime, bcast *mod
 		urnContacts[id] = u
 	}
 
-	rc := rt.RP.Get()
-	defer rc.Close()
+	// if the broadcast is paced, each channel is paced separately, so contacts are batched by the channel they'll be sent
+	// through and each channel's batches are queued as delayed tasks which are released one interval apart
+	interval := bcast.BatchInterval(startBatchSize)
 
-	contacts := make([]models.ContactID, 0, 100)
+	channelContacts := make(map[models.ChannelID][]models.ContactID)
+	if interval > 0 {
+		ids := make([]models.ContactID, 0, len(contactIDs))
+		for id := range contactIDs {
+			ids = append(ids, id)
+		}
+		channelIDs, err := models.GetPreferredChannelIDs(ctx, rt.DB, ids)
+		if err != nil {
+			return errors.Wrapf(err, "error getting preferred channels of contacts")
+		}
+		for _, id := range ids {
+			channelContacts[channelIDs[id]] = append(channelContacts[channelIDs[id]], id)
+		}
+	} else {
+		for id := range contactIDs {
+			channelContacts[models.NilChannelID] = append(channelContacts[models.NilChannelID], id)
+		}
+	}
+
+	now := time.Now()
+	batches := make([]*broadcastBatch, 0, len(contactIDs)/startBatchSize+1)
 
-	// utility functions for queueing the current set of contacts
-	queueBatch := func(isLast bool) {
-		// if this is our last batch include those contacts that overlap with our urns
-		if isLast {
-			for id := range repeatedContacts {
-				contacts = append(contacts, id)
+	for _, ids := range channelContacts {
+		releaseAt := now
+		for len(ids) > 0 {
+			size := startBatchSize
+			if len(ids) < size {
+				size = len(ids)
 			}
+			batches = append(batches, &broadcastBatch{contactIDs: ids[:size], releaseAt: releaseAt})
+			ids = ids[size:]
+			releaseAt = releaseAt.Add(interval)
 		}
+	}
 
-		batch := bcast.CreateBatch(contacts)
+	// the last batch to be released marks the broadcast as sent so it also includes those contacts that overlap with
+	// our urns, and there is always one even if there are no other contacts
+	sort.SliceStable(batches, func(i, j int) bool { return batches[i].releaseAt.Before(batches[j].releaseAt) })
+	if len(batches) == 0 {
+		batches = append(batches, &broadcastBatch{releaseAt: now})
+	}
+	last := batches[len(batches)-1]
+	for id := range repeatedContacts {
+		last.contactIDs = append(last.contactIDs, id)
+	}
+
+	if interval > 0 {
+		logrus.WithField("broadcast_id", bcast.ID()).WithField("batches", len(batches)).WithField("channels", len(channelContacts)).WithField("projected_end", last.releaseAt).Info("pacing broadcast")
+
+		rc := rt.RP.Get()
+		err := models.RecordBroadcastProjectedEnd(rc, bcast.ID(), last.releaseAt)
+		rc.Close()
+		if err != nil {
+			logrus.WithError(err).WithField("broadcast_id", bcast.ID()).Error("error recording projected end of broadcast")
+		}
+	}
+
+	// queue our batches, checking between batches whether we've been cancelled
+	for i, b := range batches {
+		if i > 0 {
+			cancelled, err := rt.Queue.IsTaskCancelled(taskID)
+			if err != nil {
+				logrus.WithError(err).WithField("task_id", taskID).Error("error checking if broadcast task is cancelled")
+			}
+			if cancelled {
+				logrus.WithField("broadcast_id", bcast.ID()).WithField("task_id", taskID).Info("broadcast cancelled, no more batches will be queued")
+
+				// the last batch won't be sent to mark the broadcast as sent, so mark it as failed instead
+				return models.MarkBroadcastFailed(ctx, rt.DB, bcast.ID())
+			}
+		}
+
+		batch := bcast.CreateBatch(b.contactIDs)
+		batch.TaskID = taskID
 
 		// also set our URNs
-		if isLast {
+		if b == last {
 			batch.IsLast = true
 			batch.URNs = urnContacts
 		}
 
-		err = queue.AddTask(rc, q, queue.SendBroadcastBatch, int(bcast.OrgID()), batch, queue.DefaultPriority)
-		if err != nil {
-			logrus.WithError(err).Error("error while queuing broadcast batch")
+		var opts []queue.TaskOption
+		if interval > 0 {
+			opts = append(opts, queue.WithRunAt(b.releaseAt))
 		}
-		contacts = make([]models.ContactID, 0, 100)
-	}
 
-	// build up batches of contacts to start
-	for c := range contactIDs {
-		if len(contacts) == startBatchSize {
-			queueBatch(false)
+		err = rt.Queue.AddTask(q, queue.SendBroadcastBatch, int(bcast.OrgID()), batch, queue.DefaultPriority, opts...)
+		if err != nil {
+			logrus.WithError(err).Error("error while queuing broadcast batch")
 		}
-		contacts = append(contacts, c)
 	}
 
-	// queue our last batch
-	queueBatch(true)
-
 	return nil
 }
 
+// a batch of contacts of a broadcast and when it should be released
+type broadcastBatch struct {
+	contactIDs []models.ContactID
+	releaseAt  time.Time
+}
+
 // handleSendBroadcastBatch sends our messages
 func handleSendBroadcastBatch(ctx context.Context, rt *runtime.Runtime, task *queue.Task) error {
 	ctx, cancel := context.WithTimeout(ctx, time.Minute*60)
@@ -147,8 +213,23 @@ func handleSendBroadcastBatch(ctx context.Context, rt *runtime.Runtime, task *qu
 	return SendBroadcastBatch(ctx, rt, broadcast)
 }
 
-// SendBroadcastBatch sends the passed in broadcast batch
+// SendBroadcastBatch sends the passed in broadcast batch, unless the task which created it has been cancelled, as
+// paced batches could have been queued long before they're sent
 func SendBroadcastBatch(ctx context.Context, rt *runtime.Runtime, bcast *models.BroadcastBatch) error {
+	cancelled, err := rt.Queue.IsTaskCancelled(bcast.TaskID)
+	if err != nil {
+		logrus.WithError(err).WithField("task_id", bcast.TaskID).Error("error checking if broadcast task is cancelled")
+	}
+	if cancelled {
+		logrus.WithField("broadcast_id", bcast.BroadcastID).WithField("task_id", bcast.TaskID).Info("broadcast cancelled, skipping batch")
+
+		// if this was our last batch, the broadcast won't be sent so mark it as failed
+		if bcast.IsLast {
+			return models.MarkBroadcastFailed(ctx, rt.DB, bcast.BroadcastID)
+		}
+		return nil
+	}
+
 	// always set our broadcast as sent if it is our last
 	defer func() {
 		if bcast.IsLast {
@@ -2,11 +2,14 @@ package msgs_test
 
 import (
 	"encoding/json"
+	"fmt"
 	"testing"
 	"time"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/nyaruka/gocommon/dbutil/assertdb"
 	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/goflow/flows"
@@ -19,6 +22,7 @@ import (
 	"github.com/nyaruka/mailroom/testsuite/testdata"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBroadcastEvents(t *testing.T) {
@@ -86,7 +90,7 @@ func TestBroadcastEvents(t *testing.T) {
 		bcast, err := models.NewBroadcastFromEvent(ctx, db, oa, event)
 		assert.NoError(t, err)
 
-		err = msgs.CreateBroadcastBatches(ctx, rt, bcast)
+		err = msgs.CreateBroadcastBatches(ctx, rt, bcast, "")
 		assert.NoError(t, err)
 
 		// pop all our tasks and execute them
@@ -236,7 +240,7 @@ func TestBroadcastTask(t *testing.T) {
 	for i, tc := range tcs {
 		// handle our start task
 		bcast := models.NewBroadcast(oa.OrgID(), tc.BroadcastID, tc.Translations, tc.TemplateState, tc.BaseLanguage, tc.URNs, tc.ContactIDs, tc.GroupIDs, tc.TicketID, tc.CreatedByID)
-		err = msgs.CreateBroadcastBatches(ctx, rt, bcast)
+		err = msgs.CreateBroadcastBatches(ctx, rt, bcast, "")
 		assert.NoError(t, err)
 
 		// pop all our tasks and execute them
@@ -289,3 +293,158 @@ func TestBroadcastTask(t *testing.T) {
 
 	assertdb.Query(t, db, `SELECT SUM(count) FROM tickets_ticketdailytiming WHERE count_type = 'R' AND scope = CONCAT('o:', $1::text)`, testdata.Org1.ID).Returns(1)
 }
+
+func TestPacedBroadcast(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	// 121 doctors at 20 messages a second means a second batch 5 seconds after the first
+	bcast := &models.Broadcast{}
+	err := json.Unmarshal([]byte(fmt.Sprintf(`{
+		"org_id": 1,
+		"translations": {"eng": {"text": "hello world"}},
+		"template_state": "evaluated",
+		"base_language": "eng",
+		"group_ids": [%d],
+		"pace_per_second": 20
+	}`, testdata.DoctorsGroup.ID)), bcast)
+	require.NoError(t, err)
+
+	err = msgs.CreateBroadcastBatches(ctx, rt, bcast, "")
+	require.NoError(t, err)
+
+	size, err := queue.Size(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	assert.Equal(t, 1, size)
+
+	delayed, err := queue.DelayedSize(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delayed)
+
+	projectedEnd, err := models.GetBroadcastProjectedEnd(rc, bcast.ID())
+	require.NoError(t, err)
+	assert.NotNil(t, projectedEnd)
+
+	// channels are paced separately, so if the doctors are split across two channels, both batches are released at once
+	testsuite.Reset(testsuite.ResetRedis)
+	db.MustExec(`UPDATE contacts_contacturn SET channel_id = CASE WHEN contact_id % 2 = 0 THEN $1::int ELSE $2::int END
+	              WHERE contact_id IN (SELECT contact_id FROM contacts_contactgroup_contacts WHERE contactgroup_id = $3)`,
+		testdata.TwilioChannel.ID, testdata.VonageChannel.ID, testdata.DoctorsGroup.ID)
+
+	err = msgs.CreateBroadcastBatches(ctx, rt, bcast, "")
+	require.NoError(t, err)
+
+	size, err = queue.Size(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	assert.Equal(t, 2, size)
+
+	delayed, err = queue.DelayedSize(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	assert.Equal(t, 0, delayed)
+}
+
+func TestCancelPacedBroadcast(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	queueBroadcast := func(taskID uuids.UUID) (models.BroadcastID, *models.Broadcast) {
+		bcastID := testdata.InsertBroadcast(db, testdata.Org1, "eng", map[envs.Language]string{"eng": "hello world"}, models.NilScheduleID, nil, []*testdata.Group{testdata.DoctorsGroup})
+
+		// 121 doctors at 20 messages a second means a second batch 5 seconds after the first
+		bcast := &models.Broadcast{}
+		err := json.Unmarshal([]byte(fmt.Sprintf(`{
+			"broadcast_id": %d,
+			"org_id": 1,
+			"translations": {"eng": {"text": "hello world"}},
+			"template_state": "evaluated",
+			"base_language": "eng",
+			"group_ids": [%d],
+			"pace_per_second": 20
+		}`, bcastID, testdata.DoctorsGroup.ID)), bcast)
+		require.NoError(t, err)
+
+		// queue the broadcast so that it has a status record which can be cancelled
+		err = rt.Queue.AddTask(queue.BatchQueue, queue.SendBroadcast, int(testdata.Org1.ID), bcast, queue.HighPriority, queue.WithTaskID(taskID))
+		require.NoError(t, err)
+		task, err := rt.Queue.PopNextTask(queue.BatchQueue)
+		require.NoError(t, err)
+		require.NoError(t, rt.Queue.MarkTaskComplete(queue.BatchQueue, task.OrgID))
+
+		return bcastID, bcast
+	}
+
+	popBatch := func() *models.BroadcastBatch {
+		task, err := rt.Queue.PopNextTask(queue.BatchQueue)
+		require.NoError(t, err)
+		require.NotNil(t, task)
+		require.NoError(t, rt.Queue.MarkTaskComplete(queue.BatchQueue, task.OrgID))
+
+		batch := &models.BroadcastBatch{}
+		require.NoError(t, json.Unmarshal(task.Task, batch))
+		return batch
+	}
+
+	// cancel a broadcast after its first batch has been sent but before its second is released
+	bcastID, bcast := queueBroadcast("5bd8a5a0-6b4e-4ee3-a5fd-6cbf6b5d3bd8")
+
+	err := msgs.CreateBroadcastBatches(ctx, rt, bcast, "5bd8a5a0-6b4e-4ee3-a5fd-6cbf6b5d3bd8")
+	require.NoError(t, err)
+
+	err = msgs.SendBroadcastBatch(ctx, rt, popBatch())
+	require.NoError(t, err)
+
+	var sent int
+	require.NoError(t, db.Get(&sent, `SELECT count(*) FROM msgs_msg WHERE broadcast_id = $1`, bcastID))
+	assert.Greater(t, sent, 0)
+
+	cancelled, err := rt.Queue.CancelTask("5bd8a5a0-6b4e-4ee3-a5fd-6cbf6b5d3bd8")
+	require.NoError(t, err)
+	assert.True(t, cancelled)
+
+	// the delayed last batch is skipped and the broadcast is marked as failed
+	delayed, err := redis.ByteSlices(rc.Do("zrange", "batch:delayed", 0, -1))
+	require.NoError(t, err)
+	require.Len(t, delayed, 1)
+
+	task := &queue.Task{}
+	require.NoError(t, json.Unmarshal(delayed[0], task))
+	batch := &models.BroadcastBatch{}
+	require.NoError(t, json.Unmarshal(task.Task, batch))
+	assert.True(t, batch.IsLast)
+
+	err = msgs.SendBroadcastBatch(ctx, rt, batch)
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE broadcast_id = $1`, bcastID).Returns(sent)
+	assertdb.Query(t, db, `SELECT status FROM msgs_broadcast WHERE id = $1`, bcastID).Returns("F")
+
+	// cancel a broadcast before its batches are created, in which case only its first batch is queued, and that is
+	// skipped too
+	testsuite.Reset(testsuite.ResetRedis)
+
+	bcastID, bcast = queueBroadcast("e7a6b1b4-1d24-4d6a-b2a6-2f7e8a7a5c0e")
+
+	cancelled, err = rt.Queue.CancelTask("e7a6b1b4-1d24-4d6a-b2a6-2f7e8a7a5c0e")
+	require.NoError(t, err)
+	assert.True(t, cancelled)
+
+	err = msgs.CreateBroadcastBatches(ctx, rt, bcast, "e7a6b1b4-1d24-4d6a-b2a6-2f7e8a7a5c0e")
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT status FROM msgs_broadcast WHERE id = $1`, bcastID).Returns("F")
+
+	delayedSize, err := queue.DelayedSize(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	assert.Equal(t, 0, delayedSize)
+
+	err = msgs.SendBroadcastBatch(ctx, rt, popBatch())
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE broadcast_id = $1`, bcastID).Returns(0)
+}
@@ -13,7 +13,7 @@ import (
 )
 
 func init() {
-	mailroom.RegisterCron("fire_schedules", time.Minute*1, false, checkSchedules)
+	mailroom.RegisterCronExpression("fire_schedules", "* * * * *", false, checkSchedules)
 }
 
 // checkSchedules looks up any expired schedules and fires them, setting the next fire as needed
@@ -25,9 +25,6 @@ func checkSchedules(ctx context.Context, rt *runtime.Runtime) error {
 	log := logrus.WithField("comp", "schedules_cron")
 	start := time.Now()
 
-	rc := rt.RP.Get()
-	defer rc.Close()
-
 	// get any expired schedules
 	unfired, err := models.GetUnfiredSchedules(ctx, rt.DB)
 	if err != nil {
@@ -120,7 +117,7 @@ func checkSchedules(ctx context.Context, rt *runtime.Runtime) error {
 
 		// add our task if we have one
 		if task != nil {
-			err = queue.AddTask(rc, queue.BatchQueue, taskName, int(s.OrgID()), task, queue.HighPriority)
+			err = rt.Queue.AddTask(queue.BatchQueue, taskName, int(s.OrgID()), task, queue.HighPriority)
 			if err != nil {
 				log.WithError(err).Error("error firing task with name: ", taskName)
 			}
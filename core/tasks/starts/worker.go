@@ -14,6 +14,7 @@ import (
 	"github.com/nyaruka/mailroom/core/search"
 	"github.com/nyaruka/mailroom/runtime"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -57,7 +58,9 @@ func handleFlowStart(ctx context.Context, rt *runtime.Runtime, task *queue.Task)
 	return nil
 }
 
-// CreateFlowBatches takes our master flow start and creates batches of flow starts for all the unique contacts
+// CreateFlowBatches takes our master flow start and creates batches of flow starts for all the unique contacts. If the
+// start is paced, its batches are released gradually rather than all at once. If the start is cancelled, no further
+// batches are queued and the start is marked as interrupted.
 func CreateFlowBatches(ctx context.Context, rt *runtime.Runtime, start *models.FlowStart) error {
 	contactIDs := make(map[models.ContactID]bool)
 	createdContactIDs := make([]models.ContactID, 0)
@@ -179,10 +182,22 @@ func CreateFlowBatches(ctx context.Context, rt *runtime.Runtime, start *models.F
 		taskType = queue.StartIVRFlowBatch
 	}
 
+	// if the start is paced, batches are queued as delayed tasks which are released one interval apart
+	batches := (len(contactIDs) + startBatchSize - 1) / startBatchSize
+	interval := start.BatchInterval(startBatchSize)
+	releaseAt := time.Now()
+
 	contacts := make([]models.ContactID, 0, 100)
 	queueBatch := func(last bool) {
 		batch := start.CreateBatch(contacts, last, len(contactIDs))
-		err = queue.AddTask(rc, q, taskType, int(start.OrgID()), batch, queue.DefaultPriority)
+
+		var opts []queue.TaskOption
+		if interval > 0 {
+			opts = append(opts, queue.WithRunAt(releaseAt))
+			releaseAt = releaseAt.Add(interval)
+		}
+
+		err = rt.Queue.AddTask(q, taskType, int(start.OrgID()), batch, queue.DefaultPriority, opts...)
 		if err != nil {
 			// TODO: is continuing the right thing here? what do we do if redis is down? (panic!)
 			logrus.WithError(err).WithField("start_id", start.ID()).Error("error while queuing start")
@@ -190,9 +205,31 @@ func CreateFlowBatches(ctx context.Context, rt *runtime.Runtime, start *models.F
 		contacts = make([]models.ContactID, 0, 100)
 	}
 
-	// build up batches of contacts to start
+	var projectedEnd time.Time
+	if interval > 0 {
+		projectedEnd = releaseAt.Add(interval * time.Duration(batches-1))
+		logrus.WithField("start_id", start.ID()).WithField("batches", batches).WithField("projected_end", projectedEnd).Info("pacing flow start")
+	}
+
+	// IVR batches don't report their progress
+	if taskType == queue.StartFlowBatch {
+		if err := models.RecordStartBatches(rc, start.ID(), batches); err != nil {
+			logrus.WithError(err).WithField("start_id", start.ID()).Error("error recording batches of start")
+		}
+		if !projectedEnd.IsZero() {
+			if err := models.RecordStartProjectedEnd(rc, start.ID(), projectedEnd); err != nil {
+				logrus.WithError(err).WithField("start_id", start.ID()).Error("error recording projected end of start")
+			}
+		}
+	}
+
+	// build up batches of contacts to start, checking between batches whether we've been cancelled
 	for c := range contactIDs {
 		if len(contacts) == startBatchSize {
+			if startCancelled(rc, start.ID()) {
+				logrus.WithField("start_id", start.ID()).Info("start cancelled, no more batches will be queued")
+				return models.MarkStartCancelled(ctx, rt.DB, start.ID())
+			}
 			queueBatch(false)
 		}
 		contacts = append(contacts, c)
@@ -221,11 +258,38 @@ func handleFlowStartBatch(ctx context.Context, rt *runtime.Runtime, task *queue.
 		return errors.Wrapf(err, "error unmarshalling flow start batch: %s", string(task.Task))
 	}
 
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	// if the start has been cancelled, skip this batch and make sure the start is marked as such
+	if startCancelled(rc, startBatch.StartID()) {
+		logrus.WithField("start_id", startBatch.StartID()).Info("skipping batch of cancelled start")
+
+		if err := models.RecordStartBatchSkipped(rc, startBatch.StartID()); err != nil {
+			logrus.WithError(err).WithField("start_id", startBatch.StartID()).Error("error recording skipped batch of start")
+		}
+		return models.MarkStartCancelled(ctx, rt.DB, startBatch.StartID())
+	}
+
 	// start these contacts in our flow
-	_, err = runner.StartFlowBatch(ctx, rt, startBatch)
-	if err != nil {
-		return errors.Wrapf(err, "error starting flow batch: %s", string(task.Task))
+	sessions, startErr := runner.StartFlowBatch(ctx, rt, startBatch)
+
+	if err := models.RecordStartBatchRun(rc, startBatch.StartID(), len(startBatch.ContactIDs()), len(sessions), startErr != nil); err != nil {
+		logrus.WithError(err).WithField("start_id", startBatch.StartID()).Error("error recording batch run of start")
 	}
 
-	return err
+	if startErr != nil {
+		return errors.Wrapf(startErr, "error starting flow batch: %s", string(task.Task))
+	}
+
+	return nil
+}
+
+// checks whether the given start has been cancelled, treating errors as not cancelled so that starts aren't lost
+func startCancelled(rc redis.Conn, startID models.StartID) bool {
+	cancelled, err := models.IsStartCancelled(rc, startID)
+	if err != nil {
+		logrus.WithError(err).WithField("start_id", startID).Error("error checking if start is cancelled")
+	}
+	return cancelled
 }
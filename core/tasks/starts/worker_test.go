@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/jsonx"
 	_ "github.com/nyaruka/mailroom/core/handlers"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/core/queue"
@@ -301,3 +302,91 @@ func TestStarts(t *testing.T) {
 		}
 	}
 }
+
+func TestStartBatchProgressAndCancellation(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	start := models.NewFlowStart(testdata.Org1.ID, models.StartTypeManual, models.FlowTypeMessaging, testdata.SingleMessage.ID).
+		WithContactIDs([]models.ContactID{testdata.Cathy.ID, testdata.Bob.ID, testdata.George.ID})
+
+	err := models.InsertFlowStarts(ctx, db, []*models.FlowStart{start})
+	require.NoError(t, err)
+
+	err = models.MarkStartStarted(ctx, db, start.ID(), 3, nil)
+	require.NoError(t, err)
+	require.NoError(t, models.RecordStartBatches(rc, start.ID(), 2))
+
+	batch1 := start.CreateBatch([]models.ContactID{testdata.Cathy.ID, testdata.Bob.ID}, false, 3)
+	batch2 := start.CreateBatch([]models.ContactID{testdata.George.ID}, true, 3)
+
+	// first batch is run and its progress recorded
+	err = handleFlowStartBatch(ctx, rt, &queue.Task{Type: queue.StartFlowBatch, Task: jsonx.MustMarshal(batch1)})
+	require.NoError(t, err)
+
+	progress, err := models.GetStartProgress(rc, start.ID())
+	require.NoError(t, err)
+	assert.Equal(t, &models.StartProgress{Batches: 2, BatchesRun: 1, Contacts: 2, Sessions: 2}, progress)
+
+	// start is cancelled so second batch is skipped
+	require.NoError(t, models.CancelStart(rc, start.ID()))
+
+	err = handleFlowStartBatch(ctx, rt, &queue.Task{Type: queue.StartFlowBatch, Task: jsonx.MustMarshal(batch2)})
+	require.NoError(t, err)
+
+	progress, err = models.GetStartProgress(rc, start.ID())
+	require.NoError(t, err)
+	assert.Equal(t, &models.StartProgress{Batches: 2, BatchesRun: 1, BatchesSkipped: 1, Contacts: 2, Sessions: 2, Cancelled: true}, progress)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM flows_flowrun WHERE start_id = $1`, start.ID()).Returns(2)
+	assertdb.Query(t, db, `SELECT count(*) FROM flows_flowrun WHERE start_id = $1 AND contact_id = $2`, start.ID(), testdata.George.ID).Returns(0)
+	assertdb.Query(t, db, `SELECT status FROM flows_flowstart WHERE id = $1`, start.ID()).Returns("I")
+}
+
+func TestPacedStart(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	// 121 doctors at 100 contacts a minute means a second batch a minute after the first
+	start := models.NewFlowStart(testdata.Org1.ID, models.StartTypeManual, models.FlowTypeMessaging, testdata.SingleMessage.ID).
+		WithGroupIDs([]models.GroupID{testdata.DoctorsGroup.ID}).
+		WithPacePerMinute(100)
+
+	err := models.InsertFlowStarts(ctx, db, []*models.FlowStart{start})
+	require.NoError(t, err)
+
+	before := time.Now()
+
+	err = CreateFlowBatches(ctx, rt, start)
+	require.NoError(t, err)
+
+	// first batch can be run now, second is delayed
+	size, err := queue.Size(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	assert.Equal(t, 1, size)
+
+	delayed, err := queue.DelayedSize(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delayed)
+
+	progress, err := models.GetStartProgress(rc, start.ID())
+	require.NoError(t, err)
+	assert.Equal(t, 2, progress.Batches)
+	if assert.NotNil(t, progress.ProjectedEnd) {
+		assert.WithinDuration(t, before.Add(time.Minute), *progress.ProjectedEnd, 2*time.Second)
+	}
+
+	task, err := queue.PopNextTask(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	require.NotNil(t, task)
+
+	task, err = queue.PopNextTask(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	assert.Nil(t, task)
+}
@@ -61,7 +61,7 @@ func timeoutSessions(ctx context.Context, rt *runtime.Runtime) error {
 
 		// ok, queue this task
 		task := handler.NewTimeoutTask(timeout.OrgID, timeout.ContactID, timeout.SessionID, timeout.TimeoutOn)
-		err = handler.QueueHandleTask(rc, timeout.ContactID, task)
+		err = handler.QueueHandleTask(rt, timeout.ContactID, task)
 		if err != nil {
 			return errors.Wrapf(err, "error adding new handle task")
 		}
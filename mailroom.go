@@ -10,9 +10,12 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/nyaruka/gocommon/analytics"
 	"github.com/nyaruka/gocommon/storage"
+	"github.com/nyaruka/mailroom/core/goflow"
+	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/core/queue"
 	"github.com/nyaruka/mailroom/runtime"
 	"github.com/nyaruka/mailroom/utils/cron"
+	"github.com/nyaruka/mailroom/utils/tracing"
 	"github.com/nyaruka/mailroom/web"
 	"github.com/pkg/errors"
 
@@ -33,8 +36,19 @@ func addInitFunction(initFunc InitFunction) {
 
 // RegisterCron registers a new cron function to run every interval
 func RegisterCron(name string, interval time.Duration, allInstances bool, fn cron.Function) {
+	registerCron(name, cron.Every(interval), allInstances, fn)
+}
+
+// RegisterCronExpression registers a new cron function to run on the schedule defined by the given cron expression,
+// e.g. "*/5 * * * *". Each slot of the schedule is fired at most once across all instances, and slots which pass
+// entirely while a previous fire is still running are skipped.
+func RegisterCronExpression(name string, expression string, allInstances bool, fn cron.Function) {
+	registerCron(name, cron.MustParseExpression(expression), allInstances, fn)
+}
+
+func registerCron(name string, schedule cron.Schedule, allInstances bool, fn cron.Function) {
 	addInitFunction(func(rt *runtime.Runtime, wg *sync.WaitGroup, quit chan bool) error {
-		cron.Start(rt, wg, name, interval, allInstances, fn, time.Minute*5, quit)
+		cron.Start(rt, wg, name, schedule, allInstances, fn, time.Minute*5, quit)
 		return nil
 	})
 }
@@ -49,6 +63,19 @@ func AddTaskFunction(taskType string, taskFunc TaskFunction) {
 	taskFunctions[taskType] = taskFunc
 }
 
+var retryableTaskTypes = make(map[string]bool)
+
+// SetTaskRetryable marks a type of task as safe to retry when it fails, which should only be done for task types which
+// are idempotent. Failed tasks of any other type are moved straight to the dead letters of their queue.
+func SetTaskRetryable(taskType string) {
+	retryableTaskTypes[taskType] = true
+}
+
+// IsTaskRetryable returns whether the given type of task can be retried when it fails
+func IsTaskRetryable(taskType string) bool {
+	return retryableTaskTypes[taskType]
+}
+
 // Mailroom is a service for handling RapidPro events
 type Mailroom struct {
 	ctx    context.Context
@@ -61,26 +88,28 @@ type Mailroom struct {
 	batchForeman   *Foreman
 	handlerForeman *Foreman
 
-	webserver *web.Server
+	webserver   *web.Server
+	stopTracing func(context.Context) error
 }
 
 // NewMailroom creates and returns a new mailroom instance
 func NewMailroom(config *runtime.Config) *Mailroom {
 	mr := &Mailroom{
-		rt:   &runtime.Runtime{Config: config},
+		rt:   &runtime.Runtime{Drainer: runtime.NewDrainer()},
 		quit: make(chan bool),
 		wg:   &sync.WaitGroup{},
 	}
+	mr.rt.SetConfig(config)
 	mr.ctx, mr.cancel = context.WithCancel(context.Background())
-	mr.batchForeman = NewForeman(mr.rt, mr.wg, queue.BatchQueue, config.BatchWorkers)
-	mr.handlerForeman = NewForeman(mr.rt, mr.wg, queue.HandlerQueue, config.HandlerWorkers)
+	mr.batchForeman = NewForeman(mr.rt, mr.wg, queue.BatchQueue, config.BatchWorkers, config.BatchWorkersPerOrg)
+	mr.handlerForeman = NewForeman(mr.rt, mr.wg, queue.HandlerQueue, config.HandlerWorkers, config.HandlerWorkersPerOrg)
 
 	return mr
 }
 
 // Start starts the mailroom service
 func (mr *Mailroom) Start() error {
-	c := mr.rt.Config
+	c := mr.rt.Config()
 
 	log := logrus.WithFields(logrus.Fields{"state": "starting"})
 
@@ -112,8 +141,10 @@ func (mr *Mailroom) Start() error {
 		log.Info("redis ok")
 	}
 
+	mr.rt.Queue = queue.NewRedisBackend(mr.rt.RP)
+
 	// create our storage (S3 or file system)
-	if mr.rt.Config.AWSAccessKeyID != "" || mr.rt.Config.AWSUseCredChain {
+	if mr.rt.Config().AWSAccessKeyID != "" || mr.rt.Config().AWSUseCredChain {
 		s3config := &storage.S3Options{
 			Endpoint:       c.S3Endpoint,
 			Region:         c.S3Region,
@@ -121,7 +152,7 @@ func (mr *Mailroom) Start() error {
 			ForcePathStyle: c.S3ForcePathStyle,
 			MaxRetries:     3,
 		}
-		if mr.rt.Config.AWSAccessKeyID != "" && !mr.rt.Config.AWSUseCredChain {
+		if mr.rt.Config().AWSAccessKeyID != "" && !mr.rt.Config().AWSUseCredChain {
 			s3config.AWSAccessKeyID = c.AWSAccessKeyID
 			s3config.AWSSecretAccessKey = c.AWSSecretAccessKey
 		}
@@ -129,8 +160,8 @@ func (mr *Mailroom) Start() error {
 		if err != nil {
 			return err
 		}
-		mr.rt.AttachmentStorage = storage.NewS3(s3Client, mr.rt.Config.S3AttachmentsBucket, c.S3Region, s3.BucketCannedACLPublicRead, 32)
-		mr.rt.SessionStorage = storage.NewS3(s3Client, mr.rt.Config.S3SessionBucket, c.S3Region, s3.ObjectCannedACLPrivate, 32)
+		mr.rt.AttachmentStorage = storage.NewS3(s3Client, mr.rt.Config().S3AttachmentsBucket, c.S3Region, s3.BucketCannedACLPublicRead, 32)
+		mr.rt.SessionStorage = storage.NewS3(s3Client, mr.rt.Config().S3SessionBucket, c.S3Region, s3.ObjectCannedACLPrivate, 32)
 	} else {
 		mr.rt.AttachmentStorage = storage.NewFS("_storage", 0766)
 		mr.rt.SessionStorage = storage.NewFS("_storage", 0766)
@@ -174,6 +205,9 @@ func (mr *Mailroom) Start() error {
 		initFunc(mr.rt, mr.wg, mr.quit)
 	}
 
+	// listen for requests to flush cached org assets, e.g. from the flush-org-assets command
+	models.StartOrgAssetsFlusher(mr.rt, mr.wg, mr.quit)
+
 	// if we have a librato token, configure it
 	if c.LibratoToken != "" {
 		analytics.RegisterBackend(analytics.NewLibrato(c.LibratoUsername, c.LibratoToken, c.InstanceName, time.Second, mr.wg))
@@ -181,6 +215,15 @@ func (mr *Mailroom) Start() error {
 
 	analytics.Start()
 
+	// configure tracing, which is a noop unless we have a collector to export to
+	mr.stopTracing, err = tracing.Configure(c)
+	if err != nil {
+		log.WithError(err).Error("unable to configure tracing")
+		mr.stopTracing = nil
+	} else if c.OTLPEndpoint != "" {
+		log.WithField("endpoint", c.OTLPEndpoint).Info("tracing configured")
+	}
+
 	// init our foremen and start it
 	mr.batchForeman.Start()
 	mr.handlerForeman.Start()
@@ -194,6 +237,52 @@ func (mr *Mailroom) Start() error {
 	return nil
 }
 
+// Drain puts the mailroom service into drain mode, where foremen stop assigning new tasks to workers and the
+// readiness endpoint reports that we're not ready, but in-flight tasks are allowed to finish
+func (mr *Mailroom) Drain() {
+	mr.rt.Drainer.Drain()
+	logrus.WithField("in_flight", mr.rt.Drainer.InFlight()).Info("mailroom draining")
+}
+
+// Resume takes the mailroom service out of drain mode
+func (mr *Mailroom) Resume() {
+	mr.rt.Drainer.Resume()
+	logrus.Info("mailroom resumed")
+}
+
+// Reload applies any changes to the reloadable fields of the passed in config, e.g. worker counts, webhook settings and
+// the log level. Other fields require a restart and changes to them are ignored.
+func (mr *Mailroom) Reload(config *runtime.Config) error {
+	if err := config.Validate(); err != nil {
+		return errors.Wrap(err, "invalid config")
+	}
+
+	level, err := logrus.ParseLevel(config.LogLevel)
+	if err != nil {
+		return errors.Wrapf(err, "invalid log level '%s'", config.LogLevel)
+	}
+
+	reloaded, changed := mr.rt.Config().Reload(config)
+	if len(changed) == 0 {
+		logrus.Info("config reloaded, nothing changed")
+		return nil
+	}
+
+	// swap in the new config as a whole so that anything reading it sees the old or new values, never a mix
+	mr.rt.SetConfig(reloaded)
+
+	logrus.SetLevel(level)
+
+	// engines and HTTP clients are rebuilt from the new config on next use
+	goflow.Reset()
+
+	mr.batchForeman.Resize(reloaded.BatchWorkers, reloaded.BatchWorkersPerOrg)
+	mr.handlerForeman.Resize(reloaded.HandlerWorkers, reloaded.HandlerWorkersPerOrg)
+
+	logrus.WithField("changed", changed).Info("config reloaded")
+	return nil
+}
+
 // Stop stops the mailroom service
 func (mr *Mailroom) Stop() error {
 	logrus.Info("mailroom stopping")
@@ -213,10 +302,40 @@ func (mr *Mailroom) Stop() error {
 		mr.rt.ES.Stop()
 	}
 
+	// flush any pending spans
+	if mr.stopTracing != nil {
+		if err := mr.stopTracing(context.Background()); err != nil {
+			logrus.WithError(err).Error("error stopping tracing")
+		}
+	}
+
 	logrus.Info("mailroom stopped")
 	return nil
 }
 
+// NewToolRuntime creates a runtime with just database and redis connections, for use by command line tools which
+// operate on the same data as a running mailroom but don't start any of its services
+func NewToolRuntime(config *runtime.Config) (*runtime.Runtime, error) {
+	rt := &runtime.Runtime{Drainer: runtime.NewDrainer()}
+	rt.SetConfig(config)
+
+	var err error
+	rt.DB, err = openAndCheckDBConnection(config.DB, 2)
+	if err != nil {
+		return nil, errors.Wrap(err, "db not reachable")
+	}
+	rt.ReadonlyDB = rt.DB
+
+	rt.RP, err = openAndCheckRedisPool(config.Redis)
+	if err != nil {
+		return nil, errors.Wrap(err, "redis not reachable")
+	}
+
+	rt.Queue = queue.NewRedisBackend(rt.RP)
+
+	return rt, nil
+}
+
 func openAndCheckDBConnection(url string, maxOpenConns int) (*sqlx.DB, error) {
 	db, err := sqlx.Open("postgres", url)
 	if err != nil {
@@ -5,6 +5,7 @@ import (
 	"io"
 	"net"
 	"os"
+	"reflect"
 	"strings"
 
 	"github.com/nyaruka/goflow/utils"
@@ -30,9 +31,18 @@ type Config struct {
 	Domain           string `help:"the domain that mailroom is listening on"`
 	AttachmentDomain string `help:"the domain that will be used for relative attachment"`
 
+	RateLimit            int `help:"the number of requests per second each org can make to each class of authenticated endpoint (0 for no limit)"`
+	RateLimitBurst       int `help:"the number of requests each org can make at once to each class of authenticated endpoint before being limited"`
+	RateLimitSearch      int `help:"the number of requests per second each org can make to endpoints which query Elastic (0 to use RateLimit)"`
+	RateLimitSearchBurst int `help:"the number of requests each org can make at once to endpoints which query Elastic (0 to use RateLimitSearch)"`
+
 	BatchWorkers         int  `help:"the number of go routines that will be used to handle batch events"`
+	BatchWorkersPerOrg   int  `help:"the maximum number of batch workers a single org can use at once across all instances (0 for no limit)"`
 	HandlerWorkers       int  `help:"the number of go routines that will be used to handle messages"`
+	HandlerWorkersPerOrg int  `help:"the maximum number of handler workers a single org can use at once across all instances (0 for no limit)"`
 	RetryPendingMessages bool `help:"whether to requeue pending messages older than five minutes to retry"`
+	TaskMaxRetries       int  `help:"the number of times a failed task of a retryable type is retried before being moved to the dead letter queue"`
+	TaskInitialBackoff   int  `help:"the initial backoff in milliseconds when retrying a failed task"`
 
 	WebhooksTimeout              int     `help:"the timeout in milliseconds for webhook calls from engine"`
 	WebhooksMaxRetries           int     `help:"the number of times to retry a failed webhook call"`
@@ -68,6 +78,8 @@ type Config struct {
 	CourierAuthToken  string `help:"the authentication token used for requests to Courier"`
 	LibratoUsername   string `help:"the username that will be used to authenticate to Librato"`
 	LibratoToken      string `help:"the token that will be used to authenticate to Librato"`
+	OTLPEndpoint      string `help:"the host:port of an OTLP/HTTP collector to export traces to, tracing is disabled if empty"`
+	OTLPInsecure      bool   `help:"whether to export traces without TLS, e.g. to a local collector"`
 	FCMKey            string `help:"the FCM API key used to notify Android relayers to sync"`
 	MailgunSigningKey string `help:"the signing key used to validate requests from mailgun"`
 
@@ -90,9 +102,18 @@ func NewDefaultConfig() *Config {
 		Address: "localhost",
 		Port:    8090,
 
+		RateLimit:            0,
+		RateLimitBurst:       0,
+		RateLimitSearch:      0,
+		RateLimitSearchBurst: 0,
+
 		BatchWorkers:         4,
+		BatchWorkersPerOrg:   0,
 		HandlerWorkers:       32,
+		HandlerWorkersPerOrg: 0,
 		RetryPendingMessages: true,
+		TaskMaxRetries:       3,
+		TaskInitialBackoff:   30000,
 
 		WebhooksTimeout:              15000,
 		WebhooksMaxRetries:           2,
@@ -144,6 +165,51 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// the fields which can be changed by reloading the config of a running instance
+var reloadableFields = []string{
+	"RateLimit",
+	"RateLimitBurst",
+	"RateLimitSearch",
+	"RateLimitSearchBurst",
+	"BatchWorkers",
+	"BatchWorkersPerOrg",
+	"HandlerWorkers",
+	"HandlerWorkersPerOrg",
+	"RetryPendingMessages",
+	"TaskMaxRetries",
+	"TaskInitialBackoff",
+	"WebhooksTimeout",
+	"WebhooksMaxRetries",
+	"WebhooksMaxBodyBytes",
+	"WebhooksInitialBackoff",
+	"WebhooksBackoffJitter",
+	"WebhooksHealthyResponseLimit",
+	"DisallowedNetworks",
+	"MaxStepsPerSprint",
+	"MaxResumesPerSession",
+	"MaxValueLength",
+	"LogLevel",
+}
+
+// Reload returns a copy of this config with the reloadable fields, e.g. worker counts and webhook settings, taken from
+// the passed in config. Other fields such as database URLs can't be changed without a restart and are left as they
+// are. Also returns the names of the fields which changed.
+func (c *Config) Reload(from *Config) (*Config, []string) {
+	reloaded := *c
+	dst := reflect.ValueOf(&reloaded).Elem()
+	src := reflect.ValueOf(from).Elem()
+	changed := make([]string, 0)
+
+	for _, name := range reloadableFields {
+		if dst.FieldByName(name).Interface() != src.FieldByName(name).Interface() {
+			dst.FieldByName(name).Set(src.FieldByName(name))
+			changed = append(changed, name)
+		}
+	}
+
+	return &reloaded, changed
+}
+
 // ParseDisallowedNetworks parses the list of IPs and IP networks (written in CIDR notation)
 func (c *Config) ParseDisallowedNetworks() ([]net.IP, []*net.IPNet, error) {
 	addrs, err := csv.NewReader(strings.NewReader(c.DisallowedNetworks)).Read()
@@ -0,0 +1,55 @@
+package runtime
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Drainer tracks whether this instance is draining, i.e. finishing its in-flight tasks without picking up new ones,
+// and how many tasks are in flight in each queue
+type Drainer struct {
+	draining atomic.Bool
+
+	mutex    sync.Mutex
+	inFlight map[string]int
+}
+
+// NewDrainer creates a new drainer which isn't draining
+func NewDrainer() *Drainer {
+	return &Drainer{inFlight: make(map[string]int)}
+}
+
+// Drain puts this instance into drain mode
+func (d *Drainer) Drain() { d.draining.Store(true) }
+
+// Resume takes this instance out of drain mode
+func (d *Drainer) Resume() { d.draining.Store(false) }
+
+// IsDraining returns whether this instance is in drain mode
+func (d *Drainer) IsDraining() bool { return d.draining.Load() }
+
+// TaskStarted records that a task has started in the given queue
+func (d *Drainer) TaskStarted(queue string) {
+	d.mutex.Lock()
+	d.inFlight[queue]++
+	d.mutex.Unlock()
+}
+
+// TaskFinished records that a task has finished in the given queue
+func (d *Drainer) TaskFinished(queue string) {
+	d.mutex.Lock()
+	d.inFlight[queue]--
+	d.mutex.Unlock()
+}
+
+// InFlight returns the number of tasks in flight in each queue
+func (d *Drainer) InFlight() map[string]int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	counts := make(map[string]int, len(d.inFlight))
+	for queue, count := range d.inFlight {
+		counts[queue] = count
+	}
+	return counts
+}
@@ -1,9 +1,12 @@
 package runtime
 
 import (
+	"sync/atomic"
+
 	"github.com/gomodule/redigo/redis"
 	"github.com/jmoiron/sqlx"
 	"github.com/nyaruka/gocommon/storage"
+	"github.com/nyaruka/mailroom/core/queue"
 	"github.com/olivere/elastic/v7"
 )
 
@@ -13,8 +16,18 @@ type Runtime struct {
 	DB                *sqlx.DB
 	ReadonlyDB        *sqlx.DB
 	RP                *redis.Pool
+	Queue             queue.Backend
 	ES                *elastic.Client
 	AttachmentStorage storage.Storage
 	SessionStorage    storage.Storage
-	Config            *Config
+	Drainer           *Drainer
+
+	config atomic.Pointer[Config]
 }
+
+// Config returns the current config, which should be read once and used for the duration of an operation as it can be
+// swapped for a reloaded config at any time
+func (r *Runtime) Config() *Config { return r.config.Load() }
+
+// SetConfig sets the current config
+func (r *Runtime) SetConfig(c *Config) { r.config.Store(c) }
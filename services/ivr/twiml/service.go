@@ -364,7 +364,7 @@ func (s *service) WriteSessionResponse(ctx context.Context, rt *runtime.Runtime,
 	}
 
 	// get our response
-	response, err := ResponseForSprint(rt.Config, number, resumeURL, sprint.Events(), true)
+	response, err := ResponseForSprint(rt.Config(), number, resumeURL, sprint.Events(), true)
 	if err != nil {
 		return errors.Wrap(err, "unable to build response for IVR call")
 	}
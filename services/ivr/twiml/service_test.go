@@ -31,8 +31,8 @@ func TestResponseForSprint(t *testing.T) {
 	resumeURL := "http://temba.io/resume?session=1"
 
 	// set our attachment domain for testing
-	rt.Config.AttachmentDomain = "mailroom.io"
-	defer func() { rt.Config.AttachmentDomain = "" }()
+	rt.Config().AttachmentDomain = "mailroom.io"
+	defer func() { rt.Config().AttachmentDomain = "" }()
 
 	tcs := []struct {
 		events   []flows.Event
@@ -108,7 +108,7 @@ func TestResponseForSprint(t *testing.T) {
 	}
 
 	for i, tc := range tcs {
-		response, err := twiml.ResponseForSprint(rt.Config, urn, resumeURL, tc.events, false)
+		response, err := twiml.ResponseForSprint(rt.Config(), urn, resumeURL, tc.events, false)
 		assert.NoError(t, err, "%d: unexpected error")
 		assert.Equal(t, xml.Header+tc.expected, response, "%d: unexpected response", i)
 	}
@@ -28,7 +28,7 @@ func TestOpenAndForward(t *testing.T) {
 	ticketer := flows.NewTicketer(static.NewTicketer(assets.TicketerUUID(uuids.New()), "Support", "internal"))
 
 	svc, err := intern.NewService(
-		rt.Config,
+		rt.Config(),
 		http.DefaultClient,
 		nil,
 		ticketer,
@@ -76,7 +76,7 @@ func TestCloseAndReopen(t *testing.T) {
 	uuids.SetGenerator(uuids.NewSeededGenerator(12345))
 
 	ticketer := flows.NewTicketer(static.NewTicketer(assets.TicketerUUID(uuids.New()), "Support", "internal"))
-	svc, err := intern.NewService(rt.Config, http.DefaultClient, nil, ticketer, nil)
+	svc, err := intern.NewService(rt.Config(), http.DefaultClient, nil, ticketer, nil)
 	require.NoError(t, err)
 
 	logger := &flows.HTTPLogger{}
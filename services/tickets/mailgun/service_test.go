@@ -55,7 +55,7 @@ func TestOpenAndForward(t *testing.T) {
 	ticketer := flows.NewTicketer(static.NewTicketer(assets.TicketerUUID(uuids.New()), "Support", "mailgun"))
 
 	_, err = mailgun.NewService(
-		rt.Config,
+		rt.Config(),
 		http.DefaultClient,
 		nil,
 		ticketer,
@@ -64,7 +64,7 @@ func TestOpenAndForward(t *testing.T) {
 	assert.EqualError(t, err, "missing domain or api_key or to_address or url_base in mailgun config")
 
 	svc, err := mailgun.NewService(
-		rt.Config,
+		rt.Config(),
 		http.DefaultClient,
 		nil,
 		ticketer,
@@ -143,7 +143,7 @@ func TestCloseAndReopen(t *testing.T) {
 
 	ticketer := flows.NewTicketer(static.NewTicketer(assets.TicketerUUID(uuids.New()), "Support", "mailgun"))
 	svc, err := mailgun.NewService(
-		rt.Config,
+		rt.Config(),
 		http.DefaultClient,
 		nil,
 		ticketer,
@@ -22,7 +22,7 @@ import (
 func init() {
 	base := "/mr/tickets/types/mailgun"
 
-	web.RegisterJSONRoute(http.MethodPost, base+"/receive", web.WithHTTPLogs(handleReceive))
+	web.RegisterJSONRoute(http.MethodPost, base+"/receive", web.WithHTTPLogs(handleReceive), web.WithoutDoc())
 }
 
 type receiveRequest struct {
@@ -67,7 +67,7 @@ func handleReceive(ctx context.Context, rt *runtime.Runtime, r *http.Request, l
 		return errors.Wrapf(err, "error decoding form"), http.StatusBadRequest, nil
 	}
 
-	if !request.verify(rt.Config.MailgunSigningKey) {
+	if !request.verify(rt.Config().MailgunSigningKey) {
 		return errors.New("request signature validation failed"), http.StatusForbidden, nil
 	}
 
@@ -50,7 +50,7 @@ func TestOpenAndForward(t *testing.T) {
 	ticketer := flows.NewTicketer(static.NewTicketer(assets.TicketerUUID(uuids.New()), "Support", "rocketchat"))
 
 	_, err = rocketchat.NewService(
-		rt.Config,
+		rt.Config(),
 		http.DefaultClient,
 		nil,
 		ticketer,
@@ -59,7 +59,7 @@ func TestOpenAndForward(t *testing.T) {
 	assert.EqualError(t, err, "missing base_url or secret config")
 
 	svc, err := rocketchat.NewService(
-		rt.Config,
+		rt.Config(),
 		http.DefaultClient,
 		nil,
 		ticketer,
@@ -125,7 +125,7 @@ func TestCloseAndReopen(t *testing.T) {
 
 	ticketer := flows.NewTicketer(static.NewTicketer(assets.TicketerUUID(uuids.New()), "Support", "rocketchat"))
 	svc, err := rocketchat.NewService(
-		rt.Config,
+		rt.Config(),
 		http.DefaultClient,
 		nil,
 		ticketer,
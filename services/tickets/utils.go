@@ -53,7 +53,7 @@ func FromTicketUUID(ctx context.Context, rt *runtime.Runtime, uuid flows.TicketU
 	}
 
 	// and load it as a service
-	svc, err := ticketer.AsService(rt.Config, flows.NewTicketer(ticketer))
+	svc, err := ticketer.AsService(rt.Config(), flows.NewTicketer(ticketer))
 	if err != nil {
 		return nil, nil, nil, errors.Wrap(err, "error loading ticketer service")
 	}
@@ -69,7 +69,7 @@ func FromTicketerUUID(ctx context.Context, rt *runtime.Runtime, uuid assets.Tick
 	}
 
 	// and load it as a service
-	svc, err := ticketer.AsService(rt.Config, flows.NewTicketer(ticketer))
+	svc, err := ticketer.AsService(rt.Config(), flows.NewTicketer(ticketer))
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "error loading ticketer service")
 	}
@@ -146,10 +146,7 @@ func Close(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, ticke
 	}
 
 	if len(events) == 1 {
-		rc := rt.RP.Get()
-		defer rc.Close()
-
-		err = handler.QueueTicketEvent(rc, ticket.ContactID(), events[ticket])
+		err = handler.QueueTicketEvent(rt, ticket.ContactID(), events[ticket])
 		if err != nil {
 			return errors.Wrapf(err, "error queueing ticket closed event")
 		}
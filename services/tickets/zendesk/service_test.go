@@ -60,7 +60,7 @@ func TestOpenAndForward(t *testing.T) {
 	ticketer := flows.NewTicketer(static.NewTicketer(assets.TicketerUUID(uuids.New()), "Support", "zendesk"))
 
 	_, err = zendesk.NewService(
-		rt.Config,
+		rt.Config(),
 		http.DefaultClient,
 		nil,
 		ticketer,
@@ -69,7 +69,7 @@ func TestOpenAndForward(t *testing.T) {
 	assert.EqualError(t, err, "missing subdomain or secret or oauth_token or push_id or push_token in zendesk config")
 
 	svc, err := zendesk.NewService(
-		rt.Config,
+		rt.Config(),
 		http.DefaultClient,
 		nil,
 		ticketer,
@@ -152,7 +152,7 @@ func TestCloseAndReopen(t *testing.T) {
 
 	ticketer := flows.NewTicketer(static.NewTicketer(assets.TicketerUUID(uuids.New()), "Support", "zendesk"))
 	svc, err := zendesk.NewService(
-		rt.Config,
+		rt.Config(),
 		http.DefaultClient,
 		nil,
 		ticketer,
@@ -113,3 +113,35 @@ func (m *MockElasticServer) AddResponse(ids ...models.ContactID) {
 	})
 	m.Responses = append(m.Responses, response)
 }
+
+// AddTermsResponse adds a mock response with no hits and a terms aggregation with the given name and bucket counts
+func (m *MockElasticServer) AddTermsResponse(name string, counts map[string]int) {
+	buckets := make([]map[string]interface{}, 0, len(counts))
+	for key, count := range counts {
+		buckets = append(buckets, map[string]interface{}{"key": key, "doc_count": count})
+	}
+
+	response := jsonx.MustMarshal(map[string]interface{}{
+		"took":      2,
+		"timed_out": false,
+		"_shards": map[string]interface{}{
+			"total":      1,
+			"successful": 1,
+			"skipped":    0,
+			"failed":     0,
+		},
+		"hits": map[string]interface{}{
+			"total":     0,
+			"max_score": nil,
+			"hits":      []interface{}{},
+		},
+		"aggregations": map[string]interface{}{
+			name: map[string]interface{}{
+				"doc_count_error_upper_bound": 0,
+				"sum_other_doc_count":         0,
+				"buckets":                     buckets,
+			},
+		},
+	})
+	m.Responses = append(m.Responses, response)
+}
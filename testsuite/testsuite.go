@@ -70,11 +70,13 @@ func Get() (context.Context, *runtime.Runtime, *sqlx.DB, *redis.Pool) {
 		DB:                db,
 		ReadonlyDB:        db,
 		RP:                rp,
+		Queue:             queue.NewRedisBackend(rp),
 		ES:                nil,
 		AttachmentStorage: storage.NewFS(AttachmentStorageDir, 0766),
 		SessionStorage:    storage.NewFS(SessionStorageDir, 0766),
-		Config:            runtime.NewDefaultConfig(),
+		Drainer:           runtime.NewDrainer(),
 	}
+	rt.SetConfig(runtime.NewDefaultConfig())
 
 	logrus.SetLevel(logrus.DebugLevel)
 
@@ -7,34 +7,68 @@ import (
 	"time"
 
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/metrics"
 	"github.com/nyaruka/redisx"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+var (
+	cronRuns     = metrics.NewCounter("mailroom_cron_runs_total", "the number of cron runs by outcome", "cron", "outcome")
+	cronDuration = metrics.NewHistogram("mailroom_cron_duration_seconds", "the time taken by cron runs", metrics.DefaultBuckets, "cron")
+)
+
 // Function is the function that will be called on our schedule
 type Function func(context.Context, *runtime.Runtime) error
 
-// Start calls the passed in function every interval, making sure it acquires a
-// lock so that only one process is running at once. Note that across processes
-// crons may be called more often than duration as there is no inter-process
-// coordination of cron fires. (this might be a worthy addition)
-func Start(rt *runtime.Runtime, wg *sync.WaitGroup, name string, interval time.Duration, allInstances bool, cronFunc Function, timeout time.Duration, quit chan bool) {
-	wg.Add(1) // add ourselves to the wait group
-
+// Start calls the passed in function on the given schedule, making sure it acquires a lock so that only one process
+// is running at once. For interval schedules, crons may be called more often than the interval across processes as
+// there is no inter-process coordination of fires. For expression schedules, each slot is claimed in redis so that
+// it is fired at most once across all instances - a slot which comes due while the previous fire is still running will
+// wait for it to finish, but slots which pass entirely while a fire is running are skipped rather than caught up.
+// The status of each cron is recorded in redis.
+func Start(rt *runtime.Runtime, wg *sync.WaitGroup, name string, schedule Schedule, allInstances bool, cronFunc Function, timeout time.Duration, quit chan bool) {
 	lockName := fmt.Sprintf("lock:%s_lock", name) // for historical reasons...
+	statusKey := name
 
-	// for jobs that run on all instances, the lock key is specific to this instance
+	// for jobs that run on all instances, the lock and status keys are specific to this instance
 	if allInstances {
-		lockName = fmt.Sprintf("%s:%s", lockName, rt.Config.InstanceName)
+		lockName = fmt.Sprintf("%s:%s", lockName, rt.Config().InstanceName)
+		statusKey = fmt.Sprintf("%s:%s", name, rt.Config().InstanceName)
 	}
 
 	locker := redisx.NewLocker(lockName, time.Minute*5)
 
-	wait := time.Duration(0)
-	lastFire := time.Now()
+	// expression schedules wait for their first slot, interval schedules fire immediately
+	_, slotted := schedule.(*Expression)
+	nextFire := time.Now()
+	if slotted {
+		nextFire = schedule.Next(nextFire)
+	}
 
 	log := logrus.WithField("cron", name).WithField("lockName", lockName)
 
+	if nextFire.IsZero() {
+		log.Error("cron schedule has no next fire, not starting")
+		return
+	}
+
+	wg.Add(1) // add ourselves to the wait group
+
+	rc := rt.RP.Get()
+	if err := register(rc, statusKey, name, schedule, allInstances); err != nil {
+		log.WithError(err).Error("error registering cron")
+	}
+	if err := recordNextFire(rc, statusKey, nextFire); err != nil {
+		log.WithError(err).Error("error recording next fire")
+	}
+	rc.Close()
+
+	wait := time.Until(nextFire)
+	if wait < time.Duration(0) {
+		wait = time.Duration(0)
+	}
+
 	go func() {
 		defer func() {
 			log.Info("cron exiting")
@@ -48,42 +82,37 @@ func Start(rt *runtime.Runtime, wg *sync.WaitGroup, name string, interval time.D
 				return
 
 			case <-time.After(wait):
-				lastFire = time.Now()
+				slot := nextFire
+				lastFire := time.Now()
 
-				// try to get lock but don't retry - if lock is taken then task is still running or running on another instance
-				lock, err := locker.Grab(rt.RP, 0)
-				if err != nil {
-					break
+				// expression schedules wait for the lock until their next slot in case the previous fire is still running
+				lockWait := time.Duration(0)
+				if slotted {
+					lockWait = time.Until(schedule.Next(slot))
 				}
-				log := log.WithField("lock", lock)
 
-				if lock == "" {
-					log.Debug("lock already present, sleeping")
-					break
-				}
+				fireSlot(rt, log, locker, cronFunc, name, statusKey, lockName, slotted, slot, lockWait)
 
-				// ok, got the lock, run our cron function
-				start := time.Now()
-				err = fireCron(rt, cronFunc, lockName, lock)
-				if err != nil {
-					log.WithError(err).Error("error while running cron")
+				// calculate our next fire time, expression schedules skipping any slots missed by taking too long
+				if slotted {
+					nextFire = schedule.Next(time.Now())
+				} else {
+					nextFire = schedule.Next(lastFire)
 				}
-				elapsed := time.Since(start)
 
-				// release our lock
-				err = locker.Release(rt.RP, lock)
-				if err != nil {
-					log.WithError(err).Error("error releasing lock")
+				// shouldn't happen as impossible expressions can't be parsed, but don't spin if it does
+				if nextFire.IsZero() {
+					log.Error("cron schedule has no next fire, exiting")
+					return
 				}
 
-				// if cron too longer than a minute, log
-				if elapsed > time.Minute {
-					logrus.WithField("cron", name).WithField("elapsed", elapsed).Error("cron took too long")
+				rc := rt.RP.Get()
+				if err := recordNextFire(rc, statusKey, nextFire); err != nil {
+					log.WithError(err).Error("error recording next fire")
 				}
+				rc.Close()
 			}
 
-			// calculate our next fire time
-			nextFire := NextFire(lastFire, interval)
 			wait = time.Until(nextFire)
 			if wait < time.Duration(0) {
 				wait = time.Duration(0)
@@ -92,9 +121,75 @@ func Start(rt *runtime.Runtime, wg *sync.WaitGroup, name string, interval time.D
 	}()
 }
 
+// fireSlot fires the passed in cron function for the given slot if it can claim the slot (for expression schedules)
+// and grab the lock within lockWait, and records the fire
+func fireSlot(rt *runtime.Runtime, log *logrus.Entry, locker *redisx.Locker, cronFunc Function, name, statusKey, lockName string, slotted bool, slot time.Time, lockWait time.Duration) {
+	if slotted {
+		rc := rt.RP.Get()
+		claimed, err := claim(rc, statusKey, slot)
+		rc.Close()
+
+		if err != nil {
+			log.WithError(err).Error("error claiming slot")
+			return
+		}
+		if !claimed {
+			log.WithField("slot", slot).Debug("slot already claimed, sleeping")
+			return
+		}
+	}
+
+	// try to get lock - if lock is still taken after lockWait then task is still running or running on another instance
+	if lockWait < 0 {
+		lockWait = 0
+	}
+	lock, err := locker.Grab(rt.RP, lockWait)
+	if err != nil {
+		return
+	}
+	log = log.WithField("lock", lock)
+
+	if lock == "" {
+		log.Debug("lock already present, sleeping")
+		return
+	}
+
+	// ok, got the lock, run our cron function
+	start := time.Now()
+	fireErr := fireCron(rt, cronFunc, lockName, lock)
+	if fireErr != nil {
+		log.WithError(fireErr).Error("error while running cron")
+	}
+	elapsed := time.Since(start)
+
+	cronDuration.Observe(elapsed.Seconds(), name)
+	if fireErr != nil {
+		cronRuns.Inc(name, "error")
+	} else {
+		cronRuns.Inc(name, "success")
+	}
+
+	// release our lock
+	err = locker.Release(rt.RP, lock)
+	if err != nil {
+		log.WithError(err).Error("error releasing lock")
+	}
+
+	rc := rt.RP.Get()
+	if err := recordFire(rc, statusKey, rt.Config().InstanceName, start, elapsed, fireErr); err != nil {
+		log.WithError(err).Error("error recording cron fire")
+	}
+	rc.Close()
+
+	// if cron too longer than a minute, log
+	if elapsed > time.Minute {
+		log.WithField("elapsed", elapsed).Error("cron took too long")
+	}
+}
+
 // fireCron is just a wrapper around the cron function we will call for the purposes of
 // catching and logging panics
-func fireCron(rt *runtime.Runtime, cronFunc Function, lockName string, lockValue string) error {
+func fireCron(rt *runtime.Runtime, cronFunc Function, lockName string, lockValue string) (err error) {
 	log := logrus.WithField("lockValue", lockValue).WithField("func", cronFunc)
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
@@ -105,6 +200,7 @@ func fireCron(rt *runtime.Runtime, cronFunc Function, lockName string, lockValue
 		panicLog := recover()
 		if panicLog != nil {
 			log.Errorf("panic running cron: %s", panicLog)
+			err = errors.Errorf("panic running cron: %s", panicLog)
 		}
 	}()
 
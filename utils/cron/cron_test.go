@@ -6,11 +6,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/nyaruka/mailroom/runtime"
 	"github.com/nyaruka/mailroom/testsuite"
 	"github.com/nyaruka/mailroom/utils/cron"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCron(t *testing.T) {
@@ -49,7 +52,7 @@ func TestCron(t *testing.T) {
 	align()
 
 	// start a job that takes ~100 ms and runs every 250ms
-	cron.Start(rt, wg, "test1", time.Millisecond*250, false, createCronFunc(&running, &fired, map[int]time.Duration{}, time.Millisecond*100), time.Minute, quit)
+	cron.Start(rt, wg, "test1", cron.Every(time.Millisecond*250), false, createCronFunc(&running, &fired, map[int]time.Duration{}, time.Millisecond*100), time.Minute, quit)
 
 	// wait a bit, should only have fired three times (initial time + three repeats)
 	time.Sleep(time.Millisecond * 875) // time for 3 delays between tasks plus half of another delay
@@ -68,7 +71,7 @@ func TestCron(t *testing.T) {
 	align()
 
 	// simulate the job taking 400ms to run on the second fire, thus skipping the third fire
-	cron.Start(rt, wg, "test2", time.Millisecond*250, false, createCronFunc(&running, &fired, map[int]time.Duration{1: time.Millisecond * 400}, time.Millisecond*100), time.Minute, quit)
+	cron.Start(rt, wg, "test2", cron.Every(time.Millisecond*250), false, createCronFunc(&running, &fired, map[int]time.Duration{1: time.Millisecond * 400}, time.Millisecond*100), time.Minute, quit)
 
 	time.Sleep(time.Millisecond * 875)
 	assert.Equal(t, 3, fired)
@@ -76,14 +79,14 @@ func TestCron(t *testing.T) {
 	close(quit)
 
 	// simulate two different instances running the same cron
-	cfg1 := *rt.Config
-	cfg2 := *rt.Config
+	cfg1 := *rt.Config()
+	cfg2 := *rt.Config()
 	cfg1.InstanceName = "instance1"
 	cfg2.InstanceName = "instance2"
-	rt1 := *rt
-	rt1.Config = &cfg1
-	rt2 := *rt
-	rt2.Config = &cfg2
+	rt1 := &runtime.Runtime{RP: rt.RP, Queue: rt.Queue}
+	rt1.SetConfig(&cfg1)
+	rt2 := &runtime.Runtime{RP: rt.RP, Queue: rt.Queue}
+	rt2.SetConfig(&cfg2)
 
 	fired1 := 0
 	fired2 := 0
@@ -92,8 +95,8 @@ func TestCron(t *testing.T) {
 
 	align()
 
-	cron.Start(&rt1, wg, "test3", time.Millisecond*250, false, createCronFunc(&running, &fired1, map[int]time.Duration{}, time.Millisecond*100), time.Minute, quit)
-	cron.Start(&rt2, wg, "test3", time.Millisecond*250, false, createCronFunc(&running, &fired2, map[int]time.Duration{}, time.Millisecond*100), time.Minute, quit)
+	cron.Start(rt1, wg, "test3", cron.Every(time.Millisecond*250), false, createCronFunc(&running, &fired1, map[int]time.Duration{}, time.Millisecond*100), time.Minute, quit)
+	cron.Start(rt2, wg, "test3", cron.Every(time.Millisecond*250), false, createCronFunc(&running, &fired2, map[int]time.Duration{}, time.Millisecond*100), time.Minute, quit)
 
 	// same number of fires as if only a single instance was running it...
 	time.Sleep(time.Millisecond * 875)
@@ -110,8 +113,8 @@ func TestCron(t *testing.T) {
 	align()
 
 	// unless we start the cron with allInstances = true
-	cron.Start(&rt1, wg, "test4", time.Millisecond*250, true, createCronFunc(&running1, &fired1, map[int]time.Duration{}, time.Millisecond*100), time.Minute, quit)
-	cron.Start(&rt2, wg, "test4", time.Millisecond*250, true, createCronFunc(&running2, &fired2, map[int]time.Duration{}, time.Millisecond*100), time.Minute, quit)
+	cron.Start(rt1, wg, "test4", cron.Every(time.Millisecond*250), true, createCronFunc(&running1, &fired1, map[int]time.Duration{}, time.Millisecond*100), time.Minute, quit)
+	cron.Start(rt2, wg, "test4", cron.Every(time.Millisecond*250), true, createCronFunc(&running2, &fired2, map[int]time.Duration{}, time.Millisecond*100), time.Minute, quit)
 
 	// now both instances fire 4 times
 	time.Sleep(time.Millisecond * 875)
@@ -119,6 +122,70 @@ func TestCron(t *testing.T) {
 	assert.Equal(t, 4, fired2)
 
 	close(quit)
+
+	// check the statuses recorded in redis
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	statuses, err := cron.GetStatuses(rc)
+	require.NoError(t, err)
+	require.Len(t, statuses, 5)
+
+	assert.Equal(t, "test1", statuses[0].Name)
+	assert.Equal(t, "250ms", statuses[0].Schedule)
+	assert.False(t, statuses[0].AllInstances)
+	assert.NotNil(t, statuses[0].LastStart)
+	assert.NotNil(t, statuses[0].LastDuration)
+	assert.Equal(t, "", statuses[0].LastError)
+	assert.NotNil(t, statuses[0].NextFire)
+
+	assert.Equal(t, "test4", statuses[3].Name)
+	assert.True(t, statuses[3].AllInstances)
+	assert.Equal(t, "instance1", statuses[3].LastInstance)
+	assert.Equal(t, "test4", statuses[4].Name)
+	assert.Equal(t, "instance2", statuses[4].LastInstance)
+
+	// statuses expire if they're not refreshed, and crons whose statuses have expired are removed from the registry
+	ttl, err := redis.Int(rc.Do("ttl", "cron:test4:instance2"))
+	require.NoError(t, err)
+	assert.Greater(t, ttl, 0)
+
+	_, err = rc.Do("del", "cron:test4:instance2")
+	require.NoError(t, err)
+
+	statuses, err = cron.GetStatuses(rc)
+	require.NoError(t, err)
+	assert.Len(t, statuses, 4)
+
+	registered, err := redis.Bool(rc.Do("sismember", "crons", "test4:instance2"))
+	require.NoError(t, err)
+	assert.False(t, registered)
+}
+
+func TestCronErrors(t *testing.T) {
+	_, rt, _, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	wg := &sync.WaitGroup{}
+	quit := make(chan bool)
+
+	cron.Start(rt, wg, "failing", cron.Every(time.Second), false, func(context.Context, *runtime.Runtime) error { return errors.New("boom") }, time.Minute, quit)
+	cron.Start(rt, wg, "panicking", cron.Every(time.Second), false, func(context.Context, *runtime.Runtime) error { panic("kaboom") }, time.Minute, quit)
+
+	time.Sleep(time.Millisecond * 100)
+	close(quit)
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	statuses, err := cron.GetStatuses(rc)
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.Equal(t, "failing", statuses[0].Name)
+	assert.Equal(t, "boom", statuses[0].LastError)
+	assert.Equal(t, "panicking", statuses[1].Name)
+	assert.Equal(t, "panic running cron: kaboom", statuses[1].LastError)
 }
 
 func TestNextFire(t *testing.T) {
@@ -139,3 +206,62 @@ func TestNextFire(t *testing.T) {
 		assert.Equal(t, tc.expected, actual, "next fire mismatch for %s + %s", tc.last, tc.interval)
 	}
 }
+
+func TestParseExpression(t *testing.T) {
+	tcs := []struct {
+		expr string
+		err  string
+	}{
+		{"* * * * *", ""},
+		{"*/5 9-17 * * 1-5", ""},
+		{"0,30 0 1 1,6 0", ""},
+		{"0 0 * * 7", ""},
+		{"* * * *", "cron expression '* * * *' must have 5 fields"},
+		{"60 * * * *", "invalid cron expression '60 * * * *': minute field value out of range: 60"},
+		{"* 5-1 * * *", "invalid cron expression '* 5-1 * * *': hour field value out of range: 5-1"},
+		{"* * 0 * *", "invalid cron expression '* * 0 * *': day of month field value out of range: 0"},
+		{"*/0 * * * *", "invalid cron expression '*/0 * * * *': invalid step in minute field: */0"},
+		{"* * * jan *", "invalid cron expression '* * * jan *': invalid value in month field: jan"},
+		{"0 0 30 2 *", "invalid cron expression '0 0 30 2 *': day of month never occurs in month"},
+		{"0 0 31 4,6,9,11 *", "invalid cron expression '0 0 31 4,6,9,11 *': day of month never occurs in month"},
+		{"0 0 30 2 1", ""}, // matches mondays in february
+	}
+
+	for _, tc := range tcs {
+		expr, err := cron.ParseExpression(tc.expr)
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err, "error mismatch for %s", tc.expr)
+		} else {
+			assert.NoError(t, err, "unexpected error for %s", tc.expr)
+			assert.Equal(t, tc.expr, expr.String())
+		}
+	}
+
+	assert.Panics(t, func() { cron.MustParseExpression("foo") })
+}
+
+func TestExpressionNext(t *testing.T) {
+	tcs := []struct {
+		expr     string
+		after    time.Time
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2000, 1, 1, 1, 1, 4, 0, time.UTC), time.Date(2000, 1, 1, 1, 2, 0, 0, time.UTC)},
+		{"* * * * *", time.Date(2000, 1, 1, 1, 1, 0, 0, time.UTC), time.Date(2000, 1, 1, 1, 2, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2000, 1, 1, 1, 1, 4, 0, time.UTC), time.Date(2000, 1, 1, 1, 15, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2000, 1, 1, 1, 50, 0, 0, time.UTC), time.Date(2000, 1, 1, 2, 0, 0, 0, time.UTC)},
+		{"30 9-17 * * *", time.Date(2000, 1, 1, 17, 45, 0, 0, time.UTC), time.Date(2000, 1, 2, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2000, 12, 15, 0, 0, 0, 0, time.UTC), time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 1-5", time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2000, 1, 3, 12, 0, 0, 0, time.UTC)}, // 1st is a saturday
+		{"0 12 * * 7", time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2000, 1, 2, 12, 0, 0, 0, time.UTC)},
+		{"0 12 15 * 1", time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2000, 1, 3, 12, 0, 0, 0, time.UTC)}, // day of month or day of week
+		{"0 0 29 2 *", time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2004, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2097, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2104, 2, 29, 0, 0, 0, 0, time.UTC)}, // 2100 isn't a leap year
+		{"* * * * *", time.Date(2000, 1, 1, 1, 1, 4, 0, time.FixedZone("", 3600)), time.Date(2000, 1, 1, 0, 2, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range tcs {
+		actual := cron.MustParseExpression(tc.expr).Next(tc.after)
+		assert.Equal(t, tc.expected, actual, "next mismatch for '%s' after %s", tc.expr, tc.after)
+	}
+}
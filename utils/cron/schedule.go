@@ -0,0 +1,227 @@
+package cron
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Schedule determines when a cron fires
+type Schedule interface {
+	// Next returns the next time the cron should fire after the passed in time
+	Next(time.Time) time.Time
+
+	// String returns a description of this schedule
+	String() string
+}
+
+// Every is a schedule which fires every interval, starting as soon as the cron is started
+type Every time.Duration
+
+// Next returns the next fire time after the passed in time
+func (e Every) Next(last time.Time) time.Time { return NextFire(last, time.Duration(e)) }
+
+// String returns a description of this schedule, e.g. "1m0s"
+func (e Every) String() string { return time.Duration(e).String() }
+
+// Expression is a schedule defined by a standard five field cron expression, i.e. minute, hour, day of month, month
+// and day of week. Each field can be a wildcard, a single value, a range, a list or a step, e.g. "*/5 9-17 * * 1-5".
+// Times are always evaluated in UTC and fires are aligned to slots so that all instances agree on when a cron
+// should fire.
+type Expression struct {
+	expr     string
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+
+	anyDay     bool
+	anyWeekday bool
+}
+
+// how far ahead we look for a matching time before giving up, which is long enough to always find the next 29th of
+// February, as there can be 8 years between leap years
+const maxExpressionYears = 8
+
+// the most days each month can have
+var maxMonthDays = [13]int{0, 31, 29, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}
+
+type expressionField struct {
+	name     string
+	min, max int
+}
+
+var expressionFields = []expressionField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// ParseExpression parses the passed in cron expression
+func ParseExpression(expr string) (*Expression, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(expressionFields) {
+		return nil, errors.Errorf("cron expression '%s' must have %d fields", expr, len(expressionFields))
+	}
+
+	values := make([]uint64, len(fields))
+	for i, f := range fields {
+		bits, err := parseExpressionField(f, expressionFields[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid cron expression '%s'", expr)
+		}
+		values[i] = bits
+	}
+
+	// sunday can be 0 or 7
+	weekdays := values[4]
+	if weekdays&(1<<7) != 0 {
+		weekdays = (weekdays | 1) &^ (1 << 7)
+	}
+
+	e := &Expression{
+		expr:       expr,
+		minutes:    values[0],
+		hours:      values[1],
+		days:       values[2],
+		months:     values[3],
+		weekdays:   weekdays,
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}
+
+	if !e.isPossible() {
+		return nil, errors.Errorf("invalid cron expression '%s': day of month never occurs in month", expr)
+	}
+
+	return e, nil
+}
+
+// whether this expression can ever match, which it can't if days are only matched by day of month and none of those
+// days occur in any of its months, e.g. "0 0 30 2 *"
+func (e *Expression) isPossible() bool {
+	if !e.anyWeekday {
+		return true
+	}
+
+	for m := 1; m <= 12; m++ {
+		if e.months&(1<<m) == 0 {
+			continue
+		}
+		for d := 1; d <= maxMonthDays[m]; d++ {
+			if e.days&(1<<d) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MustParseExpression parses the passed in cron expression, panicking if it is invalid
+func MustParseExpression(expr string) *Expression {
+	e, err := ParseExpression(expr)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// parses a single field of an expression into a bitset of the values it matches
+func parseExpressionField(field string, spec expressionField) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rng = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, errors.Errorf("invalid step in %s field: %s", spec.name, part)
+			}
+		}
+
+		start, end := spec.min, spec.max
+
+		if rng != "*" {
+			var err error
+			bounds := strings.SplitN(rng, "-", 2)
+
+			start, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, errors.Errorf("invalid value in %s field: %s", spec.name, part)
+			}
+
+			if len(bounds) == 2 {
+				end, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, errors.Errorf("invalid value in %s field: %s", spec.name, part)
+				}
+			} else if step == 1 {
+				end = start
+			}
+		}
+
+		if start < spec.min || end > spec.max || start > end {
+			return 0, errors.Errorf("%s field value out of range: %s", spec.name, part)
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	return bits, nil
+}
+
+// Next returns the first slot after the passed in time, or a zero time if there isn't one
+func (e *Expression) Next(after time.Time) time.Time {
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxExpressionYears, 0, 0)
+
+	for t.Before(limit) {
+		if e.months&(1<<int(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !e.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if e.hours&(1<<t.Hour()) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if e.minutes&(1<<t.Minute()) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+// like regular cron, if both day fields are restricted then a day matches if it matches either
+func (e *Expression) matchesDay(t time.Time) bool {
+	day := e.days&(1<<t.Day()) != 0
+	weekday := e.weekdays&(1<<int(t.Weekday())) != 0
+
+	if e.anyDay && e.anyWeekday {
+		return true
+	} else if e.anyDay {
+		return weekday
+	} else if e.anyWeekday {
+		return day
+	}
+	return day || weekday
+}
+
+// String returns the original expression
+func (e *Expression) String() string { return e.expr }
@@ -0,0 +1,137 @@
+package cron
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	registryKey   = "crons"
+	statusPattern = "cron:%s"
+	slotPattern   = "cron:%s:slot"
+
+	// statuses expire if not refreshed within a few multiples of the time until their next fire, so that those of
+	// instances which have gone away, or of crons which have been removed, don't linger
+	statusTTLMultiple = 3
+	minStatusTTL      = 10 * time.Minute
+)
+
+// Status is the status of a cron as recorded in redis by the instances running it
+type Status struct {
+	Name         string     `json:"name"`
+	Schedule     string     `json:"schedule"`
+	AllInstances bool       `json:"all_instances"`
+	LastStart    *time.Time `json:"last_start,omitempty"`
+	LastDuration *float64   `json:"last_duration,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastInstance string     `json:"last_instance,omitempty"`
+	NextFire     *time.Time `json:"next_fire,omitempty"`
+}
+
+// registers the passed in cron, adding it to our set of crons and recording its schedule
+func register(rc redis.Conn, key string, name string, schedule Schedule, allInstances bool) error {
+	rc.Send("multi")
+	rc.Send("sadd", registryKey, key)
+	rc.Send("hset", fmt.Sprintf(statusPattern, key), "name", name, "schedule", schedule.String(), "all_instances", allInstances)
+	_, err := rc.Do("exec")
+	return errors.Wrapf(err, "error registering cron %s", key)
+}
+
+// records a run of the passed in cron by the given instance
+func recordFire(rc redis.Conn, key string, instance string, start time.Time, elapsed time.Duration, fireErr error) error {
+	errMsg := ""
+	if fireErr != nil {
+		errMsg = fireErr.Error()
+	}
+
+	_, err := rc.Do("hset", fmt.Sprintf(statusPattern, key),
+		"last_start", start.UTC().Format(time.RFC3339Nano),
+		"last_duration", strconv.FormatFloat(elapsed.Seconds(), 'f', 3, 64),
+		"last_error", errMsg,
+		"last_instance", instance,
+	)
+	return errors.Wrapf(err, "error recording fire of cron %s", key)
+}
+
+// records the next time the passed in cron will fire, and refreshes the expiry of its status accordingly
+func recordNextFire(rc redis.Conn, key string, next time.Time) error {
+	ttl := time.Until(next) * statusTTLMultiple
+	if ttl < minStatusTTL {
+		ttl = minStatusTTL
+	}
+
+	rc.Send("multi")
+	rc.Send("hset", fmt.Sprintf(statusPattern, key), "next_fire", next.UTC().Format(time.RFC3339Nano))
+	rc.Send("pexpire", fmt.Sprintf(statusPattern, key), ttl.Milliseconds())
+	_, err := rc.Do("exec")
+	return errors.Wrapf(err, "error recording next fire of cron %s", key)
+}
+
+var claimSlot = redis.NewScript(1, `-- KEYS: [SlotKey] ARGV: [Slot, TTL]
+	local last = tonumber(redis.call("get", KEYS[1]) or "0")
+	if tonumber(ARGV[1]) > last then
+		redis.call("set", KEYS[1], ARGV[1], "EX", ARGV[2])
+		return 1
+	end
+	return 0
+`)
+
+// tries to claim the given slot for the passed in cron, returning false if it's already been claimed by another instance
+func claim(rc redis.Conn, key string, slot time.Time) (bool, error) {
+	claimed, err := redis.Bool(claimSlot.Do(rc, fmt.Sprintf(slotPattern, key), slot.Unix(), 60*60*24*7))
+	return claimed, errors.Wrapf(err, "error claiming slot for cron %s", key)
+}
+
+// GetStatuses returns the statuses of all registered crons, ordered by name. Crons whose statuses have expired are
+// removed from the registry.
+func GetStatuses(rc redis.Conn) ([]*Status, error) {
+	keys, err := redis.Strings(rc.Do("smembers", registryKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting registered crons")
+	}
+
+	sort.Strings(keys)
+
+	statuses := make([]*Status, 0, len(keys))
+	for _, key := range keys {
+		values, err := redis.StringMap(rc.Do("hgetall", fmt.Sprintf(statusPattern, key)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting status of cron %s", key)
+		}
+		if len(values) == 0 {
+			if _, err := rc.Do("srem", registryKey, key); err != nil {
+				return nil, errors.Wrapf(err, "error removing expired cron %s", key)
+			}
+			continue
+		}
+
+		status := &Status{
+			Name:         values["name"],
+			Schedule:     values["schedule"],
+			AllInstances: values["all_instances"] == "1",
+			LastError:    values["last_error"],
+			LastInstance: values["last_instance"],
+		}
+		if v, ok := values["last_start"]; ok {
+			t, _ := time.Parse(time.RFC3339Nano, v)
+			status.LastStart = &t
+		}
+		if v, ok := values["last_duration"]; ok {
+			d, _ := strconv.ParseFloat(v, 64)
+			status.LastDuration = &d
+		}
+		if v, ok := values["next_fire"]; ok {
+			t, _ := time.Parse(time.RFC3339Nano, v)
+			status.NextFire = &t
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
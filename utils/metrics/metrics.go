@@ -0,0 +1,263 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// DefaultBuckets are the default histogram buckets in seconds, suitable for most durations we measure
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// collector is a metric which is recorded in process and collected into a family when scraped
+type collector interface {
+	name() string
+	collect() *dto.MetricFamily
+}
+
+var registry = struct {
+	mutex      sync.Mutex
+	collectors map[string]collector
+}{collectors: make(map[string]collector)}
+
+func register(c collector) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if _, exists := registry.collectors[c.name()]; exists {
+		panic(fmt.Sprintf("metric %s already registered", c.name()))
+	}
+	registry.collectors[c.name()] = c
+}
+
+// Gather collects all registered metrics into families, ordered by name
+func Gather() []*dto.MetricFamily {
+	registry.mutex.Lock()
+	collectors := make([]collector, 0, len(registry.collectors))
+	for _, c := range registry.collectors {
+		collectors = append(collectors, c)
+	}
+	registry.mutex.Unlock()
+
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+
+	families := make([]*dto.MetricFamily, len(collectors))
+	for i, c := range collectors {
+		families[i] = c.collect()
+	}
+	return families
+}
+
+// Write writes the passed in families in the prometheus text format, skipping any which have no metrics
+func Write(w io.Writer, families []*dto.MetricFamily) error {
+	for _, family := range families {
+		if len(family.Metric) == 0 {
+			continue
+		}
+		if _, err := expfmt.MetricFamilyToText(w, family); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// base of our labelled metrics, values are keyed by their joined label values
+type vec struct {
+	family string
+	help   string
+	labels []string
+	mutex  sync.Mutex
+	keys   []string
+	values map[string][]string
+}
+
+func newVec(name, help string, labels []string) vec {
+	return vec{family: name, help: help, labels: labels, values: make(map[string][]string)}
+}
+
+func (v *vec) name() string { return v.family }
+
+// returns the key for the passed in label values, adding it if it's new. Callers must hold the mutex.
+func (v *vec) key(labelValues []string) (string, bool) {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.family, len(v.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	if _, exists := v.values[key]; exists {
+		return key, false
+	}
+
+	v.keys = append(v.keys, key)
+	v.values[key] = append([]string(nil), labelValues...)
+	return key, true
+}
+
+// builds a metric family of the given type, calling fn to build the metric for each set of label values
+func (v *vec) build(metricType dto.MetricType, fn func(key string) *dto.Metric) *dto.MetricFamily {
+	keys := append([]string(nil), v.keys...)
+	sort.Strings(keys)
+
+	family := &dto.MetricFamily{
+		Name:   proto.String(v.family),
+		Help:   proto.String(v.help),
+		Type:   metricType.Enum(),
+		Metric: make([]*dto.Metric, 0, len(keys)),
+	}
+
+	for _, key := range keys {
+		metric := fn(key)
+		metric.Label = labelPairs(v.labels, v.values[key])
+		family.Metric = append(family.Metric, metric)
+	}
+	return family
+}
+
+// Counter is a metric whose value only goes up, e.g. the number of errors
+type Counter struct {
+	vec
+	counts map[string]float64
+}
+
+// NewCounter creates and registers a new counter with the given label names
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec: newVec(name, help, labels), counts: make(map[string]float64)}
+	register(c)
+	return c
+}
+
+// Inc increments the counter for the given label values by one
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter for the given label values by the given amount
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key, _ := c.key(labelValues)
+	c.counts[key] += v
+}
+
+func (c *Counter) collect() *dto.MetricFamily {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.build(dto.MetricType_COUNTER, func(key string) *dto.Metric {
+		return &dto.Metric{Counter: &dto.Counter{Value: proto.Float64(c.counts[key])}}
+	})
+}
+
+// Histogram is a metric which counts observations in buckets, e.g. durations of tasks
+type Histogram struct {
+	vec
+	buckets []float64
+	counts  map[string][]uint64
+	sums    map[string]float64
+	totals  map[string]uint64
+}
+
+// NewHistogram creates and registers a new histogram with the given buckets and label names
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		vec:     newVec(name, help, labels),
+		buckets: buckets,
+		counts:  make(map[string][]uint64),
+		sums:    make(map[string]float64),
+		totals:  make(map[string]uint64),
+	}
+	register(h)
+	return h
+}
+
+// Observe records the passed in value for the given label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	key, added := h.key(labelValues)
+	if added {
+		h.counts[key] = make([]uint64, len(h.buckets))
+	}
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[key][i]++
+		}
+	}
+	h.sums[key] += v
+	h.totals[key]++
+}
+
+func (h *Histogram) collect() *dto.MetricFamily {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.build(dto.MetricType_HISTOGRAM, func(key string) *dto.Metric {
+		buckets := make([]*dto.Bucket, len(h.buckets))
+		for i, upper := range h.buckets {
+			buckets[i] = &dto.Bucket{UpperBound: proto.Float64(upper), CumulativeCount: proto.Uint64(h.counts[key][i])}
+		}
+
+		return &dto.Metric{Histogram: &dto.Histogram{
+			SampleCount: proto.Uint64(h.totals[key]),
+			SampleSum:   proto.Float64(h.sums[key]),
+			Bucket:      buckets,
+		}}
+	})
+}
+
+// Snapshot is a family of gauges or counters whose values are read at collection time, e.g. pool stats. Unlike
+// counters and histograms, these are not registered and callers are responsible for collecting them.
+type Snapshot struct {
+	*dto.MetricFamily
+	labels []string
+}
+
+// NewGaugeSnapshot creates a new snapshot of gauges with the given label names
+func NewGaugeSnapshot(name, help string, labels ...string) *Snapshot {
+	return newSnapshot(name, help, dto.MetricType_GAUGE, labels)
+}
+
+// NewCounterSnapshot creates a new snapshot of counters with the given label names, e.g. for cumulative stats
+func NewCounterSnapshot(name, help string, labels ...string) *Snapshot {
+	return newSnapshot(name, help, dto.MetricType_COUNTER, labels)
+}
+
+func newSnapshot(name, help string, metricType dto.MetricType, labels []string) *Snapshot {
+	return &Snapshot{
+		MetricFamily: &dto.MetricFamily{
+			Name:   proto.String(name),
+			Help:   proto.String(help),
+			Type:   metricType.Enum(),
+			Metric: []*dto.Metric{},
+		},
+		labels: labels,
+	}
+}
+
+// Set adds a value with the given label values to this snapshot
+func (s *Snapshot) Set(v float64, labelValues ...string) {
+	metric := &dto.Metric{Label: labelPairs(s.labels, labelValues)}
+	if s.GetType() == dto.MetricType_COUNTER {
+		metric.Counter = &dto.Counter{Value: proto.Float64(v)}
+	} else {
+		metric.Gauge = &dto.Gauge{Value: proto.Float64(v)}
+	}
+	s.Metric = append(s.Metric, metric)
+}
+
+func labelPairs(names, values []string) []*dto.LabelPair {
+	pairs := make([]*dto.LabelPair, len(names))
+	for i := range names {
+		pairs[i] = &dto.LabelPair{Name: proto.String(names[i]), Value: proto.String(values[i])}
+	}
+	return pairs
+}
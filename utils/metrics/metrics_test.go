@@ -0,0 +1,59 @@
+package metrics_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nyaruka/mailroom/utils/metrics"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	counter := metrics.NewCounter("test_errors_total", "the number of errors", "type")
+	histogram := metrics.NewHistogram("test_duration_seconds", "the time taken", []float64{0.25, 1}, "type")
+
+	counter.Inc("foo")
+	counter.Add(2, "foo")
+	counter.Inc("bar")
+	histogram.Observe(0.5, "foo")
+	histogram.Observe(0.25, "foo")
+	histogram.Observe(4, "foo")
+
+	assert.Panics(t, func() { metrics.NewCounter("test_errors_total", "the number of errors again") })
+	assert.Panics(t, func() { counter.Inc("foo", "bar") })
+
+	gauges := metrics.NewGaugeSnapshot("test_connections", "the number of connections", "state")
+	gauges.Set(3, "idle")
+	empty := metrics.NewCounterSnapshot("test_waits_total", "the number of waits")
+
+	families := make([]*dto.MetricFamily, 0)
+	for _, f := range metrics.Gather() {
+		if f.GetName() == "test_duration_seconds" || f.GetName() == "test_errors_total" {
+			families = append(families, f)
+		}
+	}
+	require.Len(t, families, 2)
+
+	families = append(families, gauges.MetricFamily, empty.MetricFamily)
+
+	b := &bytes.Buffer{}
+	require.NoError(t, metrics.Write(b, families))
+
+	assert.Equal(t, `# HELP test_duration_seconds the time taken
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{type="foo",le="0.25"} 1
+test_duration_seconds_bucket{type="foo",le="1"} 2
+test_duration_seconds_bucket{type="foo",le="+Inf"} 3
+test_duration_seconds_sum{type="foo"} 4.75
+test_duration_seconds_count{type="foo"} 3
+# HELP test_errors_total the number of errors
+# TYPE test_errors_total counter
+test_errors_total{type="bar"} 1
+test_errors_total{type="foo"} 3
+# HELP test_connections the number of connections
+# TYPE test_connections gauge
+test_connections{state="idle"} 3
+`, b.String())
+}
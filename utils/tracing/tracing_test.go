@@ -0,0 +1,94 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/tracing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	// no collector configured means nothing to flush
+	stop, err := tracing.Configure(runtime.NewDefaultConfig())
+	require.NoError(t, err)
+	assert.NoError(t, stop(context.Background()))
+
+	// no span in context means no trace ID
+	assert.Equal(t, "", tracing.TraceID(context.Background()))
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	ctx, span := tracing.Start(context.Background(), "parent")
+	traceID := tracing.TraceID(ctx)
+	assert.Len(t, traceID, 32)
+
+	start := time.Date(2022, 10, 5, 12, 30, 0, 0, time.UTC)
+	tracing.Record(ctx, "webhook", start, start.Add(time.Second), errors.New("connection error"), attribute.String("http.url", "http://example.com"))
+
+	tracing.End(span, errors.New("boom"))
+
+	ended := recorder.Ended()
+	require.Len(t, ended, 2)
+
+	assert.Equal(t, "webhook", ended[0].Name())
+	assert.Equal(t, traceID, ended[0].SpanContext().TraceID().String())
+	assert.Equal(t, span.SpanContext().SpanID(), ended[0].Parent().SpanID())
+	assert.Equal(t, start, ended[0].StartTime())
+	assert.Equal(t, start.Add(time.Second), ended[0].EndTime())
+	assert.Equal(t, codes.Error, ended[0].Status().Code)
+	assert.Equal(t, "connection error", ended[0].Status().Description)
+
+	assert.Equal(t, "parent", ended[1].Name())
+	assert.Equal(t, codes.Error, ended[1].Status().Code)
+	assert.Equal(t, "boom", ended[1].Status().Description)
+}
+
+func TestTransport(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, span := tracing.Start(context.Background(), "parent")
+	client := &http.Client{Transport: tracing.NewTransport(http.DefaultTransport)}
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api?token=secret", nil)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	span.End()
+
+	// trace context isn't propagated to the server
+	assert.Equal(t, "", headers.Get("traceparent"))
+
+	ended := recorder.Ended()
+	require.Len(t, ended, 2)
+
+	assert.Equal(t, "HTTP GET", ended[0].Name())
+	assert.Equal(t, span.SpanContext().SpanID(), ended[0].Parent().SpanID())
+	assert.Contains(t, ended[0].Attributes(), attribute.String("http.url", server.URL+"/api"))
+	assert.Contains(t, ended[0].Attributes(), attribute.Int("http.status_code", 503))
+	assert.Equal(t, codes.Error, ended[0].Status().Code)
+}
@@ -0,0 +1,277 @@
+package broadcast
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/contactql"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/search"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/broadcast/preview", web.RequireAuthToken(handlePreview), web.WithDoc(&web.RouteDoc{
+		Summary: "Previews who a broadcast would be sent to and what they would receive", Request: &previewRequest{}, Response: &previewResponse{},
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/broadcast/report", web.RequireAuthToken(handleReport), web.WithDoc(&web.RouteDoc{
+		Summary: "Gets the delivery report of a broadcast", Request: &reportRequest{}, Response: &models.BroadcastReport{},
+	}))
+}
+
+// Generates a preview of a broadcast, with how many contacts it would be sent to, how many of those would be sent each
+// of its translations, and a sample of up to 10 of its messages rendered for real contacts so that broken expressions
+// can be caught before it's sent. Contacts who aren't active are always excluded as broadcasts are never sent to them.
+// Templates are assumed to be unevaluated unless a template state is given.
+//
+//	{
+//	  "org_id": 1,
+//	  "translations": {"eng": {"text": "Hi @contact.name"}, "spa": {"text": "Hola @contact.name"}},
+//	  "base_language": "eng",
+//	  "template_state": "unevaluated",
+//	  "include": {
+//	    "group_uuids": ["5fa925e4-edd8-4e2a-ab24-b3dbb5932ddd"],
+//	    "contact_uuids": ["e5bb9e6f-7703-4ba1-afba-0b12791de38b"],
+//	    "urns": ["tel:+1234567890"],
+//	    "query": ""
+//	  },
+//	  "exclude": {
+//	    "in_a_flow": false,
+//	    "not_seen_since_days": 90
+//	  },
+//	  "sample_size": 3
+//	}
+//
+//	{
+//	  "query": "(group = \"Doctors\" OR uuid = \"e5bb9e6f-7703-4ba1-afba-0b12791de38b\" OR tel = \"+1234567890\") AND status = \"active\"",
+//	  "total": 567,
+//	  "languages": {"eng": 456, "spa": 111},
+//	  "samples": [
+//	    {"contact_uuid": "e5bb9e6f-7703-4ba1-afba-0b12791de38b", "language": "spa", "text": "Hola Ana"},
+//	    {"contact_uuid": "c7e7ed8c-4c0b-4f5a-9a44-46e1b0e0e5a5", "language": "eng", "text": "Hi Bob"}
+//	  ]
+//	}
+type previewRequest struct {
+	OrgID         models.OrgID                                   `json:"org_id"         validate:"required"`
+	Translations  map[envs.Language]*models.BroadcastTranslation `json:"translations"   validate:"required"`
+	BaseLanguage  envs.Language                                  `json:"base_language"  validate:"required"`
+	TemplateState models.TemplateState                           `json:"template_state"`
+	Include       struct {
+		GroupUUIDs   []assets.GroupUUID  `json:"group_uuids"`
+		ContactUUIDs []flows.ContactUUID `json:"contact_uuids"`
+		URNs         []urns.URN          `json:"urns"`
+		Query        string              `json:"query"`
+	} `json:"include" validate:"required"`
+	Exclude    search.Exclusions `json:"exclude"`
+	SampleSize int               `json:"sample_size"    validate:"required,max=10"`
+}
+
+type previewSample struct {
+	ContactUUID flows.ContactUUID `json:"contact_uuid"`
+	Language    envs.Language     `json:"language"`
+	Text        string            `json:"text"`
+	Error       string            `json:"error,omitempty"`
+}
+
+type previewResponse struct {
+	Query     string                `json:"query"`
+	Total     int                   `json:"total"`
+	Languages map[envs.Language]int `json:"languages"`
+	Samples   []*previewSample      `json:"samples"`
+}
+
+func handlePreview(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &previewRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	}
+	if request.TemplateState == "" {
+		request.TemplateState = models.TemplateStateUnevaluated
+	}
+	if request.Translations[request.BaseLanguage] == nil {
+		return errors.Errorf("no translation for base language: %s", request.BaseLanguage), http.StatusBadRequest, nil
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, request.OrgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load org assets")
+	}
+
+	groups := make([]*models.Group, 0, len(request.Include.GroupUUIDs))
+	for _, groupUUID := range request.Include.GroupUUIDs {
+		g := oa.GroupByUUID(groupUUID)
+		if g != nil {
+			groups = append(groups, g)
+		}
+	}
+
+	// without any inclusions there's nobody to send to, regardless of exclusions
+	if len(groups) == 0 && len(request.Include.ContactUUIDs) == 0 && len(request.Include.URNs) == 0 && request.Include.Query == "" {
+		return &previewResponse{Languages: map[envs.Language]int{}, Samples: []*previewSample{}}, http.StatusOK, nil
+	}
+
+	request.Exclude.NonActive = true
+
+	query, err := search.BuildStartQuery(oa, nil, groups, request.Include.ContactUUIDs, request.Include.URNs, request.Include.Query, request.Exclude)
+	if err != nil {
+		isQueryError, qerr := contactql.IsQueryError(err)
+		if isQueryError {
+			return qerr, http.StatusBadRequest, nil
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	parsedQuery, sampleIDs, total, err := search.GetContactIDsForQueryPage(ctx, rt.ES, oa, nil, nil, query, "", 0, request.SampleSize)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error querying preview")
+	}
+
+	// contacts who don't get their own language's translation get the org default language's, or failing that the base
+	// language's, so we count those who do and the rest get the fallback
+	fallback := oa.Env().DefaultLanguage()
+	if request.Translations[fallback] == nil {
+		fallback = request.BaseLanguage
+	}
+
+	counted := make([]envs.Language, 0, len(request.Translations))
+	for _, lang := range oa.Env().AllowedLanguages() {
+		if lang != fallback && request.Translations[lang] != nil {
+			counted = append(counted, lang)
+		}
+	}
+
+	languages, err := search.GetContactLanguageCounts(ctx, rt.ES, oa, query, counted)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error counting contacts by language")
+	}
+
+	remaining := int(total)
+	for _, count := range languages {
+		remaining -= count
+	}
+	if remaining > 0 {
+		languages[fallback] = remaining
+	}
+
+	// render the messages our sample of contacts would be sent, in the order they were returned by the search
+	contacts, err := models.LoadContacts(ctx, rt.ReadonlyDB, oa, sampleIDs)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error loading sample contacts")
+	}
+	contactsByID := make(map[models.ContactID]*models.Contact, len(contacts))
+	for _, c := range contacts {
+		contactsByID[c.ID()] = c
+	}
+
+	batch := models.NewBroadcast(oa.OrgID(), models.NilBroadcastID, request.Translations, request.TemplateState, request.BaseLanguage, nil, nil, nil, models.NilTicketID, models.NilUserID).CreateBatch(sampleIDs)
+	samples := make([]*previewSample, 0, len(contacts))
+
+	for _, id := range sampleIDs {
+		c := contactsByID[id]
+		if c == nil {
+			continue
+		}
+
+		contact, err := c.FlowContact(oa)
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.Wrapf(err, "error creating flow contact")
+		}
+
+		lang, trans := batch.ResolveTranslation(oa, contact)
+		text, err := batch.RenderText(oa, contact, trans)
+
+		sample := &previewSample{ContactUUID: contact.UUID(), Language: lang, Text: text}
+		if err != nil {
+			sample.Error = err.Error()
+		}
+		samples = append(samples, sample)
+	}
+
+	return &previewResponse{
+		Query:     parsedQuery.String(),
+		Total:     int(total),
+		Languages: languages,
+		Samples:   samples,
+	}, http.StatusOK, nil
+}
+
+// Gets the delivery report of a broadcast, with counts of its messages by status, failed reason, channel and contact
+// language, and how many of its contacts replied within the given number of hours, which defaults to 24. Reports of
+// recently sent broadcasts are refreshed periodically and the last of those is returned for the default number of
+// hours, otherwise the report is computed when requested. Paced broadcasts also include when their last batch is due.
+//
+//	{
+//	  "org_id": 1,
+//	  "broadcast_id": 123,
+//	  "reply_hours": 24
+//	}
+//
+//	{
+//	  "org_id": 1,
+//	  "broadcast_id": 123,
+//	  "msgs": 3,
+//	  "statuses": {"delivered": 2, "failed": 1},
+//	  "failed_reasons": {"error_limit": 1},
+//	  "channels": {"74729f45-7f29-4868-9dc4-90e491e3c7d8": 3},
+//	  "languages": {"eng": 2, "und": 1},
+//	  "contacts": 3,
+//	  "reply_hours": 24,
+//	  "replied": 1,
+//	  "reply_rate": 0.3333333333333333,
+//	  "created_on": "2022-12-01T12:00:00.000000Z",
+//	  "projected_end": "2022-12-01T12:30:00Z"
+//	}
+type reportRequest struct {
+	OrgID       models.OrgID       `json:"org_id"       validate:"required"`
+	BroadcastID models.BroadcastID `json:"broadcast_id" validate:"required"`
+	ReplyHours  int                `json:"reply_hours"  validate:"omitempty,min=1,max=720"`
+}
+
+func handleReport(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &reportRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	}
+	if request.ReplyHours == 0 {
+		request.ReplyHours = models.DefaultBroadcastReplyHours
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	var report *models.BroadcastReport
+	var err error
+
+	if request.ReplyHours == models.DefaultBroadcastReplyHours {
+		report, err = models.GetCachedBroadcastReport(rc, request.BroadcastID)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		if report != nil && report.OrgID != request.OrgID {
+			report = nil
+		}
+	}
+
+	if report == nil {
+		report, err = models.GetBroadcastReport(ctx, rt.ReadonlyDB, request.OrgID, request.BroadcastID, request.ReplyHours)
+		if err == models.ErrNotFound {
+			return errors.Errorf("no such broadcast: %d", request.BroadcastID), http.StatusNotFound, nil
+		} else if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+
+	// paced broadcasts also report when their last batch is due to be released
+	report.ProjectedEnd, err = models.GetBroadcastProjectedEnd(rc, request.BroadcastID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return report, http.StatusOK, nil
+}
@@ -0,0 +1,75 @@
+package broadcast_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreview(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	mockES := testsuite.NewMockElasticServer()
+	defer mockES.Close()
+
+	rt.ES = mockES.Client()
+
+	// org allows English and Spanish, Cathy speaks Spanish and Bob doesn't have a language
+	db.MustExec(`UPDATE orgs_org SET flow_languages = '{eng,spa}' WHERE id = $1`, testdata.Org1.ID)
+	db.MustExec(`UPDATE contacts_contact SET language = 'spa' WHERE id = $1`, testdata.Cathy.ID)
+	db.MustExec(`UPDATE contacts_contact SET language = NULL WHERE id = $1`, testdata.Bob.ID)
+	models.FlushCache()
+
+	// sample search and then the counts of contacts by language
+	mockES.AddResponse(testdata.Cathy.ID, testdata.Bob.ID)
+	mockES.AddTermsResponse("languages", map[string]int{"spa": 1})
+
+	web.RunWebTests(t, ctx, rt, "testdata/preview.json", nil)
+}
+
+func TestReport(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	bcastID := testdata.InsertBroadcast(db, testdata.Org1, "eng", map[envs.Language]string{"eng": "Hi there"}, models.NilScheduleID, nil, nil)
+
+	db.MustExec(`UPDATE contacts_contact SET language = 'eng' WHERE id = ANY(ARRAY[$1, $2, $3]::int[])`, testdata.Cathy.ID, testdata.Bob.ID, testdata.George.ID)
+
+	testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "Hi there", nil, models.MsgStatusDelivered, false)
+	testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "Hi there", nil, models.MsgStatusDelivered, false)
+	testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.George, "Hi there", nil, models.MsgStatusFailed, false)
+	db.MustExec(`UPDATE msgs_msg SET broadcast_id = $1 WHERE direction = 'O'`, bcastID)
+	db.MustExec(`UPDATE msgs_msg SET failed_reason = 'E' WHERE status = 'F'`)
+
+	// cache an older report, as would have been by the last refresh
+	err := models.CacheBroadcastReport(rc, &models.BroadcastReport{
+		OrgID:         testdata.Org1.ID,
+		BroadcastID:   bcastID,
+		Msgs:          2,
+		Statuses:      map[string]int{"delivered": 1, "failed": 1},
+		FailedReasons: map[string]int{"error_limit": 1},
+		Channels:      map[assets.ChannelUUID]int{testdata.TwilioChannel.UUID: 2},
+		Languages:     map[envs.Language]int{"eng": 2},
+		Contacts:      2,
+		ReplyHours:    24,
+		Replied:       1,
+		ReplyRate:     0.5,
+		CreatedOn:     time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC),
+	})
+	require.NoError(t, err)
+
+	web.RunWebTests(t, ctx, rt, "testdata/report.json", map[string]string{"broadcast_id": fmt.Sprint(bcastID)})
+}
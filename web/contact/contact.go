@@ -4,11 +4,16 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/mailroom/core/goflow"
 	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/core/tasks/contacts"
 	"github.com/nyaruka/mailroom/runtime"
 	"github.com/nyaruka/mailroom/web"
 
@@ -16,10 +21,24 @@ import (
 )
 
 func init() {
-	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/create", web.RequireAuthToken(handleCreate))
-	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/modify", web.RequireAuthToken(handleModify))
-	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/resolve", web.RequireAuthToken(handleResolve))
-	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/interrupt", web.RequireAuthToken(handleInterrupt))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/create", web.RequireAuthToken(handleCreate), web.WithDoc(&web.RouteDoc{
+		Summary: "Creates a new contact", Request: &createRequest{},
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/modify", web.RequireAuthToken(handleModify), web.WithDoc(&web.RouteDoc{
+		Summary: "Applies modifiers to a set of contacts", Request: &modifyRequest{}, Response: map[flows.ContactID]modifyResult{},
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/resolve", web.RequireAuthToken(handleResolve), web.WithDoc(&web.RouteDoc{
+		Summary: "Gets or creates the contact with a URN", Request: &resolveRequest{},
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/merge", web.RequireAuthToken(handleMerge), web.WithDoc(&web.RouteDoc{
+		Summary: "Merges a duplicate contact into another contact", Request: &mergeRequest{}, Response: &mergeResponse{},
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/erase", web.RequireAuthToken(handleErase), web.WithDoc(&web.RouteDoc{
+		Summary: "Queues a set of contacts to be erased", Request: &eraseRequest{}, Response: &eraseResponse{},
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/interrupt", web.RequireAuthToken(handleInterrupt), web.WithDoc(&web.RouteDoc{
+		Summary: "Interrupts the sessions of a single contact", Request: &interruptRequest{},
+	}))
 }
 
 // Request to create a new contact.
@@ -255,3 +274,123 @@ func handleInterrupt(ctx context.Context, rt *runtime.Runtime, r *http.Request)
 
 	return map[string]interface{}{"sessions": count}, http.StatusOK, nil
 }
+
+// Request that a duplicate contact is merged into another contact. The duplicate's URNs, groups, messages, runs,
+// tickets and campaign fires are moved to the contact and the duplicate is released. Precedence decides whose name,
+// language and field values are kept when both contacts have them, and defaults to the contact's.
+//
+//	{
+//	  "org_id": 1,
+//	  "user_id": 3,
+//	  "contact_id": 235,
+//	  "duplicate_id": 236,
+//	  "precedence": "contact"
+//	}
+type mergeRequest struct {
+	OrgID       models.OrgID           `json:"org_id"       validate:"required"`
+	UserID      models.UserID          `json:"user_id"      validate:"required"`
+	ContactID   models.ContactID       `json:"contact_id"   validate:"required"`
+	DuplicateID models.ContactID       `json:"duplicate_id" validate:"required,nefield=ContactID"`
+	Precedence  models.MergePrecedence `json:"precedence"   validate:"omitempty,oneof=contact duplicate"`
+}
+
+type mergeResponse struct {
+	Contact *flows.Contact `json:"contact"`
+	Events  []flows.Event  `json:"events"`
+}
+
+// handles a request to merge two contacts
+func handleMerge(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &mergeRequest{Precedence: models.MergePrecedenceContact}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, request.OrgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load org assets")
+	}
+
+	// neither contact can be handling events whilst we merge them
+	for _, contactID := range []models.ContactID{request.ContactID, request.DuplicateID} {
+		locker := models.GetContactLocker(request.OrgID, contactID)
+
+		lock, err := locker.Grab(rt.RP, time.Second*10)
+		if err != nil {
+			return nil, http.StatusInternalServerError, errors.Wrapf(err, "error acquiring lock for contact %d", contactID)
+		}
+		if lock == "" {
+			return errors.Errorf("contact %d is busy, try again later", contactID), http.StatusConflict, nil
+		}
+		defer locker.Release(rt.RP, lock)
+	}
+
+	contacts, err := models.LoadContacts(ctx, rt.DB, oa, []models.ContactID{request.ContactID, request.DuplicateID})
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load contacts")
+	}
+
+	var contact, duplicate *models.Contact
+	for _, c := range contacts {
+		if c.ID() == request.ContactID {
+			contact = c
+		} else {
+			duplicate = c
+		}
+	}
+	if contact == nil || duplicate == nil {
+		return errors.New("no such contact in this org"), http.StatusBadRequest, nil
+	}
+
+	merged, evts, err := models.MergeContacts(ctx, rt, oa, request.UserID, contact, duplicate, request.Precedence)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error merging contacts")
+	}
+
+	return &mergeResponse{Contact: merged, Events: evts}, http.StatusOK, nil
+}
+
+// Request that a set of contacts are erased. Their messages, attachments, session outputs, run results, channel and HTTP
+// logs are erased or anonymized, their sessions are interrupted and they are released. This is done by a batch task
+// which writes an audit record for each contact to session storage.
+//
+//	{
+//	  "org_id": 1,
+//	  "user_id": 3,
+//	  "contact_ids": [235, 236]
+//	}
+type eraseRequest struct {
+	OrgID      models.OrgID       `json:"org_id"      validate:"required"`
+	UserID     models.UserID      `json:"user_id"     validate:"required"`
+	ContactIDs []models.ContactID `json:"contact_ids" validate:"required,min=1"`
+}
+
+type eraseResponse struct {
+	TaskID uuids.UUID `json:"task_id"`
+}
+
+// handles a request to erase contacts
+func handleErase(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &eraseRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	// contacts which have been released can still be erased so we don't check whether they're active
+	var count int
+	if err := rt.DB.GetContext(ctx, &count, `SELECT count(*) FROM contacts_contact WHERE org_id = $1 AND id = ANY($2)`, request.OrgID, pq.Array(request.ContactIDs)); err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error checking contacts")
+	}
+	if count != len(request.ContactIDs) {
+		return errors.New("no such contact in this org"), http.StatusBadRequest, nil
+	}
+
+	task := &contacts.EraseContactsTask{UserID: request.UserID, ContactIDs: request.ContactIDs}
+	taskID, opts := web.QueueOptions(r, request.OrgID, contacts.TypeEraseContacts)
+
+	if err := rt.Queue.AddTask(queue.BatchQueue, contacts.TypeEraseContacts, int(request.OrgID), task, queue.DefaultPriority, opts...); err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error queuing erase task")
+	}
+
+	return &eraseResponse{TaskID: taskID}, http.StatusOK, nil
+}
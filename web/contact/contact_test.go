@@ -6,10 +6,14 @@ import (
 
 	_ "github.com/nyaruka/mailroom/core/handlers"
 	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/core/tasks/contacts"
 	_ "github.com/nyaruka/mailroom/services/tickets/intern"
 	"github.com/nyaruka/mailroom/testsuite"
 	"github.com/nyaruka/mailroom/testsuite/testdata"
 	"github.com/nyaruka/mailroom/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCreateContacts(t *testing.T) {
@@ -65,6 +69,30 @@ func TestResolveContacts(t *testing.T) {
 	web.RunWebTests(t, ctx, rt, "testdata/resolve.json", nil)
 }
 
+func TestMergeContacts(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	web.RunWebTests(t, ctx, rt, "testdata/merge.json", nil)
+}
+
+func TestEraseContacts(t *testing.T) {
+	ctx, rt, _, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	web.RunWebTests(t, ctx, rt, "testdata/erase.json", nil)
+
+	task, err := queue.PopNextTask(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	require.NotNil(t, task)
+	assert.Equal(t, contacts.TypeEraseContacts, task.Type)
+	assert.JSONEq(t, `{"user_id": 3, "contact_ids": [10000, 10001]}`, string(task.Task))
+}
+
 func TestInterruptContact(t *testing.T) {
 	ctx, rt, db, _ := testsuite.Get()
 
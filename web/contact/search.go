@@ -15,8 +15,12 @@ import (
 )
 
 func init() {
-	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/search", web.RequireAuthToken(handleSearch))
-	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/parse_query", web.RequireAuthToken(handleParseQuery))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/search", web.RequireAuthToken(handleSearch), web.WithDoc(&web.RouteDoc{
+		Summary: "Searches the contacts of an org", Request: &searchRequest{}, Response: &searchResponse{},
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/parse_query", web.RequireAuthToken(handleParseQuery), web.WithDoc(&web.RouteDoc{
+		Summary: "Parses a contact query", Request: &parseRequest{}, Response: &parseResponse{},
+	}))
 }
 
 // Searches the contacts for an org
@@ -0,0 +1,48 @@
+package cron
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/cron"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/cron/status", web.RequireAuthToken(handleStatus), web.WithDoc(&web.RouteDoc{
+		Summary: "Gets the status of all crons", Response: &statusResponse{},
+	}))
+}
+
+// Request for the status of all crons which have been started by any instance, ordered by name. Crons which run on
+// all instances have a status for each instance. Durations are in seconds.
+//
+//	{
+//	  "crons": [
+//	    {
+//	      "name": "run_expirations",
+//	      "schedule": "* * * * *",
+//	      "all_instances": false,
+//	      "last_start": "2018-07-06T12:30:00Z",
+//	      "last_duration": 0.25,
+//	      "last_instance": "mailroom1",
+//	      "next_fire": "2018-07-06T12:31:00Z"
+//	    }
+//	  ]
+//	}
+type statusResponse struct {
+	Crons []*cron.Status `json:"crons"`
+}
+
+func handleStatus(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	statuses, err := cron.GetStatuses(rc)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return &statusResponse{Crons: statuses}, http.StatusOK, nil
+}
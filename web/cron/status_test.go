@@ -0,0 +1,30 @@
+package cron_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatus(t *testing.T) {
+	ctx, rt, _, rp := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	// record statuses as they would be written by running crons
+	_, err := rc.Do("sadd", "crons", "run_expirations", "analytics:mailroom1", "retry_msgs")
+	require.NoError(t, err)
+	_, err = rc.Do("hset", "cron:run_expirations", "name", "run_expirations", "schedule", "* * * * *", "all_instances", 0, "last_start", "2018-07-06T12:29:00Z", "last_duration", "0.250", "last_error", "", "last_instance", "mailroom2", "next_fire", "2018-07-06T12:31:00Z")
+	require.NoError(t, err)
+	_, err = rc.Do("hset", "cron:analytics:mailroom1", "name", "analytics", "schedule", "1m0s", "all_instances", 1, "last_start", "2018-07-06T12:29:01Z", "last_duration", "1.500", "last_error", "error reporting analytics", "last_instance", "mailroom1", "next_fire", "2018-07-06T12:30:01Z")
+	require.NoError(t, err)
+	_, err = rc.Do("hset", "cron:retry_msgs", "name", "retry_msgs", "schedule", "5m0s", "all_instances", 0, "next_fire", "2018-07-06T12:30:00Z")
+	require.NoError(t, err)
+
+	web.RunWebTests(t, ctx, rt, "testdata/status.json", nil)
+}
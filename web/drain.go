@@ -0,0 +1,53 @@
+package web
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	RegisterJSONRoute(http.MethodPost, "/mr/drain", RequireAuthToken(handleDrain), WithDoc(&RouteDoc{
+		Summary: "Puts this instance into or takes it out of drain mode", Request: &drainRequest{}, Response: &drainResponse{},
+	}))
+}
+
+// Request to put this instance into or take it out of drain mode. While draining, foremen don't assign new tasks
+// to workers and /mr/health/ready reports that we're not ready. Omitting draining just returns the current
+// state and the number of in-flight tasks in each queue.
+//
+//	{
+//	  "draining": true
+//	}
+//
+//	{
+//	  "draining": true,
+//	  "in_flight": {"batch": 2, "handler": 0}
+//	}
+type drainRequest struct {
+	Draining *bool `json:"draining"`
+}
+
+type drainResponse struct {
+	Draining bool           `json:"draining"`
+	InFlight map[string]int `json:"in_flight"`
+}
+
+func handleDrain(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &drainRequest{}
+	if err := ReadAndValidateJSON(r, request); err != nil {
+		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	if request.Draining != nil {
+		if *request.Draining {
+			rt.Drainer.Drain()
+		} else {
+			rt.Drainer.Resume()
+		}
+	}
+
+	return &drainResponse{Draining: rt.Drainer.IsDraining(), InFlight: rt.Drainer.InFlight()}, http.StatusOK, nil
+}
@@ -0,0 +1,23 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrain(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	defer rt.Drainer.Resume()
+
+	rt.Drainer.TaskStarted("batch")
+	rt.Drainer.TaskStarted("batch")
+	rt.Drainer.TaskStarted("handler")
+	rt.Drainer.TaskFinished("handler")
+
+	RunWebTests(t, ctx, rt, "testdata/drain.json", nil)
+
+	assert.False(t, rt.Drainer.IsDraining())
+}
@@ -12,7 +12,9 @@ import (
 )
 
 func init() {
-	web.RegisterJSONRoute(http.MethodPost, "/mr/expression/migrate", web.RequireAuthToken(handleMigrate))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/expression/migrate", web.RequireAuthToken(handleMigrate), web.WithDoc(&web.RouteDoc{
+		Summary: "Migrates a legacy expression", Request: &migrateRequest{}, Response: &migrateResponse{},
+	}))
 }
 
 // Migrates a legacy expression to the new flow definition specification
@@ -18,10 +18,18 @@ import (
 )
 
 func init() {
-	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/migrate", web.RequireAuthToken(handleMigrate))
-	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/inspect", web.RequireAuthToken(handleInspect))
-	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/clone", web.RequireAuthToken(handleClone))
-	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/change_language", web.RequireAuthToken(handleChangeLanguage))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/migrate", web.RequireAuthToken(handleMigrate), web.WithDoc(&web.RouteDoc{
+		Summary: "Migrates a flow definition to the latest spec", Request: &migrateRequest{}, Response: json.RawMessage(nil),
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/inspect", web.RequireAuthToken(handleInspect), web.WithDoc(&web.RouteDoc{
+		Summary: "Inspects a flow definition for its results and dependencies", Request: &inspectRequest{}, Response: &flows.Inspection{},
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/clone", web.RequireAuthToken(handleClone), web.WithDoc(&web.RouteDoc{
+		Summary: "Clones a flow definition with new UUIDs", Request: &cloneRequest{}, Response: json.RawMessage(nil),
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/change_language", web.RequireAuthToken(handleChangeLanguage), web.WithDoc(&web.RouteDoc{
+		Summary: "Changes the base language of a flow definition", Request: &changeLanguageRequest{}, Response: json.RawMessage(nil),
+	}))
 }
 
 // Migrates a flow to the latest flow specification
@@ -42,13 +50,13 @@ func handleMigrate(ctx context.Context, rt *runtime.Runtime, r *http.Request) (i
 	}
 
 	// do a JSON to JSON migration of the definition
-	migrated, err := goflow.MigrateDefinition(rt.Config, request.Flow, request.ToVersion)
+	migrated, err := goflow.MigrateDefinition(rt.Config(), request.Flow, request.ToVersion)
 	if err != nil {
 		return errors.Wrapf(err, "unable to migrate flow"), http.StatusUnprocessableEntity, nil
 	}
 
 	// try to read result to check that it's valid
-	_, err = goflow.ReadFlow(rt.Config, migrated)
+	_, err = goflow.ReadFlow(rt.Config(), migrated)
 	if err != nil {
 		return errors.Wrapf(err, "unable to read migrated flow"), http.StatusUnprocessableEntity, nil
 	}
@@ -75,7 +83,7 @@ func handleInspect(ctx context.Context, rt *runtime.Runtime, r *http.Request) (i
 		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
 	}
 
-	flow, err := goflow.ReadFlow(rt.Config, request.Flow)
+	flow, err := goflow.ReadFlow(rt.Config(), request.Flow)
 	if err != nil {
 		return errors.Wrapf(err, "unable to read flow"), http.StatusUnprocessableEntity, nil
 	}
@@ -120,7 +128,7 @@ func handleClone(ctx context.Context, rt *runtime.Runtime, r *http.Request) (int
 	}
 
 	// read flow to check that cloning produced something valid
-	_, err = goflow.ReadFlow(rt.Config, cloneJSON)
+	_, err = goflow.ReadFlow(rt.Config(), cloneJSON)
 	if err != nil {
 		return errors.Wrapf(err, "unable to clone flow"), http.StatusUnprocessableEntity, nil
 	}
@@ -145,7 +153,7 @@ func handleChangeLanguage(ctx context.Context, rt *runtime.Runtime, r *http.Requ
 		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
 	}
 
-	flow, err := goflow.ReadFlow(rt.Config, request.Flow)
+	flow, err := goflow.ReadFlow(rt.Config(), request.Flow)
 	if err != nil {
 		return errors.Wrapf(err, "unable to read flow"), http.StatusUnprocessableEntity, nil
 	}
@@ -2,13 +2,19 @@ package flow
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	"time"
 
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/contactql"
+	"github.com/nyaruka/goflow/excellent/types"
 	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/events"
+	"github.com/nyaruka/goflow/flows/triggers"
 	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/runner"
 	"github.com/nyaruka/mailroom/core/search"
 	"github.com/nyaruka/mailroom/runtime"
 	"github.com/nyaruka/mailroom/web"
@@ -16,7 +22,18 @@ import (
 )
 
 func init() {
-	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/preview_start", web.RequireAuthToken(handlePreviewStart))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/preview_start", web.RequireAuthToken(handlePreviewStart), web.WithDoc(&web.RouteDoc{
+		Summary: "Previews which contacts would be started in a flow", Request: &previewStartRequest{}, Response: &previewStartResponse{},
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/start_status", web.RequireAuthToken(handleStartStatus), web.WithDoc(&web.RouteDoc{
+		Summary: "Gets the status and progress of a flow start", Request: &startStatusRequest{}, Response: &startStatusResponse{},
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/start_cancel", web.RequireAuthToken(handleStartCancel), web.WithDoc(&web.RouteDoc{
+		Summary: "Cancels the remaining batches of a flow start", Request: &startCancelRequest{}, Response: &startCancelResponse{},
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/start_contact", web.RequireAuthToken(handleStartContact), web.WithDoc(&web.RouteDoc{
+		Summary: "Starts a single contact in a flow", Request: &startContactRequest{}, Response: &startContactResponse{},
+	}))
 }
 
 // Generates a preview of which contacts will be started in the given flow.
@@ -120,3 +137,236 @@ func handlePreviewStart(ctx context.Context, rt *runtime.Runtime, r *http.Reques
 		Metadata:  inspection,
 	}, http.StatusOK, nil
 }
+
+// Gets the status of a flow start and, once it has been split into batches, its progress through them.
+//
+//	{
+//	  "org_id": 1,
+//	  "start_id": 123
+//	}
+//
+//	{
+//	  "start_id": 123,
+//	  "status": "S",
+//	  "contact_count": 1000,
+//	  "progress": {
+//	    "batches": 10,
+//	    "batches_run": 4,
+//	    "batches_skipped": 0,
+//	    "contacts": 400,
+//	    "sessions": 396,
+//	    "errors": 0,
+//	    "cancelled": false
+//	  }
+//	}
+type startStatusRequest struct {
+	OrgID   models.OrgID   `json:"org_id"   validate:"required"`
+	StartID models.StartID `json:"start_id" validate:"required"`
+}
+
+type startStatusResponse struct {
+	StartID      models.StartID        `json:"start_id"`
+	Status       models.StartStatus    `json:"status"`
+	ContactCount int                   `json:"contact_count"`
+	Progress     *models.StartProgress `json:"progress"`
+}
+
+func handleStartStatus(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &startStatusRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	status, contactCount, err := models.GetStartStatus(ctx, rt.DB, request.OrgID, request.StartID)
+	if err == models.ErrNotFound {
+		return errors.Errorf("no such start: %d", request.StartID), http.StatusNotFound, nil
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	progress, err := models.GetStartProgress(rc, request.StartID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return &startStatusResponse{StartID: request.StartID, Status: status, ContactCount: contactCount, Progress: progress}, http.StatusOK, nil
+}
+
+// Cancels a flow start. Any of its batches which haven't been run yet are skipped and the start is marked as
+// cancelled. Starts which have already completed or failed can't be cancelled.
+//
+//	{
+//	  "org_id": 1,
+//	  "start_id": 123
+//	}
+//
+//	{
+//	  "cancelled": true
+//	}
+type startCancelRequest struct {
+	OrgID   models.OrgID   `json:"org_id"   validate:"required"`
+	StartID models.StartID `json:"start_id" validate:"required"`
+}
+
+type startCancelResponse struct {
+	Cancelled bool `json:"cancelled"`
+}
+
+func handleStartCancel(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &startCancelRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	status, _, err := models.GetStartStatus(ctx, rt.DB, request.OrgID, request.StartID)
+	if err == models.ErrNotFound {
+		return errors.Errorf("no such start: %d", request.StartID), http.StatusNotFound, nil
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if status == models.StartStatusComplete || status == models.StartStatusFailed {
+		return errors.Errorf("start %d has already finished", request.StartID), http.StatusBadRequest, nil
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	if err := models.CancelStart(rc, request.StartID); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return &startCancelResponse{Cancelled: true}, http.StatusOK, nil
+}
+
+// Starts a single contact in a flow immediately rather than queuing a start, returning the status of the new session,
+// the messages it created and the results of its run. Extra is optional and, as with flow starts, is available in the
+// flow as @trigger.params.
+//
+//	{
+//	  "org_id": 1,
+//	  "user_id": 3,
+//	  "flow_id": 2,
+//	  "contact_id": 235,
+//	  "extra": {"source": "widget"}
+//	}
+//
+//	{
+//	  "session_uuid": "8a7fc501-177b-4567-a0aa-81c48e6de1c5",
+//	  "status": "waiting",
+//	  "msgs": [{"uuid": "...", "text": "What is your name?", ...}],
+//	  "results": {}
+//	}
+type startContactRequest struct {
+	OrgID     models.OrgID     `json:"org_id"     validate:"required"`
+	UserID    models.UserID    `json:"user_id"`
+	FlowID    models.FlowID    `json:"flow_id"    validate:"required"`
+	ContactID models.ContactID `json:"contact_id" validate:"required"`
+	Extra     json.RawMessage  `json:"extra,omitempty"`
+}
+
+type startContactResponse struct {
+	SessionUUID flows.SessionUUID   `json:"session_uuid"`
+	Status      flows.SessionStatus `json:"status"`
+	Msgs        []*flows.MsgOut     `json:"msgs"`
+	Results     flows.Results       `json:"results"`
+}
+
+func handleStartContact(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &startContactRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, request.OrgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load org assets")
+	}
+
+	flow, err := oa.FlowByID(request.FlowID)
+	if err == models.ErrNotFound {
+		return errors.New("no such flow in this org"), http.StatusBadRequest, nil
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load flow")
+	}
+
+	// voice flows need a call and surveyor flows are run offline
+	if flow.FlowType() != models.FlowTypeMessaging && flow.FlowType() != models.FlowTypeBackground {
+		return errors.New("can only start contacts in messaging and background flows"), http.StatusBadRequest, nil
+	}
+
+	var params *types.XObject
+	if len(request.Extra) > 0 {
+		params, err = types.ReadXObject(request.Extra)
+		if err != nil {
+			return errors.Wrapf(err, "unable to read extra"), http.StatusBadRequest, nil
+		}
+	}
+
+	// we can't wait long for the contact as the caller is waiting for us
+	locker := models.GetContactLocker(request.OrgID, request.ContactID)
+
+	lock, err := locker.Grab(rt.RP, time.Second*10)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error acquiring lock for contact %d", request.ContactID)
+	}
+	if lock == "" {
+		return errors.Errorf("contact %d is busy, try again later", request.ContactID), http.StatusConflict, nil
+	}
+	defer locker.Release(rt.RP, lock)
+
+	contact, err := models.LoadContact(ctx, rt.DB, oa, request.ContactID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load contact")
+	}
+	if contact == nil {
+		return errors.New("no such contact in this org"), http.StatusBadRequest, nil
+	}
+	if contact.Status() != models.ContactStatusActive {
+		return errors.New("contact is not active"), http.StatusBadRequest, nil
+	}
+
+	flowContact, err := contact.FlowContact(oa)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error creating flow contact")
+	}
+
+	var flowUser *flows.User
+	if user := oa.UserByID(request.UserID); user != nil {
+		flowUser = oa.SessionAssets().Users().Get(user.Email())
+	}
+
+	tb := triggers.NewBuilder(oa.Env(), flow.Reference(), flowContact).Manual()
+	if params != nil {
+		tb = tb.WithParams(params)
+	}
+	trigger := tb.WithUser(flowUser).WithOrigin("api").Build()
+
+	sessions, err := runner.StartFlowForContacts(ctx, rt, oa, flow, []*models.Contact{contact}, []flows.Trigger{trigger}, nil, flow.FlowType().Interrupts())
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error starting flow")
+	}
+	if len(sessions) == 0 {
+		return nil, http.StatusInternalServerError, errors.Errorf("unable to start contact %d in flow %d", request.ContactID, request.FlowID)
+	}
+
+	// the first run is the one in the flow we started, any others are subflows
+	session := sessions[0]
+	run := session.Runs()[0].Run()
+
+	msgs := make([]*flows.MsgOut, 0)
+	for _, e := range session.Sprint().Events() {
+		if created, ok := e.(*events.MsgCreatedEvent); ok {
+			msgs = append(msgs, created.Msg)
+		}
+	}
+
+	return &startContactResponse{
+		SessionUUID: session.UUID(),
+		Status:      run.Session().Status(),
+		Msgs:        msgs,
+		Results:     run.Results(),
+	}, http.StatusOK, nil
+}
@@ -1,11 +1,23 @@
 package flow_test
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/goflow/flows"
+	_ "github.com/nyaruka/mailroom/core/handlers"
+	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/testsuite"
 	"github.com/nyaruka/mailroom/testsuite/testdata"
 	"github.com/nyaruka/mailroom/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPreviewStart(t *testing.T) {
@@ -23,3 +35,84 @@ func TestPreviewStart(t *testing.T) {
 
 	web.RunWebTests(t, ctx, rt, "testdata/preview_start.json", nil)
 }
+
+func TestStartStatus(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	startID := testdata.InsertFlowStart(db, testdata.Org1, testdata.Favorites, []*testdata.Contact{testdata.Cathy, testdata.Bob})
+	startedID := testdata.InsertFlowStart(db, testdata.Org1, testdata.Favorites, []*testdata.Contact{testdata.Cathy, testdata.Bob})
+	db.MustExec(`UPDATE flows_flowstart SET status = 'S' WHERE id = $1`, startedID)
+
+	require.NoError(t, models.RecordStartBatches(rc, startedID, 2))
+	require.NoError(t, models.RecordStartBatchRun(rc, startedID, 100, 98, false))
+
+	web.RunWebTests(t, ctx, rt, "testdata/start_status.json", map[string]string{
+		"start_id":   fmt.Sprint(startID),
+		"started_id": fmt.Sprint(startedID),
+	})
+}
+
+func TestStartCancel(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	startID := testdata.InsertFlowStart(db, testdata.Org1, testdata.Favorites, []*testdata.Contact{testdata.Cathy, testdata.Bob})
+	completeID := testdata.InsertFlowStart(db, testdata.Org1, testdata.Favorites, []*testdata.Contact{testdata.Cathy, testdata.Bob})
+	db.MustExec(`UPDATE flows_flowstart SET status = 'C' WHERE id = $1`, completeID)
+
+	web.RunWebTests(t, ctx, rt, "testdata/start_cancel.json", map[string]string{
+		"start_id":    fmt.Sprint(startID),
+		"complete_id": fmt.Sprint(completeID),
+	})
+
+	cancelled, err := models.IsStartCancelled(rc, startID)
+	require.NoError(t, err)
+	assert.True(t, cancelled)
+}
+
+func TestStartContact(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	web.RunWebTests(t, ctx, rt, "testdata/start_contact.json", nil)
+
+	// check a successful start separately as its response has generated UUIDs
+	server := web.NewServer(ctx, rt, &sync.WaitGroup{})
+	server.Start()
+	defer server.Stop()
+
+	// give our server time to start
+	time.Sleep(time.Second)
+
+	body := fmt.Sprintf(`{"org_id": 1, "user_id": %d, "flow_id": %d, "contact_id": %d, "extra": {"source": "widget"}}`, testdata.Admin.ID, testdata.Favorites.ID, testdata.Cathy.ID)
+	resp, err := http.Post("http://localhost:8090/mr/flow/start_contact", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	started := &struct {
+		SessionUUID flows.SessionUUID   `json:"session_uuid"`
+		Status      flows.SessionStatus `json:"status"`
+		Msgs        []struct {
+			Text string `json:"text"`
+		} `json:"msgs"`
+		Results map[string]interface{} `json:"results"`
+	}{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(started))
+
+	assert.Equal(t, flows.SessionStatusWaiting, started.Status)
+	assert.Len(t, started.Msgs, 1)
+	assert.Equal(t, "What is your favorite color?", started.Msgs[0].Text)
+	assert.Len(t, started.Results, 0)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM flows_flowsession WHERE uuid = $1 AND contact_id = $2 AND status = 'W'`, started.SessionUUID, testdata.Cathy.ID).Returns(1)
+	assertdb.Query(t, db, `SELECT count(*) FROM flows_flowsession WHERE uuid = $1 AND output LIKE '%"params":{"source":"widget"}%'`, started.SessionUUID).Returns(1)
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE contact_id = $1 AND direction = 'O' AND text = 'What is your favorite color?'`, testdata.Cathy.ID).Returns(1)
+}
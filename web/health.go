@@ -0,0 +1,221 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/goflow/utils/smtpx"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+)
+
+// how long we give each component to respond before considering it down
+const healthCheckTimeout = 5 * time.Second
+
+// how long we reuse the results of checks which are too slow or expensive to make on every probe
+const slowHealthCheckCacheFor = 30 * time.Second
+
+// a dependency that we check when asked whether we're ready, if it's required then we're not ready without it. If
+// cacheFor is set, its result is reused for that long rather than checking it on every request.
+type healthCheck struct {
+	name     string
+	required bool
+	cacheFor time.Duration
+	check    func(context.Context, *runtime.Runtime) error
+}
+
+var healthChecks = []*healthCheck{
+	{"db", true, 0, checkDB},
+	{"readonly_db", true, 0, checkReadonlyDB},
+	{"redis", true, 0, checkRedis},
+	{"elastic", false, slowHealthCheckCacheFor, checkElastic},
+	{"session_storage", false, slowHealthCheckCacheFor, checkSessionStorage},
+	{"smtp", false, 0, checkSMTP},
+}
+
+// the last results of checks which are cached, by check name
+var healthCache = make(map[string]*cachedStatus)
+var healthCacheMutex sync.Mutex
+
+type cachedStatus struct {
+	status    *componentStatus
+	checkedOn time.Time
+}
+
+type componentStatus struct {
+	OK       bool    `json:"ok"`
+	Required bool    `json:"required"`
+	Error    string  `json:"error,omitempty"`
+	Elapsed  float64 `json:"elapsed"`
+	Cached   bool    `json:"cached,omitempty"`
+}
+
+type readyResponse struct {
+	Ready      bool                        `json:"ready"`
+	Draining   bool                        `json:"draining"`
+	Components map[string]*componentStatus `json:"components"`
+}
+
+// liveness check for process supervisors, which only fails if we can't serve requests at all
+//
+//	{
+//	  "live": true,
+//	  "version": "7.5.1"
+//	}
+func handleHealthLive(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	return map[string]interface{}{"live": true, "version": rt.Config().Version}, http.StatusOK, nil
+}
+
+// readiness check for load balancers which checks each of our dependencies, failing if we're draining or any required
+// dependency is unavailable. Checks of optional dependencies which are slower, e.g. elastic cluster health and session
+// storage, are cached for a short time so only required dependencies are hit on every probe.
+//
+//	{
+//	  "ready": false,
+//	  "draining": false,
+//	  "components": {
+//	    "db": {"ok": true, "required": true, "elapsed": 0.002},
+//	    "redis": {"ok": false, "required": true, "error": "dial tcp: connection refused", "elapsed": 0.001},
+//	    "elastic": {"ok": true, "required": false, "elapsed": 0.015, "cached": true},
+//	    ...
+//	  }
+//	}
+func handleHealthReady(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	response := &readyResponse{
+		Ready:      !rt.Drainer.IsDraining(),
+		Draining:   rt.Drainer.IsDraining(),
+		Components: checkHealth(ctx, rt, healthChecks),
+	}
+
+	for _, hc := range healthChecks {
+		if hc.required && !response.Components[hc.name].OK {
+			response.Ready = false
+		}
+	}
+
+	status := http.StatusOK
+	if !response.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	return response, status, nil
+}
+
+// runs the passed in checks concurrently, each with its own timeout, using cached results where they're still fresh
+func checkHealth(ctx context.Context, rt *runtime.Runtime, checks []*healthCheck) map[string]*componentStatus {
+	statuses := make(map[string]*componentStatus, len(checks))
+	mutex := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+
+	for _, hc := range checks {
+		wg.Add(1)
+
+		go func(hc *healthCheck) {
+			defer wg.Done()
+
+			status := runHealthCheck(ctx, rt, hc)
+
+			mutex.Lock()
+			statuses[hc.name] = status
+			mutex.Unlock()
+		}(hc)
+	}
+
+	wg.Wait()
+	return statuses
+}
+
+// runs a single check, or returns its cached result if it's cacheable and was checked recently enough
+func runHealthCheck(ctx context.Context, rt *runtime.Runtime, hc *healthCheck) *componentStatus {
+	if hc.cacheFor > 0 {
+		healthCacheMutex.Lock()
+		cached := healthCache[hc.name]
+		healthCacheMutex.Unlock()
+
+		if cached != nil && time.Since(cached.checkedOn) < hc.cacheFor {
+			status := *cached.status
+			status.Cached = true
+			return &status
+		}
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := hc.check(checkCtx, rt)
+	status := &componentStatus{OK: err == nil, Required: hc.required, Elapsed: time.Since(start).Seconds()}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	if hc.cacheFor > 0 {
+		healthCacheMutex.Lock()
+		healthCache[hc.name] = &cachedStatus{status: status, checkedOn: start}
+		healthCacheMutex.Unlock()
+	}
+
+	return status
+}
+
+func checkDB(ctx context.Context, rt *runtime.Runtime) error {
+	if rt.DB == nil {
+		return errors.New("not connected")
+	}
+	return rt.DB.PingContext(ctx)
+}
+
+func checkReadonlyDB(ctx context.Context, rt *runtime.Runtime) error {
+	if rt.ReadonlyDB == nil {
+		return errors.New("not connected")
+	}
+	return rt.ReadonlyDB.PingContext(ctx)
+}
+
+func checkRedis(ctx context.Context, rt *runtime.Runtime) error {
+	if rt.RP == nil {
+		return errors.New("not connected")
+	}
+
+	rc, err := rt.RP.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	_, err = redis.DoContext(rc, ctx, "PING")
+	return err
+}
+
+func checkElastic(ctx context.Context, rt *runtime.Runtime) error {
+	if rt.ES == nil {
+		return errors.New("not connected")
+	}
+
+	health, err := rt.ES.ClusterHealth().Do(ctx)
+	if err != nil {
+		return err
+	}
+	if health.Status == "red" {
+		return errors.Errorf("cluster status is %s", health.Status)
+	}
+	return nil
+}
+
+func checkSessionStorage(ctx context.Context, rt *runtime.Runtime) error {
+	if rt.SessionStorage == nil {
+		return errors.New("not configured")
+	}
+	return rt.SessionStorage.Test(ctx)
+}
+
+// we don't want to send an email just to check health, so we only check that the configuration is valid
+func checkSMTP(ctx context.Context, rt *runtime.Runtime) error {
+	if rt.Config().SMTPServer == "" {
+		return errors.New("not configured")
+	}
+	_, err := smtpx.NewClientFromURL(rt.Config().SMTPServer)
+	return err
+}
@@ -0,0 +1,85 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealth(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	r, _ := http.NewRequest(http.MethodGet, "/mr/health/live", nil)
+	resp, status, err := handleHealthLive(ctx, rt, r)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, true, resp.(map[string]interface{})["live"])
+
+	r, _ = http.NewRequest(http.MethodGet, "/mr/health/ready", nil)
+	resp, status, err = handleHealthReady(ctx, rt, r)
+	require.NoError(t, err)
+
+	ready := resp.(*readyResponse)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, ready.Ready)
+	assert.False(t, ready.Draining)
+	assert.Len(t, ready.Components, len(healthChecks))
+	assert.True(t, ready.Components["db"].OK)
+	assert.True(t, ready.Components["readonly_db"].OK)
+	assert.True(t, ready.Components["redis"].OK)
+
+	// smtp isn't configured in tests but isn't required so doesn't affect readiness
+	assert.False(t, ready.Components["smtp"].OK)
+	assert.Equal(t, "not configured", ready.Components["smtp"].Error)
+
+	// not ready whilst draining
+	rt.Drainer.Drain()
+	resp, status, err = handleHealthReady(ctx, rt, r)
+	rt.Drainer.Resume()
+
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.False(t, resp.(*readyResponse).Ready)
+	assert.True(t, resp.(*readyResponse).Draining)
+
+	// checks which fail or take too long are reported as errors
+	statuses := checkHealth(ctx, rt, []*healthCheck{
+		{"good", true, 0, func(context.Context, *runtime.Runtime) error { return nil }},
+		{"bad", true, 0, func(context.Context, *runtime.Runtime) error { return errors.New("boom") }},
+		{"slow", false, 0, func(ctx context.Context, rt *runtime.Runtime) error { <-ctx.Done(); return ctx.Err() }},
+	})
+
+	assert.True(t, statuses["good"].OK)
+	assert.False(t, statuses["bad"].OK)
+	assert.Equal(t, "boom", statuses["bad"].Error)
+	assert.False(t, statuses["slow"].OK)
+	assert.Equal(t, "context deadline exceeded", statuses["slow"].Error)
+	assert.False(t, statuses["slow"].Required)
+
+	// checks with a cache time are only made again once their cached result is stale
+	calls := 0
+	cached := &healthCheck{"cached", false, time.Minute, func(context.Context, *runtime.Runtime) error { calls++; return errors.New("boom") }}
+
+	statuses = checkHealth(ctx, rt, []*healthCheck{cached})
+	assert.False(t, statuses["cached"].OK)
+	assert.False(t, statuses["cached"].Cached)
+
+	statuses = checkHealth(ctx, rt, []*healthCheck{cached})
+	assert.False(t, statuses["cached"].OK)
+	assert.Equal(t, "boom", statuses["cached"].Error)
+	assert.True(t, statuses["cached"].Cached)
+	assert.Equal(t, 1, calls)
+
+	healthCache["cached"].checkedOn = time.Now().Add(-2 * time.Minute)
+
+	statuses = checkHealth(ctx, rt, []*healthCheck{cached})
+	assert.False(t, statuses["cached"].Cached)
+	assert.Equal(t, 2, calls)
+}
@@ -0,0 +1,19 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+)
+
+// IdempotencyKeyHeader is the header callers can use to make requests which queue tasks safe to repeat
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// QueueOptions returns the task ID and options to use when queueing a task of the given type for the given org in
+// response to the passed in request. If the request has an idempotency key then this will be used to dedupe the task,
+// and the task ID is derived from it so that repeat requests get the same task ID.
+func QueueOptions(r *http.Request, orgID models.OrgID, taskType string) (uuids.UUID, []queue.TaskOption) {
+	return queue.IdempotencyOptions(taskType, int(orgID), r.Header.Get(IdempotencyKeyHeader))
+}
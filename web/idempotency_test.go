@@ -0,0 +1,36 @@
+package web_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueOptions(t *testing.T) {
+	// without an idempotency key, each request gets a new task ID
+	r1, err := http.NewRequest("POST", "http://temba.io", nil)
+	require.NoError(t, err)
+
+	taskID1, opts := web.QueueOptions(r1, 1, "erase_contacts")
+	assert.Len(t, opts, 1)
+	taskID2, _ := web.QueueOptions(r1, 1, "erase_contacts")
+	assert.NotEqual(t, taskID1, taskID2)
+
+	// with one, repeat requests get the same task ID and the task is deduped
+	r2, err := http.NewRequest("POST", "http://temba.io", nil)
+	require.NoError(t, err)
+	r2.Header.Set(web.IdempotencyKeyHeader, "erase-123")
+
+	taskID1, opts = web.QueueOptions(r2, 1, "erase_contacts")
+	assert.Len(t, opts, 2)
+	taskID2, _ = web.QueueOptions(r2, 1, "erase_contacts")
+	assert.Equal(t, taskID1, taskID2)
+
+	// but not for other orgs
+	taskID2, _ = web.QueueOptions(r2, 2, "erase_contacts")
+	assert.NotEqual(t, taskID1, taskID2)
+}
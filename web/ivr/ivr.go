@@ -147,7 +147,7 @@ func handleIncoming(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAsse
 		}
 
 		// build our resume URL
-		resumeURL := buildResumeURL(rt.Config, ch, call, urn)
+		resumeURL := buildResumeURL(rt.Config(), ch, call, urn)
 
 		// have our client output our session status
 		err = svc.WriteSessionResponse(ctx, rt, ch, call, session, urn, resumeURL, r, w)
@@ -238,7 +238,7 @@ func handleCallback(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAsse
 		return conn, svc.WriteErrorResponse(w, errors.Errorf("unable to find URN: %s on contact: %d", urn, conn.ContactID()))
 	}
 
-	resumeURL := buildResumeURL(rt.Config, ch, conn, urn)
+	resumeURL := buildResumeURL(rt.Config(), ch, conn, urn)
 
 	// if this a start, start our contact
 	switch request.Action {
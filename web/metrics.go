@@ -0,0 +1,118 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/metrics"
+	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+func init() {
+	RegisterRoute(http.MethodGet, "/mr/metrics", handleMetrics)
+}
+
+// handleMetrics exposes the metrics of this instance in the prometheus text format. These are the metrics recorded
+// as we handle tasks, run crons, call webhooks and run sprints, plus cheap queue counts and pool stats which are read
+// at scrape time. Queue depths are only labelled by queue here since a label per org would grow without bound - per-org
+// depths are exported by each org's /mr/org/{uuid}/metrics endpoint and detailed by /mr/queue/inspect. If we have an
+// auth token, scrapers must send it in the same way as other requests.
+func handleMetrics(ctx context.Context, rt *runtime.Runtime, r *http.Request, w http.ResponseWriter) error {
+	if rt.Config().AuthToken != "" && fmt.Sprintf("Token %s", rt.Config().AuthToken) != r.Header.Get("authorization") {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": "invalid or missing authorization header, denying"}`))
+		return nil
+	}
+
+	families := metrics.Gather()
+
+	queues, err := collectQueueMetrics(rt)
+	if err != nil {
+		return errors.Wrapf(err, "error collecting queue metrics")
+	}
+	families = append(families, queues...)
+	families = append(families, collectPoolMetrics(rt)...)
+
+	w.Header().Set("Content-Type", string(expfmt.FmtText))
+	w.WriteHeader(http.StatusOK)
+
+	return metrics.Write(w, families)
+}
+
+// collects the depth and other counts for each queue, and the tasks being handled by this instance
+func collectQueueMetrics(rt *runtime.Runtime) ([]*dto.MetricFamily, error) {
+	depth := metrics.NewGaugeSnapshot("mailroom_queue_depth", "the number of queued tasks which are due by queue", "queue")
+	activeOrgs := metrics.NewGaugeSnapshot("mailroom_queue_active_orgs", "the number of orgs with queued tasks or workers by queue", "queue")
+	delayed := metrics.NewGaugeSnapshot("mailroom_queue_delayed", "the number of tasks which aren't yet due by queue", "queue")
+	inFlight := metrics.NewGaugeSnapshot("mailroom_tasks_in_flight", "the number of tasks being handled by this instance by queue", "queue")
+
+	for _, q := range []string{queue.BatchQueue, queue.HandlerQueue} {
+		size, err := rt.Queue.Size(q)
+		if err != nil {
+			return nil, err
+		}
+		depth.Set(float64(size), q)
+
+		orgs, err := rt.Queue.ActiveOrgs(q)
+		if err != nil {
+			return nil, err
+		}
+		activeOrgs.Set(float64(orgs), q)
+
+		size, err = rt.Queue.DelayedSize(q)
+		if err != nil {
+			return nil, err
+		}
+		delayed.Set(float64(size), q)
+	}
+
+	for q, count := range rt.Drainer.InFlight() {
+		inFlight.Set(float64(count), q)
+	}
+
+	return []*dto.MetricFamily{depth.MetricFamily, activeOrgs.MetricFamily, delayed.MetricFamily, inFlight.MetricFamily}, nil
+}
+
+// collects the stats of our database and redis connection pools
+func collectPoolMetrics(rt *runtime.Runtime) []*dto.MetricFamily {
+	dbConns := metrics.NewGaugeSnapshot("mailroom_db_connections", "the number of database connections by state", "db", "state")
+	dbWaits := metrics.NewCounterSnapshot("mailroom_db_waits_total", "the number of times we waited for a database connection", "db")
+	dbWaitTime := metrics.NewCounterSnapshot("mailroom_db_wait_seconds_total", "the total time spent waiting for database connections", "db")
+
+	dbs := []struct {
+		name string
+		db   *sqlx.DB
+	}{{"primary", rt.DB}, {"readonly", rt.ReadonlyDB}}
+
+	for _, d := range dbs {
+		if d.db == nil {
+			continue
+		}
+		stats := d.db.Stats()
+		dbConns.Set(float64(stats.InUse), d.name, "in_use")
+		dbConns.Set(float64(stats.Idle), d.name, "idle")
+		dbWaits.Set(float64(stats.WaitCount), d.name)
+		dbWaitTime.Set(stats.WaitDuration.Seconds(), d.name)
+	}
+
+	redisConns := metrics.NewGaugeSnapshot("mailroom_redis_connections", "the number of redis connections by state", "state")
+	redisWaits := metrics.NewCounterSnapshot("mailroom_redis_waits_total", "the number of times we waited for a redis connection")
+	redisWaitTime := metrics.NewCounterSnapshot("mailroom_redis_wait_seconds_total", "the total time spent waiting for redis connections")
+
+	stats := rt.RP.Stats()
+	redisConns.Set(float64(stats.ActiveCount-stats.IdleCount), "in_use")
+	redisConns.Set(float64(stats.IdleCount), "idle")
+	redisWaits.Set(float64(stats.WaitCount))
+	redisWaitTime.Set(stats.WaitDuration.Seconds())
+
+	return []*dto.MetricFamily{
+		dbConns.MetricFamily, dbWaits.MetricFamily, dbWaitTime.MetricFamily,
+		redisConns.MetricFamily, redisWaits.MetricFamily, redisWaitTime.MetricFamily,
+	}
+}
@@ -0,0 +1,54 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	require.NoError(t, rt.Queue.AddTask(queue.BatchQueue, queue.StartFlow, int(testdata.Org1.ID), "task1", queue.DefaultPriority))
+	require.NoError(t, rt.Queue.AddTask(queue.BatchQueue, queue.StartFlow, int(testdata.Org1.ID), "task2", queue.DefaultPriority))
+
+	rt.Drainer.TaskStarted("handler")
+	defer rt.Drainer.TaskFinished("handler")
+
+	// no auth token configured
+	r, _ := http.NewRequest(http.MethodGet, "/mr/metrics", nil)
+	w := httptest.NewRecorder()
+	require.NoError(t, handleMetrics(ctx, rt, r, w))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `mailroom_queue_depth{queue="batch"} 2`)
+	assert.Contains(t, w.Body.String(), `mailroom_queue_depth{queue="handler"} 0`)
+	assert.Contains(t, w.Body.String(), `mailroom_queue_active_orgs{queue="batch"} 1`)
+	assert.Contains(t, w.Body.String(), `mailroom_queue_delayed{queue="handler"} 0`)
+	assert.NotContains(t, w.Body.String(), `org_id`)
+	assert.Contains(t, w.Body.String(), `mailroom_tasks_in_flight{queue="handler"} 1`)
+	assert.Contains(t, w.Body.String(), `mailroom_db_connections{db="primary",state="idle"}`)
+	assert.Contains(t, w.Body.String(), `mailroom_redis_connections{state="idle"}`)
+
+	// auth token configured but not provided
+	rt.Config().AuthToken = "sesame"
+	defer func() { rt.Config().AuthToken = "" }()
+
+	w = httptest.NewRecorder()
+	require.NoError(t, handleMetrics(ctx, rt, r, w))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// and provided
+	r.Header.Set("Authorization", "Token sesame")
+	w = httptest.NewRecorder()
+	require.NoError(t, handleMetrics(ctx, rt, r, w))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -14,7 +14,9 @@ import (
 )
 
 func init() {
-	web.RegisterJSONRoute(http.MethodPost, "/mr/msg/resend", web.RequireAuthToken(handleResend))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/msg/resend", web.RequireAuthToken(handleResend), web.WithDoc(&web.RouteDoc{
+		Summary: "Resends failed messages", Request: &resendRequest{},
+	}))
 }
 
 // Request to resend failed messages.
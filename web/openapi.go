@@ -0,0 +1,387 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/mailroom/runtime"
+)
+
+// RouteDoc describes a JSON route for our OpenAPI specification, and is added to a route with WithDoc. Request and
+// response should be values of the types the handler reads and writes, e.g. &resendRequest{}, from which schemas
+// are generated using their json and validate tags. Either can be nil if the route doesn't read a body or its
+// response isn't described by a type. Deprecated routes are still described but marked as such.
+type RouteDoc struct {
+	Summary    string
+	Request    interface{}
+	Response   interface{}
+	Deprecated bool
+}
+
+// the subset of OpenAPI 3 that we generate
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+	Security   []map[string][]string                   `json:"security"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Summary     string                      `json:"summary,omitempty"`
+	Deprecated  bool                        `json:"deprecated,omitempty"`
+	RequestBody *openAPIBody                `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIBody struct {
+	Required bool                         `json:"required"`
+	Content  map[string]*openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPIComponents struct {
+	Schemas         map[string]*openAPISchema         `json:"schemas"`
+	SecuritySchemes map[string]*openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPISecurityScheme struct {
+	Type        string `json:"type"`
+	In          string `json:"in"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	AllOf                []*openAPISchema          `json:"allOf,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}             `json:"enum,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	Maximum              *float64                  `json:"maximum,omitempty"`
+	MinLength            *int                      `json:"minLength,omitempty"`
+	MaxLength            *int                      `json:"maxLength,omitempty"`
+	MinItems             *int                      `json:"minItems,omitempty"`
+	MaxItems             *int                      `json:"maxItems,omitempty"`
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+)
+
+// serves the OpenAPI specification of our registered JSON routes, other than those registered with WithoutDoc which
+// are currently the zendesk, rocketchat and mailgun ticketer callbacks
+func handleOpenAPI(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	return newOpenAPIDocument(rt.Config().Version, jsonRoutes), http.StatusOK, nil
+}
+
+// generates an OpenAPI document for the passed in routes
+func newOpenAPIDocument(version string, routes []*jsonRoute) *openAPIDocument {
+	g := &schemaGenerator{schemas: make(map[string]*openAPISchema), names: make(map[reflect.Type]string)}
+	errorSchema := g.schemaFor(reflect.TypeOf(ErrorResponse{}))
+
+	doc := &openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: "Mailroom", Version: version},
+		Paths:   make(map[string]map[string]*openAPIOperation),
+		Components: openAPIComponents{
+			Schemas: g.schemas,
+			SecuritySchemes: map[string]*openAPISecurityScheme{
+				"token": {Type: "apiKey", In: "header", Name: "Authorization", Description: "Token <auth token>"},
+			},
+		},
+		Security: []map[string][]string{{"token": {}}},
+	}
+
+	for _, route := range routes {
+		if route.hidden {
+			continue
+		}
+
+		op := &openAPIOperation{
+			OperationID: operationID(route.pattern),
+			Responses: map[string]*openAPIResponse{
+				"400": {Description: "invalid request", Content: jsonContent(errorSchema)},
+				"401": {Description: "missing or invalid authorization", Content: jsonContent(errorSchema)},
+				"500": {Description: "server error", Content: jsonContent(errorSchema)},
+			},
+		}
+
+		success := &openAPIResponse{Description: "success", Content: jsonContent(&openAPISchema{Type: "object"})}
+
+		if route.doc != nil {
+			op.Summary = route.doc.Summary
+			op.Deprecated = route.doc.Deprecated
+
+			if route.doc.Request != nil {
+				op.RequestBody = &openAPIBody{Required: true, Content: jsonContent(g.schemaFor(reflect.TypeOf(route.doc.Request)))}
+			}
+			if route.doc.Response != nil {
+				success.Content = jsonContent(g.schemaFor(reflect.TypeOf(route.doc.Response)))
+			}
+		}
+		op.Responses["200"] = success
+
+		if doc.Paths[route.pattern] == nil {
+			doc.Paths[route.pattern] = make(map[string]*openAPIOperation)
+		}
+		doc.Paths[route.pattern][strings.ToLower(route.method)] = op
+	}
+
+	return doc
+}
+
+func jsonContent(s *openAPISchema) map[string]*openAPIMediaType {
+	return map[string]*openAPIMediaType{"application/json": {Schema: s}}
+}
+
+// derives an operation id from a route pattern, e.g. /mr/flow/start -> flow_start
+func operationID(pattern string) string {
+	return strings.ReplaceAll(strings.Trim(strings.TrimPrefix(pattern, "/mr/"), "/"), "/", "_")
+}
+
+// generates schemas for Go types, adding named struct types to our components so they're only described once
+type schemaGenerator struct {
+	schemas map[string]*openAPISchema
+	names   map[reflect.Type]string
+}
+
+func (g *schemaGenerator) schemaFor(t reflect.Type) *openAPISchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &openAPISchema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 && t.Implements(jsonMarshalerType):
+		return &openAPISchema{} // e.g. json.RawMessage which can be any JSON
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &openAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &openAPISchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &openAPISchema{Type: "number"}
+	case reflect.String:
+		return &openAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &openAPISchema{Type: "string", Format: "byte"}
+		}
+		return &openAPISchema{Type: "array", Items: g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &openAPISchema{Type: "object", AdditionalProperties: g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		return g.structSchema(t)
+	default:
+		return &openAPISchema{} // interfaces etc which can be any JSON
+	}
+}
+
+// returns a reference to the schema for a named struct, or the schema itself for an anonymous struct
+func (g *schemaGenerator) structSchema(t reflect.Type) *openAPISchema {
+	if t.Name() == "" {
+		return g.objectSchema(t)
+	}
+
+	name, seen := g.names[t]
+	if !seen {
+		name = path.Base(t.PkgPath()) + "." + t.Name()
+		g.names[t] = name // recorded first in case this type references itself
+		g.schemas[name] = g.objectSchema(t)
+	}
+
+	return &openAPISchema{Ref: "#/components/schemas/" + name}
+}
+
+func (g *schemaGenerator) objectSchema(t reflect.Type) *openAPISchema {
+	// types with custom marshaling can't be described by their fields, except for our models which marshal a single
+	// unexported struct field, e.g. FlowStart.s
+	if reflect.PointerTo(t).Implements(jsonMarshalerType) {
+		if t.NumField() == 1 && !t.Field(0).IsExported() && t.Field(0).Type.Kind() == reflect.Struct {
+			return g.objectSchema(t.Field(0).Type)
+		}
+		return &openAPISchema{Type: marshaledType(t)}
+	}
+
+	s := &openAPISchema{Type: "object", Properties: make(map[string]*openAPISchema)}
+	g.addProperties(s, t)
+	return s
+}
+
+func (g *schemaGenerator) addProperties(s *openAPISchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+
+		// embedded structs without names have their fields promoted
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addProperties(s, ft)
+				continue
+			}
+		}
+
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := g.schemaFor(f.Type)
+		if applyValidateTag(prop, f.Tag.Get("validate")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = prop
+	}
+}
+
+// applies the constraints in a validate tag to the passed in schema, returning whether the field is required
+func applyValidateTag(s *openAPISchema, tag string) bool {
+	if tag == "" {
+		return false
+	}
+
+	// OpenAPI 3.0 ignores anything alongside a reference so if there are constraints, wrap the reference with allOf
+	if s.Ref != "" {
+		c := &openAPISchema{}
+		required := applyValidateTag(c, tag)
+		if !reflect.DeepEqual(c, &openAPISchema{}) {
+			c.AllOf = []*openAPISchema{{Ref: s.Ref}}
+			*s = *c
+		}
+		return required
+	}
+
+	required := false
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+
+		switch name {
+		case "dive":
+			return required // remaining rules apply to elements
+		case "required":
+			required = true
+		case "oneof":
+			s.Enum = enumValues(s.Type, strings.Fields(param))
+		case "min", "max":
+			n, err := strconv.Atoi(param)
+			if err != nil {
+				continue
+			}
+			f := float64(n)
+
+			switch s.Type {
+			case "string":
+				if name == "min" {
+					s.MinLength = &n
+				} else {
+					s.MaxLength = &n
+				}
+			case "array":
+				if name == "min" {
+					s.MinItems = &n
+				} else {
+					s.MaxItems = &n
+				}
+			case "integer", "number":
+				if name == "min" {
+					s.Minimum = &f
+				} else {
+					s.Maximum = &f
+				}
+			}
+		case "uuid", "uuid4":
+			s.Format = "uuid"
+		case "email":
+			s.Format = "email"
+		case "url", "http_url":
+			s.Format = "uri"
+		}
+	}
+
+	return required
+}
+
+// converts the values of a oneof rule to the type of the schema they're for, e.g. numbers for an integer field
+func enumValues(typ string, params []string) []interface{} {
+	values := make([]interface{}, len(params))
+	for i, p := range params {
+		values[i] = p
+
+		switch typ {
+		case "integer":
+			if n, err := strconv.ParseInt(p, 10, 64); err == nil {
+				values[i] = n
+			}
+		case "number":
+			if n, err := strconv.ParseFloat(p, 64); err == nil {
+				values[i] = n
+			}
+		}
+	}
+	return values
+}
+
+// determines the JSON type of a struct with custom marshaling by marshaling its zero value, e.g. a semver.Version is
+// marshaled as a string. Types which can't marshal their zero value are assumed to be objects.
+func marshaledType(t reflect.Type) (typ string) {
+	defer func() {
+		if r := recover(); r != nil {
+			typ = "object"
+		}
+	}()
+
+	marshaled, err := reflect.New(t).Interface().(json.Marshaler).MarshalJSON()
+	if err != nil || len(marshaled) == 0 {
+		return "object"
+	}
+
+	switch marshaled[0] {
+	case '"':
+		return "string"
+	case '[':
+		return "array"
+	case 't', 'f':
+		return "boolean"
+	case '-', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return "number"
+	default:
+		return "object"
+	}
+}
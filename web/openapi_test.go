@@ -0,0 +1,108 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testThing struct {
+	Name string `json:"name"`
+}
+
+type testRequest struct {
+	OrgID    int          `json:"org_id"    validate:"required"`
+	Channel  string       `json:"channel"   validate:"required,oneof=sms voice"`
+	Priority int          `json:"priority"  validate:"oneof=0 1 2"`
+	Weight   float64      `json:"weight"    validate:"oneof=0.5 1"`
+	Text     string       `json:"text"      validate:"max=640"`
+	URNs     []string     `json:"urns"      validate:"min=1,dive,max=255"`
+	Thing    *testThing   `json:"thing"     validate:"required"`
+	Other    testThing    `json:"other"     validate:"required,email"`
+	Things   []*testThing `json:"things"`
+	internal int
+	Skipped  string `json:"-"`
+}
+
+type testResponse struct {
+	CreatedOn time.Time       `json:"created_on"`
+	Counts    map[string]int  `json:"counts"`
+	Extra     json.RawMessage `json:"extra,omitempty"`
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	routes := []*jsonRoute{
+		{method: http.MethodPost, pattern: "/mr/test/create", doc: &RouteDoc{Summary: "Creates a thing", Request: &testRequest{}, Response: &testResponse{}}},
+		{method: http.MethodPost, pattern: "/mr/test/other"},
+		{method: http.MethodPost, pattern: "/mr/test/old", doc: &RouteDoc{Summary: "Creates a thing the old way", Deprecated: true}},
+		{method: http.MethodPost, pattern: "/mr/test/callback", hidden: true},
+	}
+
+	doc := newOpenAPIDocument("1.2.3", routes)
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+	assert.Equal(t, "1.2.3", doc.Info.Version)
+
+	create := doc.Paths["/mr/test/create"]["post"]
+	require.NotNil(t, create)
+	assert.Equal(t, "test_create", create.OperationID)
+	assert.Equal(t, "Creates a thing", create.Summary)
+	assert.Equal(t, "#/components/schemas/web.testRequest", create.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Equal(t, "#/components/schemas/web.testResponse", create.Responses["200"].Content["application/json"].Schema.Ref)
+	assert.Equal(t, "#/components/schemas/web.ErrorResponse", create.Responses["400"].Content["application/json"].Schema.Ref)
+
+	req := doc.Components.Schemas["web.testRequest"]
+	require.NotNil(t, req)
+	assert.Equal(t, []string{"org_id", "channel", "thing", "other"}, req.Required)
+	assert.Equal(t, []interface{}{"sms", "voice"}, req.Properties["channel"].Enum)
+	assert.Equal(t, []interface{}{int64(0), int64(1), int64(2)}, req.Properties["priority"].Enum)
+	assert.Equal(t, []interface{}{0.5, 1.0}, req.Properties["weight"].Enum)
+	assert.Equal(t, 640, *req.Properties["text"].MaxLength)
+	assert.Equal(t, 1, *req.Properties["urns"].MinItems)
+	assert.Nil(t, req.Properties["urns"].MaxItems) // max applies to elements after dive
+	assert.Equal(t, "#/components/schemas/web.testThing", req.Properties["thing"].Ref)
+	assert.Equal(t, &openAPISchema{AllOf: []*openAPISchema{{Ref: "#/components/schemas/web.testThing"}}, Format: "email"}, req.Properties["other"])
+	assert.Equal(t, "#/components/schemas/web.testThing", req.Properties["things"].Items.Ref)
+	assert.NotContains(t, req.Properties, "internal")
+	assert.NotContains(t, req.Properties, "Skipped")
+
+	resp := doc.Components.Schemas["web.testResponse"]
+	require.NotNil(t, resp)
+	assert.Equal(t, "date-time", resp.Properties["created_on"].Format)
+	assert.Equal(t, "integer", resp.Properties["counts"].AdditionalProperties.Type)
+	assert.Equal(t, &openAPISchema{}, resp.Properties["extra"])
+
+	// routes without docs still get an operation with a generic response
+	other := doc.Paths["/mr/test/other"]["post"]
+	require.NotNil(t, other)
+	assert.Equal(t, "test_other", other.OperationID)
+	assert.Nil(t, other.RequestBody)
+	assert.Equal(t, "object", other.Responses["200"].Content["application/json"].Schema.Type)
+	assert.False(t, other.Deprecated)
+
+	// deprecated routes are marked as such
+	assert.True(t, doc.Paths["/mr/test/old"]["post"].Deprecated)
+
+	// and hidden routes are excluded
+	assert.NotContains(t, doc.Paths, "/mr/test/callback")
+
+	// and the whole thing can be marshaled
+	_, err := jsonx.Marshal(doc)
+	assert.NoError(t, err)
+}
+
+func TestHandleOpenAPI(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	r, _ := http.NewRequest(http.MethodGet, "/mr/docs/openapi.json", nil)
+	resp, status, err := handleOpenAPI(ctx, rt, r)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, resp.(*openAPIDocument).Paths["/mr/drain"], 1)
+	assert.Equal(t, "Puts this instance into or takes it out of drain mode", resp.(*openAPIDocument).Paths["/mr/drain"]["post"].Summary)
+}
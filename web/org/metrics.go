@@ -3,13 +3,17 @@ package org
 import (
 	"context"
 	"net/http"
+	"sort"
 
 	"github.com/go-chi/chi"
 	"github.com/golang/protobuf/proto"
 	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/metrics"
 	"github.com/nyaruka/mailroom/web"
 	"github.com/pkg/errors"
 	dto "github.com/prometheus/client_model/go"
@@ -36,7 +40,7 @@ type groupCountRow struct {
 }
 
 func calculateGroupCounts(ctx context.Context, rt *runtime.Runtime, org *models.OrgReference) (*dto.MetricFamily, error) {
-	rows, err := rt.DB.QueryxContext(ctx, groupCountsSQL, org.ID)
+	rows, err := rt.ReadonlyDB.QueryxContext(ctx, groupCountsSQL, org.ID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error querying group counts for org")
 	}
@@ -118,7 +122,7 @@ type channelStats struct {
 }
 
 func calculateChannelCounts(ctx context.Context, rt *runtime.Runtime, org *models.OrgReference) (*dto.MetricFamily, error) {
-	rows, err := rt.DB.QueryxContext(ctx, channelCountsSQL, org.ID)
+	rows, err := rt.ReadonlyDB.QueryxContext(ctx, channelCountsSQL, org.ID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error querying channel counts for org")
 	}
@@ -233,6 +237,233 @@ func calculateChannelCounts(ctx context.Context, rt *runtime.Runtime, org *model
 	return family, err
 }
 
+// the rolling windows that we count messages over
+var msgCountWindows = []string{"1h", "24h", "7d"}
+
+var msgStatusNames = map[models.MsgStatus]string{
+	models.MsgStatusPending:   "pending",
+	models.MsgStatusHandled:   "handled",
+	models.MsgStatusQueued:    "queued",
+	models.MsgStatusWired:     "wired",
+	models.MsgStatusSent:      "sent",
+	models.MsgStatusDelivered: "delivered",
+	models.MsgStatusErrored:   "errored",
+	models.MsgStatusFailed:    "failed",
+}
+
+const msgCountsSQL = `
+   SELECT COALESCE(ch.uuid, '') AS channel_uuid, COALESCE(ch.name, '') AS channel_name, m.direction, m.status,
+          COUNT(*) FILTER (WHERE m.created_on > NOW() - INTERVAL '1 hour') AS count_1h,
+          COUNT(*) FILTER (WHERE m.created_on > NOW() - INTERVAL '1 day') AS count_24h,
+          COUNT(*) AS count_7d
+     FROM msgs_msg m
+LEFT JOIN channels_channel ch ON ch.id = m.channel_id
+    WHERE m.org_id = $1 AND m.created_on > NOW() - INTERVAL '7 days'
+ GROUP BY ch.uuid, ch.name, m.direction, m.status;`
+
+type msgCountRow struct {
+	ChannelUUID string              `db:"channel_uuid"`
+	ChannelName string              `db:"channel_name"`
+	Direction   models.MsgDirection `db:"direction"`
+	Status      models.MsgStatus    `db:"status"`
+	Count1h     int64               `db:"count_1h"`
+	Count24h    int64               `db:"count_24h"`
+	Count7d     int64               `db:"count_7d"`
+}
+
+func calculateMsgCounts(ctx context.Context, rt *runtime.Runtime, org *models.OrgReference) (*dto.MetricFamily, error) {
+	rows, err := rt.ReadonlyDB.QueryxContext(ctx, msgCountsSQL, org.ID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error querying msg counts for org")
+	}
+	defer rows.Close()
+
+	family := metrics.NewGaugeSnapshot("rapidpro_msg_count", "the number of messages created in rolling windows by channel, direction and status",
+		"channel_name", "channel_uuid", "msg_direction", "msg_status", "window", "org")
+
+	row := &msgCountRow{}
+	for rows.Next() {
+		if err := rows.StructScan(row); err != nil {
+			return nil, errors.Wrapf(err, "error scanning msg count row")
+		}
+
+		direction := "in"
+		if row.Direction == models.DirectionOut {
+			direction = "out"
+		}
+
+		status, found := msgStatusNames[row.Status]
+		if !found {
+			status = string(row.Status)
+		}
+
+		for i, count := range []int64{row.Count1h, row.Count24h, row.Count7d} {
+			family.Set(float64(count), row.ChannelName, row.ChannelUUID, direction, status, msgCountWindows[i], org.Name)
+		}
+	}
+
+	return family.MetricFamily, rows.Err()
+}
+
+const flowRunCountsSQL = `
+  SELECT f.uuid AS flow_uuid, f.name AS flow_name, r.status, COUNT(*) AS count
+    FROM flows_flowrun r
+    JOIN flows_flow f ON f.id = r.flow_id
+   WHERE r.org_id = $1 AND r.status IN ('A', 'W')
+GROUP BY f.uuid, f.name, r.status;`
+
+type flowRunCountRow struct {
+	FlowUUID assets.FlowUUID  `db:"flow_uuid"`
+	FlowName string           `db:"flow_name"`
+	Status   models.RunStatus `db:"status"`
+	Count    int64            `db:"count"`
+}
+
+func calculateFlowRunCounts(ctx context.Context, rt *runtime.Runtime, org *models.OrgReference) (*dto.MetricFamily, error) {
+	rows, err := rt.ReadonlyDB.QueryxContext(ctx, flowRunCountsSQL, org.ID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error querying flow run counts for org")
+	}
+	defer rows.Close()
+
+	family := metrics.NewGaugeSnapshot("rapidpro_flow_run_count", "the number of runs which are active or waiting in each flow",
+		"flow_name", "flow_uuid", "run_status", "org")
+
+	row := &flowRunCountRow{}
+	for rows.Next() {
+		if err := rows.StructScan(row); err != nil {
+			return nil, errors.Wrapf(err, "error scanning flow run count row")
+		}
+
+		status := "active"
+		if row.Status == models.RunStatusWaiting {
+			status = "waiting"
+		}
+
+		family.Set(float64(row.Count), row.FlowName, string(row.FlowUUID), status, org.Name)
+	}
+
+	return family.MetricFamily, rows.Err()
+}
+
+const ticketCountsSQL = `
+   SELECT COALESCE(tp.uuid, '') AS topic_uuid, COALESCE(tp.name, '') AS topic_name, COALESCE(u.email, '') AS assignee, COUNT(*) AS count
+     FROM tickets_ticket t
+LEFT JOIN tickets_topic tp ON tp.id = t.topic_id
+LEFT JOIN auth_user u ON u.id = t.assignee_id
+    WHERE t.org_id = $1 AND t.status = 'O'
+ GROUP BY tp.uuid, tp.name, u.email;`
+
+type ticketCountRow struct {
+	TopicUUID string `db:"topic_uuid"`
+	TopicName string `db:"topic_name"`
+	Assignee  string `db:"assignee"`
+	Count     int64  `db:"count"`
+}
+
+func calculateTicketCounts(ctx context.Context, rt *runtime.Runtime, org *models.OrgReference) (*dto.MetricFamily, error) {
+	rows, err := rt.ReadonlyDB.QueryxContext(ctx, ticketCountsSQL, org.ID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error querying ticket counts for org")
+	}
+	defer rows.Close()
+
+	family := metrics.NewGaugeSnapshot("rapidpro_open_ticket_count", "the number of open tickets by topic and assignee",
+		"topic_name", "topic_uuid", "assignee", "org")
+
+	row := &ticketCountRow{}
+	for rows.Next() {
+		if err := rows.StructScan(row); err != nil {
+			return nil, errors.Wrapf(err, "error scanning ticket count row")
+		}
+
+		family.Set(float64(row.Count), row.TopicName, row.TopicUUID, row.Assignee, org.Name)
+	}
+
+	return family.MetricFamily, rows.Err()
+}
+
+const campaignFireCountsSQL = `
+  SELECT c.uuid AS campaign_uuid, c.name AS campaign_name, COUNT(*) AS count
+    FROM campaigns_eventfire ef
+    JOIN campaigns_campaignevent e ON e.id = ef.event_id
+    JOIN campaigns_campaign c ON c.id = e.campaign_id
+   WHERE c.org_id = $1 AND ef.fired IS NULL
+GROUP BY c.uuid, c.name;`
+
+type campaignFireCountRow struct {
+	CampaignUUID string `db:"campaign_uuid"`
+	CampaignName string `db:"campaign_name"`
+	Count        int64  `db:"count"`
+}
+
+func calculateCampaignFireCounts(ctx context.Context, rt *runtime.Runtime, org *models.OrgReference) (*dto.MetricFamily, error) {
+	rows, err := rt.ReadonlyDB.QueryxContext(ctx, campaignFireCountsSQL, org.ID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error querying campaign fire counts for org")
+	}
+	defer rows.Close()
+
+	family := metrics.NewGaugeSnapshot("rapidpro_campaign_pending_fire_count", "the number of campaign event fires which haven't yet fired by campaign",
+		"campaign_name", "campaign_uuid", "org")
+
+	row := &campaignFireCountRow{}
+	for rows.Next() {
+		if err := rows.StructScan(row); err != nil {
+			return nil, errors.Wrapf(err, "error scanning campaign fire count row")
+		}
+
+		family.Set(float64(row.Count), row.CampaignName, row.CampaignUUID, org.Name)
+	}
+
+	return family.MetricFamily, rows.Err()
+}
+
+// webhook results aren't recorded against nodes in the database so these come from redis
+func calculateWebhookResults(ctx context.Context, rt *runtime.Runtime, org *models.OrgReference) ([]*dto.MetricFamily, error) {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	results, err := models.GetWebhookResults(rc, org.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	calls := metrics.NewGaugeSnapshot("rapidpro_webhook_call_count", "the number of webhook calls over the last day by node and outcome", "node_uuid", "outcome", "org")
+	rates := metrics.NewGaugeSnapshot("rapidpro_webhook_success_rate", "the proportion of webhook calls over the last day which succeeded by node", "node_uuid", "org")
+
+	nodeUUIDs := make([]string, 0, len(results))
+	for nodeUUID := range results {
+		nodeUUIDs = append(nodeUUIDs, string(nodeUUID))
+	}
+	sort.Strings(nodeUUIDs)
+
+	for _, nodeUUID := range nodeUUIDs {
+		r := results[flows.NodeUUID(nodeUUID)]
+
+		calls.Set(float64(r.Success), nodeUUID, "success", org.Name)
+		calls.Set(float64(r.Failure), nodeUUID, "failure", org.Name)
+		rates.Set(float64(r.Success)/float64(r.Success+r.Failure), nodeUUID, org.Name)
+	}
+
+	return []*dto.MetricFamily{calls.MetricFamily, rates.MetricFamily}, nil
+}
+
+func calculateQueueDepths(ctx context.Context, rt *runtime.Runtime, org *models.OrgReference) (*dto.MetricFamily, error) {
+	family := metrics.NewGaugeSnapshot("rapidpro_queue_depth", "the number of tasks queued for this workspace by queue", "queue", "org")
+
+	for _, q := range []string{queue.BatchQueue, queue.HandlerQueue} {
+		depth, err := rt.Queue.OrgSize(q, int(org.ID))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error getting %s queue depth", q)
+		}
+
+		family.Set(float64(depth), q, org.Name)
+	}
+
+	return family.MetricFamily, nil
+}
+
 func handleMetrics(ctx context.Context, rt *runtime.Runtime, r *http.Request, rawW http.ResponseWriter) error {
 	// we should have basic auth headers, username should be metrics
 	username, token, ok := r.BasicAuth()
@@ -264,6 +495,24 @@ func handleMetrics(ctx context.Context, rt *runtime.Runtime, r *http.Request, ra
 		return errors.Wrapf(err, "error calculating channel counts for org: %d", org.ID)
 	}
 
+	families := []*dto.MetricFamily{groups, channels}
+
+	for _, calculate := range []func(context.Context, *runtime.Runtime, *models.OrgReference) (*dto.MetricFamily, error){
+		calculateMsgCounts, calculateFlowRunCounts, calculateTicketCounts, calculateCampaignFireCounts, calculateQueueDepths,
+	} {
+		family, err := calculate(ctx, rt, org)
+		if err != nil {
+			return errors.Wrapf(err, "error calculating metrics for org: %d", org.ID)
+		}
+		families = append(families, family)
+	}
+
+	webhooks, err := calculateWebhookResults(ctx, rt, org)
+	if err != nil {
+		return errors.Wrapf(err, "error calculating webhook results for org: %d", org.ID)
+	}
+	families = append(families, webhooks...)
+
 	rawW.WriteHeader(http.StatusOK)
 
 	_, err = expfmt.MetricFamilyToText(rawW, groups)
@@ -271,12 +520,6 @@ func handleMetrics(ctx context.Context, rt *runtime.Runtime, r *http.Request, ra
 		return err
 	}
 
-	if len(channels.Metric) > 0 {
-		_, err = expfmt.MetricFamilyToText(rawW, channels)
-		if err != nil {
-			return err
-		}
-	}
-
-	return err
+	// other families are only written if they have metrics
+	return metrics.Write(rawW, families[1:])
 }
@@ -8,6 +8,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/events"
+	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/testsuite"
 	"github.com/nyaruka/mailroom/testsuite/testdata"
 	"github.com/nyaruka/mailroom/web"
@@ -26,6 +29,21 @@ func TestMetrics(t *testing.T) {
 	adminToken := "5c26a50841ff48237238bbdd021150f6a33a4199"
 	db.MustExec(`INSERT INTO api_apitoken(is_active, org_id, created, key, role_id, user_id) VALUES(TRUE, $1, NOW(), $2, 8, 1);`, testdata.Org1.ID, adminToken)
 
+	testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "Hi", nil, models.MsgStatusQueued, false)
+	sessionID := testdata.InsertWaitingSession(db, testdata.Org1, testdata.Cathy, models.FlowTypeMessaging, testdata.Favorites, models.NilCallID, time.Now(), time.Now().Add(time.Hour), false, nil)
+	testdata.InsertFlowRun(db, testdata.Org1, sessionID, testdata.Cathy, testdata.Favorites, models.RunStatusWaiting)
+	testdata.InsertOpenTicket(db, testdata.Org1, testdata.Cathy, testdata.Mailgun, testdata.SalesTopic, "Help", "", time.Now(), testdata.Admin)
+	testdata.InsertEventFire(db, testdata.Cathy, testdata.RemindersEvent1, time.Now().Add(time.Hour))
+
+	rc := rt.RP.Get()
+	models.RecordWebhookResults(rc, testdata.Org1.ID, "3c703019-8c92-4d28-9be0-a926a934486b", []*events.WebhookCalledEvent{
+		{HTTPLogWithoutTime: &flows.HTTPLogWithoutTime{Status: flows.CallStatusSuccess}},
+		{HTTPLogWithoutTime: &flows.HTTPLogWithoutTime{Status: flows.CallStatusSuccess}},
+		{HTTPLogWithoutTime: &flows.HTTPLogWithoutTime{Status: flows.CallStatusSuccess}},
+		{HTTPLogWithoutTime: &flows.HTTPLogWithoutTime{Status: flows.CallStatusResponseError}},
+	})
+	rc.Close()
+
 	wg := &sync.WaitGroup{}
 	server := web.NewServer(ctx, rt, wg)
 	server.Start()
@@ -86,6 +104,14 @@ func TestMetrics(t *testing.T) {
 				`rapidpro_group_contact_count{group_name="Active",group_uuid="b97f69f7-5edf-45c7-9fda-d37066eae91d",group_type="system",org="UNICEF"} 124`,
 				`rapidpro_group_contact_count{group_name="Doctors",group_uuid="c153e265-f7c9-4539-9dbc-9b358714b638",group_type="user",org="UNICEF"} 121`,
 				`rapidpro_channel_msg_count{channel_name="Vonage",channel_uuid="19012bfd-3ce3-4cae-9bb9-76cf92c73d49",channel_type="NX",msg_direction="out",msg_type="message",org="UNICEF"} 0`,
+				`rapidpro_msg_count{channel_name="Twilio",channel_uuid="74729f45-7f29-4868-9dc4-90e491e3c7d8",msg_direction="out",msg_status="queued",window="1h",org="UNICEF"}`,
+				`rapidpro_flow_run_count{flow_name="Favorites",flow_uuid="9de3663f-c5c5-4c92-9f45-ecbc09abcc85",run_status="waiting",org="UNICEF"} 1`,
+				`rapidpro_open_ticket_count{topic_name="Sales",topic_uuid="9ef2ff21-064a-41f1-8560-ccc990b4f937",assignee="admin1@nyaruka.com",org="UNICEF"} 1`,
+				`campaign_uuid="72aa12c5-cc11-4bc7-9406-044047845c70",org="UNICEF"} 1`,
+				`rapidpro_webhook_call_count{node_uuid="3c703019-8c92-4d28-9be0-a926a934486b",outcome="success",org="UNICEF"} 3`,
+				`rapidpro_webhook_call_count{node_uuid="3c703019-8c92-4d28-9be0-a926a934486b",outcome="failure",org="UNICEF"} 1`,
+				`rapidpro_webhook_success_rate{node_uuid="3c703019-8c92-4d28-9be0-a926a934486b",org="UNICEF"} 0.75`,
+				`rapidpro_queue_depth{queue="batch",org="UNICEF"} 0`,
 			},
 		},
 	}
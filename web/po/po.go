@@ -18,7 +18,9 @@ import (
 
 func init() {
 	web.RegisterRoute(http.MethodPost, "/mr/po/export", handleExport)
-	web.RegisterJSONRoute(http.MethodPost, "/mr/po/import", handleImport)
+	web.RegisterJSONRoute(http.MethodPost, "/mr/po/import", handleImport, web.WithDoc(&web.RouteDoc{
+		Summary: "Imports translations from a PO file into flows", Response: &importResponse{},
+	}))
 }
 
 // Exports a PO file from the given set of flows.
@@ -71,6 +73,10 @@ type importForm struct {
 	Language envs.Language   `form:"language" validate:"required"`
 }
 
+type importResponse struct {
+	Flows []flows.Flow `json:"flows"`
+}
+
 func handleImport(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 	form := &importForm{}
 	if err := web.DecodeAndValidateForm(form, r); err != nil {
@@ -97,7 +103,7 @@ func handleImport(ctx context.Context, rt *runtime.Runtime, r *http.Request) (in
 		return err, http.StatusBadRequest, nil
 	}
 
-	return map[string]interface{}{"flows": flows}, http.StatusOK, nil
+	return &importResponse{Flows: flows}, http.StatusOK, nil
 }
 
 func loadFlows(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, flowIDs []models.FlowID) ([]flows.Flow, error) {
@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/queue/dead_letters/list", web.RequireAuthToken(handleListDeadLetters), web.WithDoc(&web.RouteDoc{
+		Summary: "Lists the dead letters of a task queue", Request: &listDeadLettersRequest{}, Response: &listDeadLettersResponse{},
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/queue/dead_letters/inspect", web.RequireAuthToken(handleInspectDeadLetter), web.WithDoc(&web.RouteDoc{
+		Summary: "Inspects a single dead letter", Request: &inspectDeadLetterRequest{}, Response: &queue.DeadLetter{},
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/queue/dead_letters/requeue", web.RequireAuthToken(handleRequeueDeadLetters), web.WithDoc(&web.RouteDoc{
+		Summary: "Requeues dead letters", Request: &bulkDeadLettersRequest{}, Response: &bulkDeadLettersResponse{},
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/queue/dead_letters/discard", web.RequireAuthToken(handleDiscardDeadLetters), web.WithDoc(&web.RouteDoc{
+		Summary: "Discards dead letters", Request: &bulkDeadLettersRequest{}, Response: &bulkDeadLettersResponse{},
+	}))
+}
+
+const defaultDeadLettersLimit = 50
+
+// Request to list the dead letters of a queue, most recent first.
+//
+//	{
+//	  "queue": "batch",
+//	  "limit": 50
+//	}
+type listDeadLettersRequest struct {
+	Queue string `json:"queue"  validate:"required,oneof=batch handler"`
+	Limit int    `json:"limit"`
+}
+
+type listDeadLettersResponse struct {
+	DeadLetters []*queue.DeadLetter `json:"dead_letters"`
+}
+
+func handleListDeadLetters(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &listDeadLettersRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	}
+	if request.Limit <= 0 {
+		request.Limit = defaultDeadLettersLimit
+	}
+
+	letters, err := rt.Queue.DeadLetters(request.Queue, request.Limit)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return &listDeadLettersResponse{DeadLetters: letters}, http.StatusOK, nil
+}
+
+// Request to inspect a single dead letter.
+//
+//	{
+//	  "queue": "batch",
+//	  "id": "5fa925e4-edd8-4e2a-ab24-b3dbb5932ddd"
+//	}
+type inspectDeadLetterRequest struct {
+	Queue string     `json:"queue"  validate:"required,oneof=batch handler"`
+	ID    uuids.UUID `json:"id"     validate:"required"`
+}
+
+func handleInspectDeadLetter(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &inspectDeadLetterRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	letter, err := rt.Queue.GetDeadLetter(request.Queue, request.ID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if letter == nil {
+		return errors.Errorf("no such dead letter: %s", request.ID), http.StatusNotFound, nil
+	}
+
+	return letter, http.StatusOK, nil
+}
+
+// Request to requeue or discard dead letters.
+//
+//	{
+//	  "queue": "batch",
+//	  "ids": ["5fa925e4-edd8-4e2a-ab24-b3dbb5932ddd"]
+//	}
+type bulkDeadLettersRequest struct {
+	Queue string       `json:"queue"  validate:"required,oneof=batch handler"`
+	IDs   []uuids.UUID `json:"ids"    validate:"required"`
+}
+
+type bulkDeadLettersResponse struct {
+	ChangedIDs []uuids.UUID `json:"changed_ids"`
+}
+
+func handleRequeueDeadLetters(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	return handleBulkDeadLetters(r, rt.Queue.RequeueDeadLetter)
+}
+
+func handleDiscardDeadLetters(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	return handleBulkDeadLetters(r, rt.Queue.DiscardDeadLetter)
+}
+
+func handleBulkDeadLetters(r *http.Request, action func(string, uuids.UUID) (bool, error)) (interface{}, int, error) {
+	request := &bulkDeadLettersRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	changed := make([]uuids.UUID, 0, len(request.IDs))
+	for _, id := range request.IDs {
+		ok, err := action(request.Queue, id)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		if ok {
+			changed = append(changed, id)
+		}
+	}
+
+	return &bulkDeadLettersResponse{ChangedIDs: changed}, http.StatusOK, nil
+}
@@ -0,0 +1,37 @@
+package queue_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetters(t *testing.T) {
+	ctx, rt, _, rp := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	task := &queue.Task{Type: queue.StartFlow, OrgID: int(testdata.Org1.ID), Task: []byte(`{}`)}
+
+	letter1, err := queue.AddDeadLetter(rc, queue.BatchQueue, task, errors.New("boom"))
+	require.NoError(t, err)
+	letter2, err := queue.AddDeadLetter(rc, queue.BatchQueue, task, errors.New("boom"))
+	require.NoError(t, err)
+
+	web.RunWebTests(t, ctx, rt, "testdata/dead_letters.json", map[string]string{
+		"letter1_id": string(letter1.ID),
+		"letter2_id": string(letter2.ID),
+	})
+
+	size, err := queue.Size(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	require.Equal(t, 1, size)
+}
@@ -0,0 +1,126 @@
+package queue
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/queue/inspect", web.RequireAuthToken(handleInspect), web.WithDoc(&web.RouteDoc{
+		Summary: "Inspects the contents of a task queue", Request: &inspectRequest{}, Response: &inspectResponse{},
+	}))
+}
+
+const defaultInspectSample = 10
+
+// Request to inspect the orgs which have tasks in a queue, optionally limited to a single org. Task types and the
+// oldest task of each org are determined from a sample of tasks taken from each end of the org's queue. Ages are
+// in seconds.
+//
+//	{
+//	  "queue": "batch",
+//	  "org_id": 1,
+//	  "sample": 10
+//	}
+//
+//	{
+//	  "queue": "batch",
+//	  "size": 2,
+//	  "delayed": 0,
+//	  "orgs": [
+//	    {
+//	      "org_id": 1,
+//	      "depth": 2,
+//	      "workers": 1,
+//	      "max_workers": 4,
+//	      "oldest_queued_on": "2018-07-06T12:00:00Z",
+//	      "oldest_age": 1800,
+//	      "task_types": {"start_flow": 2}
+//	    }
+//	  ]
+//	}
+type inspectRequest struct {
+	Queue  string       `json:"queue"   validate:"required,oneof=batch handler"`
+	OrgID  models.OrgID `json:"org_id"`
+	Sample int          `json:"sample"  validate:"min=0"`
+}
+
+type inspectOrg struct {
+	OrgID          models.OrgID   `json:"org_id"`
+	Depth          int            `json:"depth"`
+	Workers        int            `json:"workers"`
+	MaxWorkers     int            `json:"max_workers"`
+	OldestQueuedOn *time.Time     `json:"oldest_queued_on,omitempty"`
+	OldestAge      *int           `json:"oldest_age,omitempty"`
+	TaskTypes      map[string]int `json:"task_types"`
+}
+
+type inspectResponse struct {
+	Queue   string        `json:"queue"`
+	Size    int           `json:"size"`
+	Delayed int           `json:"delayed"`
+	Orgs    []*inspectOrg `json:"orgs"`
+}
+
+func handleInspect(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &inspectRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	}
+	if request.Sample == 0 {
+		request.Sample = defaultInspectSample
+	}
+
+	infos, err := rt.Queue.Inspect(request.Queue, request.Sample)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	delayed, err := rt.Queue.DelayedSize(request.Queue)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	defaultMax, orgMaxes, err := rt.Queue.GetMaxWorkers(request.Queue)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	now := dates.Now()
+	response := &inspectResponse{Queue: request.Queue, Delayed: delayed, Orgs: make([]*inspectOrg, 0, len(infos))}
+
+	for _, info := range infos {
+		response.Size += info.Depth
+
+		if request.OrgID != models.NilOrgID && models.OrgID(info.OrgID) != request.OrgID {
+			continue
+		}
+
+		org := &inspectOrg{
+			OrgID:      models.OrgID(info.OrgID),
+			Depth:      info.Depth,
+			Workers:    info.Workers,
+			MaxWorkers: defaultMax,
+			TaskTypes:  info.TaskTypes,
+		}
+		if max, ok := orgMaxes[info.OrgID]; ok {
+			org.MaxWorkers = max
+		}
+		if !info.OldestQueuedOn.IsZero() {
+			oldestAge := int(now.Sub(info.OldestQueuedOn) / time.Second)
+			org.OldestQueuedOn = &info.OldestQueuedOn
+			org.OldestAge = &oldestAge
+		}
+
+		response.Orgs = append(response.Orgs, org)
+	}
+
+	return response, http.StatusOK, nil
+}
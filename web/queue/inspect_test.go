@@ -0,0 +1,48 @@
+package queue_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspect(t *testing.T) {
+	ctx, rt, _, rp := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	require.NoError(t, queue.SetMaxWorkers(rc, queue.BatchQueue, 0, 4))
+	require.NoError(t, queue.SetMaxWorkers(rc, queue.BatchQueue, int(testdata.Org2.ID), 1))
+
+	queueTaskAt(t, rc, queue.BatchQueue, int(testdata.Org1.ID), queue.StartFlow, time.Date(2018, 7, 6, 12, 0, 0, 0, time.UTC))
+	queueTaskAt(t, rc, queue.BatchQueue, int(testdata.Org1.ID), queue.StartFlow, time.Date(2018, 7, 6, 12, 10, 0, 0, time.UTC))
+	queueTaskAt(t, rc, queue.BatchQueue, int(testdata.Org2.ID), queue.SendBroadcast, time.Date(2018, 7, 6, 12, 25, 0, 0, time.UTC))
+
+	// pop the oldest task so that org 1 has a worker
+	task, err := queue.PopNextTask(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	require.Equal(t, int(testdata.Org1.ID), task.OrgID)
+
+	web.RunWebTests(t, ctx, rt, "testdata/inspect.json", nil)
+}
+
+// queues a task directly so that we can control when it was queued
+func queueTaskAt(t *testing.T, rc redis.Conn, q string, orgID int, taskType string, queuedOn time.Time) {
+	payload := jsonx.MustMarshal(&queue.Task{Type: taskType, OrgID: orgID, Task: []byte(`{}`), QueuedOn: queuedOn})
+
+	_, err := rc.Do("zadd", fmt.Sprintf("%s:%d", q, orgID), float64(queuedOn.UnixMicro())/float64(1000000), payload)
+	require.NoError(t, err)
+	_, err = rc.Do("zincrby", fmt.Sprintf("%s:active", q), 0, orgID)
+	require.NoError(t, err)
+}
@@ -0,0 +1,65 @@
+package queue
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/queue/max_workers", web.RequireAuthToken(handleMaxWorkers), web.WithDoc(&web.RouteDoc{
+		Summary: "Sets the maximum number of workers for an org on a task queue", Request: &maxWorkersRequest{}, Response: &maxWorkersResponse{},
+	}))
+}
+
+// Request to override the maximum number of workers which can work on tasks for the given org at once. A max
+// workers of zero removes the override so that the org uses the default for the queue. Response is the current
+// default and org overrides for the queue.
+//
+//	{
+//	  "queue": "batch",
+//	  "org_id": 1,
+//	  "max_workers": 2
+//	}
+//
+//	{
+//	  "default": 4,
+//	  "orgs": {"1": 2}
+//	}
+type maxWorkersRequest struct {
+	Queue      string       `json:"queue"        validate:"required,oneof=batch handler"`
+	OrgID      models.OrgID `json:"org_id"       validate:"required"`
+	MaxWorkers int          `json:"max_workers"  validate:"min=0"`
+}
+
+type maxWorkersResponse struct {
+	Default int                  `json:"default"`
+	Orgs    map[models.OrgID]int `json:"orgs"`
+}
+
+func handleMaxWorkers(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &maxWorkersRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	if err := rt.Queue.SetMaxWorkers(request.Queue, int(request.OrgID), request.MaxWorkers); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	def, orgs, err := rt.Queue.GetMaxWorkers(request.Queue)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	response := &maxWorkersResponse{Default: def, Orgs: make(map[models.OrgID]int, len(orgs))}
+	for orgID, max := range orgs {
+		response.Orgs[models.OrgID(orgID)] = max
+	}
+
+	return response, http.StatusOK, nil
+}
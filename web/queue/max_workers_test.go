@@ -0,0 +1,16 @@
+package queue_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func TestMaxWorkers(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	web.RunWebTests(t, ctx, rt, "testdata/max_workers.json", nil)
+}
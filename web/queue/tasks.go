@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/queue/task/status", web.RequireAuthToken(handleTaskStatus), web.WithDoc(&web.RouteDoc{
+		Summary: "Gets the status record of a queued task", Request: &taskStatusRequest{}, Response: &queue.TaskRecord{},
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/queue/task/cancel", web.RequireAuthToken(handleCancelTask), web.WithDoc(&web.RouteDoc{
+		Summary: "Cancels a queued task", Request: &cancelTaskRequest{}, Response: &cancelTaskResponse{},
+	}))
+}
+
+// Request to get the status record of a queued task.
+//
+//	{
+//	  "id": "5fa925e4-edd8-4e2a-ab24-b3dbb5932ddd"
+//	}
+//
+//	{
+//	  "id": "5fa925e4-edd8-4e2a-ab24-b3dbb5932ddd",
+//	  "queue": "batch",
+//	  "type": "start_flow",
+//	  "org_id": 1,
+//	  "status": "running",
+//	  "error_count": 0,
+//	  "cancelled": false,
+//	  "queued_on": "2018-07-06T12:30:00.123456789Z",
+//	  "started_on": "2018-07-06T12:30:01.123456789Z"
+//	}
+type taskStatusRequest struct {
+	ID uuids.UUID `json:"id" validate:"required"`
+}
+
+func handleTaskStatus(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &taskStatusRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	record, err := rt.Queue.GetTaskRecord(request.ID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if record == nil {
+		return errors.Errorf("no such task: %s", request.ID), http.StatusNotFound, nil
+	}
+
+	return record, http.StatusOK, nil
+}
+
+// Request to cancel a queued or running task. Only broadcasts stop early when cancelled, as flow starts are cancelled
+// with /mr/flow/start_cancel. Batches of a cancelled broadcast which have already been queued are skipped and the
+// broadcast is marked as failed.
+//
+//	{
+//	  "id": "5fa925e4-edd8-4e2a-ab24-b3dbb5932ddd"
+//	}
+//
+//	{
+//	  "cancelled": true
+//	}
+type cancelTaskRequest struct {
+	ID uuids.UUID `json:"id" validate:"required"`
+}
+
+type cancelTaskResponse struct {
+	Cancelled bool `json:"cancelled"`
+}
+
+func handleCancelTask(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &cancelTaskRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	cancelled, err := rt.Queue.CancelTask(request.ID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if !cancelled {
+		return errors.Errorf("no such task: %s", request.ID), http.StatusNotFound, nil
+	}
+
+	return &cancelTaskResponse{Cancelled: true}, http.StatusOK, nil
+}
@@ -0,0 +1,36 @@
+package queue_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTasks(t *testing.T) {
+	ctx, rt, _, rp := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	task := &queue.Task{
+		ID:       "5fa925e4-edd8-4e2a-ab24-b3dbb5932ddd",
+		Type:     queue.StartFlow,
+		OrgID:    int(testdata.Org1.ID),
+		Task:     []byte(`{}`),
+		QueuedOn: time.Date(2018, 7, 6, 12, 0, 0, 0, time.UTC),
+	}
+	require.NoError(t, queue.SetTaskStatus(rc, queue.BatchQueue, task, queue.TaskStatusQueued, nil))
+
+	web.RunWebTests(t, ctx, rt, "testdata/tasks.json", nil)
+
+	cancelled, err := queue.IsTaskCancelled(rc, task.ID)
+	require.NoError(t, err)
+	require.True(t, cancelled)
+}
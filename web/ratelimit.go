@@ -0,0 +1,159 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/metrics"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// the rate limiting class of endpoints which query Elastic, which can be given their own lower limit
+const searchRateLimitClass = "search"
+
+var searchRoutes = map[string]bool{
+	"/mr/contact/search":      true,
+	"/mr/contact/parse_query": true,
+	"/mr/flow/preview_start":  true,
+}
+
+var rateLimited = metrics.NewCounter("mailroom_web_rate_limited_total", "the number of web requests rejected by rate limiting", "class")
+
+// RateLimitedError is returned as the response to a request which has been rate limited
+type RateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("rate limit exceeded, retry after %s", e.RetryAfter)
+}
+
+// returns the class of the passed in request path for rate limiting, e.g. /mr/contact/resolve -> contact, so that an org
+// hammering one kind of endpoint doesn't use up its limit for others
+func rateLimitClass(path string) string {
+	if searchRoutes[path] {
+		return searchRateLimitClass
+	}
+	class, _, _ := strings.Cut(strings.TrimPrefix(path, "/mr/"), "/")
+	return class
+}
+
+// returns whether any rate limits are configured
+func rateLimitEnabled(cfg *runtime.Config) bool {
+	return cfg.RateLimit > 0 || cfg.RateLimitSearch > 0
+}
+
+// returns the rate in requests per second and the burst size for the given class, with a rate of zero meaning no limit.
+// If search has its own rate then it also has its own burst, so that search isn't allowed the larger general burst.
+func rateLimitFor(cfg *runtime.Config, class string) (int, int) {
+	rate, burst := cfg.RateLimit, cfg.RateLimitBurst
+	if class == searchRateLimitClass && cfg.RateLimitSearch > 0 {
+		rate, burst = cfg.RateLimitSearch, cfg.RateLimitSearchBurst
+	}
+
+	if burst < rate {
+		burst = rate
+	}
+	return rate, burst
+}
+
+// checks whether the given org can make the passed in request, returning an error to use as the response if not. If
+// we can't reach redis then we let the request through rather than failing every request.
+func checkRateLimit(rt *runtime.Runtime, r *http.Request, orgID models.OrgID) error {
+	if orgID == models.NilOrgID {
+		return nil
+	}
+
+	class := rateLimitClass(r.URL.Path)
+	rate, burst := rateLimitFor(rt.Config(), class)
+	if rate <= 0 {
+		return nil
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	key := fmt.Sprintf("rate_limit:%d:%s", orgID, class)
+
+	allowed, wait, err := takeToken(rc, key, rate, burst, dates.Now())
+	if err != nil {
+		logrus.WithError(err).WithField("org_id", orgID).WithField("class", class).Error("error checking rate limit")
+		return nil
+	}
+	if allowed {
+		return nil
+	}
+
+	rateLimited.Inc(class)
+
+	return &RateLimitedError{RetryAfter: wait}
+}
+
+var takeTokenScript = redis.NewScript(1, `-- KEYS: [BucketKey] ARGV: [Rate, Burst, NowMillis]
+local key, rate, burst, now = KEYS[1], tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", key, "tokens", "updated")
+local tokens = tonumber(bucket[1]) or burst
+local updated = tonumber(bucket[2]) or now
+
+-- refill the bucket for the time since it was last updated
+tokens = math.min(burst, tokens + math.max(0, now - updated) * rate / 1000)
+
+local allowed, wait = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+
+redis.call("HMSET", key, "tokens", tostring(tokens), "updated", now)
+redis.call("PEXPIRE", key, math.ceil(burst * 1000 / rate) + 1000)
+
+return {allowed, wait}
+`)
+
+// takes a token from the bucket with the given key, returning whether there was one and if not, how long until there is
+func takeToken(rc redis.Conn, key string, rate, burst int, now time.Time) (bool, time.Duration, error) {
+	result, err := redis.Ints(takeTokenScript.Do(rc, key, rate, burst, now.UnixMilli()))
+	if err != nil {
+		return false, 0, errors.Wrapf(err, "error taking token from bucket %s", key)
+	}
+
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond, nil
+}
+
+// reads the org id from the JSON body of the passed in request, replacing the body so that it can still be read by
+// the handler. Returns NilOrgID if the body isn't JSON or doesn't have an org id.
+func requestOrgID(r *http.Request) models.OrgID {
+	if r.Body == nil {
+		return models.NilOrgID
+	}
+
+	// read up to one byte past our limit so that the handler can still reject bodies which are too big
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes+1))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return models.NilOrgID
+	}
+
+	payload := &struct {
+		OrgID models.OrgID `json:"org_id"`
+	}{}
+	if err := json.Unmarshal(body, payload); err != nil {
+		return models.NilOrgID
+	}
+
+	return payload.OrgID
+}
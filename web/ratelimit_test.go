@@ -0,0 +1,178 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitClass(t *testing.T) {
+	assert.Equal(t, "contact", rateLimitClass("/mr/contact/resolve"))
+	assert.Equal(t, "search", rateLimitClass("/mr/contact/search"))
+	assert.Equal(t, "search", rateLimitClass("/mr/flow/preview_start"))
+	assert.Equal(t, "flow", rateLimitClass("/mr/flow/start"))
+	assert.Equal(t, "ticket", rateLimitClass("/mr/ticket/close"))
+
+	cfg := runtime.NewDefaultConfig()
+	assert.False(t, rateLimitEnabled(cfg))
+
+	cfg.RateLimit = 10
+	rate, burst := rateLimitFor(cfg, "contact")
+	assert.Equal(t, 10, rate)
+	assert.Equal(t, 10, burst)
+
+	// search falls back to the general limit if it doesn't have its own
+	cfg.RateLimitBurst = 25
+	rate, burst = rateLimitFor(cfg, "search")
+	assert.Equal(t, 10, rate)
+	assert.Equal(t, 25, burst)
+
+	// but if it has its own rate, it doesn't get the general burst
+	cfg.RateLimitSearch = 2
+	rate, burst = rateLimitFor(cfg, "search")
+	assert.Equal(t, 2, rate)
+	assert.Equal(t, 2, burst)
+
+	cfg.RateLimitSearchBurst = 5
+	rate, burst = rateLimitFor(cfg, "search")
+	assert.Equal(t, 2, rate)
+	assert.Equal(t, 5, burst)
+
+	rate, burst = rateLimitFor(cfg, "contact")
+	assert.Equal(t, 10, rate)
+	assert.Equal(t, 25, burst)
+}
+
+func TestTakeToken(t *testing.T) {
+	_, rt, _, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	now := time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)
+
+	// bucket starts full so we can take burst tokens at once
+	for i := 0; i < 3; i++ {
+		allowed, _, err := takeToken(rc, "rate_limit:1:contact", 2, 3, now)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+
+	allowed, wait, err := takeToken(rc, "rate_limit:1:contact", 2, 3, now)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// other buckets aren't affected
+	allowed, _, err = takeToken(rc, "rate_limit:2:contact", 2, 3, now)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	// after half a second we've been given another token
+	allowed, _, err = takeToken(rc, "rate_limit:1:contact", 2, 3, now.Add(500*time.Millisecond))
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	allowed, wait, err = takeToken(rc, "rate_limit:1:contact", 2, 3, now.Add(750*time.Millisecond))
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, 250*time.Millisecond, wait)
+}
+
+func TestRequireAuthTokenRateLimiting(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+	defer dates.SetNowSource(dates.DefaultNowSource)
+
+	dates.SetNowSource(dates.NewFixedNowSource(time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)))
+
+	rt.Config().RateLimit = 1
+	rt.Config().RateLimitBurst = 2
+	defer func() { rt.Config().RateLimit = 0; rt.Config().RateLimitBurst = 0 }()
+
+	var read string
+	handler := RequireAuthToken(func(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+		body, _ := io.ReadAll(r.Body)
+		read = string(body)
+		return map[string]interface{}{}, http.StatusOK, nil
+	})
+
+	call := func(body string) (interface{}, int) {
+		r, _ := http.NewRequest(http.MethodPost, "/mr/contact/resolve", bytes.NewReader([]byte(body)))
+		resp, status, err := handler(ctx, rt, r)
+		require.NoError(t, err)
+		return resp, status
+	}
+
+	_, status := call(`{"org_id": 1, "urn": "tel:+1234567890"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, `{"org_id": 1, "urn": "tel:+1234567890"}`, read) // handler can still read the body
+
+	_, status = call(`{"org_id": 1}`)
+	assert.Equal(t, http.StatusOK, status)
+
+	resp, status := call(`{"org_id": 1}`)
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Equal(t, &RateLimitedError{RetryAfter: time.Second}, resp)
+
+	// other orgs have their own limit
+	_, status = call(`{"org_id": 2}`)
+	assert.Equal(t, http.StatusOK, status)
+
+	// requests without an org aren't limited
+	for i := 0; i < 3; i++ {
+		_, status = call(`{"urn": "tel:+1234567890"}`)
+		assert.Equal(t, http.StatusOK, status)
+	}
+}
+
+func TestRequireAuthTokenSearchRateLimiting(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+	defer dates.SetNowSource(dates.DefaultNowSource)
+
+	dates.SetNowSource(dates.NewFixedNowSource(time.Date(2022, 12, 1, 12, 0, 0, 0, time.UTC)))
+
+	rt.Config().RateLimit = 5
+	rt.Config().RateLimitBurst = 10
+	rt.Config().RateLimitSearch = 1
+	rt.Config().RateLimitSearchBurst = 2
+	defer func() {
+		rt.Config().RateLimit, rt.Config().RateLimitBurst, rt.Config().RateLimitSearch, rt.Config().RateLimitSearchBurst = 0, 0, 0, 0
+	}()
+
+	handler := RequireAuthToken(func(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+		return map[string]interface{}{}, http.StatusOK, nil
+	})
+
+	call := func(path string) int {
+		r, _ := http.NewRequest(http.MethodPost, path, bytes.NewReader([]byte(`{"org_id": 1}`)))
+		_, status, err := handler(ctx, rt, r)
+		require.NoError(t, err)
+		return status
+	}
+
+	// search is throttled after its own smaller burst
+	assert.Equal(t, http.StatusOK, call("/mr/contact/search"))
+	assert.Equal(t, http.StatusOK, call("/mr/contact/search"))
+	assert.Equal(t, http.StatusTooManyRequests, call("/mr/contact/search"))
+
+	// whilst the general class still has its larger burst available
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, http.StatusOK, call("/mr/contact/resolve"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, call("/mr/contact/resolve"))
+}
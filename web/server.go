@@ -4,7 +4,9 @@ import (
 	"compress/flate"
 	"context"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
@@ -34,6 +36,8 @@ type jsonRoute struct {
 	method  string
 	pattern string
 	handler JSONHandler
+	doc     *RouteDoc
+	hidden  bool
 }
 
 var jsonRoutes = make([]*jsonRoute, 0)
@@ -46,8 +50,26 @@ type route struct {
 
 var routes = make([]*route, 0)
 
-func RegisterJSONRoute(method string, pattern string, handler JSONHandler) {
-	jsonRoutes = append(jsonRoutes, &jsonRoute{method, pattern, handler})
+// RouteOption is an option which can be passed when registering a JSON route
+type RouteOption func(*jsonRoute)
+
+// WithDoc describes a JSON route in our OpenAPI specification
+func WithDoc(doc *RouteDoc) RouteOption {
+	return func(r *jsonRoute) { r.doc = doc }
+}
+
+// WithoutDoc excludes a JSON route from our OpenAPI specification, e.g. callbacks from ticketing services which aren't
+// authenticated with our token and whose payloads are defined by those services
+func WithoutDoc() RouteOption {
+	return func(r *jsonRoute) { r.hidden = true }
+}
+
+func RegisterJSONRoute(method string, pattern string, handler JSONHandler, opts ...RouteOption) {
+	route := &jsonRoute{method: method, pattern: pattern, handler: handler}
+	for _, opt := range opts {
+		opt(route)
+	}
+	jsonRoutes = append(jsonRoutes, route)
 }
 
 func RegisterRoute(method string, pattern string, handler Handler) {
@@ -73,6 +95,9 @@ func NewServer(ctx context.Context, rt *runtime.Runtime, wg *sync.WaitGroup) *Se
 	router.MethodNotAllowed(s.WrapJSONHandler(handle405))
 	router.Get("/", s.WrapJSONHandler(handleIndex))
 	router.Get("/mr/", s.WrapJSONHandler(handleIndex))
+	router.Get("/mr/health/live", s.WrapJSONHandler(handleHealthLive))
+	router.Get("/mr/health/ready", s.WrapJSONHandler(handleHealthReady))
+	router.Get("/mr/docs/openapi.json", s.WrapJSONHandler(handleOpenAPI))
 
 	// add any registered json routes
 	for _, route := range jsonRoutes {
@@ -86,7 +111,7 @@ func NewServer(ctx context.Context, rt *runtime.Runtime, wg *sync.WaitGroup) *Se
 
 	// configure our http server
 	s.httpServer = &http.Server{
-		Addr:         fmt.Sprintf("%s:%d", rt.Config.Address, rt.Config.Port),
+		Addr:         fmt.Sprintf("%s:%d", rt.Config().Address, rt.Config().Port),
 		Handler:      router,
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
@@ -110,6 +135,9 @@ func (s *Server) WrapJSONHandler(handler JSONHandler) http.HandlerFunc {
 			// handler returned an error to use as a the response
 			asError, isError := value.(error)
 			if isError {
+				if limited, isLimited := asError.(*RateLimitedError); isLimited {
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+				}
 				value = NewErrorResponse(asError)
 			}
 		}
@@ -163,7 +191,7 @@ func (s *Server) Start() {
 		}
 	}()
 
-	logrus.WithField("address", s.rt.Config.Address).WithField("port", s.rt.Config.Port).Info("server started")
+	logrus.WithField("address", s.rt.Config().Address).WithField("port", s.rt.Config().Port).Info("server started")
 }
 
 // Stop stops our web server
@@ -178,7 +206,7 @@ func handleIndex(ctx context.Context, rt *runtime.Runtime, r *http.Request) (int
 	response := map[string]string{
 		"url":       r.URL.String(),
 		"component": "mailroom",
-		"version":   rt.Config.Version,
+		"version":   rt.Config().Version,
 	}
 	return response, http.StatusOK, nil
 }
@@ -25,8 +25,12 @@ var testChannel = assets.NewChannelReference("440099cf-200c-4d45-a8e7-4a564f4a0e
 var testURN = urns.URN("tel:+12065551212")
 
 func init() {
-	web.RegisterJSONRoute(http.MethodPost, "/mr/sim/start", web.RequireAuthToken(handleStart))
-	web.RegisterJSONRoute(http.MethodPost, "/mr/sim/resume", web.RequireAuthToken(handleResume))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/sim/start", web.RequireAuthToken(handleStart), web.WithDoc(&web.RouteDoc{
+		Summary: "Starts a flow simulation", Request: &startRequest{}, Response: &simulationResponse{},
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/sim/resume", web.RequireAuthToken(handleResume), web.WithDoc(&web.RouteDoc{
+		Summary: "Resumes a flow simulation", Request: &resumeRequest{}, Response: &simulationResponse{},
+	}))
 }
 
 type flowDefinition struct {
@@ -147,7 +151,7 @@ func handleStart(ctx context.Context, rt *runtime.Runtime, r *http.Request) (int
 // triggerFlow creates a new session with the passed in trigger, returning our standard response
 func triggerFlow(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, trigger flows.Trigger) (interface{}, int, error) {
 	// start our flow session
-	session, sprint, err := goflow.Simulator(rt.Config).NewSession(oa.SessionAssets(), trigger)
+	session, sprint, err := goflow.Simulator(rt.Config()).NewSession(oa.SessionAssets(), trigger)
 	if err != nil {
 		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error starting session")
 	}
@@ -197,7 +201,7 @@ func handleResume(ctx context.Context, rt *runtime.Runtime, r *http.Request) (in
 		return nil, http.StatusBadRequest, err
 	}
 
-	session, err := goflow.Simulator(rt.Config).ReadSession(oa.SessionAssets(), request.Session, assets.IgnoreMissing)
+	session, err := goflow.Simulator(rt.Config()).ReadSession(oa.SessionAssets(), request.Session, assets.IgnoreMissing)
 	if err != nil {
 		return nil, http.StatusBadRequest, err
 	}
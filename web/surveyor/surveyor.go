@@ -21,7 +21,9 @@ import (
 )
 
 func init() {
-	web.RegisterJSONRoute(http.MethodPost, "/mr/surveyor/submit", web.RequireUserToken(handleSubmit))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/surveyor/submit", web.RequireUserToken(handleSubmit), web.WithDoc(&web.RouteDoc{
+		Summary: "Submits a session from Surveyor", Request: &submitRequest{}, Response: &submitResponse{},
+	}))
 }
 
 // Represents a surveyor submission
@@ -68,7 +70,7 @@ func handleSubmit(ctx context.Context, rt *runtime.Runtime, r *http.Request) (in
 		return nil, http.StatusInternalServerError, errors.Errorf("missing request user")
 	}
 
-	fs, err := goflow.Engine(rt.Config).ReadSession(oa.SessionAssets(), request.Session, assets.IgnoreMissing)
+	fs, err := goflow.Engine(rt.Config()).ReadSession(oa.SessionAssets(), request.Session, assets.IgnoreMissing)
 	if err != nil {
 		return nil, http.StatusBadRequest, errors.Wrapf(err, "error reading session")
 	}
@@ -115,7 +117,7 @@ func handleSubmit(ctx context.Context, rt *runtime.Runtime, r *http.Request) (in
 
 	// run through each contact modifier, applying it to our contact
 	for _, m := range mods {
-		modifiers.Apply(oa.Env(), goflow.Engine(rt.Config).Services(), oa.SessionAssets(), flowContact, m, appender)
+		modifiers.Apply(oa.Env(), goflow.Engine(rt.Config()).Services(), oa.SessionAssets(), flowContact, m, appender)
 	}
 
 	// set this updated contact on our session
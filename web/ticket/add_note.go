@@ -11,8 +11,12 @@ import (
 )
 
 func init() {
-	web.RegisterJSONRoute(http.MethodPost, "/mr/ticket/note", web.RequireAuthToken(handleAddNote)) // deprecated
-	web.RegisterJSONRoute(http.MethodPost, "/mr/ticket/add_note", web.RequireAuthToken(handleAddNote))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/ticket/note", web.RequireAuthToken(handleAddNote), web.WithDoc(&web.RouteDoc{
+		Summary: "Adds a note to tickets, use /mr/ticket/add_note instead", Request: &addNoteRequest{}, Response: &bulkTicketResponse{}, Deprecated: true,
+	}))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/ticket/add_note", web.RequireAuthToken(handleAddNote), web.WithDoc(&web.RouteDoc{
+		Summary: "Adds a note to tickets", Request: &addNoteRequest{}, Response: &bulkTicketResponse{},
+	}))
 }
 
 type addNoteRequest struct {
@@ -11,7 +11,9 @@ import (
 )
 
 func init() {
-	web.RegisterJSONRoute(http.MethodPost, "/mr/ticket/assign", web.RequireAuthToken(handleAssign))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/ticket/assign", web.RequireAuthToken(handleAssign), web.WithDoc(&web.RouteDoc{
+		Summary: "Assigns tickets to a user", Request: &assignRequest{}, Response: &bulkTicketResponse{},
+	}))
 }
 
 type assignRequest struct {
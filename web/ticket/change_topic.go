@@ -11,7 +11,9 @@ import (
 )
 
 func init() {
-	web.RegisterJSONRoute(http.MethodPost, "/mr/ticket/change_topic", web.RequireAuthToken(handleChangeTopic))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/ticket/change_topic", web.RequireAuthToken(handleChangeTopic), web.WithDoc(&web.RouteDoc{
+		Summary: "Changes the topic of tickets", Request: &changeTopicRequest{}, Response: &bulkTicketResponse{},
+	}))
 }
 
 type changeTopicRequest struct {
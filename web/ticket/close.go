@@ -12,7 +12,9 @@ import (
 )
 
 func init() {
-	web.RegisterJSONRoute(http.MethodPost, "/mr/ticket/close", web.RequireAuthToken(web.WithHTTPLogs(handleClose)))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/ticket/close", web.RequireAuthToken(web.WithHTTPLogs(handleClose)), web.WithDoc(&web.RouteDoc{
+		Summary: "Closes tickets", Request: &bulkTicketRequest{}, Response: &bulkTicketResponse{},
+	}))
 }
 
 // Closes any open tickets with the given ids. If force=true then even if tickets can't be closed on external service,
@@ -46,11 +48,8 @@ func handleClose(ctx context.Context, rt *runtime.Runtime, r *http.Request, l *m
 		return nil, http.StatusInternalServerError, errors.Wrap(err, "error closing tickets")
 	}
 
-	rc := rt.RP.Get()
-	defer rc.Close()
-
 	for t, e := range evts {
-		err = handler.QueueTicketEvent(rc, t.ContactID(), e)
+		err = handler.QueueTicketEvent(rt, t.ContactID(), e)
 		if err != nil {
 			return nil, http.StatusInternalServerError, errors.Wrapf(err, "error queueing ticket event for ticket %d", t.ID())
 		}
@@ -12,7 +12,9 @@ import (
 )
 
 func init() {
-	web.RegisterJSONRoute(http.MethodPost, "/mr/ticket/reopen", web.RequireAuthToken(web.WithHTTPLogs(handleReopen)))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/ticket/reopen", web.RequireAuthToken(web.WithHTTPLogs(handleReopen)), web.WithDoc(&web.RouteDoc{
+		Summary: "Reopens tickets", Request: &bulkTicketRequest{}, Response: &bulkTicketResponse{},
+	}))
 }
 
 // Reopens any closed tickets with the given ids
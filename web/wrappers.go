@@ -12,7 +12,8 @@ import (
 	"github.com/pkg/errors"
 )
 
-// RequireUserToken wraps a JSON handler to require passing of an API token via the authorization header
+// RequireUserToken wraps a JSON handler to require passing of an API token via the authorization header, and rate
+// limits requests by the org of that token
 func RequireUserToken(handler JSONHandler) JSONHandler {
 	return func(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 		token := r.Header.Get("authorization")
@@ -56,6 +57,10 @@ func RequireUserToken(handler JSONHandler) JSONHandler {
 			return nil, 0, errors.Wrapf(err, "error scanning auth row")
 		}
 
+		if err := checkRateLimit(rt, r, orgID); err != nil {
+			return err, http.StatusTooManyRequests, nil
+		}
+
 		// we are authenticated set our user id ang org id on our context and call our sub handler
 		ctx = context.WithValue(ctx, UserIDKey, userID)
 		ctx = context.WithValue(ctx, OrgIDKey, orgID)
@@ -63,14 +68,22 @@ func RequireUserToken(handler JSONHandler) JSONHandler {
 	}
 }
 
-// RequireAuthToken wraps a handler to require that our request to have our global authorization header
+// RequireAuthToken wraps a handler to require that our request to have our global authorization header, and rate
+// limits requests by the org_id in their JSON body
 func RequireAuthToken(handler JSONHandler) JSONHandler {
 	return func(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 		auth := r.Header.Get("authorization")
-		if rt.Config.AuthToken != "" && fmt.Sprintf("Token %s", rt.Config.AuthToken) != auth {
+		if rt.Config().AuthToken != "" && fmt.Sprintf("Token %s", rt.Config().AuthToken) != auth {
 			return fmt.Errorf("invalid or missing authorization header, denying"), http.StatusUnauthorized, nil
 		}
 
+		// our token isn't tied to an org so requests are limited by the org in their body
+		if rateLimitEnabled(rt.Config()) {
+			if err := checkRateLimit(rt, r, requestOrgID(r)); err != nil {
+				return err, http.StatusTooManyRequests, nil
+			}
+		}
+
 		// we are authenticated, call our chain
 		return handler(ctx, rt, r)
 	}
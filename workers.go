@@ -8,8 +8,16 @@ import (
 
 	"github.com/nyaruka/mailroom/core/queue"
 	"github.com/nyaruka/mailroom/runtime"
-
+	"github.com/nyaruka/mailroom/utils/metrics"
+	"github.com/nyaruka/mailroom/utils/tracing"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	taskDuration = metrics.NewHistogram("mailroom_task_duration_seconds", "the time taken to handle tasks", metrics.DefaultBuckets, "queue", "task_type")
+	taskErrors   = metrics.NewCounter("mailroom_task_errors_total", "the number of tasks which errored or panicked", "queue", "task_type")
 )
 
 // Foreman takes care of managing our set of workers and assigns msgs for each to send
@@ -17,19 +25,27 @@ type Foreman struct {
 	rt               *runtime.Runtime
 	wg               *sync.WaitGroup
 	queue            string
+	workersPerOrg    int
+	workersPerOrgMu  sync.Mutex
 	workers          []*Worker
+	nextWorkerID     int
 	availableWorkers chan *Worker
+	resize           chan int
 	quit             chan bool
 }
 
-// NewForeman creates a new Foreman for the passed in server with the number of max workers
-func NewForeman(rt *runtime.Runtime, wg *sync.WaitGroup, queue string, maxWorkers int) *Foreman {
+// NewForeman creates a new Foreman for the passed in server with the number of max workers, and the default
+// maximum number of workers across all instances which can be working on tasks for the same org
+func NewForeman(rt *runtime.Runtime, wg *sync.WaitGroup, queue string, maxWorkers int, workersPerOrg int) *Foreman {
 	foreman := &Foreman{
 		rt:               rt,
 		wg:               wg,
 		queue:            queue,
+		workersPerOrg:    workersPerOrg,
 		workers:          make([]*Worker, maxWorkers),
+		nextWorkerID:     maxWorkers,
 		availableWorkers: make(chan *Worker, maxWorkers),
+		resize:           make(chan int),
 		quit:             make(chan bool),
 	}
 
@@ -42,6 +58,13 @@ func NewForeman(rt *runtime.Runtime, wg *sync.WaitGroup, queue string, maxWorker
 
 // Start starts the foreman and all its workers, assigning jobs while there are some
 func (f *Foreman) Start() {
+	// set the default limit of workers per org for our queue
+	f.workersPerOrgMu.Lock()
+	if err := f.rt.Queue.SetMaxWorkers(f.queue, 0, f.workersPerOrg); err != nil {
+		logrus.WithField("comp", "foreman").WithField("queue", f.queue).WithError(err).Error("error setting max workers per org")
+	}
+	f.workersPerOrgMu.Unlock()
+
 	for _, worker := range f.workers {
 		worker.Start()
 	}
@@ -50,13 +73,64 @@ func (f *Foreman) Start() {
 
 // Stop stops the foreman and all its workers, the wait group of the worker can be used to track progress
 func (f *Foreman) Stop() {
-	for _, worker := range f.workers {
-		worker.Stop()
-	}
 	close(f.quit)
 	logrus.WithField("comp", "foreman").WithField("queue", f.queue).WithField("state", "stopping").Info("foreman stopping")
 }
 
+// Resize changes the number of workers of this foreman and the default limit of workers per org. Workers being
+// removed are allowed to finish any task they're currently handling.
+func (f *Foreman) Resize(maxWorkers int, workersPerOrg int) {
+	f.workersPerOrgMu.Lock()
+	if workersPerOrg != f.workersPerOrg {
+		if err := f.rt.Queue.SetMaxWorkers(f.queue, 0, workersPerOrg); err != nil {
+			logrus.WithField("comp", "foreman").WithField("queue", f.queue).WithError(err).Error("error setting max workers per org")
+		}
+		f.workersPerOrg = workersPerOrg
+	}
+	f.workersPerOrgMu.Unlock()
+
+	select {
+	case f.resize <- maxWorkers:
+	case <-f.quit:
+	}
+}
+
+// adds or retires workers so that we have the given number of active workers. Only called from Assign.
+func (f *Foreman) resizeWorkers(maxWorkers int) {
+	active := make([]*Worker, 0, len(f.workers))
+	for _, w := range f.workers {
+		if !w.retired {
+			active = append(active, w)
+		}
+	}
+
+	for i := len(active); i < maxWorkers; i++ {
+		worker := NewWorker(f, f.nextWorkerID)
+		f.nextWorkerID++
+		f.workers = append(f.workers, worker)
+		worker.Start()
+	}
+
+	// retired workers are stopped the next time they become available
+	for i := maxWorkers; i < len(active); i++ {
+		active[i].retired = true
+	}
+
+	logrus.WithField("comp", "foreman").WithField("queue", f.queue).WithField("workers", maxWorkers).Info("workers resized")
+}
+
+// stops the passed in worker and removes it from our workers. Only called from Assign.
+func (f *Foreman) removeWorker(worker *Worker) {
+	worker.Stop()
+
+	for i, w := range f.workers {
+		if w == worker {
+			f.workers = append(f.workers[:i], f.workers[i+1:]...)
+			break
+		}
+	}
+}
+
 // Assign is our main loop for the Foreman, it takes care of popping the next outgoing task from our
 // backend and assigning them to workers
 func (f *Foreman) Assign() {
@@ -70,49 +144,109 @@ func (f *Foreman) Assign() {
 		"queue":   f.queue,
 	}).Info("workers started and waiting")
 
-	lastSleep := false
+	lastWait := false
+	lastDraining := false
+
+	// the worker we're trying to find a task for, which we hold onto until we find one rather than putting it back
+	// in the available queue, so that only workers ever write to that queue
+	var worker *Worker
 
 	for {
-		select {
-		// return if we have been told to stop
-		case <-f.quit:
-			log.WithField("state", "stopped").Info("foreman stopped")
-			return
-
-		// otherwise, grab the next task and assign it to a worker
-		case worker := <-f.availableWorkers:
-			// see if we have a task to work on
-			rc := f.rt.RP.Get()
-			task, err := queue.PopNextTask(rc, f.queue)
-			rc.Close()
-
-			if err == nil && task != nil {
-				// if so, assign it to our worker
-				worker.job <- task
-				lastSleep = false
-			} else {
-				// we received an error getting the next message, log it
-				if err != nil {
-					log.WithError(err).Error("error popping task")
-				}
-
-				// add our worker back to our queue and sleep a bit
-				if !lastSleep {
-					log.Debug("sleeping, no tasks")
-					lastSleep = true
-				}
-				f.availableWorkers <- worker
-				time.Sleep(250 * time.Millisecond)
+		if worker == nil {
+			select {
+			// return if we have been told to stop
+			case <-f.quit:
+				f.stopWorkers()
+				log.WithField("state", "stopped").Info("foreman stopped")
+				return
+
+			case size := <-f.resize:
+				f.resizeWorkers(size)
+				continue
+
+			// otherwise, grab the next available worker
+			case worker = <-f.availableWorkers:
+			}
+		} else {
+			select {
+			case <-f.quit:
+				f.stopWorkers()
+				log.WithField("state", "stopped").Info("foreman stopped")
+				return
+
+			case size := <-f.resize:
+				f.resizeWorkers(size)
+
+			default:
+			}
+		}
+
+		// workers which have been retired by a resize don't get any more tasks
+		if worker.retired {
+			f.removeWorker(worker)
+			worker = nil
+			continue
+		}
+
+		// if we're draining, don't take on any new tasks
+		if f.rt.Drainer.IsDraining() {
+			if !lastDraining {
+				log.Info("draining, not assigning tasks")
+				lastDraining = true
+			}
+			time.Sleep(time.Second)
+			continue
+		}
+		lastDraining = false
+
+		// see if we have a task to work on
+		task, err := f.rt.Queue.PopNextTask(f.queue)
+
+		if err == nil && task != nil {
+			// if so, assign it to our worker
+			worker.job <- task
+			worker = nil
+			lastWait = false
+		} else {
+			// we received an error getting the next message, log it and back off a bit
+			if err != nil {
+				log.WithError(err).Error("error popping task")
+				time.Sleep(time.Second)
+				continue
 			}
+
+			// otherwise block until a task is added or our timeout is reached
+			if !lastWait {
+				log.Debug("waiting, no tasks")
+				lastWait = true
+			}
+			f.waitForTask()
 		}
 	}
 }
 
+// stops all our workers, which will finish any task they're currently handling. Only called from Assign.
+func (f *Foreman) stopWorkers() {
+	for _, worker := range f.workers {
+		worker.Stop()
+	}
+}
+
+// waitForTask blocks until a task is added to our queue, a task completes for an org which has more tasks or a
+// delayed task becomes due, or for at most a second
+func (f *Foreman) waitForTask() {
+	if _, err := f.rt.Queue.WaitForTask(f.queue, time.Second); err != nil {
+		logrus.WithField("comp", "foreman").WithField("queue", f.queue).WithError(err).Error("error waiting for task")
+		time.Sleep(time.Second)
+	}
+}
+
 // Worker is our type for a single goroutine that is handling queued events
 type Worker struct {
 	id      int
 	foreman *Foreman
 	job     chan *queue.Task
+	retired bool
 }
 
 // NewWorker creates a new worker responsible for working on events
@@ -136,8 +270,13 @@ func (w *Worker) Start() {
 		log.Debug("started")
 
 		for {
-			// list ourselves as available for work
-			w.foreman.availableWorkers <- w
+			// list ourselves as available for work, unless our foreman has stopped
+			select {
+			case w.foreman.availableWorkers <- w:
+			case <-w.foreman.quit:
+				log.Debug("stopped")
+				return
+			}
 
 			// grab our next piece of work
 			task := <-w.job
@@ -161,33 +300,58 @@ func (w *Worker) Stop() {
 func (w *Worker) handleTask(task *queue.Task) {
 	log := logrus.WithField("queue", w.foreman.queue).WithField("worker_id", w.id).WithField("task_type", task.Type).WithField("org_id", task.OrgID)
 
+	var taskErr error
+	start := time.Now()
+
+	ctx, span := tracing.Start(context.Background(), "task "+task.Type,
+		attribute.String("mailroom.queue", w.foreman.queue),
+		attribute.String("mailroom.task_type", task.Type),
+		attribute.String("mailroom.task_id", string(task.ID)),
+		attribute.Int("mailroom.org_id", task.OrgID),
+	)
+
 	defer func() {
 		// catch any panics and recover
 		panicLog := recover()
 		if panicLog != nil {
 			debug.PrintStack()
 			log.WithField("task", string(task.Task)).WithField("task_type", task.Type).WithField("org_id", task.OrgID).Errorf("panic handling task: %s", panicLog)
+			taskErr = errors.Errorf("panic handling task: %s", panicLog)
+		}
+
+		taskDuration.Observe(time.Since(start).Seconds(), w.foreman.queue, task.Type)
+		tracing.End(span, taskErr)
+
+		// if our task failed, retry it or move it to our dead letters
+		if taskErr != nil {
+			taskErrors.Inc(w.foreman.queue, task.Type)
+			w.failTask(task, taskErr)
+		} else {
+			w.setTaskStatus(task, queue.TaskStatusDone, nil)
 		}
 
 		// mark our task as complete
-		rc := w.foreman.rt.RP.Get()
-		err := queue.MarkTaskComplete(rc, w.foreman.queue, task.OrgID)
+		err := w.foreman.rt.Queue.MarkTaskComplete(w.foreman.queue, task.OrgID)
 		if err != nil {
-			log.WithError(err)
+			log.WithError(err).Error("error marking task as complete")
 		}
-		rc.Close()
 	}()
 
 	log.Info("starting handling of task")
-	start := time.Now()
+
+	w.foreman.rt.Drainer.TaskStarted(w.foreman.queue)
+	defer w.foreman.rt.Drainer.TaskFinished(w.foreman.queue)
+
+	w.setTaskStatus(task, queue.TaskStatusRunning, nil)
 
 	taskFunc, found := taskFunctions[task.Type]
 	if found {
-		err := taskFunc(context.Background(), w.foreman.rt, task)
-		if err != nil {
-			log.WithError(err).WithField("task", string(task.Task)).Error("error running task")
+		taskErr = taskFunc(ctx, w.foreman.rt, task)
+		if taskErr != nil {
+			log.WithError(taskErr).WithField("task", string(task.Task)).Error("error running task")
 		}
 	} else {
+		taskErr = errors.Errorf("unable to find function for task type: %s", task.Type)
 		log.Error("unable to find function for task type")
 	}
 
@@ -200,3 +364,42 @@ func (w *Worker) handleTask(task *queue.Task) {
 		log.WithField("task", string(task.Task)).WithField("elapsed", elapsed).Warn("long running task")
 	}
 }
+
+// failTask either schedules the passed in failed task to be retried with backoff or, if it isn't of a retryable type
+// or has exhausted its retries, moves it to the dead letters of our queue
+func (w *Worker) failTask(task *queue.Task, taskErr error) {
+	cfg := w.foreman.rt.Config()
+	log := logrus.WithField("queue", w.foreman.queue).WithField("task_type", task.Type).WithField("org_id", task.OrgID)
+
+	task.ErrorCount++
+
+	if IsTaskRetryable(task.Type) && task.ErrorCount <= cfg.TaskMaxRetries {
+		backoff := queue.RetryBackoff(time.Duration(cfg.TaskInitialBackoff)*time.Millisecond, task.ErrorCount)
+
+		w.setTaskStatus(task, queue.TaskStatusQueued, taskErr)
+
+		if err := w.foreman.rt.Queue.RetryTask(w.foreman.queue, task, backoff); err != nil {
+			log.WithError(err).Error("error scheduling retry of failed task")
+		} else {
+			log.WithField("error_count", task.ErrorCount).WithField("backoff", backoff).Info("failed task scheduled for retry")
+		}
+		return
+	}
+
+	w.setTaskStatus(task, queue.TaskStatusFailed, taskErr)
+
+	letter, err := w.foreman.rt.Queue.AddDeadLetter(w.foreman.queue, task, taskErr)
+	if err != nil {
+		log.WithError(err).WithField("task", string(task.Task)).Error("error moving failed task to dead letters")
+		return
+	}
+
+	log.WithField("dead_letter_id", letter.ID).WithField("error_count", task.ErrorCount).Error("task failed too many times, moved to dead letters")
+}
+
+// setTaskStatus updates the status record of the passed in task, logging any error
+func (w *Worker) setTaskStatus(task *queue.Task, status queue.TaskStatus, taskErr error) {
+	if err := w.foreman.rt.Queue.SetTaskStatus(w.foreman.queue, task, status, taskErr); err != nil {
+		logrus.WithField("queue", w.foreman.queue).WithField("task_id", task.ID).WithError(err).Error("error setting task status")
+	}
+}